@@ -0,0 +1,122 @@
+// Command breachfilter builds the bloom filter loaded from BREACHED_PASSWORDS_FILE.
+//
+// Input is either the Pwned Passwords SHA-1 download, one "HASH:COUNT" line per password,
+// or a plain password list with one password per line:
+//
+//	go run ./cmd/breachfilter -in pwnedpasswords.txt -out data/breached-passwords.bloom
+//	go run ./cmd/breachfilter -format plain -in rockyou.txt -out data/breached-passwords.bloom
+//
+// The server keeps the filter in memory. The whole Pwned Passwords corpus makes a filter of
+// about 1.7 GB at the default false positive rate; -min-count keeps only passwords seen at
+// least that often to shrink it.
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"dotsat.work/internal/breach"
+)
+
+func main() {
+	in := flag.String("in", "", "input file (required)")
+	out := flag.String("out", "", "filter file to write (required)")
+	format := flag.String("format", "sha1", `input format: "sha1" for HASH[:COUNT] lines, "plain" for passwords`)
+	fp := flag.Float64("fp", 0.001, "false positive rate")
+	minCount := flag.Int("min-count", 1, "skip sha1 entries seen fewer times than this")
+	flag.Parse()
+
+	if *in == "" || *out == "" || (*format != "sha1" && *format != "plain") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Size the filter with a first pass over the input
+	n, err := scan(*in, *format, *minCount, func([sha1.Size]byte) {})
+	if err != nil {
+		log.Fatalf("failed to read %s: %v", *in, err)
+	}
+	if n == 0 {
+		log.Fatalf("no passwords found in %s", *in)
+	}
+
+	filter, err := breach.NewFilter(n, *fp)
+	if err != nil {
+		log.Fatalf("failed to create filter: %v", err)
+	}
+	_, err = scan(*in, *format, *minCount, filter.AddSHA1)
+	if err != nil {
+		log.Fatalf("failed to read %s: %v", *in, err)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("failed to create %s: %v", *out, err)
+	}
+	_, err = filter.WriteTo(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Fatalf("failed to write %s: %v", *out, err)
+	}
+
+	log.Printf("wrote %d passwords to %s", n, *out)
+}
+
+// scan calls add with the SHA-1 digest of every password in the input and returns their count
+func scan(path, format string, minCount int, add func([sha1.Size]byte)) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var n uint64
+	reader := bufio.NewReaderSize(file, 1<<20)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			digest, ok := parseLine(line, format, minCount)
+			if ok {
+				add(digest)
+				n++
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// parseLine returns the SHA-1 digest of the password on a line of input
+func parseLine(line, format string, minCount int) ([sha1.Size]byte, bool) {
+	if format == "plain" {
+		return sha1.Sum([]byte(line)), true
+	}
+
+	var digest [sha1.Size]byte
+	hash, count, hasCount := strings.Cut(line, ":")
+	if hasCount {
+		c, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || c < minCount {
+			return digest, false
+		}
+	}
+	decoded, err := hex.DecodeString(strings.TrimSpace(hash))
+	if err != nil || len(decoded) != sha1.Size {
+		log.Printf("skipping malformed line %q", line)
+		return digest, false
+	}
+	return [sha1.Size]byte(decoded), true
+}
@@ -1,24 +1,43 @@
 package app
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
 
+	"dotsat.work/internal/breach"
 	"dotsat.work/internal/config"
 	"dotsat.work/internal/db"
+	"dotsat.work/internal/keyring"
+	"dotsat.work/internal/mail"
 	"dotsat.work/internal/repository"
 	"dotsat.work/internal/service"
+	"dotsat.work/internal/validation"
 )
 
 type App struct {
-	Cfg            *config.Config
-	DB             *sqlx.DB
-	TenantService  *service.TenantService
-	UserService    *service.UserService
-	ProfileService *service.ProfileService
-	AuthService    *service.AuthService
+	Cfg                        *config.Config
+	DB                         *sqlx.DB
+	TenantService              *service.TenantService
+	UserService                *service.UserService
+	ProfileService             *service.ProfileService
+	AuthService                *service.AuthService
+	SignupService              *service.SignupService
+	TwoFactorService           *service.TwoFactorService
+	PasskeyService             *service.PasskeyService
+	OIDCService                *service.OIDCService
+	SAMLService                *service.SAMLService
+	Mailer                     mail.Sender
+	Keys                       *keyring.Keyring
+	PersonalAccessTokenService *service.PersonalAccessTokenService
+	APIKeyService              *service.APIKeyService
+	ImpersonationService       *service.ImpersonationService
+	PasswordPolicyService      *service.PasswordPolicyService
+	SecurityEventService       *service.SecurityEventService
 }
 
 func New(cfg *config.Config) (*App, error) {
@@ -37,34 +56,206 @@ func New(cfg *config.Config) (*App, error) {
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	// Initialize mailer
+	mailer, err := newMailer(cfg)
+	if err != nil {
+		if closeErr := database.Close(); closeErr != nil {
+			return nil, fmt.Errorf("failed to initialize mailer: %w (also failed to close DB: %v)", err, closeErr)
+		}
+		return nil, fmt.Errorf("failed to initialize mailer: %w", err)
+	}
+
+	// Initialize JWT keyring
+	keys, err := newKeyring(cfg)
+	if err != nil {
+		if closeErr := database.Close(); closeErr != nil {
+			return nil, fmt.Errorf("failed to initialize JWT keys: %w (also failed to close DB: %v)", err, closeErr)
+		}
+		return nil, fmt.Errorf("failed to initialize JWT keys: %w", err)
+	}
+
+	// Initialize breached password screening
+	breachedPasswords, err := newBreachedPasswordChecker(cfg)
+	if err != nil {
+		if closeErr := database.Close(); closeErr != nil {
+			return nil, fmt.Errorf("failed to initialize breached passwords: %w (also failed to close DB: %v)", err, closeErr)
+		}
+		return nil, fmt.Errorf("failed to initialize breached passwords: %w", err)
+	}
+
 	// Initialize repositories
 	tenantRepository := repository.NewTenantRepository(database)
+	tenantSettingsRepository := repository.NewTenantSettingsRepository(database)
 	userRepository := repository.NewUserRepository(database)
 	profileRepository := repository.NewProfileRepository(database)
 	tokenRepository := repository.NewTokenRepository(database)
+	sessionRepository := repository.NewSessionRepository(database)
+	throttleRepository := repository.NewThrottleRepository(database)
+	signupRepository := repository.NewSignupRepository(database)
+	twoFactorRepository := repository.NewTwoFactorRepository(database)
+	webAuthnRepository := repository.NewWebAuthnRepository(database)
+	oidcRepository := repository.NewOIDCRepository(database)
+	samlRepository := repository.NewSAMLRepository(database)
+	personalAccessTokenRepository := repository.NewPersonalAccessTokenRepository(database)
+	apiKeyRepository := repository.NewAPIKeyRepository(database)
+	impersonationRepository := repository.NewImpersonationRepository(database)
+	passwordPolicyRepository := repository.NewPasswordPolicyRepository(database)
+	passwordHistoryRepository := repository.NewPasswordHistoryRepository(database)
+	securityEventRepository := repository.NewSecurityEventRepository(database)
 
 	// Initialize services
-	tenantService := service.NewTenantService(tenantRepository)
-	userService := service.NewUserService(userRepository)
+	tenantService := service.NewTenantService(tenantRepository, tenantSettingsRepository, oidcRepository, samlRepository)
+	passwordHasher := service.NewPasswordHasher(service.Argon2Params{
+		Memory:      cfg.Argon2Memory,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+	})
+	passwordPolicyService := service.NewPasswordPolicyService(
+		newPasswordPolicy(cfg),
+		passwordPolicyRepository,
+		passwordHistoryRepository,
+		tenantRepository,
+		profileRepository,
+		passwordHasher,
+		breachedPasswords,
+	)
+	securityEventService := service.NewSecurityEventService(securityEventRepository, throttleRepository, cfg.SecurityEventRetention)
+	userService := service.NewUserService(userRepository, sessionRepository, passwordHasher, passwordPolicyService, securityEventService)
 	profileService := service.NewProfileService(profileRepository)
 	authService := service.NewAuthService(
 		userRepository,
+		tenantRepository,
 		tokenRepository,
-		cfg.JWTSecret,
+		sessionRepository,
+		throttleRepository,
+		mailer,
+		cfg.AppURL,
+		keys,
+		passwordHasher,
+		passwordPolicyService,
+		securityEventService,
 		cfg.IsProduction(),
 		cfg.JWTExpiry,
+		cfg.JWTAccessExpiry,
 	)
+	signupService := service.NewSignupService(signupRepository, tenantRepository, userRepository, authService)
+	passkeyService, err := service.NewPasskeyService(webAuthnRepository, userRepository, cfg.AppName, cfg.AppURL, cfg.IsProduction())
+	if err != nil {
+		if closeErr := database.Close(); closeErr != nil {
+			return nil, fmt.Errorf("failed to initialize passkeys: %w (also failed to close DB: %v)", err, closeErr)
+		}
+		return nil, fmt.Errorf("failed to initialize passkeys: %w", err)
+	}
+	twoFactorService := service.NewTwoFactorService(twoFactorRepository, userRepository, throttleRepository, passkeyService, securityEventService, cfg.AppName, cfg.IsProduction())
+	oidcService := service.NewOIDCService(oidcRepository, tenantRepository, userRepository, signupRepository, cfg.AppURL, cfg.IsProduction())
+	samlService := service.NewSAMLService(samlRepository, tenantRepository, userRepository, signupRepository, cfg.AppURL, cfg.IsProduction())
+	personalAccessTokenService := service.NewPersonalAccessTokenService(personalAccessTokenRepository)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepository)
+	impersonationService := service.NewImpersonationService(impersonationRepository, userRepository, securityEventService, keys, cfg.IsProduction())
 
 	return &App{
-		Cfg:            cfg,
-		DB:             database,
-		TenantService:  tenantService,
-		UserService:    userService,
-		ProfileService: profileService,
-		AuthService:    authService,
+		Cfg:                        cfg,
+		DB:                         database,
+		TenantService:              tenantService,
+		UserService:                userService,
+		ProfileService:             profileService,
+		AuthService:                authService,
+		SignupService:              signupService,
+		TwoFactorService:           twoFactorService,
+		PasskeyService:             passkeyService,
+		OIDCService:                oidcService,
+		SAMLService:                samlService,
+		Mailer:                     mailer,
+		Keys:                       keys,
+		PersonalAccessTokenService: personalAccessTokenService,
+		APIKeyService:              apiKeyService,
+		ImpersonationService:       impersonationService,
+		PasswordPolicyService:      passwordPolicyService,
+		SecurityEventService:       securityEventService,
 	}, nil
 }
 
+// newKeyring loads the JWT keyring from JWT_KEYS_FILE, falling back to JWT_SECRET as a single HS256 key
+func newKeyring(cfg *config.Config) (*keyring.Keyring, error) {
+	if cfg.JWTKeysFile != "" {
+		return keyring.LoadFile(cfg.JWTKeysFile, cfg.JWTKeyGracePeriod)
+	}
+
+	if cfg.JWTSecret == "" {
+		return nil, fmt.Errorf("either JWT_KEYS_FILE or JWT_SECRET must be set")
+	}
+	key, err := keyring.NewHMACKey("default", []byte(cfg.JWTSecret))
+	if err != nil {
+		return nil, err
+	}
+	return keyring.New(key.ID, cfg.JWTKeyGracePeriod, key)
+}
+
+// newBreachedPasswordChecker loads the filter from BREACHED_PASSWORDS_FILE, falling back to the
+// Pwned Passwords API when BREACHED_PASSWORDS_API is set. Without either, passwords are only
+// checked against the built-in list of common passwords.
+func newBreachedPasswordChecker(cfg *config.Config) (validation.BreachedPasswordChecker, error) {
+	if cfg.BreachedPasswordsFile != "" {
+		return breach.LoadFilter(cfg.BreachedPasswordsFile)
+	}
+	if cfg.BreachedPasswordsAPI {
+		return breach.NewClient(breach.PwnedPasswordsURL), nil
+	}
+	return nil, nil
+}
+
+// newPasswordPolicy returns the global password policy, within the bounds the app supports
+func newPasswordPolicy(cfg *config.Config) validation.PasswordPolicy {
+	return validation.PasswordPolicy{
+		MinLength:   max(cfg.PasswordMinLength, 1),
+		MaxLength:   min(max(cfg.PasswordMaxLength, cfg.PasswordMinLength), validation.MaxPasswordLength),
+		MinScore:    min(max(cfg.PasswordMinScore, 0), 4),
+		HistorySize: min(max(cfg.PasswordHistorySize, 0), validation.MaxPasswordHistory),
+	}
+}
+
+// newMailer selects the mail.Sender implementation configured by MAIL_DRIVER
+func newMailer(cfg *config.Config) (mail.Sender, error) {
+	switch cfg.MailDriver {
+	case "smtp":
+		return mail.NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	case "file":
+		return mail.NewFileSender(cfg.MailOutboxDir, cfg.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.MailDriver)
+	}
+}
+
+// maintenanceInterval is how often data that is no longer needed is cleaned up
+const maintenanceInterval = time.Hour
+
+// RunMaintenance cleans up expired data once at startup and then every maintenanceInterval,
+// until ctx is done
+func (a *App) RunMaintenance(ctx context.Context) {
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+
+	tasks := []func() error{
+		a.AuthService.CleanupThrottleEvents,
+		a.SecurityEventService.Cleanup,
+		a.TwoFactorService.CleanupChallenges,
+	}
+	for {
+		for _, task := range tasks {
+			err := task()
+			if err != nil {
+				slog.Error("maintenance failed", "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func (a *App) Close() error {
 	if a.DB != nil {
 		return a.DB.Close()
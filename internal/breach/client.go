@@ -0,0 +1,71 @@
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PwnedPasswordsURL is the Have I Been Pwned range API
+const PwnedPasswordsURL = "https://api.pwnedpasswords.com/range/"
+
+// clientTimeout keeps a slow API from holding up signups and password changes
+const clientTimeout = 5 * time.Second
+
+// Client checks passwords against the Pwned Passwords range API using k-anonymity: only the
+// first five hex characters of the password's SHA-1 digest are sent, and the suffixes of every
+// breached password sharing that prefix are compared locally.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient returns a client for baseURL, normally PwnedPasswordsURL
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: clientTimeout},
+	}
+}
+
+// IsBreached reports whether the password appears in the Pwned Passwords corpus.
+// It implements validation.BreachedPasswordChecker.
+func (c *Client) IsBreached(password string) (bool, error) {
+	digest := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(digest[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+prefix, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create range request: %w", err)
+	}
+	// Padding hides the real number of suffixes for the prefix from observers
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to query breached passwords: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("breached passwords range API returned %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// Padding entries have a count of zero
+		if ok && strings.EqualFold(candidate, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read breached passwords: %w", err)
+	}
+	return false, nil
+}
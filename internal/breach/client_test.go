@@ -0,0 +1,61 @@
+package breach
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient_IsBreached(t *testing.T) {
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/range/5BAA6" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Add-Padding") != "true" {
+			t.Error("expected the request to ask for padding")
+		}
+		fmt.Fprint(w, "003D68EB55068C33ACE09247EE4C639306B:3\r\n")
+		fmt.Fprint(w, "1E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\r\n")
+		fmt.Fprint(w, "A1B2C3D4E5F60718293A4B5C6D7E8F90A1B:0\r\n")
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL + "/range/")
+
+	breached, err := client.IsBreached("password")
+	if err != nil {
+		t.Fatalf("IsBreached() error = %v", err)
+	}
+	if !breached {
+		t.Error("expected password to be breached")
+	}
+}
+
+func TestClient_IsBreached_NotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "003D68EB55068C33ACE09247EE4C639306B:3\r\n")
+	}))
+	defer server.Close()
+
+	breached, err := NewClient(server.URL + "/range/").IsBreached("correct-horse-battery-staple")
+	if err != nil {
+		t.Fatalf("IsBreached() error = %v", err)
+	}
+	if breached {
+		t.Error("expected password not to be breached")
+	}
+}
+
+func TestClient_IsBreached_Unavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	if _, err := NewClient(server.URL + "/range/").IsBreached("password"); err == nil {
+		t.Error("expected an error when the API is unavailable")
+	}
+}
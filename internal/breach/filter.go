@@ -0,0 +1,163 @@
+// Package breach checks passwords against corpora of passwords exposed in data breaches,
+// either offline with a bloom filter or online with the Pwned Passwords range API.
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// filterMagic starts every filter file, followed by the bit count, the hash count and the bits
+var filterMagic = [8]byte{'D', 'S', 'B', 'F', 'v', '1', 0, 0}
+
+var ErrInvalidFilter = errors.New("invalid breached password filter")
+
+// Bounds for the header of a filter file; 2^40 bits is a 128 GiB filter
+const (
+	maxFilterBits   = 1 << 40
+	maxFilterHashes = 64
+)
+
+// Filter is a bloom filter over the SHA-1 digests of breached passwords. It answers "maybe
+// breached" for every password that was added and, with the chosen false positive rate, for
+// a few that weren't; it never misses one that was added.
+type Filter struct {
+	bits   []uint64
+	m      uint64
+	hashes uint32
+}
+
+// NewFilter returns an empty filter sized for n passwords at the false positive rate fp
+func NewFilter(n uint64, fp float64) (*Filter, error) {
+	if n == 0 || fp <= 0 || fp >= 1 {
+		return nil, fmt.Errorf("filter needs a positive size and a false positive rate between 0 and 1")
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	hashes := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return newFilter(m, hashes), nil
+}
+
+func newFilter(m uint64, hashes uint32) *Filter {
+	return &Filter{
+		bits:   make([]uint64, (m+63)/64),
+		m:      m,
+		hashes: hashes,
+	}
+}
+
+// Add adds a password to the filter
+func (f *Filter) Add(password string) {
+	f.AddSHA1(sha1.Sum([]byte(password)))
+}
+
+// AddSHA1 adds a password by its SHA-1 digest, as published by Have I Been Pwned
+func (f *Filter) AddSHA1(digest [sha1.Size]byte) {
+	h1, h2 := filterHashes(digest)
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// IsBreached reports whether the password is in the filter. It implements
+// validation.BreachedPasswordChecker and never fails.
+func (f *Filter) IsBreached(password string) (bool, error) {
+	h1, h2 := filterHashes(sha1.Sum([]byte(password)))
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// filterHashes derives the two hashes the filter's bit positions are combined from.
+// SHA-1 output is uniform enough to slice directly.
+func filterHashes(digest [sha1.Size]byte) (uint64, uint64) {
+	h1 := binary.LittleEndian.Uint64(digest[0:8])
+	h2 := binary.LittleEndian.Uint64(digest[8:16]) | 1
+	return h1, h2
+}
+
+// WriteTo writes the filter in the format LoadFilter reads
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	header := make([]byte, 0, len(filterMagic)+12)
+	header = append(header, filterMagic[:]...)
+	header = binary.LittleEndian.AppendUint64(header, f.m)
+	header = binary.LittleEndian.AppendUint32(header, f.hashes)
+
+	n, err := bw.Write(header)
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	buf := make([]byte, 8)
+	for _, word := range f.bits {
+		binary.LittleEndian.PutUint64(buf, word)
+		n, err = bw.Write(buf)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, bw.Flush()
+}
+
+// LoadFilter reads a filter file written by WriteTo, e.g. by cmd/breachfilter
+func LoadFilter(path string) (*Filter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password filter: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password filter: %w", err)
+	}
+	return readFilter(file, info.Size())
+}
+
+// readFilter reads a filter of size bytes written by WriteTo
+func readFilter(r io.Reader, size int64) (*Filter, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(filterMagic)+12)
+	_, err := io.ReadFull(br, header)
+	if err != nil {
+		return nil, ErrInvalidFilter
+	}
+	if [8]byte(header[:8]) != filterMagic {
+		return nil, ErrInvalidFilter
+	}
+	m := binary.LittleEndian.Uint64(header[8:16])
+	hashes := binary.LittleEndian.Uint32(header[16:20])
+	if m == 0 || m > maxFilterBits || hashes == 0 || hashes > maxFilterHashes {
+		return nil, ErrInvalidFilter
+	}
+	// Check the size before allocating the bits a corrupt header asks for
+	if size != int64(len(header))+int64((m+63)/64)*8 {
+		return nil, ErrInvalidFilter
+	}
+
+	f := newFilter(m, hashes)
+	buf := make([]byte, 8)
+	for i := range f.bits {
+		_, err = io.ReadFull(br, buf)
+		if err != nil {
+			return nil, ErrInvalidFilter
+		}
+		f.bits[i] = binary.LittleEndian.Uint64(buf)
+	}
+	return f, nil
+}
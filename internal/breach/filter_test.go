@@ -0,0 +1,98 @@
+package breach
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilter_IsBreached(t *testing.T) {
+	filter, err := NewFilter(1000, 0.001)
+	if err != nil {
+		t.Fatalf("NewFilter() error = %v", err)
+	}
+	for i := range 1000 {
+		filter.Add(fmt.Sprintf("breached-%d", i))
+	}
+	filter.AddSHA1(sha1.Sum([]byte("correct-horse-battery-staple")))
+
+	for _, password := range []string{"breached-0", "breached-999", "correct-horse-battery-staple"} {
+		breached, err := filter.IsBreached(password)
+		if err != nil {
+			t.Fatalf("IsBreached() error = %v", err)
+		}
+		if !breached {
+			t.Errorf("expected %q to be breached", password)
+		}
+	}
+
+	falsePositives := 0
+	for i := range 10000 {
+		breached, _ := filter.IsBreached(fmt.Sprintf("unique-%d", i))
+		if breached {
+			falsePositives++
+		}
+	}
+	// 0.1% of 10000 is 10; allow for chance
+	if falsePositives > 40 {
+		t.Errorf("expected about 10 false positives, got %d", falsePositives)
+	}
+}
+
+func TestNewFilter_Invalid(t *testing.T) {
+	for _, tt := range []struct {
+		n  uint64
+		fp float64
+	}{{0, 0.01}, {10, 0}, {10, 1}} {
+		if _, err := NewFilter(tt.n, tt.fp); err == nil {
+			t.Errorf("NewFilter(%d, %v) expected an error", tt.n, tt.fp)
+		}
+	}
+}
+
+func TestLoadFilter(t *testing.T) {
+	filter, err := NewFilter(100, 0.01)
+	if err != nil {
+		t.Fatalf("NewFilter() error = %v", err)
+	}
+	filter.Add("hunter2")
+
+	var buf bytes.Buffer
+	if _, err := filter.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "breached.bloom")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("failed to write filter: %v", err)
+	}
+
+	loaded, err := LoadFilter(path)
+	if err != nil {
+		t.Fatalf("LoadFilter() error = %v", err)
+	}
+	if breached, _ := loaded.IsBreached("hunter2"); !breached {
+		t.Error("expected the loaded filter to contain hunter2")
+	}
+
+	corrupt := map[string][]byte{
+		"empty":       nil,
+		"bad magic":   append([]byte("NOTAFILT"), buf.Bytes()[8:]...),
+		"truncated":   buf.Bytes()[:buf.Len()-8],
+		"extra bytes": append(bytes.Clone(buf.Bytes()), 0),
+	}
+	for name, data := range corrupt {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("failed to write filter: %v", err)
+		}
+		if _, err := LoadFilter(path); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("LoadFilter(%s) error = %v, want ErrInvalidFilter", name, err)
+		}
+	}
+}
@@ -3,9 +3,12 @@ package config
 import (
 	"log/slog"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/joho/godotenv"
+
+	"dotsat.work/internal/keyring"
 )
 
 type Config struct {
@@ -15,13 +18,47 @@ type Config struct {
 	AppURL  string
 	Port    string
 
+	// TrustProxy takes the client IP from X-Forwarded-For; only enable behind a reverse proxy
+	TrustProxy bool
+
 	// Database
 	DBDriver     string
 	DBConnection string
 
 	// Authentication
-	JWTSecret string
-	JWTExpiry time.Duration
+	// JWTKeysFile points to a keyring manifest (see keyring.LoadFile); when empty
+	// JWTSecret is used as a single HS256 key
+	JWTKeysFile string
+	JWTSecret   string
+	// JWTExpiry is the session lifetime, i.e. how long refresh tokens keep renewing access
+	JWTExpiry         time.Duration
+	JWTAccessExpiry   time.Duration
+	JWTKeyGracePeriod time.Duration
+	// Argon2 cost parameters for new password hashes; hashes with other parameters are
+	// upgraded when their owner next signs in
+	Argon2Memory      uint32 // KiB
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	// BreachedPasswordsFile is a bloom filter built with cmd/breachfilter; when empty and
+	// BreachedPasswordsAPI is set, passwords are checked with the Pwned Passwords range API
+	BreachedPasswordsFile string
+	BreachedPasswordsAPI  bool
+	// Global password policy; tenants can only make it stricter
+	PasswordMinLength   int
+	PasswordMaxLength   int
+	PasswordMinScore    int // 0-4, see validation.EstimateStrength
+	PasswordHistorySize int
+	// SecurityEventRetention is how long the security event log is kept
+	SecurityEventRetention time.Duration
+
+	// Mail
+	MailDriver    string // smtp, file
+	MailFrom      string
+	MailOutboxDir string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
 }
 
 func Load() *Config {
@@ -38,18 +75,64 @@ func Load() *Config {
 		AppURL:  envRequired("APP_URL"),
 		Port:    envString("PORT", "8090"),
 
+		TrustProxy: envBool("TRUST_PROXY", false),
+
 		// Database
 		DBDriver:     envString("DB_DRIVER", "postgres"),
 		DBConnection: envRequired("DB_CONNECTION"),
 
 		// Authentication
-		JWTSecret: envRequired("JWT_SECRET"),
-		JWTExpiry: envDuration("JWT_EXPIRY", 168*time.Hour), // 7-day default
+		JWTKeysFile:     envString("JWT_KEYS_FILE", ""),
+		JWTSecret:       envString("JWT_SECRET", ""),
+		JWTExpiry:       envDuration("JWT_EXPIRY", 168*time.Hour), // 7-day default
+		JWTAccessExpiry: envDuration("JWT_ACCESS_EXPIRY", 15*time.Minute),
+
+		// OWASP's recommended argon2id minimum
+		Argon2Memory:      uint32(envInt("ARGON2_MEMORY", 19*1024)),
+		Argon2Iterations:  uint32(envInt("ARGON2_ITERATIONS", 2)),
+		Argon2Parallelism: uint8(min(envInt("ARGON2_PARALLELISM", 1), 255)),
+
+		BreachedPasswordsFile: envString("BREACHED_PASSWORDS_FILE", ""),
+		BreachedPasswordsAPI:  envBool("BREACHED_PASSWORDS_API", false),
+
+		PasswordMinLength:   envInt("PASSWORD_MIN_LENGTH", 12),
+		PasswordMaxLength:   envInt("PASSWORD_MAX_LENGTH", 128),
+		PasswordMinScore:    envNonNegativeInt("PASSWORD_MIN_SCORE", 3),
+		PasswordHistorySize: envNonNegativeInt("PASSWORD_HISTORY", 0),
+
+		SecurityEventRetention: envDuration("SECURITY_EVENT_RETENTION", 365*24*time.Hour),
+
+		// Mail
+		MailDriver:    envString("MAIL_DRIVER", "file"),
+		MailFrom:      envString("MAIL_FROM", "dotsat.work <no-reply@dotsat.work>"),
+		MailOutboxDir: envString("MAIL_OUTBOX_DIR", "tmp/outbox"),
+		SMTPHost:      envString("SMTP_HOST", "localhost"),
+		SMTPPort:      envString("SMTP_PORT", "587"),
+		SMTPUsername:  envString("SMTP_USERNAME", ""),
+		SMTPPassword:  envString("SMTP_PASSWORD", ""),
 	}
 
+	// Retired keys keep verifying until every access token they signed has expired
+	cfg.JWTKeyGracePeriod = envDuration("JWT_KEY_GRACE_PERIOD", cfg.JWTAccessExpiry)
+
+	checkJWTSecret(cfg)
+
 	return cfg
 }
 
+// checkJWTSecret stops startup with instructions when JWT_SECRET is too short for HS256.
+// Older versions accepted secrets of any length, so upgraded deployments may need a new one;
+// replacing it signs everyone out.
+func checkJWTSecret(cfg *Config) {
+	if cfg.JWTKeysFile != "" || cfg.JWTSecret == "" || len(cfg.JWTSecret) >= keyring.MinHMACSecretLength {
+		return
+	}
+	slog.Error("config JWT_SECRET is too short: replace it with at least 32 random bytes, "+
+		"e.g. the output of `openssl rand -base64 48`; existing sessions end when the secret changes",
+		"key", "JWT_SECRET", "length", len(cfg.JWTSecret), "min_length", keyring.MinHMACSecretLength)
+	os.Exit(1)
+}
+
 func envString(key, def string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -67,6 +150,46 @@ func envRequired(key string) string {
 	return ""
 }
 
+func envBool(key string, def bool) bool {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Warn("config invalid bool, using default", "key", key, "value", v, "default", def)
+		return def
+	}
+	return b
+}
+
+func envInt(key string, def int) int {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i <= 0 {
+		slog.Warn("config invalid int, using default", "key", key, "value", v, "default", def)
+		return def
+	}
+	return i
+}
+
+// envNonNegativeInt is envInt for settings where 0 is meaningful, e.g. turning a check off
+func envNonNegativeInt(key string, def int) int {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		slog.Warn("config invalid non-negative int, using default", "key", key, "value", v, "default", def)
+		return def
+	}
+	return i
+}
+
 func envDuration(key string, def time.Duration) time.Duration {
 	v, ok := os.LookupEnv(key)
 	if !ok || v == "" {
@@ -0,0 +1,33 @@
+package csrf
+
+import (
+	"testing"
+	"time"
+
+	"dotsat.work/internal/keyring"
+	"github.com/google/uuid"
+)
+
+func TestSessionToken(t *testing.T) {
+	key, err := keyring.NewHMACKey("test", []byte("test-secret-that-is-at-least-32-bytes"))
+	if err != nil {
+		t.Fatalf("NewHMACKey() error = %v", err)
+	}
+	keys, err := keyring.New(key.ID, time.Hour, key)
+	if err != nil {
+		t.Fatalf("keyring.New() error = %v", err)
+	}
+
+	session := uuid.New()
+	token := SessionToken(keys, session)
+
+	if !ValidSessionToken(keys, session, token) {
+		t.Error("expected the session's token to be valid")
+	}
+	if ValidSessionToken(keys, uuid.New(), token) {
+		t.Error("expected the token to be refused for another session")
+	}
+	if ValidSessionToken(keys, session, "not-hex") || ValidSessionToken(keys, session, "") {
+		t.Error("expected malformed tokens to be refused")
+	}
+}
@@ -14,8 +14,13 @@ const (
 	UserKey      contextKey = "user"
 	ProfileKey   contextKey = "profile"
 	TenantKey    contextKey = "tenant"
+	SessionKey   contextKey = "session"
 	ConfigKey    contextKey = "config"
 	CSRFTokenKey contextKey = "csrf_token"
+
+	PersonalAccessTokenKey contextKey = "personal_access_token"
+	APIKeyKey              contextKey = "api_key"
+	ImpersonatorKey        contextKey = "impersonator"
 )
 
 // User retrieves the user from context
@@ -51,6 +56,52 @@ func WithTenant(ctx context.Context, tenant *model.Tenant) context.Context {
 	return context.WithValue(ctx, TenantKey, tenant)
 }
 
+// Session retrieves the current session from context
+func Session(ctx context.Context) *model.Session {
+	session, _ := ctx.Value(SessionKey).(*model.Session)
+	return session
+}
+
+// WithSession adds the current session to the context
+func WithSession(ctx context.Context, session *model.Session) context.Context {
+	return context.WithValue(ctx, SessionKey, session)
+}
+
+// PersonalAccessToken retrieves the token an API client authenticated with from context
+func PersonalAccessToken(ctx context.Context) *model.PersonalAccessToken {
+	token, _ := ctx.Value(PersonalAccessTokenKey).(*model.PersonalAccessToken)
+	return token
+}
+
+// WithPersonalAccessToken adds the token an API client authenticated with to the context
+func WithPersonalAccessToken(ctx context.Context, token *model.PersonalAccessToken) context.Context {
+	return context.WithValue(ctx, PersonalAccessTokenKey, token)
+}
+
+// APIKey retrieves the tenant API key an integration authenticated with from context.
+// Requests made with an API key have a tenant but no user.
+func APIKey(ctx context.Context) *model.APIKey {
+	key, _ := ctx.Value(APIKeyKey).(*model.APIKey)
+	return key
+}
+
+// WithAPIKey adds the tenant API key an integration authenticated with to the context
+func WithAPIKey(ctx context.Context, key *model.APIKey) context.Context {
+	return context.WithValue(ctx, APIKeyKey, key)
+}
+
+// Impersonator retrieves the platform staff member impersonating the user in context.
+// It is nil unless the request is made on behalf of support.
+func Impersonator(ctx context.Context) *model.User {
+	user, _ := ctx.Value(ImpersonatorKey).(*model.User)
+	return user
+}
+
+// WithImpersonator adds the platform staff member impersonating the user to the context
+func WithImpersonator(ctx context.Context, user *model.User) context.Context {
+	return context.WithValue(ctx, ImpersonatorKey, user)
+}
+
 // Config retrieves the config from context
 func Config(ctx context.Context) *config.Config {
 	cfg, _ := ctx.Value(ConfigKey).(*config.Config)
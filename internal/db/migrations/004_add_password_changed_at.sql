@@ -0,0 +1,7 @@
+-- +goose Up
+-- Track when a user's password was last changed or reset.
+-- JWTs issued before this moment are rejected, which signs out existing sessions.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMPTZ NULL;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS password_changed_at;
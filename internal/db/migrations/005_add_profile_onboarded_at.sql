@@ -0,0 +1,9 @@
+-- +goose Up
+-- Track onboarding completion explicitly instead of inferring it from an empty profile name
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS onboarded_at TIMESTAMPTZ NULL;
+
+-- Existing users with a name have already been through onboarding
+UPDATE profiles SET onboarded_at = updated_at WHERE name <> '' AND onboarded_at IS NULL;
+
+-- +goose Down
+ALTER TABLE profiles DROP COLUMN IF EXISTS onboarded_at;
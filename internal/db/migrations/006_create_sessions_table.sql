@@ -0,0 +1,22 @@
+-- +goose Up
+-- ============================================================================
+-- SESSIONS TABLE
+-- One row per signed-in browser. The id is the JWT's jti claim, so a JWT is
+-- only accepted while its session exists, is unexpired and has not been revoked.
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS sessions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Index for revoking every session of a user
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+-- Index for cleanup queries (find expired sessions)
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS sessions;
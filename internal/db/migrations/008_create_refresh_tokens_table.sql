@@ -0,0 +1,21 @@
+-- +goose Up
+-- ============================================================================
+-- REFRESH TOKENS TABLE
+-- One-time-use refresh tokens for short-lived access JWTs. Every refresh token
+-- of a session belongs to the same family; presenting a used token again
+-- revokes the session. Only the SHA-256 hash of the token is stored.
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Index for listing a session's token family
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens(session_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS refresh_tokens;
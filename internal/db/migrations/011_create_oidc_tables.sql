@@ -0,0 +1,35 @@
+-- +goose Up
+-- ============================================================================
+-- TENANT OIDC CONFIGS
+-- Per-tenant OpenID Connect identity provider for single sign-on
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS tenant_oidc_configs (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    client_secret TEXT NOT NULL,
+    allowed_domains TEXT NOT NULL DEFAULT '', -- comma separated, lowercase
+    jit_provisioning BOOLEAN NOT NULL DEFAULT FALSE,
+    default_role TEXT NOT NULL DEFAULT 'user',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- ============================================================================
+-- OIDC LOGIN STATES
+-- PKCE verifier and nonce between the redirect to the IdP and the callback; single use
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    state_hash TEXT NOT NULL UNIQUE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    code_verifier TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS oidc_login_states;
+DROP TABLE IF EXISTS tenant_oidc_configs;
@@ -0,0 +1,39 @@
+-- +goose Up
+-- Tenants can require their members to sign in through their identity provider
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS sso_enforced BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- ============================================================================
+-- TENANT SAML CONFIGS
+-- Per-tenant SAML 2.0 identity provider for single sign-on
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS tenant_saml_configs (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    idp_metadata TEXT NOT NULL,
+    idp_entity_id TEXT NOT NULL,
+    role_attribute TEXT NOT NULL DEFAULT '',
+    role_mapping TEXT NOT NULL DEFAULT '', -- one "value = role" pair per line
+    allowed_domains TEXT NOT NULL DEFAULT '', -- comma separated, lowercase
+    jit_provisioning BOOLEAN NOT NULL DEFAULT FALSE,
+    default_role TEXT NOT NULL DEFAULT 'user',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- ============================================================================
+-- SAML LOGIN STATES
+-- AuthnRequest ID between the redirect to the IdP and the assertion; single use
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS saml_login_states (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    state_hash TEXT NOT NULL UNIQUE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    request_id TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS saml_login_states;
+DROP TABLE IF EXISTS tenant_saml_configs;
+ALTER TABLE tenants DROP COLUMN IF EXISTS sso_enforced;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- ============================================================================
+-- THROTTLE EVENTS TABLE
+-- Rate limited authentication events such as failed password sign-ins and
+-- magic link requests. Limits, progressive delays and lockouts are derived
+-- from recent rows, so they hold across every app instance.
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS throttle_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    action TEXT NOT NULL,
+    email TEXT NOT NULL,
+    ip_address TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Indexes for counting recent events per email and per client IP
+CREATE INDEX IF NOT EXISTS idx_throttle_events_email ON throttle_events(action, email, created_at);
+CREATE INDEX IF NOT EXISTS idx_throttle_events_ip_address ON throttle_events(action, ip_address, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS throttle_events;
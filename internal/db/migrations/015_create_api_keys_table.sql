@@ -0,0 +1,23 @@
+-- +goose Up
+-- ============================================================================
+-- API KEYS
+-- Machine credentials owned by a tenant rather than a user; only the hash is stored
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    key_prefix TEXT NOT NULL UNIQUE, -- public part of the key, shown to identify it
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL DEFAULT '', -- comma separated
+    created_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NULL, -- set when the key is rotated, NULL until then
+    last_used_at TIMESTAMPTZ NULL,
+    revoked_at TIMESTAMPTZ NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant_id ON api_keys(tenant_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- Platform staff can sign in as other users for support; granted by hand, never through the app
+ALTER TABLE users ADD COLUMN IF NOT EXISTS platform_staff BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- ============================================================================
+-- IMPERSONATIONS
+-- Audit trail of support staff signing in as another user; rows are never deleted.
+-- Emails are copied so the record survives either user being deleted.
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS impersonations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    impersonator_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    impersonator_email TEXT NOT NULL,
+    target_user_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    target_email TEXT NOT NULL,
+    target_tenant_id UUID NULL REFERENCES tenants(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL,
+    ip_address TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    ended_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonations_impersonator_id ON impersonations(impersonator_id, started_at);
+CREATE INDEX IF NOT EXISTS idx_impersonations_target_user_id ON impersonations(target_user_id, started_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS impersonations;
+ALTER TABLE users DROP COLUMN IF EXISTS platform_staff;
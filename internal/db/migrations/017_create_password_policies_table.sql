@@ -0,0 +1,31 @@
+-- +goose Up
+-- ============================================================================
+-- TENANT PASSWORD POLICIES
+-- Per-tenant overrides of the global password policy. Each rule only applies
+-- where it is stricter than the global one.
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS tenant_password_policies (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    min_length INTEGER NOT NULL DEFAULT 0,
+    min_score INTEGER NOT NULL DEFAULT 0,
+    history_size INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- ============================================================================
+-- PASSWORD HISTORY
+-- Hashes of passwords users have replaced, so policies can forbid reusing them
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS password_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history(user_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS password_history;
+DROP TABLE IF EXISTS tenant_password_policies;
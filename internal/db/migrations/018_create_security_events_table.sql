@@ -0,0 +1,26 @@
+-- +goose Up
+-- ============================================================================
+-- SECURITY EVENTS
+-- Log of sign-ins, password and email changes, sessions ending and rejected
+-- tokens; rows are deleted after SECURITY_EVENT_RETENTION. The email is copied
+-- so the record survives the user being deleted. Events for unknown accounts
+-- have no actor or tenant.
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS security_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    type TEXT NOT NULL,
+    outcome TEXT NOT NULL CHECK (outcome IN ('success', 'failure')),
+    actor_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    actor_email TEXT NOT NULL DEFAULT '',
+    tenant_id UUID NULL REFERENCES tenants(id) ON DELETE SET NULL,
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_events_actor_id ON security_events(actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_security_events_tenant_id ON security_events(tenant_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS security_events;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Failed second-factor attempts are limited per account rather than per email address,
+-- which the account holder can change from a signed-in session.
+ALTER TABLE throttle_events ADD COLUMN IF NOT EXISTS user_id UUID NULL REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_throttle_events_user_id ON throttle_events(action, user_id, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_throttle_events_user_id;
+ALTER TABLE throttle_events DROP COLUMN IF EXISTS user_id;
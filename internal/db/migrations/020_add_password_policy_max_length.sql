@@ -0,0 +1,6 @@
+-- +goose Up
+-- Tenants can cap password length below the platform maximum; 0 keeps the platform's.
+ALTER TABLE tenant_password_policies ADD COLUMN IF NOT EXISTS max_length INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE tenant_password_policies DROP COLUMN IF EXISTS max_length;
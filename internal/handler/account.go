@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/middleware"
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+	"dotsat.work/internal/validation"
+	"github.com/google/uuid"
+)
+
+type AccountHandler struct {
+	authService                *service.AuthService
+	userService                *service.UserService
+	twoFactorService           *service.TwoFactorService
+	passkeyService             *service.PasskeyService
+	personalAccessTokenService *service.PersonalAccessTokenService
+	securityEventService       *service.SecurityEventService
+}
+
+func NewAccountHandler(
+	authService *service.AuthService,
+	userService *service.UserService,
+	twoFactorService *service.TwoFactorService,
+	passkeyService *service.PasskeyService,
+	personalAccessTokenService *service.PersonalAccessTokenService,
+	securityEventService *service.SecurityEventService,
+) *AccountHandler {
+	return &AccountHandler{
+		authService:                authService,
+		userService:                userService,
+		twoFactorService:           twoFactorService,
+		passkeyService:             passkeyService,
+		personalAccessTokenService: personalAccessTokenService,
+		securityEventService:       securityEventService,
+	}
+}
+
+// accountNotices are the messages other flows can show on the account page via ?notice=
+var accountNotices = map[string]string{
+	"email-changed": "Your email address has been changed.",
+}
+
+// Show renders the account settings page
+func (h *AccountHandler) Show(w http.ResponseWriter, r *http.Request) {
+	form := pages.EmailSettingsForm{
+		Notice: accountNotices[r.URL.Query().Get("notice")],
+	}
+	user := ctxkeys.User(r.Context())
+	ui.Render(w, r, pages.Account(user, form, pages.PasswordSettingsForm{HasPassword: h.hasPassword(user)}, h.twoFactorEnabled(user)))
+}
+
+// ChangeEmail starts an email change that must be confirmed from the new address
+func (h *AccountHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	user := ctxkeys.User(r.Context())
+	form := pages.EmailSettingsForm{
+		NewEmail: r.PostFormValue("new_email"),
+	}
+
+	err = h.authService.RequestEmailChange(user.ID, form.NewEmail)
+	switch {
+	case err == nil:
+		form = pages.EmailSettingsForm{Notice: "We sent a confirmation link to your new email address."}
+	case errors.Is(err, service.ErrEmailTaken):
+		form.Error = "That email address is already in use."
+	case errors.Is(err, service.ErrEmailUnchanged):
+		form.Error = "That is already your email address."
+	default:
+		slog.Warn("failed to request email change", "error", err, "user_id", user.ID)
+		form.Error = "We couldn't change your email address. Please check it and try again."
+	}
+
+	h.renderEmailSettings(w, r, user, form)
+}
+
+// CancelEmailChange discards the pending email change
+func (h *AccountHandler) CancelEmailChange(w http.ResponseWriter, r *http.Request) {
+	user := ctxkeys.User(r.Context())
+	form := pages.EmailSettingsForm{}
+
+	err := h.authService.CancelEmailChange(user.ID)
+	if err != nil && !errors.Is(err, service.ErrNoPendingEmail) {
+		slog.Error("failed to cancel email change", "error", err, "user_id", user.ID)
+		form.Error = "Something went wrong. Please try again."
+	} else {
+		form.Notice = "The pending email change was cancelled."
+	}
+
+	h.renderEmailSettings(w, r, user, form)
+}
+
+// ChangePassword replaces the user's password. This signs out every session, so the user
+// is sent to sign in again with the new password.
+func (h *AccountHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	user := ctxkeys.User(r.Context())
+	form := pages.PasswordSettingsForm{HasPassword: true}
+	newPassword := r.PostFormValue("new_password")
+
+	if newPassword != r.PostFormValue("new_password_confirm") {
+		form.Error = "Passwords do not match."
+		h.renderPasswordError(w, r, user, form)
+		return
+	}
+
+	err = h.userService.UpdatePassword(user.ID, r.PostFormValue("current_password"), newPassword, middleware.ClientInfo(r))
+	if err != nil {
+		var passwordErr *validation.PasswordError
+		switch {
+		case errors.As(err, &passwordErr):
+			form.Error = passwordErr.Error()
+		case errors.Is(err, service.ErrInvalidCurrentPassword):
+			form.Error = "Your current password is incorrect."
+		case errors.Is(err, service.ErrNoCurrentPassword):
+			form.HasPassword = false
+		default:
+			slog.Error("failed to change password", "error", err, "user_id", user.ID)
+			form.Error = "Something went wrong. Please try again."
+		}
+		h.renderPasswordError(w, r, user, form)
+		return
+	}
+
+	h.authService.ClearSessionCookies(w)
+	redirect(w, r, "/auth?notice=password-changed")
+}
+
+// renderPasswordError re-renders the account page with the change password form's error
+func (h *AccountHandler) renderPasswordError(w http.ResponseWriter, r *http.Request, user *model.User, form pages.PasswordSettingsForm) {
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	ui.Render(w, r, pages.Account(user, pages.EmailSettingsForm{}, form, h.twoFactorEnabled(user)))
+}
+
+// sessionNotices are the messages shown on the sessions page via ?notice=
+var sessionNotices = map[string]string{
+	"session-revoked": "The session was signed out.",
+}
+
+// Sessions lists the devices the user is signed in on
+func (h *AccountHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	user := ctxkeys.User(r.Context())
+
+	sessions, err := h.authService.ActiveSessions(user.ID)
+	if err != nil {
+		slog.Error("failed to list sessions", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	current := ctxkeys.Session(r.Context())
+	ui.Render(w, r, pages.Sessions(sessions, current.ID, sessionNotices[r.URL.Query().Get("notice")]))
+}
+
+// SecurityActivity lists the user's recent sign-ins and security changes
+func (h *AccountHandler) SecurityActivity(w http.ResponseWriter, r *http.Request) {
+	user := ctxkeys.User(r.Context())
+
+	events, err := h.securityEventService.Recent(user.ID)
+	if err != nil {
+		slog.Error("failed to list security events", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	ui.Render(w, r, pages.SecurityActivity(events))
+}
+
+// RevokeSession signs out one of the user's other sessions
+func (h *AccountHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user := ctxkeys.User(r.Context())
+	current := ctxkeys.Session(r.Context())
+
+	sessionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = h.authService.RevokeOtherSession(user.ID, current.ID, sessionID, middleware.ClientInfo(r))
+	switch {
+	case errors.Is(err, service.ErrInvalidSession):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, service.ErrCurrentSession):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		slog.Error("failed to revoke session", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// HTMX swaps the row out with the empty response
+	if isHTMX(r) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, "/app/account/sessions?notice=session-revoked", http.StatusSeeOther)
+}
+
+// SignOutEverywhere revokes every session of the user, including the current one
+func (h *AccountHandler) SignOutEverywhere(w http.ResponseWriter, r *http.Request) {
+	user := ctxkeys.User(r.Context())
+
+	err := h.authService.RevokeAllSessions(user.ID)
+	if err != nil {
+		slog.Error("failed to revoke sessions", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.authService.ClearSessionCookies(w)
+	redirect(w, r, "/auth?notice=signed-out-all")
+}
+
+// renderEmailSettings re-renders the email section with the user's current state
+func (h *AccountHandler) renderEmailSettings(w http.ResponseWriter, r *http.Request, user *model.User, form pages.EmailSettingsForm) {
+	fresh, err := h.userService.ByID(user.ID)
+	if err != nil {
+		slog.Error("failed to reload user", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	passwordForm := pages.PasswordSettingsForm{HasPassword: fresh.HasPassword()}
+	fresh.PasswordHash = nil
+
+	if isHTMX(r) {
+		ui.Render(w, r, pages.EmailSettings(fresh, form))
+		return
+	}
+	ui.Render(w, r, pages.Account(fresh, form, passwordForm, h.twoFactorEnabled(fresh)))
+}
+
+// twoFactorEnabled reports the user's two-factor state for the account page.
+// A lookup failure only affects the label, so it is logged rather than failing the page.
+// hasPassword reports whether the user signs in with a password. The user in the request
+// context has its password hash removed, so this looks it up again.
+func (h *AccountHandler) hasPassword(user *model.User) bool {
+	fresh, err := h.userService.ByID(user.ID)
+	if err != nil {
+		slog.Error("failed to reload user", "error", err, "user_id", user.ID)
+		return false
+	}
+	return fresh.HasPassword()
+}
+
+func (h *AccountHandler) twoFactorEnabled(user *model.User) bool {
+	enabled, err := h.twoFactorService.Enabled(user.ID)
+	if err != nil {
+		slog.Error("failed to get two-factor status", "error", err, "user_id", user.ID)
+	}
+	return enabled
+}
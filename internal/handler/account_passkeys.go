@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+	"github.com/google/uuid"
+)
+
+// passkeyNotices are the messages shown on the passkeys page via ?notice=
+var passkeyNotices = map[string]string{
+	"added":   "Your passkey has been added.",
+	"removed": "The passkey has been removed.",
+}
+
+// Passkeys lists the user's passkeys
+func (h *AccountHandler) Passkeys(w http.ResponseWriter, r *http.Request) {
+	user := ctxkeys.User(r.Context())
+
+	passkeys, err := h.passkeyService.Passkeys(user.ID)
+	if err != nil {
+		slog.Error("failed to list passkeys", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	form := pages.PasskeysForm{
+		Notice: passkeyNotices[r.URL.Query().Get("notice")],
+	}
+	ui.Render(w, r, pages.Passkeys(passkeys, form))
+}
+
+// PasskeyRegistrationOptions returns the options for navigator.credentials.create
+func (h *AccountHandler) PasskeyRegistrationOptions(w http.ResponseWriter, r *http.Request) {
+	user := ctxkeys.User(r.Context())
+
+	options, token, err := h.passkeyService.BeginRegistration(user)
+	if err != nil {
+		slog.Error("failed to begin passkey registration", "error", err, "user_id", user.ID)
+		writePasskeyError(w, err)
+		return
+	}
+
+	h.passkeyService.SetCeremonyCookie(w, token)
+	writeJSON(w, http.StatusOK, options)
+}
+
+// RegisterPasskey verifies the new credential and saves it under the name in ?name=
+func (h *AccountHandler) RegisterPasskey(w http.ResponseWriter, r *http.Request) {
+	user := ctxkeys.User(r.Context())
+
+	_, err := h.passkeyService.FinishRegistration(user, ceremonyToken(r), r.URL.Query().Get("name"), passkeyResponse(w, r))
+	h.passkeyService.ClearCeremonyCookie(w)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"redirect": "/app/account/passkeys?notice=added"})
+}
+
+// DeletePasskey removes one of the user's passkeys
+func (h *AccountHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	user := ctxkeys.User(r.Context())
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = h.passkeyService.Delete(user.ID, id)
+	if errors.Is(err, service.ErrPasskeyNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to delete passkey", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/app/account/passkeys?notice=removed", http.StatusSeeOther)
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+	"github.com/google/uuid"
+)
+
+// defaultTokenLifetimeDays is preselected when creating a personal access token
+const defaultTokenLifetimeDays = 30
+
+// accessTokenNotices are the messages shown on the access tokens page via ?notice=
+var accessTokenNotices = map[string]string{
+	"revoked": "The token has been revoked.",
+}
+
+// AccessTokens lists the user's personal access tokens
+func (h *AccountHandler) AccessTokens(w http.ResponseWriter, r *http.Request) {
+	form := pages.AccessTokensForm{
+		LifetimeDays: defaultTokenLifetimeDays,
+		Notice:       accessTokenNotices[r.URL.Query().Get("notice")],
+	}
+	h.renderAccessTokens(w, r, http.StatusOK, form)
+}
+
+// CreateAccessToken creates a personal access token and shows its secret once
+func (h *AccountHandler) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	user := ctxkeys.User(r.Context())
+	form := pages.AccessTokensForm{
+		Name: r.PostFormValue("name"),
+	}
+	form.LifetimeDays, _ = strconv.Atoi(r.PostFormValue("lifetime_days"))
+
+	secret, _, err := h.personalAccessTokenService.Create(user.ID, form.Name, form.LifetimeDays)
+	switch {
+	case err == nil:
+		w.Header().Set("Cache-Control", "no-store")
+		h.renderAccessTokens(w, r, http.StatusOK, pages.AccessTokensForm{
+			LifetimeDays: defaultTokenLifetimeDays,
+			NewToken:     secret,
+		})
+	case errors.Is(err, service.ErrInvalidTokenName):
+		form.Error = "Give the token a name of up to 64 characters."
+		h.renderAccessTokens(w, r, http.StatusUnprocessableEntity, form)
+	case errors.Is(err, service.ErrInvalidTokenLifetime):
+		form.Error = "Choose when the token expires."
+		form.LifetimeDays = defaultTokenLifetimeDays
+		h.renderAccessTokens(w, r, http.StatusUnprocessableEntity, form)
+	default:
+		slog.Error("failed to create personal access token", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// RevokeAccessToken revokes one of the user's personal access tokens
+func (h *AccountHandler) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	user := ctxkeys.User(r.Context())
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = h.personalAccessTokenService.Revoke(user.ID, id)
+	if errors.Is(err, service.ErrPersonalAccessTokenNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to revoke personal access token", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/app/account/tokens?notice=revoked", http.StatusSeeOther)
+}
+
+// renderAccessTokens renders the access tokens page with the user's current tokens
+func (h *AccountHandler) renderAccessTokens(w http.ResponseWriter, r *http.Request, status int, form pages.AccessTokensForm) {
+	user := ctxkeys.User(r.Context())
+
+	tokens, err := h.personalAccessTokenService.Tokens(user.ID)
+	if err != nil {
+		slog.Error("failed to list personal access tokens", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	form.Lifetimes = service.PersonalAccessTokenLifetimes
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	ui.Render(w, r, pages.AccessTokens(tokens, form))
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+)
+
+// twoFactorNotices are the messages shown on the two-factor page via ?notice=
+var twoFactorNotices = map[string]string{
+	"disabled": "Two-factor authentication has been turned off.",
+}
+
+// TwoFactor shows the user's two-factor settings
+func (h *AccountHandler) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	form := pages.TwoFactorForm{
+		Notice: twoFactorNotices[r.URL.Query().Get("notice")],
+	}
+	h.renderTwoFactor(w, r, form, http.StatusOK)
+}
+
+// BeginTwoFactorSetup generates a new authenticator secret and shows its QR code
+func (h *AccountHandler) BeginTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	user := ctxkeys.User(r.Context())
+
+	enrollment, err := h.twoFactorService.BeginEnrollment(user)
+	if errors.Is(err, service.ErrTwoFactorEnabled) {
+		http.Redirect(w, r, "/app/account/2fa", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to begin two-factor enrollment", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	ui.Render(w, r, pages.TwoFactorSetup(enrollment.QRCode, enrollment.Secret, pages.TwoFactorForm{}))
+}
+
+// ConfirmTwoFactor turns on two-factor authentication once the user enters a valid code
+// and shows the first set of recovery codes
+func (h *AccountHandler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	user := ctxkeys.User(r.Context())
+
+	codes, err := h.twoFactorService.ConfirmEnrollment(user.ID, r.PostFormValue("code"))
+	switch {
+	case err == nil:
+		renderRecoveryCodes(w, r, codes)
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		enrollment, err := h.twoFactorService.PendingEnrollment(user)
+		if err != nil {
+			slog.Error("failed to reload two-factor enrollment", "error", err, "user_id", user.ID)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		form := pages.TwoFactorForm{Error: "That code didn't match. Check the time on your device and try again."}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ui.Render(w, r, pages.TwoFactorSetup(enrollment.QRCode, enrollment.Secret, form))
+	case errors.Is(err, service.ErrTwoFactorEnabled), errors.Is(err, service.ErrNoPendingEnrollment):
+		http.Redirect(w, r, "/app/account/2fa", http.StatusSeeOther)
+	default:
+		slog.Error("failed to confirm two-factor enrollment", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes and shows the new ones
+func (h *AccountHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	user := ctxkeys.User(r.Context())
+
+	codes, err := h.twoFactorService.RegenerateRecoveryCodes(user.ID, r.PostFormValue("code"))
+	if err != nil {
+		h.renderTwoFactorError(w, r, err)
+		return
+	}
+
+	renderRecoveryCodes(w, r, codes)
+}
+
+// DisableTwoFactor turns off two-factor authentication
+func (h *AccountHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	user := ctxkeys.User(r.Context())
+
+	err = h.twoFactorService.Disable(user.ID, r.PostFormValue("code"))
+	if err != nil {
+		h.renderTwoFactorError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/app/account/2fa?notice=disabled", http.StatusSeeOther)
+}
+
+// renderTwoFactor renders the two-factor settings page with the user's current state
+func (h *AccountHandler) renderTwoFactor(w http.ResponseWriter, r *http.Request, form pages.TwoFactorForm, status int) {
+	user := ctxkeys.User(r.Context())
+
+	twoFactor, err := h.twoFactorService.Status(user.ID)
+	if err != nil {
+		slog.Error("failed to get two-factor status", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(status)
+	ui.Render(w, r, pages.TwoFactor(twoFactor.Enabled, twoFactor.RecoveryCodesRemaining, form))
+}
+
+// renderTwoFactorError re-renders the settings page for a change that needed a valid code
+func (h *AccountHandler) renderTwoFactorError(w http.ResponseWriter, r *http.Request, err error) {
+	form := pages.TwoFactorForm{}
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		form.Error = "That code didn't work. Enter a current code from your authenticator app or an unused recovery code."
+	case errors.Is(err, service.ErrTwoFactorNotEnabled):
+		form.Error = "Two-factor authentication is not turned on."
+	case errors.Is(err, service.ErrTooManyRequests):
+		setRetryAfter(w, err)
+		form.Error = twoFactorThrottledMessage
+	default:
+		slog.Error("failed to change two-factor settings", "error", err, "user_id", ctxkeys.User(r.Context()).ID)
+		form.Error = "Something went wrong. Please try again."
+	}
+
+	h.renderTwoFactor(w, r, form, http.StatusUnprocessableEntity)
+}
+
+// renderRecoveryCodes shows new recovery codes; browsers must not keep a copy of the page
+func renderRecoveryCodes(w http.ResponseWriter, r *http.Request, codes []string) {
+	w.Header().Set("Cache-Control", "no-store")
+	ui.Render(w, r, pages.RecoveryCodes(codes))
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/service"
+	"github.com/google/uuid"
+)
+
+// APIHandler serves the JSON API used by integrations. Callers are a signed-in user,
+// a personal access token or a tenant API key; in every case the tenant is in context.
+type APIHandler struct {
+	userService *service.UserService
+}
+
+func NewAPIHandler(userService *service.UserService) *APIHandler {
+	return &APIHandler{userService: userService}
+}
+
+// apiUser is the JSON representation of a tenant member
+type apiUser struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Users lists the members of the caller's tenant
+func (h *APIHandler) Users(w http.ResponseWriter, r *http.Request) {
+	tenant := ctxkeys.Tenant(r.Context())
+
+	users, err := h.userService.ByTenantID(tenant.ID)
+	if err != nil {
+		slog.Error("failed to list users", "error", err, "tenant_id", tenant.ID)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		return
+	}
+
+	data := make([]apiUser, 0, len(users))
+	for _, user := range users {
+		data = append(data, apiUser{ID: user.ID, Email: user.Email, Role: user.Role, CreatedAt: user.CreatedAt})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": data})
+}
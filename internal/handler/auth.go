@@ -0,0 +1,297 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"dotsat.work/internal/middleware"
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+)
+
+type AuthHandler struct {
+	authService      *service.AuthService
+	twoFactorService *service.TwoFactorService
+	passkeyService   *service.PasskeyService
+	oidcService      *service.OIDCService
+	samlService      *service.SAMLService
+
+	impersonationService *service.ImpersonationService
+	securityEventService *service.SecurityEventService
+}
+
+func NewAuthHandler(
+	authService *service.AuthService,
+	twoFactorService *service.TwoFactorService,
+	passkeyService *service.PasskeyService,
+	oidcService *service.OIDCService,
+	samlService *service.SAMLService,
+	impersonationService *service.ImpersonationService,
+	securityEventService *service.SecurityEventService,
+) *AuthHandler {
+	return &AuthHandler{
+		authService:      authService,
+		twoFactorService: twoFactorService,
+		passkeyService:   passkeyService,
+		oidcService:      oidcService,
+		samlService:      samlService,
+
+		impersonationService: impersonationService,
+		securityEventService: securityEventService,
+	}
+}
+
+// loginNotices are the messages other flows can show on the sign-in page via ?notice=
+var loginNotices = map[string]string{
+	"password-reset":   "Your password has been reset. Sign in with your new password.",
+	"password-changed": "Your password has been changed. Sign in with your new password.",
+	"email-verified":   "Your email address has been verified. You can now sign in.",
+	"signed-up":        "Check your inbox: we sent you an email with the next step.",
+	"signed-out-all":   "You have been signed out on all devices.",
+	"2fa-expired":      "Your sign-in timed out or had too many attempts. Please sign in again.",
+	"unlocked":         "Your account has been unlocked. You can sign in again.",
+}
+
+// ShowLogin renders the sign-in page
+func (h *AuthHandler) ShowLogin(w http.ResponseWriter, r *http.Request) {
+	form := pages.LoginForm{
+		Notice: loginNotices[r.URL.Query().Get("notice")],
+	}
+	ui.Render(w, r, pages.Login(form))
+}
+
+// Login authenticates the user with email and password, then either starts a session
+// or continues to the two-factor step
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := pages.LoginForm{
+		Email: r.PostFormValue("email"),
+	}
+
+	user, err := h.authService.Login(form.Email, r.PostFormValue("password"), middleware.ClientInfo(r))
+	if err != nil {
+		setRetryAfter(w, err)
+		form.Error = loginErrorMessage(err)
+		form.Unverified = errors.Is(err, service.ErrEmailNotVerified)
+		h.renderLoginError(w, r, form)
+		return
+	}
+
+	next, err := h.signIn(w, r, user, model.SecurityEventLogin)
+	if err != nil {
+		slog.Error("failed to sign in", "error", err, "user_id", user.ID)
+		form.Error = "Something went wrong. Please try again."
+		h.renderLoginError(w, r, form)
+		return
+	}
+
+	redirect(w, r, next)
+}
+
+// ShowMagicLink renders the magic link request form
+func (h *AuthHandler) ShowMagicLink(w http.ResponseWriter, r *http.Request) {
+	ui.Render(w, r, pages.MagicLink(pages.MagicLinkForm{}))
+}
+
+// SendMagicLink emails a one-time sign-in link to the submitted address
+func (h *AuthHandler) SendMagicLink(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := pages.MagicLinkForm{
+		Email: r.PostFormValue("email"),
+	}
+
+	err = h.authService.SendMagicLink(form.Email, middleware.ClientIP(r))
+	switch {
+	case errors.Is(err, service.ErrTooManyRequests):
+		setRetryAfter(w, err)
+		form.Error = "A sign-in link was requested for this address recently. Please wait a few minutes before trying again."
+	case err != nil:
+		slog.Warn("failed to send magic link", "error", err)
+		form.Error = "We couldn't send a sign-in link to that address."
+	default:
+		form.Sent = true
+	}
+
+	if isHTMX(r) {
+		ui.RenderFragment(w, r, pages.MagicLink(form), pages.MagicLinkFormFragment)
+		return
+	}
+	ui.Render(w, r, pages.MagicLink(form))
+}
+
+// VerifyMagicLink consumes a magic link token and signs the user in
+func (h *AuthHandler) VerifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	user, err := h.authService.VerifyMagicLink(r.URL.Query().Get("token"), middleware.ClientInfo(r))
+	if errors.Is(err, service.ErrSSORequired) {
+		renderSSOError(w, r, pages.SSOForm{Error: ssoRequiredMessage})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		ui.Render(w, r, pages.MagicLinkInvalid())
+		return
+	}
+
+	next, err := h.signIn(w, r, user, model.SecurityEventMagicLink)
+	if err != nil {
+		slog.Error("failed to sign in", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// UnlockAccount consumes the token from the emailed unlock link and lifts the lockout
+func (h *AuthHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	err := h.authService.UnlockAccount(r.URL.Query().Get("token"), middleware.ClientInfo(r))
+	if err != nil {
+		if !errors.Is(err, service.ErrInvalidToken) {
+			slog.Error("failed to unlock account", "error", err)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		ui.Render(w, r, pages.AccountUnlockInvalid())
+		return
+	}
+
+	http.Redirect(w, r, "/auth?notice=unlocked", http.StatusSeeOther)
+}
+
+// Logout revokes the current session, clears the JWT cookie and sends the user back to the sign-in page
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var accessToken, refreshToken string
+	if cookie, err := r.Cookie(service.AccessTokenCookie); err == nil {
+		accessToken = cookie.Value
+	}
+	if cookie, err := r.Cookie(service.RefreshTokenCookie); err == nil {
+		refreshToken = cookie.Value
+	}
+
+	err := h.authService.EndSession(accessToken, refreshToken, middleware.ClientInfo(r))
+	if err != nil {
+		slog.Error("failed to end session", "error", err)
+	}
+
+	// Signing out ends a running impersonation as well
+	if cookie, err := r.Cookie(service.ImpersonationCookie); err == nil {
+		err = h.impersonationService.Stop(cookie.Value, middleware.ClientInfo(r))
+		if err != nil {
+			slog.Error("failed to stop impersonation", "error", err)
+		}
+		h.impersonationService.ClearCookie(w)
+	}
+
+	h.authService.ClearSessionCookies(w)
+	middleware.ClearCSRFCookie(w)
+	redirect(w, r, "/auth")
+}
+
+// signIn completes the first factor. Users with two-factor authentication get a challenge
+// cookie for the code step; everyone else gets a session. It returns where to go next.
+// The sign-in is recorded as eventType, pending until the challenge is passed if there is one.
+func (h *AuthHandler) signIn(w http.ResponseWriter, r *http.Request, user *model.User, eventType string) (string, error) {
+	enabled, err := h.twoFactorService.Enabled(user.ID)
+	if err != nil {
+		return "", err
+	}
+
+	if enabled {
+		token, err := h.twoFactorService.BeginChallenge(user.ID)
+		if err != nil {
+			return "", err
+		}
+		h.twoFactorService.SetChallengeCookie(w, token)
+		h.securityEventService.Pending(eventType, user, middleware.ClientInfo(r))
+		return "/auth/2fa", nil
+	}
+
+	err = h.startSession(w, user)
+	if err != nil {
+		return "", err
+	}
+	h.securityEventService.Success(eventType, user, middleware.ClientInfo(r))
+	slog.Info("user logged in", "user_id", user.ID)
+	return "/app/dashboard", nil
+}
+
+// startSession starts a session for the user and stores its tokens in cookies.
+// The CSRF token is rotated so one planted before sign-in can't be used against the session.
+func (h *AuthHandler) startSession(w http.ResponseWriter, user *model.User) error {
+	tokens, err := h.authService.StartSession(user)
+	if err != nil {
+		return err
+	}
+
+	h.authService.SetSessionCookies(w, tokens)
+	middleware.ClearCSRFCookie(w)
+	return nil
+}
+
+// renderLoginError re-renders the login form with an error message.
+// HTMX requests only receive the form fragment so it can be swapped in place.
+func (h *AuthHandler) renderLoginError(w http.ResponseWriter, r *http.Request, form pages.LoginForm) {
+	if isHTMX(r) {
+		ui.RenderFragment(w, r, pages.Login(form), pages.LoginFormFragment)
+		return
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	ui.Render(w, r, pages.Login(form))
+}
+
+// loginErrorMessage maps AuthService.Login errors to user-facing messages
+func loginErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, service.ErrInvalidCredentials):
+		return "Invalid email or password."
+	case errors.Is(err, service.ErrEmailNotVerified):
+		return "Please verify your email address before signing in. Check your inbox for the verification link."
+	case errors.Is(err, service.ErrSSORequired):
+		return ssoRequiredMessage
+	case errors.Is(err, service.ErrAccountLocked):
+		return "This account is temporarily locked after too many failed sign-in attempts. Check your inbox for a link to unlock it, or try again later."
+	case errors.Is(err, service.ErrTooManyRequests):
+		return "Too many failed sign-in attempts. Please wait a moment before trying again."
+	default:
+		slog.Error("login failed", "error", err)
+		return "Something went wrong. Please try again."
+	}
+}
+
+// setRetryAfter sets the Retry-After header when err says how long the client has to wait
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var retry *service.RetryAfterError
+	if errors.As(err, &retry) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.RetryAfter.Seconds()))))
+	}
+}
+
+// isHTMX reports whether the request was issued by HTMX
+func isHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+// redirect sends the client to url, using HX-Redirect for HTMX requests
+// so the browser performs a full page navigation
+func redirect(w http.ResponseWriter, r *http.Request, url string) {
+	if isHTMX(r) {
+		w.Header().Set("HX-Redirect", url)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
@@ -0,0 +1,512 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/keyring"
+	"dotsat.work/internal/mail"
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"dotsat.work/internal/service"
+)
+
+// fakeUserRepository is an in-memory repository.UserRepository keyed by email
+type fakeUserRepository struct {
+	users map[string]*model.User
+}
+
+func (f *fakeUserRepository) Create(user *model.User) error {
+	f.users[user.Email] = user
+	return nil
+}
+
+func (f *fakeUserRepository) ByID(id uuid.UUID) (*model.User, error) {
+	for _, u := range f.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (f *fakeUserRepository) ByEmail(email string) (*model.User, error) {
+	u, ok := f.users[email]
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (f *fakeUserRepository) ByTenantAndEmail(tenantID uuid.UUID, email string) (*model.User, error) {
+	u, ok := f.users[email]
+	if !ok || u.TenantID != tenantID {
+		return nil, repository.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (f *fakeUserRepository) ByTenantID(tenantID uuid.UUID) ([]*model.User, error) {
+	return nil, nil
+}
+
+func (f *fakeUserRepository) Update(user *model.User) error {
+	f.users[user.Email] = user
+	return nil
+}
+
+func (f *fakeUserRepository) UpdatePasswordHash(id uuid.UUID, oldHash, newHash string) error {
+	return nil
+}
+
+func (f *fakeUserRepository) ConfirmPendingEmail(id uuid.UUID) error {
+	return nil
+}
+
+func (f *fakeUserRepository) Delete(id uuid.UUID) error {
+	return nil
+}
+
+// fakeTenantRepository is a repository.TenantRepository where every ID is an active tenant,
+// enforcing single sign-on when listed in ssoEnforced
+type fakeTenantRepository struct {
+	ssoEnforced map[uuid.UUID]bool
+}
+
+func (f *fakeTenantRepository) Create(tenant *model.Tenant) error { return nil }
+
+func (f *fakeTenantRepository) ByID(id uuid.UUID) (*model.Tenant, error) {
+	return &model.Tenant{ID: id, Status: "active", Tier: "enterprise", SSOEnforced: f.ssoEnforced[id]}, nil
+}
+
+func (f *fakeTenantRepository) BySubdomain(subdomain string) (*model.Tenant, error) {
+	return nil, repository.ErrTenantNotFound
+}
+
+func (f *fakeTenantRepository) Update(tenant *model.Tenant) error { return nil }
+
+func (f *fakeTenantRepository) Delete(id uuid.UUID) error { return nil }
+
+func (f *fakeTenantRepository) List() ([]*model.Tenant, error) { return nil, nil }
+
+// fakeTokenRepository is a no-op repository.TokenRepository
+type fakeTokenRepository struct{}
+
+func (f *fakeTokenRepository) Create(token *model.Token) error { return nil }
+
+func (f *fakeTokenRepository) ConsumeToken(token, tokenType string) (*model.Token, error) {
+	return nil, repository.ErrTokenNotFound
+}
+
+func (f *fakeTokenRepository) ByToken(token string) (*model.Token, error) {
+	return nil, repository.ErrTokenNotFound
+}
+
+func (f *fakeTokenRepository) DeleteByUserAndType(userID uuid.UUID, tokenType string) error {
+	return nil
+}
+
+// fakeImpersonationRepository is a no-op repository.ImpersonationRepository
+type fakeImpersonationRepository struct{}
+
+func (f *fakeImpersonationRepository) Create(impersonation *model.Impersonation) error { return nil }
+
+func (f *fakeImpersonationRepository) ByID(id uuid.UUID) (*model.Impersonation, error) {
+	return nil, repository.ErrImpersonationNotFound
+}
+
+func (f *fakeImpersonationRepository) End(id uuid.UUID, endedAt time.Time) error { return nil }
+
+// fakeSessionRepository is an in-memory repository.SessionRepository
+type fakeSessionRepository struct {
+	sessions map[uuid.UUID]*model.Session
+}
+
+func (f *fakeSessionRepository) Create(session *model.Session) error {
+	f.sessions[session.ID] = session
+	return nil
+}
+
+func (f *fakeSessionRepository) ByID(id uuid.UUID) (*model.Session, error) {
+	session, ok := f.sessions[id]
+	if !ok {
+		return nil, repository.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (f *fakeSessionRepository) ActiveByUserID(userID uuid.UUID) ([]*model.Session, error) {
+	return nil, nil
+}
+
+func (f *fakeSessionRepository) Touch(id uuid.UUID, userAgent, ipAddress string, seenAt time.Time) error {
+	return nil
+}
+
+func (f *fakeSessionRepository) Revoke(id uuid.UUID) error {
+	if session, ok := f.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+func (f *fakeSessionRepository) CreateRefreshToken(token *model.RefreshToken) error {
+	return nil
+}
+
+func (f *fakeSessionRepository) ConsumeRefreshToken(tokenHash string) (*model.RefreshToken, error) {
+	return nil, repository.ErrRefreshTokenNotFound
+}
+
+func (f *fakeSessionRepository) RefreshTokenByHash(tokenHash string) (*model.RefreshToken, error) {
+	return nil, repository.ErrRefreshTokenNotFound
+}
+
+func (f *fakeSessionRepository) RevokeAllByUserID(userID uuid.UUID) error {
+	for id, session := range f.sessions {
+		if session.UserID == userID {
+			_ = f.Revoke(id)
+		}
+	}
+	return nil
+}
+
+// fakeThrottleRepository is a repository.ThrottleRepository reporting a fixed number
+// of just-recorded failures per email
+type fakeThrottleRepository struct {
+	failures map[string]int
+}
+
+func (f *fakeThrottleRepository) Record(event *model.ThrottleEvent) error { return nil }
+
+func (f *fakeThrottleRepository) StatsByEmailSince(action, email string, since time.Time) (*model.ThrottleStats, error) {
+	count := f.failures[email]
+	if action != model.ThrottleActionLoginFailure || count == 0 {
+		return &model.ThrottleStats{}, nil
+	}
+	now := time.Now()
+	return &model.ThrottleStats{Count: count, LastAt: &now}, nil
+}
+
+func (f *fakeThrottleRepository) StatsByIPSince(action, ipAddress string, since time.Time) (*model.ThrottleStats, error) {
+	return &model.ThrottleStats{}, nil
+}
+
+func (f *fakeThrottleRepository) StatsByUserSince(action string, userID uuid.UUID, since time.Time) (*model.ThrottleStats, error) {
+	return &model.ThrottleStats{}, nil
+}
+
+func (f *fakeThrottleRepository) DeleteByEmail(action, email string) error { return nil }
+
+func (f *fakeThrottleRepository) CleanupExpired(olderThan time.Duration) (int64, error) {
+	return 0, nil
+}
+
+// fakeSecurityEventRepository is a repository.SecurityEventRepository that keeps events in memory
+type fakeSecurityEventRepository struct {
+	events []*model.SecurityEvent
+}
+
+func (f *fakeSecurityEventRepository) Create(event *model.SecurityEvent) error {
+	copied := *event
+	f.events = append(f.events, &copied)
+	return nil
+}
+
+func (f *fakeSecurityEventRepository) ByActorID(actorID uuid.UUID, limit int) ([]*model.SecurityEvent, error) {
+	return nil, nil
+}
+
+func (f *fakeSecurityEventRepository) ByTenantID(tenantID uuid.UUID, limit int) ([]*model.SecurityEvent, error) {
+	return nil, nil
+}
+
+func (f *fakeSecurityEventRepository) CleanupExpired(olderThan time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func newTestAuthHandler(t *testing.T) *AuthHandler {
+	t.Helper()
+
+	h, _ := newTestAuthHandlerWithEvents(t)
+	return h
+}
+
+// newTestAuthHandlerWithEvents is newTestAuthHandler that also returns where security events are recorded
+func newTestAuthHandlerWithEvents(t *testing.T) (*AuthHandler, *fakeSecurityEventRepository) {
+	t.Helper()
+
+	users := &fakeUserRepository{users: map[string]*model.User{}}
+	tenants := &fakeTenantRepository{ssoEnforced: map[uuid.UUID]bool{}}
+	events := &fakeSecurityEventRepository{}
+	securityEventService := service.NewSecurityEventService(events, &fakeThrottleRepository{}, time.Hour)
+	authService := service.NewAuthService(
+		users,
+		tenants,
+		&fakeTokenRepository{},
+		&fakeSessionRepository{sessions: map[uuid.UUID]*model.Session{}},
+		&fakeThrottleRepository{failures: map[string]int{"locked@example.com": 10, "slow@example.com": 5}},
+		mail.NewCaptureSender(),
+		"http://localhost:8090",
+		testKeyring(t),
+		service.NewPasswordHasher(service.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1}),
+		nil,
+		securityEventService,
+		false,
+		time.Hour,
+		15*time.Minute,
+	)
+
+	hash, err := authService.HashPassword("correct-horse-battery-staple")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	verifiedAt := time.Now()
+
+	users.users["verified@example.com"] = &model.User{
+		ID:              uuid.New(),
+		TenantID:        uuid.New(),
+		Email:           "verified@example.com",
+		PasswordHash:    &hash,
+		Role:            "user",
+		EmailVerifiedAt: &verifiedAt,
+	}
+	ssoUser := &model.User{
+		ID:              uuid.New(),
+		TenantID:        uuid.New(),
+		Email:           "sso@example.com",
+		PasswordHash:    &hash,
+		Role:            "user",
+		EmailVerifiedAt: &verifiedAt,
+	}
+	users.users[ssoUser.Email] = ssoUser
+	tenants.ssoEnforced[ssoUser.TenantID] = true
+	users.users["unverified@example.com"] = &model.User{
+		ID:           uuid.New(),
+		TenantID:     uuid.New(),
+		Email:        "unverified@example.com",
+		PasswordHash: &hash,
+		Role:         "user",
+	}
+
+	twoFactor := newFakeTwoFactorRepository()
+	passkeyService, err := service.NewPasskeyService(newFakeWebAuthnRepository(), users, "dotsat.work", "http://localhost:8090", false)
+	if err != nil {
+		t.Fatalf("NewPasskeyService() error = %v", err)
+	}
+	twoFactorService := service.NewTwoFactorService(twoFactor, users, &fakeThrottleRepository{}, passkeyService, securityEventService, "dotsat.work", false)
+
+	twoFactorUser := &model.User{
+		ID:              uuid.New(),
+		TenantID:        uuid.New(),
+		Email:           "2fa@example.com",
+		PasswordHash:    &hash,
+		Role:            "user",
+		EmailVerifiedAt: &verifiedAt,
+	}
+	users.users[twoFactorUser.Email] = twoFactorUser
+	twoFactor.credentials[twoFactorUser.ID] = &model.TOTPCredential{
+		UserID:      twoFactorUser.ID,
+		Secret:      testTOTPSecret,
+		ConfirmedAt: &verifiedAt,
+	}
+
+	impersonationService := service.NewImpersonationService(&fakeImpersonationRepository{}, users, securityEventService, testKeyring(t), false)
+
+	return NewAuthHandler(authService, twoFactorService, passkeyService, nil, nil, impersonationService, securityEventService), events
+}
+
+// testKeyring returns a single-key HS256 keyring for tests
+func testKeyring(t *testing.T) *keyring.Keyring {
+	t.Helper()
+
+	key, err := keyring.NewHMACKey("test", []byte("test-secret-that-is-at-least-32-bytes"))
+	if err != nil {
+		t.Fatalf("NewHMACKey() error = %v", err)
+	}
+	keys, err := keyring.New(key.ID, time.Hour, key)
+	if err != nil {
+		t.Fatalf("keyring.New() error = %v", err)
+	}
+	return keys
+}
+
+func postForm(path string, values url.Values, htmx bool) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if htmx {
+		req.Header.Set("HX-Request", "true")
+	}
+	return req
+}
+
+func authCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "auth_token" {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestAuthHandler_ShowLogin(t *testing.T) {
+	h := newTestAuthHandler(t)
+	req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+	rec := httptest.NewRecorder()
+
+	h.ShowLogin(rec, req)
+
+	assertStatus(t, rec.Code, http.StatusOK)
+	assertBodyContains(t, rec.Body.String(), []string{"<!doctype html>", `action="/auth/login"`, `name="password"`})
+}
+
+func TestAuthHandler_Login(t *testing.T) {
+	tests := []struct {
+		name             string
+		email            string
+		password         string
+		htmx             bool
+		expectedStatus   int
+		expectedLocation string
+		expectCookie     bool
+		expectRetryAfter bool
+		expectedContains []string
+	}{
+		{
+			name:             "valid credentials redirect to dashboard",
+			email:            "verified@example.com",
+			password:         "correct-horse-battery-staple",
+			expectedStatus:   http.StatusSeeOther,
+			expectedLocation: "/app/dashboard",
+			expectCookie:     true,
+		},
+		{
+			name:           "valid credentials via htmx use HX-Redirect",
+			email:          "Verified@Example.com",
+			password:       "correct-horse-battery-staple",
+			htmx:           true,
+			expectedStatus: http.StatusOK,
+			expectCookie:   true,
+		},
+		{
+			name:             "wrong password renders error page",
+			email:            "verified@example.com",
+			password:         "wrong-password",
+			expectedStatus:   http.StatusUnprocessableEntity,
+			expectedContains: []string{"<!doctype html>", "Invalid email or password."},
+		},
+		{
+			name:             "unknown email renders same error",
+			email:            "nobody@example.com",
+			password:         "correct-horse-battery-staple",
+			expectedStatus:   http.StatusUnprocessableEntity,
+			expectedContains: []string{"Invalid email or password."},
+		},
+		{
+			name:             "unverified email via htmx renders form fragment",
+			email:            "unverified@example.com",
+			password:         "correct-horse-battery-staple",
+			htmx:             true,
+			expectedStatus:   http.StatusOK,
+			expectedContains: []string{`id="login-form"`, "Please verify your email address", `action="/auth/verify/resend"`},
+		},
+		{
+			name:             "organization requiring single sign-on refuses passwords",
+			email:            "sso@example.com",
+			password:         "correct-horse-battery-staple",
+			expectedStatus:   http.StatusUnprocessableEntity,
+			expectedContains: []string{"Your organization requires single sign-on."},
+		},
+		{
+			name:             "locked account",
+			email:            "locked@example.com",
+			password:         "correct-horse-battery-staple",
+			expectedStatus:   http.StatusUnprocessableEntity,
+			expectRetryAfter: true,
+			expectedContains: []string{"This account is temporarily locked"},
+		},
+		{
+			name:             "progressive delay after failed attempts",
+			email:            "slow@example.com",
+			password:         "correct-horse-battery-staple",
+			expectedStatus:   http.StatusUnprocessableEntity,
+			expectRetryAfter: true,
+			expectedContains: []string{"Too many failed sign-in attempts."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, events := newTestAuthHandlerWithEvents(t)
+			req := postForm("/auth/login", url.Values{"email": {tt.email}, "password": {tt.password}}, tt.htmx)
+			rec := httptest.NewRecorder()
+
+			h.Login(rec, req)
+
+			assertStatus(t, rec.Code, tt.expectedStatus)
+			if tt.expectedLocation != "" && rec.Header().Get("Location") != tt.expectedLocation {
+				t.Errorf("expected Location %q, got %q", tt.expectedLocation, rec.Header().Get("Location"))
+			}
+			if tt.htmx && tt.expectCookie && rec.Header().Get("HX-Redirect") != "/app/dashboard" {
+				t.Errorf("expected HX-Redirect to /app/dashboard, got %q", rec.Header().Get("HX-Redirect"))
+			}
+			if got := rec.Header().Get("Retry-After") != ""; got != tt.expectRetryAfter {
+				t.Errorf("expected Retry-After set = %v, got %q", tt.expectRetryAfter, rec.Header().Get("Retry-After"))
+			}
+			if got := authCookie(rec) != nil; got != tt.expectCookie {
+				t.Errorf("expected auth cookie set = %v, got %v", tt.expectCookie, got)
+			}
+			// A session is always recorded as a completed sign-in
+			if tt.expectCookie {
+				if n := len(events.events); n == 0 || events.events[n-1].Type != model.SecurityEventLogin ||
+					!events.events[n-1].Succeeded() || events.events[n-1].AwaitsSecondFactor() {
+					t.Errorf("expected a completed sign-in to be recorded, got %+v", events.events)
+				}
+			}
+			if tt.htmx && !tt.expectCookie && strings.Contains(rec.Body.String(), "<!doctype html>") {
+				t.Error("expected htmx error response to contain only the form fragment")
+			}
+			assertBodyContains(t, rec.Body.String(), tt.expectedContains)
+		})
+	}
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	h := newTestAuthHandler(t)
+
+	// Sign in first so there is a session to end
+	loginRec := httptest.NewRecorder()
+	h.Login(loginRec, postForm("/auth/login", url.Values{"email": {"verified@example.com"}, "password": {"correct-horse-battery-staple"}}, false))
+	session := authCookie(loginRec)
+	if session == nil {
+		t.Fatal("expected login to set the auth cookie")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.AddCookie(session)
+	rec := httptest.NewRecorder()
+
+	h.Logout(rec, req)
+
+	assertStatus(t, rec.Code, http.StatusSeeOther)
+	cookie := authCookie(rec)
+	if cookie == nil || cookie.Value != "" || cookie.MaxAge > 0 {
+		t.Errorf("expected auth cookie to be cleared, got %+v", cookie)
+	}
+
+	// The old token must stop working even if it was copied elsewhere
+	claims, err := h.authService.VerifyJWT(session.Value)
+	if err != nil {
+		t.Fatalf("VerifyJWT() error = %v", err)
+	}
+	if _, err := h.authService.ValidateSession(claims); err == nil {
+		t.Error("expected session to be revoked after logout")
+	}
+}
@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"net/http"
+
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+)
+
+type DashboardHandler struct{}
+
+func NewDashboardHandler() *DashboardHandler {
+	return &DashboardHandler{}
+}
+
+func (h *DashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ui.Render(w, r, pages.Dashboard(ctxkeys.Profile(ctx), ctxkeys.Tenant(ctx)))
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/middleware"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+)
+
+// ImpersonationHandler lets platform staff sign in as a user to see what they see
+type ImpersonationHandler struct {
+	impersonationService *service.ImpersonationService
+}
+
+func NewImpersonationHandler(impersonationService *service.ImpersonationService) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		impersonationService: impersonationService,
+	}
+}
+
+// Show renders the form to start an impersonation
+func (h *ImpersonationHandler) Show(w http.ResponseWriter, r *http.Request) {
+	ui.Render(w, r, pages.Impersonate(pages.ImpersonateForm{}))
+}
+
+// Start records an impersonation and switches the staff member to the target user
+func (h *ImpersonationHandler) Start(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	staff := ctxkeys.User(r.Context())
+	form := pages.ImpersonateForm{
+		Email:  r.PostFormValue("email"),
+		Reason: r.PostFormValue("reason"),
+	}
+
+	token, _, err := h.impersonationService.Start(staff, form.Email, form.Reason, middleware.ClientInfo(r))
+	switch {
+	case err == nil:
+		h.impersonationService.SetCookie(w, token)
+		redirect(w, r, "/app/dashboard")
+	case errors.Is(err, service.ErrImpersonationTargetNotFound):
+		form.Error = "There is no user with that email address."
+		h.renderError(w, r, form)
+	case errors.Is(err, service.ErrCannotImpersonate):
+		form.Error = "Platform staff accounts, including your own, can't be impersonated."
+		h.renderError(w, r, form)
+	case errors.Is(err, service.ErrImpersonationReason):
+		form.Error = "Give a reason of up to 500 characters, such as the support ticket."
+		h.renderError(w, r, form)
+	default:
+		slog.Error("failed to start impersonation", "error", err, "user_id", staff.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// Stop ends the running impersonation and returns the staff member to their own account.
+// It isn't behind RequireAuth so it also works while the target user is still onboarding.
+func (h *ImpersonationHandler) Stop(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(service.ImpersonationCookie); err == nil {
+		err = h.impersonationService.Stop(cookie.Value, middleware.ClientInfo(r))
+		if err != nil {
+			slog.Error("failed to stop impersonation", "error", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.impersonationService.ClearCookie(w)
+	redirect(w, r, "/app/dashboard")
+}
+
+func (h *ImpersonationHandler) renderError(w http.ResponseWriter, r *http.Request, form pages.ImpersonateForm) {
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	ui.Render(w, r, pages.Impersonate(form))
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/keyring"
+)
+
+// JWKSHandler publishes the public JWT verification keys for downstream services
+type JWKSHandler struct {
+	keys *keyring.Keyring
+}
+
+func NewJWKSHandler(keys *keyring.Keyring) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+func (h *JWKSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	// Short enough that consumers pick up a rotation well within the grace period
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	err := json.NewEncoder(w).Encode(h.keys.JWKS())
+	if err != nil {
+		slog.Error("failed to encode JWKS", "error", err)
+	}
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/keyring"
+)
+
+func TestJWKSHandler_ServeHTTP(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	edKey, err := keyring.NewEd25519Key("2026-10", private)
+	if err != nil {
+		t.Fatalf("NewEd25519Key() error = %v", err)
+	}
+	hmacKey, err := keyring.NewHMACKey("default", []byte("a-shared-secret-that-is-long-enough"))
+	if err != nil {
+		t.Fatalf("NewHMACKey() error = %v", err)
+	}
+	keys, err := keyring.New("2026-10", time.Hour, edKey, hmacKey)
+	if err != nil {
+		t.Fatalf("keyring.New() error = %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	NewJWKSHandler(keys).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	assertStatus(t, rec.Code, http.StatusOK)
+	assertContentType(t, rec.Header().Get("Content-Type"), "application/jwk-set+json")
+
+	var set keyring.JWKS
+	err = json.Unmarshal(rec.Body.Bytes(), &set)
+	if err != nil {
+		t.Fatalf("failed to decode JWKS: %v", err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].KeyID != "2026-10" {
+		t.Errorf("expected only the Ed25519 key to be published, got %+v", set.Keys)
+	}
+}
@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/a-h/templ"
+
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+)
+
+// OnboardingHandler walks new users through the onboarding wizard:
+// name -> optional details -> organization settings (tenant admins only).
+// Every route is behind RequireAuth, which sends users here until CompleteOnboarding is called.
+type OnboardingHandler struct {
+	profileService *service.ProfileService
+	tenantService  *service.TenantService
+}
+
+func NewOnboardingHandler(profileService *service.ProfileService, tenantService *service.TenantService) *OnboardingHandler {
+	return &OnboardingHandler{
+		profileService: profileService,
+		tenantService:  tenantService,
+	}
+}
+
+// Start sends the user to the first onboarding step
+func (h *OnboardingHandler) Start(w http.ResponseWriter, r *http.Request) {
+	if h.redirectIfOnboarded(w, r) {
+		return
+	}
+	http.Redirect(w, r, "/auth/onboarding/name", http.StatusSeeOther)
+}
+
+// ShowName renders the name step
+func (h *OnboardingHandler) ShowName(w http.ResponseWriter, r *http.Request) {
+	if h.redirectIfOnboarded(w, r) {
+		return
+	}
+
+	profile := ctxkeys.Profile(r.Context())
+	form := pages.OnboardingNameForm{Name: profile.Name}
+	ui.Render(w, r, pages.OnboardingName(form, onboardingStep(r, 1)))
+}
+
+// SaveName stores the user's name and continues to the details step
+func (h *OnboardingHandler) SaveName(w http.ResponseWriter, r *http.Request) {
+	if h.redirectIfOnboarded(w, r) {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	user := ctxkeys.User(r.Context())
+	form := pages.OnboardingNameForm{Name: r.PostFormValue("name")}
+
+	err = h.profileService.UpdateName(user.ID, form.Name)
+	if err != nil {
+		form.Error = err.Error()
+		renderOnboardingError(w, r, pages.OnboardingName(form, onboardingStep(r, 1)))
+		return
+	}
+
+	redirect(w, r, "/auth/onboarding/details")
+}
+
+// ShowDetails renders the optional bio/phone step
+func (h *OnboardingHandler) ShowDetails(w http.ResponseWriter, r *http.Request) {
+	if h.redirectIfOnboarded(w, r) {
+		return
+	}
+
+	profile := ctxkeys.Profile(r.Context())
+	if !profile.HasName() {
+		http.Redirect(w, r, "/auth/onboarding/name", http.StatusSeeOther)
+		return
+	}
+
+	form := pages.OnboardingDetailsForm{
+		Bio:   derefString(profile.Bio),
+		Phone: derefString(profile.Phone),
+	}
+	ui.Render(w, r, pages.OnboardingDetails(form, onboardingStep(r, 2)))
+}
+
+// SaveDetails stores the optional bio/phone (unless skipped) and continues
+func (h *OnboardingHandler) SaveDetails(w http.ResponseWriter, r *http.Request) {
+	if h.redirectIfOnboarded(w, r) {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	user := ctxkeys.User(r.Context())
+
+	if r.PostFormValue("action") != "skip" {
+		form := pages.OnboardingDetailsForm{
+			Bio:   r.PostFormValue("bio"),
+			Phone: r.PostFormValue("phone"),
+		}
+
+		err = h.profileService.UpdateDetails(user.ID, form.Bio, form.Phone)
+		if err != nil {
+			form.Error = err.Error()
+			renderOnboardingError(w, r, pages.OnboardingDetails(form, onboardingStep(r, 2)))
+			return
+		}
+	}
+
+	if user.IsAdmin() {
+		redirect(w, r, "/auth/onboarding/organization")
+		return
+	}
+
+	h.complete(w, r, user)
+}
+
+// ShowOrganization renders the tenant settings step for tenant admins
+func (h *OnboardingHandler) ShowOrganization(w http.ResponseWriter, r *http.Request) {
+	if h.redirectIfOnboarded(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	user := ctxkeys.User(ctx)
+	if !user.IsAdmin() {
+		http.NotFound(w, r)
+		return
+	}
+
+	tenant := ctxkeys.Tenant(ctx)
+	settings, err := h.tenantService.Settings(tenant.ID)
+	if err != nil {
+		slog.Error("failed to load tenant settings", "error", err, "tenant_id", tenant.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	form := pages.OnboardingOrganizationForm{
+		LogoURL:      derefString(settings.LogoURL),
+		PrimaryColor: settings.PrimaryColor,
+		Timezone:     settings.Timezone,
+	}
+	ui.Render(w, r, pages.OnboardingOrganization(form, tenant.Name, onboardingStep(r, 3)))
+}
+
+// SaveOrganization stores the initial tenant settings and finishes onboarding
+func (h *OnboardingHandler) SaveOrganization(w http.ResponseWriter, r *http.Request) {
+	if h.redirectIfOnboarded(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	user := ctxkeys.User(ctx)
+	if !user.IsAdmin() {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	tenant := ctxkeys.Tenant(ctx)
+	form := pages.OnboardingOrganizationForm{
+		LogoURL:      r.PostFormValue("logo_url"),
+		PrimaryColor: r.PostFormValue("primary_color"),
+		Timezone:     r.PostFormValue("timezone"),
+	}
+
+	settings, err := h.tenantService.Settings(tenant.ID)
+	if err == nil {
+		settings.LogoURL = &form.LogoURL
+		settings.PrimaryColor = form.PrimaryColor
+		settings.Timezone = form.Timezone
+		err = h.tenantService.UpdateSettings(settings)
+	}
+	if err != nil {
+		form.Error = err.Error()
+		renderOnboardingError(w, r, pages.OnboardingOrganization(form, tenant.Name, onboardingStep(r, 3)))
+		return
+	}
+
+	h.complete(w, r, user)
+}
+
+// complete marks onboarding as finished and sends the user to the dashboard
+func (h *OnboardingHandler) complete(w http.ResponseWriter, r *http.Request, user *model.User) {
+	err := h.profileService.CompleteOnboarding(user.ID)
+	if err != nil {
+		slog.Error("failed to complete onboarding", "error", err, "user_id", user.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("onboarding completed", "user_id", user.ID)
+	redirect(w, r, "/app/dashboard")
+}
+
+// redirectIfOnboarded sends users who already finished onboarding to the dashboard
+func (h *OnboardingHandler) redirectIfOnboarded(w http.ResponseWriter, r *http.Request) bool {
+	profile := ctxkeys.Profile(r.Context())
+	if profile == nil || !profile.IsOnboarded() {
+		return false
+	}
+	redirect(w, r, "/app/dashboard")
+	return true
+}
+
+// onboardingStep numbers the step; tenant admins get the extra organization step
+func onboardingStep(r *http.Request, number int) pages.OnboardingStep {
+	total := 2
+	if user := ctxkeys.User(r.Context()); user != nil && user.IsAdmin() {
+		total = 3
+	}
+	return pages.OnboardingStep{Number: number, Total: total}
+}
+
+// renderOnboardingError re-renders an onboarding step with its validation error
+func renderOnboardingError(w http.ResponseWriter, r *http.Request, page templ.Component) {
+	if isHTMX(r) {
+		ui.RenderFragment(w, r, page, pages.OnboardingFormFragment)
+		return
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	ui.Render(w, r, page)
+}
+
+func derefString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,275 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+)
+
+// idpMetadataLimit caps uploaded SAML identity provider metadata
+const idpMetadataLimit = 1 << 20
+
+// OrganizationHandler serves the tenant settings only admins can change
+type OrganizationHandler struct {
+	tenantService         *service.TenantService
+	oidcService           *service.OIDCService
+	samlService           *service.SAMLService
+	apiKeyService         *service.APIKeyService
+	passwordPolicyService *service.PasswordPolicyService
+	securityEventService  *service.SecurityEventService
+}
+
+func NewOrganizationHandler(
+	tenantService *service.TenantService,
+	oidcService *service.OIDCService,
+	samlService *service.SAMLService,
+	apiKeyService *service.APIKeyService,
+	passwordPolicyService *service.PasswordPolicyService,
+	securityEventService *service.SecurityEventService,
+) *OrganizationHandler {
+	return &OrganizationHandler{
+		tenantService:         tenantService,
+		oidcService:           oidcService,
+		samlService:           samlService,
+		apiKeyService:         apiKeyService,
+		passwordPolicyService: passwordPolicyService,
+		securityEventService:  securityEventService,
+	}
+}
+
+// ssoNotices are the messages shown on the single sign-on settings page via ?notice=
+var ssoNotices = map[string]string{
+	"oidc-saved":       "Your OpenID Connect settings have been saved.",
+	"saml-saved":       "Your SAML settings have been saved.",
+	"sso-enforced":     "Members must now sign in with single sign-on.",
+	"sso-not-enforced": "Members can now sign in with a password, magic link or passkey again.",
+}
+
+// SSO shows the organization's single sign-on settings
+func (h *OrganizationHandler) SSO(w http.ResponseWriter, r *http.Request) {
+	tenant := ctxkeys.Tenant(r.Context())
+
+	page, err := h.ssoPage(tenant)
+	if err != nil {
+		slog.Error("failed to get sso config", "error", err, "tenant_id", tenant.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	notice := r.URL.Query().Get("notice")
+	switch notice {
+	case "oidc-saved":
+		page.OIDC.Notice = ssoNotices[notice]
+	case "saml-saved":
+		page.SAML.Notice = ssoNotices[notice]
+	default:
+		page.EnforcementNotice = ssoNotices[notice]
+	}
+
+	ui.Render(w, r, pages.OrganizationSSO(tenant, page))
+}
+
+// SaveOIDC validates the OpenID Connect settings against the issuer and stores them
+func (h *OrganizationHandler) SaveOIDC(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	tenant := ctxkeys.Tenant(r.Context())
+	input := service.OIDCConfigInput{
+		Issuer:          r.PostFormValue("issuer"),
+		ClientID:        r.PostFormValue("client_id"),
+		ClientSecret:    r.PostFormValue("client_secret"),
+		AllowedDomains:  r.PostFormValue("allowed_domains"),
+		JITProvisioning: r.PostFormValue("jit_provisioning") == "on",
+		DefaultRole:     r.PostFormValue("default_role"),
+		Enabled:         r.PostFormValue("enabled") == "on",
+	}
+
+	_, err = h.oidcService.SaveConfig(r.Context(), tenant, input)
+	if err != nil {
+		page, pageErr := h.ssoPage(tenant)
+		if pageErr != nil {
+			slog.Error("failed to get sso config", "error", pageErr, "tenant_id", tenant.ID)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		page.OIDC = pages.OIDCSettingsForm{
+			Issuer:          input.Issuer,
+			ClientID:        input.ClientID,
+			AllowedDomains:  input.AllowedDomains,
+			JITProvisioning: input.JITProvisioning,
+			DefaultRole:     input.DefaultRole,
+			Enabled:         input.Enabled,
+			HasSecret:       page.OIDC.HasSecret,
+			Error:           ssoSettingsErrorMessage(err),
+		}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ui.Render(w, r, pages.OrganizationSSO(tenant, page))
+		return
+	}
+
+	http.Redirect(w, r, "/app/organization/sso?notice=oidc-saved", http.StatusSeeOther)
+}
+
+// SaveSAML stores the SAML settings. The IdP metadata can be uploaded as a file or pasted.
+func (h *OrganizationHandler) SaveSAML(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, idpMetadataLimit)
+	err := r.ParseMultipartForm(idpMetadataLimit)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	tenant := ctxkeys.Tenant(r.Context())
+	input := service.SAMLConfigInput{
+		IdPMetadata:     r.PostFormValue("idp_metadata"),
+		RoleAttribute:   r.PostFormValue("role_attribute"),
+		RoleMapping:     r.PostFormValue("role_mapping"),
+		AllowedDomains:  r.PostFormValue("allowed_domains"),
+		JITProvisioning: r.PostFormValue("jit_provisioning") == "on",
+		DefaultRole:     r.PostFormValue("default_role"),
+		Enabled:         r.PostFormValue("enabled") == "on",
+	}
+	if file, _, err := r.FormFile("idp_metadata_file"); err == nil {
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if len(data) > 0 {
+			input.IdPMetadata = string(data)
+		}
+	}
+
+	_, err = h.samlService.SaveConfig(tenant, input)
+	if err != nil {
+		page, pageErr := h.ssoPage(tenant)
+		if pageErr != nil {
+			slog.Error("failed to get sso config", "error", pageErr, "tenant_id", tenant.ID)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		page.SAML = pages.SAMLSettingsForm{
+			IdPEntityID:     page.SAML.IdPEntityID,
+			RoleAttribute:   input.RoleAttribute,
+			RoleMapping:     input.RoleMapping,
+			AllowedDomains:  input.AllowedDomains,
+			JITProvisioning: input.JITProvisioning,
+			DefaultRole:     input.DefaultRole,
+			Enabled:         input.Enabled,
+			Error:           ssoSettingsErrorMessage(err),
+		}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ui.Render(w, r, pages.OrganizationSSO(tenant, page))
+		return
+	}
+
+	http.Redirect(w, r, "/app/organization/sso?notice=saml-saved", http.StatusSeeOther)
+}
+
+// EnforceSSO turns requiring single sign-on for the organization's members on or off
+func (h *OrganizationHandler) EnforceSSO(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	tenant := ctxkeys.Tenant(r.Context())
+	enforced := r.PostFormValue("enforced") == "on"
+
+	err = h.tenantService.SetSSOEnforced(tenant, enforced)
+	if err != nil {
+		page, pageErr := h.ssoPage(tenant)
+		if pageErr != nil {
+			slog.Error("failed to get sso config", "error", pageErr, "tenant_id", tenant.ID)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		page.EnforcementError = ssoSettingsErrorMessage(err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ui.Render(w, r, pages.OrganizationSSO(tenant, page))
+		return
+	}
+	slog.Info("sso enforcement changed", "tenant_id", tenant.ID, "enforced", enforced)
+
+	notice := "sso-enforced"
+	if !enforced {
+		notice = "sso-not-enforced"
+	}
+	http.Redirect(w, r, "/app/organization/sso?notice="+notice, http.StatusSeeOther)
+}
+
+// ssoPage loads the tenant's stored single sign-on settings into the page's forms
+func (h *OrganizationHandler) ssoPage(tenant *model.Tenant) (pages.OrganizationSSOPage, error) {
+	page := pages.OrganizationSSOPage{
+		CallbackURL:  h.oidcService.CallbackURL(),
+		SAMLEntityID: h.samlService.EntityID(tenant.Subdomain),
+		SAMLACSURL:   h.samlService.ACSURL(tenant.Subdomain),
+		OIDC:         pages.OIDCSettingsForm{DefaultRole: "user", Enabled: true},
+		SAML:         pages.SAMLSettingsForm{DefaultRole: "user", Enabled: true},
+	}
+
+	oidc, err := h.oidcService.Config(tenant.ID)
+	switch {
+	case err == nil:
+		page.OIDC = pages.OIDCSettingsForm{
+			Issuer:          oidc.Issuer,
+			ClientID:        oidc.ClientID,
+			AllowedDomains:  oidc.AllowedDomains,
+			JITProvisioning: oidc.JITProvisioning,
+			DefaultRole:     oidc.DefaultRole,
+			Enabled:         oidc.Enabled,
+			HasSecret:       oidc.ClientSecret != "",
+		}
+	case !errors.Is(err, service.ErrSSONotConfigured):
+		return page, err
+	}
+
+	saml, err := h.samlService.Config(tenant.ID)
+	switch {
+	case err == nil:
+		page.SAML = pages.SAMLSettingsForm{
+			IdPEntityID:     saml.IdPEntityID,
+			RoleAttribute:   saml.RoleAttribute,
+			RoleMapping:     saml.RoleMapping,
+			AllowedDomains:  saml.AllowedDomains,
+			JITProvisioning: saml.JITProvisioning,
+			DefaultRole:     saml.DefaultRole,
+			Enabled:         saml.Enabled,
+		}
+	case !errors.Is(err, service.ErrSSONotConfigured):
+		return page, err
+	}
+
+	return page, nil
+}
+
+// ssoSettingsErrorMessage maps errors from saving single sign-on settings to form messages
+func ssoSettingsErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, service.ErrSSONotAvailable):
+		return "Single sign-on is available on the Enterprise plan."
+	case errors.Is(err, service.ErrSSONotConfigured):
+		return "Enable OpenID Connect or SAML before requiring single sign-on, so members can still sign in."
+	case errors.Is(err, service.ErrInvalidOIDCIssuer):
+		return "We couldn't reach an OpenID Connect provider at that issuer URL. Check the URL and try again."
+	case errors.Unwrap(err) == nil:
+		// Unwrapped errors are validation failures and already user-facing
+		return err.Error()
+	default:
+		slog.Error("failed to save sso settings", "error", err)
+		return "Something went wrong. Please try again."
+	}
+}
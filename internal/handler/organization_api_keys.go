@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+	"github.com/google/uuid"
+)
+
+// apiKeyNotices are the messages shown on the API keys page via ?notice=
+var apiKeyNotices = map[string]string{
+	"revoked": "The API key has been revoked.",
+}
+
+// APIKeys lists the organization's API keys
+func (h *OrganizationHandler) APIKeys(w http.ResponseWriter, r *http.Request) {
+	form := pages.APIKeysForm{
+		Notice: apiKeyNotices[r.URL.Query().Get("notice")],
+	}
+	h.renderAPIKeys(w, r, http.StatusOK, form)
+}
+
+// CreateAPIKey creates an API key and shows its secret once
+func (h *OrganizationHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	user := ctxkeys.User(r.Context())
+	tenant := ctxkeys.Tenant(r.Context())
+	form := pages.APIKeysForm{
+		Name:   r.PostFormValue("name"),
+		Scopes: r.PostForm["scopes"],
+	}
+
+	secret, _, err := h.apiKeyService.Create(tenant.ID, user.ID, form.Name, form.Scopes)
+	switch {
+	case err == nil:
+		w.Header().Set("Cache-Control", "no-store")
+		h.renderAPIKeys(w, r, http.StatusOK, pages.APIKeysForm{NewKey: secret})
+	case errors.Is(err, service.ErrInvalidKeyName):
+		form.Error = "Give the key a name of up to 64 characters."
+		h.renderAPIKeys(w, r, http.StatusUnprocessableEntity, form)
+	case errors.Is(err, service.ErrInvalidAPIScope):
+		form.Error = "Choose at least one scope."
+		h.renderAPIKeys(w, r, http.StatusUnprocessableEntity, form)
+	default:
+		slog.Error("failed to create api key", "error", err, "tenant_id", tenant.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// RotateAPIKey replaces an API key with a new one and shows its secret once.
+// The old key keeps working for a day so the integration can be updated.
+func (h *OrganizationHandler) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	user := ctxkeys.User(r.Context())
+	tenant := ctxkeys.Tenant(r.Context())
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	secret, _, err := h.apiKeyService.Rotate(tenant.ID, user.ID, id)
+	switch {
+	case err == nil:
+		w.Header().Set("Cache-Control", "no-store")
+		h.renderAPIKeys(w, r, http.StatusOK, pages.APIKeysForm{
+			NewKey: secret,
+			Notice: "The old key keeps working for 24 hours. Update your integration before then.",
+		})
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		http.NotFound(w, r)
+	case errors.Is(err, service.ErrAPIKeyRotated):
+		h.renderAPIKeys(w, r, http.StatusConflict, pages.APIKeysForm{Error: "That key was already rotated."})
+	default:
+		slog.Error("failed to rotate api key", "error", err, "tenant_id", tenant.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// RevokeAPIKey revokes an API key immediately
+func (h *OrganizationHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	user := ctxkeys.User(r.Context())
+	tenant := ctxkeys.Tenant(r.Context())
+
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = h.apiKeyService.Revoke(tenant.ID, user.ID, id)
+	if errors.Is(err, service.ErrAPIKeyNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to revoke api key", "error", err, "tenant_id", tenant.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/app/organization/api-keys?notice=revoked", http.StatusSeeOther)
+}
+
+// renderAPIKeys renders the API keys page with the organization's current keys
+func (h *OrganizationHandler) renderAPIKeys(w http.ResponseWriter, r *http.Request, status int, form pages.APIKeysForm) {
+	tenant := ctxkeys.Tenant(r.Context())
+
+	keys, err := h.apiKeyService.Keys(tenant.ID)
+	if err != nil {
+		slog.Error("failed to list api keys", "error", err, "tenant_id", tenant.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	ui.Render(w, r, pages.APIKeys(tenant, keys, form))
+}
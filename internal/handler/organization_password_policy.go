@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+	"dotsat.work/internal/validation"
+)
+
+// passwordPolicyNotices are the messages shown on the password policy page via ?notice=
+var passwordPolicyNotices = map[string]string{
+	"saved": "Your password policy has been saved.",
+}
+
+// PasswordPolicy shows the organization's password policy
+func (h *OrganizationHandler) PasswordPolicy(w http.ResponseWriter, r *http.Request) {
+	tenant := ctxkeys.Tenant(r.Context())
+
+	policy, err := h.passwordPolicyService.TenantPolicy(tenant.ID)
+	if err != nil {
+		slog.Error("failed to get password policy", "error", err, "tenant_id", tenant.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	form := pages.PasswordPolicyForm{
+		MinLength:   policy.MinLength,
+		MaxLength:   policy.MaxLength,
+		MinScore:    policy.MinScore,
+		HistorySize: policy.HistorySize,
+		Notice:      passwordPolicyNotices[r.URL.Query().Get("notice")],
+	}
+	ui.Render(w, r, pages.OrganizationPasswordPolicy(tenant, h.passwordPolicyService.Global(), form))
+}
+
+// SavePasswordPolicy stores the organization's password policy
+func (h *OrganizationHandler) SavePasswordPolicy(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	tenant := ctxkeys.Tenant(r.Context())
+	minLength, minLengthErr := strconv.Atoi(r.PostFormValue("min_length"))
+	maxLength, maxLengthErr := strconv.Atoi(r.PostFormValue("max_length"))
+	minScore, minScoreErr := strconv.Atoi(r.PostFormValue("min_score"))
+	historySize, historySizeErr := strconv.Atoi(r.PostFormValue("history_size"))
+	policy := &model.TenantPasswordPolicy{
+		TenantID:    tenant.ID,
+		MinLength:   minLength,
+		MaxLength:   maxLength,
+		MinScore:    minScore,
+		HistorySize: historySize,
+	}
+
+	// Values that aren't numbers are as invalid as ones out of range
+	err = service.ErrInvalidPasswordPolicy
+	if errors.Join(minLengthErr, maxLengthErr, minScoreErr, historySizeErr) == nil {
+		err = h.passwordPolicyService.UpdateTenantPolicy(policy)
+	}
+
+	switch {
+	case err == nil:
+		http.Redirect(w, r, "/app/organization/password-policy?notice=saved", http.StatusSeeOther)
+	case errors.Is(err, service.ErrInvalidPasswordPolicy):
+		form := pages.PasswordPolicyForm{
+			MinLength:   policy.MinLength,
+			MaxLength:   policy.MaxLength,
+			MinScore:    policy.MinScore,
+			HistorySize: policy.HistorySize,
+			Error: fmt.Sprintf("Enter a minimum length of up to %d characters, a maximum length of 0 or between the minimum and %d characters, "+
+				"and a history of up to %d passwords.",
+				h.passwordPolicyService.Global().MaxLength, validation.MaxPasswordLength, validation.MaxPasswordHistory),
+		}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ui.Render(w, r, pages.OrganizationPasswordPolicy(tenant, h.passwordPolicyService.Global(), form))
+	default:
+		slog.Error("failed to save password policy", "error", err, "tenant_id", tenant.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+)
+
+// SecurityEvents lists the recent sign-ins and security changes of the organization's members
+func (h *OrganizationHandler) SecurityEvents(w http.ResponseWriter, r *http.Request) {
+	tenant := ctxkeys.Tenant(r.Context())
+
+	events, err := h.securityEventService.RecentForTenant(tenant.ID)
+	if err != nil {
+		slog.Error("failed to list security events", "error", err, "tenant_id", tenant.ID)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	ui.Render(w, r, pages.OrganizationSecurityEvents(tenant, events))
+}
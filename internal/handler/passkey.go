@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/middleware"
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/service"
+)
+
+// maxPasskeyResponseBytes bounds the authenticator response the browser posts back
+const maxPasskeyResponseBytes = 64 << 10
+
+// PasskeyLoginOptions starts a passwordless sign-in and returns the options for navigator.credentials.get
+func (h *AuthHandler) PasskeyLoginOptions(w http.ResponseWriter, r *http.Request) {
+	options, token, err := h.passkeyService.BeginLogin()
+	if err != nil {
+		slog.Error("failed to begin passkey login", "error", err)
+		writePasskeyError(w, err)
+		return
+	}
+
+	h.passkeyService.SetCeremonyCookie(w, token)
+	writeJSON(w, http.StatusOK, options)
+}
+
+// PasskeyLogin verifies the passkey assertion and starts a session. The authenticator verified
+// the user, so the passkey counts as both factors and no two-factor challenge follows.
+func (h *AuthHandler) PasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	client := middleware.ClientInfo(r)
+	user, err := h.passkeyService.FinishLogin(ceremonyToken(r), passkeyResponse(w, r))
+	h.passkeyService.ClearCeremonyCookie(w)
+	if err != nil {
+		if errors.Is(err, service.ErrPasskeyVerification) || errors.Is(err, service.ErrInvalidCeremony) {
+			h.securityEventService.AnonymousFailure(model.SecurityEventPasskeyLogin, "", client, model.SecurityReasonInvalidPasskey)
+		}
+		writePasskeyError(w, err)
+		return
+	}
+
+	err = h.authService.CheckSSOEnforced(user)
+	if err != nil {
+		if errors.Is(err, service.ErrSSORequired) {
+			h.securityEventService.Failure(model.SecurityEventPasskeyLogin, user, "", client, model.SecurityReasonSSORequired)
+		}
+		writePasskeyError(w, err)
+		return
+	}
+
+	err = h.startSession(w, user)
+	if err != nil {
+		slog.Error("failed to start session", "error", err, "user_id", user.ID)
+		writePasskeyError(w, err)
+		return
+	}
+	h.securityEventService.Success(model.SecurityEventPasskeyLogin, user, client)
+	slog.Info("user logged in", "user_id", user.ID, "passkey", true)
+
+	writeJSON(w, http.StatusOK, map[string]string{"redirect": "/app/dashboard"})
+}
+
+// TwoFactorPasskeyOptions returns assertion options for the user of the pending two-factor challenge
+func (h *AuthHandler) TwoFactorPasskeyOptions(w http.ResponseWriter, r *http.Request) {
+	options, token, err := h.twoFactorService.BeginPasskeyChallenge(twoFactorChallengeToken(r))
+	if errors.Is(err, service.ErrInvalidChallenge) {
+		h.twoFactorService.ClearChallengeCookie(w)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"redirect": "/auth?notice=2fa-expired"})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to begin passkey challenge", "error", err)
+		writePasskeyError(w, err)
+		return
+	}
+
+	h.passkeyService.SetCeremonyCookie(w, token)
+	writeJSON(w, http.StatusOK, options)
+}
+
+// VerifyTwoFactorPasskey completes the two-factor challenge with a passkey instead of a code
+func (h *AuthHandler) VerifyTwoFactorPasskey(w http.ResponseWriter, r *http.Request) {
+	user, err := h.twoFactorService.CompletePasskeyChallenge(twoFactorChallengeToken(r), ceremonyToken(r), passkeyResponse(w, r), middleware.ClientInfo(r))
+	h.passkeyService.ClearCeremonyCookie(w)
+	if errors.Is(err, service.ErrInvalidChallenge) {
+		h.twoFactorService.ClearChallengeCookie(w)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"redirect": "/auth?notice=2fa-expired"})
+		return
+	}
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+
+	h.twoFactorService.ClearChallengeCookie(w)
+	err = h.startSession(w, user)
+	if err != nil {
+		slog.Error("failed to start session", "error", err, "user_id", user.ID)
+		writePasskeyError(w, err)
+		return
+	}
+	slog.Info("user logged in", "user_id", user.ID, "two_factor", true, "passkey", true)
+
+	writeJSON(w, http.StatusOK, map[string]string{"redirect": "/app/dashboard"})
+}
+
+// ceremonyToken returns the WebAuthn ceremony token the options request set
+func ceremonyToken(r *http.Request) string {
+	cookie, err := r.Cookie(service.WebAuthnCeremonyCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// twoFactorChallengeToken returns the pending two-factor challenge token
+func twoFactorChallengeToken(r *http.Request) string {
+	cookie, err := r.Cookie(service.TwoFactorChallengeCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// passkeyResponse returns the request body holding the authenticator response
+func passkeyResponse(w http.ResponseWriter, r *http.Request) io.Reader {
+	return http.MaxBytesReader(w, r.Body, maxPasskeyResponseBytes)
+}
+
+// writePasskeyError maps PasskeyService errors to a JSON message for the passkey script
+func writePasskeyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidCeremony):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "The passkey request expired. Please try again."})
+	case errors.Is(err, service.ErrPasskeyVerification):
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "That passkey couldn't be verified."})
+	case errors.Is(err, service.ErrPasskeyExists):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "This passkey is already registered."})
+	case errors.Is(err, service.ErrPasskeyNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "You don't have a passkey set up."})
+	case errors.Is(err, service.ErrSSORequired):
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": ssoRequiredMessage})
+	case errors.Is(err, service.ErrTooManyRequests):
+		setRetryAfter(w, err)
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": twoFactorThrottledMessage})
+	default:
+		slog.Error("passkey request failed", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Something went wrong. Please try again."})
+	}
+}
+
+// writeJSON encodes v as the response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		slog.Error("failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"dotsat.work/internal/service"
+)
+
+// fakeWebAuthnRepository is an in-memory repository.WebAuthnRepository holding ceremonies only
+type fakeWebAuthnRepository struct {
+	ceremonies map[string]*model.WebAuthnCeremony
+}
+
+func newFakeWebAuthnRepository() *fakeWebAuthnRepository {
+	return &fakeWebAuthnRepository{ceremonies: map[string]*model.WebAuthnCeremony{}}
+}
+
+func (f *fakeWebAuthnRepository) CreateCredential(credential *model.WebAuthnCredential) error {
+	return nil
+}
+
+func (f *fakeWebAuthnRepository) CredentialsByUserID(userID uuid.UUID) ([]*model.WebAuthnCredential, error) {
+	return nil, nil
+}
+
+func (f *fakeWebAuthnRepository) UpdateCredentialUse(credential *model.WebAuthnCredential) error {
+	return nil
+}
+
+func (f *fakeWebAuthnRepository) DeleteCredential(userID, id uuid.UUID) error {
+	return repository.ErrWebAuthnCredentialNotFound
+}
+
+func (f *fakeWebAuthnRepository) CreateCeremony(ceremony *model.WebAuthnCeremony) error {
+	f.ceremonies[ceremony.TokenHash] = ceremony
+	return nil
+}
+
+func (f *fakeWebAuthnRepository) ConsumeCeremony(tokenHash string) (*model.WebAuthnCeremony, error) {
+	ceremony, ok := f.ceremonies[tokenHash]
+	if !ok || time.Now().After(ceremony.ExpiresAt) {
+		return nil, repository.ErrWebAuthnCeremonyNotFound
+	}
+	delete(f.ceremonies, tokenHash)
+	return ceremony, nil
+}
+
+func TestAuthHandler_PasskeyLoginOptions(t *testing.T) {
+	h := newTestAuthHandler(t)
+	rec := httptest.NewRecorder()
+
+	h.PasskeyLoginOptions(rec, httptest.NewRequest(http.MethodPost, "/auth/passkey/options", nil))
+
+	assertStatus(t, rec.Code, http.StatusOK)
+	var options struct {
+		PublicKey struct {
+			Challenge        string `json:"challenge"`
+			RPID             string `json:"rpId"`
+			UserVerification string `json:"userVerification"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &options); err != nil {
+		t.Fatalf("expected JSON options, got %q: %v", rec.Body.String(), err)
+	}
+	if options.PublicKey.Challenge == "" || options.PublicKey.RPID != "localhost" {
+		t.Errorf("expected a challenge for localhost, got %+v", options.PublicKey)
+	}
+	if options.PublicKey.UserVerification != "required" {
+		t.Errorf("expected user verification to be required, got %q", options.PublicKey.UserVerification)
+	}
+
+	var ceremony *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == service.WebAuthnCeremonyCookie {
+			ceremony = c
+		}
+	}
+	if ceremony == nil || ceremony.Value == "" || !ceremony.HttpOnly {
+		t.Errorf("expected an HttpOnly ceremony cookie, got %+v", ceremony)
+	}
+}
+
+func TestAuthHandler_PasskeyLogin_WithoutCeremony(t *testing.T) {
+	h := newTestAuthHandler(t)
+	rec := httptest.NewRecorder()
+
+	h.PasskeyLogin(rec, httptest.NewRequest(http.MethodPost, "/auth/passkey", strings.NewReader(`{}`)))
+
+	assertStatus(t, rec.Code, http.StatusBadRequest)
+	assertBodyContains(t, rec.Body.String(), []string{`"error":"The passkey request expired. Please try again."`})
+	if authCookie(rec) != nil {
+		t.Error("expected no auth cookie")
+	}
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/middleware"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+	"dotsat.work/internal/validation"
+)
+
+// ShowForgotPassword renders the password reset request form
+func (h *AuthHandler) ShowForgotPassword(w http.ResponseWriter, r *http.Request) {
+	ui.Render(w, r, pages.ForgotPassword(pages.ForgotPasswordForm{}))
+}
+
+// ForgotPassword emails a password reset link to the submitted address
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := pages.ForgotPasswordForm{
+		Email: r.PostFormValue("email"),
+	}
+
+	err = h.authService.RequestPasswordReset(form.Email, middleware.ClientInfo(r))
+	switch {
+	case errors.Is(err, service.ErrTooManyRequests):
+		setRetryAfter(w, err)
+		form.Error = "A reset link was requested for this address recently. Please wait a few minutes before trying again."
+	case err != nil:
+		slog.Warn("failed to request password reset", "error", err)
+		form.Error = "We couldn't send a reset link to that address."
+	default:
+		form.Sent = true
+	}
+
+	if isHTMX(r) {
+		ui.RenderFragment(w, r, pages.ForgotPassword(form), pages.ForgotPasswordFormFragment)
+		return
+	}
+	ui.Render(w, r, pages.ForgotPassword(form))
+}
+
+// ShowResetPassword renders the new password form for the token in the link.
+// The token is only consumed when the form is submitted.
+func (h *AuthHandler) ShowResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		ui.Render(w, r, pages.ResetPasswordInvalid())
+		return
+	}
+
+	ui.Render(w, r, pages.ResetPassword(pages.ResetPasswordForm{Token: token}))
+}
+
+// ResetPassword consumes the reset token and sets the new password
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := pages.ResetPasswordForm{
+		Token: r.PostFormValue("token"),
+	}
+	password := r.PostFormValue("password")
+
+	if password != r.PostFormValue("password_confirm") {
+		form.Error = "Passwords do not match."
+		h.renderResetPasswordError(w, r, form)
+		return
+	}
+
+	err = h.authService.ResetPassword(form.Token, password, middleware.ClientInfo(r))
+	if err != nil {
+		var passwordErr *validation.PasswordError
+		if errors.As(err, &passwordErr) {
+			form.Error = passwordErr.Error()
+		} else if errors.Is(err, service.ErrInvalidToken) {
+			form.Error = "This password reset link is invalid or has expired. Please request a new one."
+		} else {
+			slog.Error("failed to reset password", "error", err)
+			form.Error = "Something went wrong. Please try again."
+		}
+		h.renderResetPasswordError(w, r, form)
+		return
+	}
+
+	redirect(w, r, "/auth?notice=password-reset")
+}
+
+// renderResetPasswordError re-renders the new password form with an error message
+func (h *AuthHandler) renderResetPasswordError(w http.ResponseWriter, r *http.Request, form pages.ResetPasswordForm) {
+	if isHTMX(r) {
+		ui.RenderFragment(w, r, pages.ResetPassword(form), pages.ResetPasswordFormFragment)
+		return
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	ui.Render(w, r, pages.ResetPassword(form))
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/middleware"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/components"
+	"dotsat.work/internal/validation"
+)
+
+// passwordStrengthFormLimit caps the form the strength meter posts, which only carries a
+// password and a few short fields
+const passwordStrengthFormLimit = 4 << 10
+
+// PasswordStrengthHandler updates the strength meter on the signup and password reset forms
+type PasswordStrengthHandler struct {
+	authService           *service.AuthService
+	passwordPolicyService *service.PasswordPolicyService
+}
+
+func NewPasswordStrengthHandler(authService *service.AuthService, passwordPolicyService *service.PasswordPolicyService) *PasswordStrengthHandler {
+	return &PasswordStrengthHandler{
+		authService:           authService,
+		passwordPolicyService: passwordPolicyService,
+	}
+}
+
+// ServeHTTP checks the typed password against the policy that will apply to it: the reset
+// token's user and tenant on the reset form, the global policy and the entered details on signup
+func (h *PasswordStrengthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, passwordStrengthFormLimit)
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	err = h.authService.CheckPasswordStrengthThrottle(middleware.ClientIP(r))
+	if errors.Is(err, service.ErrTooManyRequests) {
+		setRetryAfter(w, err)
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to throttle password strength check", "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	password := r.PostFormValue("password")
+	if password == "" {
+		ui.Render(w, r, components.PasswordStrength(nil))
+		return
+	}
+
+	check, err := h.check(r, password)
+	if err != nil {
+		slog.Error("failed to check password strength", "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	ui.Render(w, r, components.PasswordStrength(&check))
+}
+
+func (h *PasswordStrengthHandler) check(r *http.Request, password string) (validation.PasswordCheck, error) {
+	if token := r.PostFormValue("token"); token != "" {
+		user, err := h.authService.PasswordResetUser(token)
+		if err == nil {
+			return h.passwordPolicyService.CheckChange(user, password)
+		}
+		// The reset form reports an expired link when it is submitted
+		if !errors.Is(err, service.ErrInvalidToken) {
+			return validation.PasswordCheck{}, err
+		}
+	}
+
+	return h.passwordPolicyService.Check(password, validation.PasswordContext{
+		Email:            r.PostFormValue("email"),
+		OrganizationName: r.PostFormValue("organization_name"),
+		Subdomain:        r.PostFormValue("subdomain"),
+	}), nil
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+	"dotsat.work/internal/validation"
+)
+
+type SignupHandler struct {
+	signupService *service.SignupService
+}
+
+func NewSignupHandler(signupService *service.SignupService) *SignupHandler {
+	return &SignupHandler{
+		signupService: signupService,
+	}
+}
+
+// Show renders the signup form
+func (h *SignupHandler) Show(w http.ResponseWriter, r *http.Request) {
+	ui.Render(w, r, pages.Signup(pages.SignupForm{}))
+}
+
+// Signup creates the organization and its first admin
+func (h *SignupHandler) Signup(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := pages.SignupForm{
+		OrganizationName: r.PostFormValue("organization_name"),
+		Subdomain:        r.PostFormValue("subdomain"),
+		Email:            r.PostFormValue("email"),
+	}
+
+	_, err = h.signupService.Signup(service.SignupInput{
+		OrganizationName: form.OrganizationName,
+		Subdomain:        form.Subdomain,
+		Email:            form.Email,
+		Password:         r.PostFormValue("password"),
+	})
+	if err != nil {
+		form.Error = signupErrorMessage(err)
+		if isHTMX(r) {
+			ui.RenderFragment(w, r, pages.Signup(form), pages.SignupFormFragment)
+			return
+		}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ui.Render(w, r, pages.Signup(form))
+		return
+	}
+
+	redirect(w, r, "/auth?notice=signed-up")
+}
+
+// CheckSubdomain reports whether the subdomain typed on the signup form is available
+func (h *SignupHandler) CheckSubdomain(w http.ResponseWriter, r *http.Request) {
+	subdomain := r.URL.Query().Get("subdomain")
+	if subdomain == "" {
+		ui.Render(w, r, pages.SubdomainStatus("", false))
+		return
+	}
+
+	available, err := h.signupService.SubdomainAvailable(subdomain)
+	switch {
+	case errors.Is(err, service.ErrInvalidSubdomain):
+		ui.Render(w, r, pages.SubdomainStatus("Use lowercase letters, numbers and hyphens only.", false))
+	case err != nil:
+		slog.Error("failed to check subdomain", "error", err)
+		ui.Render(w, r, pages.SubdomainStatus("", false))
+	case available:
+		ui.Render(w, r, pages.SubdomainStatus("Available", true))
+	default:
+		ui.Render(w, r, pages.SubdomainStatus("Already taken", false))
+	}
+}
+
+// signupErrorMessage maps SignupService.Signup errors to user-facing messages.
+// Only validation errors are shown as they are; anything else is logged.
+func signupErrorMessage(err error) string {
+	var passwordErr *validation.PasswordError
+	switch {
+	case errors.Is(err, service.ErrSubdomainTaken):
+		return "That subdomain is already taken."
+	case errors.Is(err, service.ErrInvalidSubdomain),
+		errors.Is(err, service.ErrInvalidTenantName),
+		errors.Is(err, validation.ErrEmailRequired),
+		errors.Is(err, validation.ErrEmailTooLong),
+		errors.Is(err, validation.ErrInvalidEmail),
+		errors.As(err, &passwordErr):
+		return err.Error()
+	default:
+		slog.Error("signup failed", "error", err)
+		return "Something went wrong. Please try again."
+	}
+}
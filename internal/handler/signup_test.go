@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/validation"
+)
+
+func TestSignupErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"subdomain taken", service.ErrSubdomainTaken, "That subdomain is already taken."},
+		{"invalid email", validation.ErrInvalidEmail, validation.ErrInvalidEmail.Error()},
+		{"weak password", &validation.PasswordError{Reasons: []validation.PasswordReason{{Code: "too_short", Message: "Too short."}}}, "Too short."},
+		{"unwrapped internal error", errors.New(`pq: relation "tenants" does not exist`), "Something went wrong. Please try again."},
+		{"wrapped internal error", fmt.Errorf("failed to check email: %w", errors.New("connection refused")), "Something went wrong. Please try again."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signupErrorMessage(tt.err); got != tt.want {
+				t.Errorf("signupErrorMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
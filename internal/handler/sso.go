@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/middleware"
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+)
+
+// ssoRequiredMessage is shown when a member of an organization that requires single sign-on
+// tries another way to sign in
+const ssoRequiredMessage = "Your organization requires single sign-on. Sign in with your identity provider instead."
+
+// samlResponseLimit caps the SAMLResponse form IdPs post to the ACS
+const samlResponseLimit = 1 << 20
+
+// ShowSSO asks for the organization to sign in to, or starts right away when ?organization= is set
+func (h *AuthHandler) ShowSSO(w http.ResponseWriter, r *http.Request) {
+	organization := r.URL.Query().Get("organization")
+	if organization == "" {
+		ui.Render(w, r, pages.SSO(pages.SSOForm{}))
+		return
+	}
+	h.startSSO(w, r, organization)
+}
+
+// StartSSO redirects to the identity provider of the submitted organization
+func (h *AuthHandler) StartSSO(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	h.startSSO(w, r, r.PostFormValue("organization"))
+}
+
+// OIDCCallback completes an OpenID Connect sign-in when the identity provider redirects back
+func (h *AuthHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var cookieState string
+	if cookie, err := r.Cookie(service.OIDCStateCookie); err == nil {
+		cookieState = cookie.Value
+	}
+	h.oidcService.ClearStateCookie(w)
+
+	if idpError := query.Get("error"); idpError != "" {
+		slog.Warn("identity provider returned an error", "error", idpError, "description", query.Get("error_description"))
+		renderSSOError(w, r, pages.SSOForm{Error: "Your identity provider didn't complete the sign-in. Please try again."})
+		return
+	}
+
+	user, err := h.oidcService.CompleteLogin(r.Context(), cookieState, query.Get("state"), query.Get("code"))
+	if err != nil {
+		h.recordSSOFailure(r, err)
+		renderSSOError(w, r, pages.SSOForm{Error: ssoErrorMessage(err)})
+		return
+	}
+
+	next, err := h.signIn(w, r, user, model.SecurityEventSSOLogin)
+	if err != nil {
+		slog.Error("failed to sign in", "error", err, "user_id", user.ID)
+		renderSSOError(w, r, pages.SSOForm{Error: "Something went wrong. Please try again."})
+		return
+	}
+	slog.Info("user signed in with sso", "user_id", user.ID, "tenant_id", user.TenantID)
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// SAMLMetadata serves the organization's service provider metadata for its admins to register with their IdP
+func (h *AuthHandler) SAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	metadata, err := h.samlService.Metadata(r.PathValue("organization"))
+	if errors.Is(err, service.ErrSSONotConfigured) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to build saml metadata", "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	_, err = w.Write(metadata)
+	if err != nil {
+		slog.Error("failed to write saml metadata", "error", err)
+	}
+}
+
+// SAMLACS is the assertion consumer service the identity provider posts the signed SAMLResponse to
+func (h *AuthHandler) SAMLACS(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, samlResponseLimit)
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	var cookieState string
+	if cookie, err := r.Cookie(service.SAMLStateCookie); err == nil {
+		cookieState = cookie.Value
+	}
+	h.samlService.ClearStateCookie(w)
+
+	user, err := h.samlService.CompleteLogin(r.PathValue("organization"), cookieState, r.PostFormValue("RelayState"), r.PostFormValue("SAMLResponse"))
+	if err != nil {
+		h.recordSSOFailure(r, err)
+		renderSSOError(w, r, pages.SSOForm{Error: ssoErrorMessage(err)})
+		return
+	}
+
+	next, err := h.signIn(w, r, user, model.SecurityEventSSOLogin)
+	if err != nil {
+		slog.Error("failed to sign in", "error", err, "user_id", user.ID)
+		renderSSOError(w, r, pages.SSOForm{Error: "Something went wrong. Please try again."})
+		return
+	}
+	slog.Info("user signed in with sso", "user_id", user.ID, "tenant_id", user.TenantID, "saml", true)
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// startSSO redirects to the organization's SAML identity provider, or its OpenID Connect
+// provider when SAML isn't set up
+func (h *AuthHandler) startSSO(w http.ResponseWriter, r *http.Request, organization string) {
+	redirectURL, state, err := h.samlService.BeginLogin(organization)
+	if err == nil {
+		h.samlService.SetStateCookie(w, state)
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+	if !errors.Is(err, service.ErrSSONotConfigured) {
+		renderSSOError(w, r, pages.SSOForm{Organization: organization, Error: ssoErrorMessage(err)})
+		return
+	}
+
+	authURL, state, err := h.oidcService.BeginLogin(r.Context(), organization)
+	if err != nil {
+		renderSSOError(w, r, pages.SSOForm{Organization: organization, Error: ssoErrorMessage(err)})
+		return
+	}
+
+	h.oidcService.SetStateCookie(w, state)
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+func renderSSOError(w http.ResponseWriter, r *http.Request, form pages.SSOForm) {
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	ui.Render(w, r, pages.SSO(form))
+}
+
+// ssoErrorMessage maps single sign-on errors to user-facing messages
+func ssoErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, service.ErrSSONotConfigured):
+		return "Single sign-on isn't set up for that organization."
+	case errors.Is(err, service.ErrInvalidSSOState):
+		return "Your sign-in timed out. Please try again."
+	case errors.Is(err, service.ErrSSOEmailNotVerified):
+		return "Your identity provider didn't confirm your email address."
+	case errors.Is(err, service.ErrSSODomainNotAllowed):
+		return "Your email domain isn't allowed to sign in to this organization."
+	case errors.Is(err, service.ErrSSOUserNotFound):
+		return "You don't have an account in this organization yet. Ask an admin to invite you."
+	case errors.Is(err, service.ErrSSOFailed):
+		return "We couldn't verify the sign-in from your identity provider."
+	default:
+		slog.Error("sso sign-in failed", "error", err)
+		return "Something went wrong. Please try again."
+	}
+}
+
+// recordSSOFailure records a refused single sign-on response. Internal errors are only logged.
+func (h *AuthHandler) recordSSOFailure(r *http.Request, err error) {
+	refused := []error{
+		service.ErrInvalidSSOState,
+		service.ErrSSOEmailNotVerified,
+		service.ErrSSODomainNotAllowed,
+		service.ErrSSOUserNotFound,
+		service.ErrSSOFailed,
+	}
+	for _, target := range refused {
+		if errors.Is(err, target) {
+			h.securityEventService.AnonymousFailure(model.SecurityEventSSOLogin, "", middleware.ClientInfo(r), model.SecurityReasonSSOFailed)
+			return
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/middleware"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+)
+
+// twoFactorThrottledMessage is shown once too many wrong codes or passkeys were tried for an account
+const twoFactorThrottledMessage = "Too many failed attempts. Please wait a few minutes before trying again."
+
+// ShowTwoFactor renders the code step of sign-in
+func (h *AuthHandler) ShowTwoFactor(w http.ResponseWriter, r *http.Request) {
+	challenge := twoFactorChallengeToken(r)
+	if challenge == "" {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+	form := pages.TwoFactorChallengeForm{
+		Passkey: h.twoFactorService.ChallengeOffersPasskey(challenge),
+	}
+	ui.Render(w, r, pages.TwoFactorChallenge(form))
+}
+
+// VerifyTwoFactor checks the authenticator or recovery code and starts the session
+func (h *AuthHandler) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	challenge := twoFactorChallengeToken(r)
+	user, err := h.twoFactorService.CompleteChallenge(challenge, r.PostFormValue("code"), middleware.ClientInfo(r))
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		h.renderTwoFactorError(w, r, pages.TwoFactorChallengeForm{Error: "That code didn't work. Please try again."})
+		return
+	case errors.Is(err, service.ErrTooManyRequests):
+		setRetryAfter(w, err)
+		h.renderTwoFactorError(w, r, pages.TwoFactorChallengeForm{Error: twoFactorThrottledMessage})
+		return
+	case errors.Is(err, service.ErrInvalidChallenge):
+		h.twoFactorService.ClearChallengeCookie(w)
+		redirect(w, r, "/auth?notice=2fa-expired")
+		return
+	case err != nil:
+		slog.Error("failed to verify two-factor code", "error", err)
+		h.renderTwoFactorError(w, r, pages.TwoFactorChallengeForm{Error: "Something went wrong. Please try again."})
+		return
+	}
+
+	h.twoFactorService.ClearChallengeCookie(w)
+	err = h.startSession(w, user)
+	if err != nil {
+		slog.Error("failed to start session", "error", err, "user_id", user.ID)
+		h.renderTwoFactorError(w, r, pages.TwoFactorChallengeForm{Error: "Something went wrong. Please sign in again."})
+		return
+	}
+	slog.Info("user logged in", "user_id", user.ID, "two_factor", true)
+
+	redirect(w, r, "/app/dashboard")
+}
+
+// renderTwoFactorError re-renders the code form with an error message
+func (h *AuthHandler) renderTwoFactorError(w http.ResponseWriter, r *http.Request, form pages.TwoFactorChallengeForm) {
+	form.Passkey = h.twoFactorService.ChallengeOffersPasskey(twoFactorChallengeToken(r))
+	if isHTMX(r) {
+		ui.RenderFragment(w, r, pages.TwoFactorChallenge(form), pages.TwoFactorChallengeFragment)
+		return
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	ui.Render(w, r, pages.TwoFactorChallenge(form))
+}
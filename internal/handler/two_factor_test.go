@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pquerna/otp/totp"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"dotsat.work/internal/service"
+)
+
+// testTOTPSecret is the authenticator secret of 2fa@example.com
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+// fakeTwoFactorRepository is an in-memory repository.TwoFactorRepository without recovery codes
+type fakeTwoFactorRepository struct {
+	credentials map[uuid.UUID]*model.TOTPCredential
+	challenges  map[uuid.UUID]*model.TwoFactorChallenge
+}
+
+func newFakeTwoFactorRepository() *fakeTwoFactorRepository {
+	return &fakeTwoFactorRepository{
+		credentials: map[uuid.UUID]*model.TOTPCredential{},
+		challenges:  map[uuid.UUID]*model.TwoFactorChallenge{},
+	}
+}
+
+func (f *fakeTwoFactorRepository) UpsertTOTP(credential *model.TOTPCredential) error {
+	f.credentials[credential.UserID] = credential
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) TOTPByUserID(userID uuid.UUID) (*model.TOTPCredential, error) {
+	credential, ok := f.credentials[userID]
+	if !ok {
+		return nil, repository.ErrTOTPNotFound
+	}
+	return credential, nil
+}
+
+func (f *fakeTwoFactorRepository) ConfirmTOTP(userID uuid.UUID) error {
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) MarkTOTPStepUsed(userID uuid.UUID, step int64) error {
+	credential := f.credentials[userID]
+	if credential.LastUsedStep != nil && *credential.LastUsedStep >= step {
+		return repository.ErrTOTPStepUsed
+	}
+	credential.LastUsedStep = &step
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) DeleteTOTP(userID uuid.UUID) error {
+	delete(f.credentials, userID)
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) ReplaceRecoveryCodes(userID uuid.UUID, codeHashes []string) error {
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) ConsumeRecoveryCode(userID uuid.UUID, codeHash string) error {
+	return repository.ErrRecoveryCodeNotFound
+}
+
+func (f *fakeTwoFactorRepository) CountUnusedRecoveryCodes(userID uuid.UUID) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeTwoFactorRepository) CreateChallenge(challenge *model.TwoFactorChallenge) error {
+	challenge.ID = uuid.New()
+	f.challenges[challenge.ID] = challenge
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) ActiveChallengeByHash(tokenHash string) (*model.TwoFactorChallenge, error) {
+	for _, challenge := range f.challenges {
+		if challenge.TokenHash == tokenHash && challenge.ConsumedAt == nil {
+			return challenge, nil
+		}
+	}
+	return nil, repository.ErrChallengeNotFound
+}
+
+func (f *fakeTwoFactorRepository) IncrementChallengeAttempts(id uuid.UUID) (int, error) {
+	f.challenges[id].Attempts++
+	return f.challenges[id].Attempts, nil
+}
+
+func (f *fakeTwoFactorRepository) ConsumeChallenge(id uuid.UUID) error {
+	now := time.Now()
+	f.challenges[id].ConsumedAt = &now
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) CleanupExpiredChallenges(olderThan time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func challengeCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == service.TwoFactorChallengeCookie {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestAuthHandler_Login_TwoFactor(t *testing.T) {
+	h, events := newTestAuthHandlerWithEvents(t)
+
+	// The password alone must not issue a session
+	loginRec := httptest.NewRecorder()
+	h.Login(loginRec, postForm("/auth/login", url.Values{"email": {"2fa@example.com"}, "password": {"correct-horse-battery-staple"}}, false))
+
+	assertStatus(t, loginRec.Code, http.StatusSeeOther)
+	if loginRec.Header().Get("Location") != "/auth/2fa" {
+		t.Errorf("expected Location /auth/2fa, got %q", loginRec.Header().Get("Location"))
+	}
+	if authCookie(loginRec) != nil {
+		t.Fatal("expected no auth cookie before the second factor")
+	}
+	challenge := challengeCookie(loginRec)
+	if challenge == nil || challenge.Value == "" {
+		t.Fatal("expected a two-factor challenge cookie")
+	}
+
+	// A wrong code re-renders the form and keeps the challenge
+	req := postForm("/auth/2fa", url.Values{"code": {"000000"}}, true)
+	req.AddCookie(challenge)
+	rec := httptest.NewRecorder()
+	h.VerifyTwoFactor(rec, req)
+
+	assertStatus(t, rec.Code, http.StatusOK)
+	assertBodyContains(t, rec.Body.String(), []string{`id="two-factor-form"`, "That code didn&#39;t work."})
+	if authCookie(rec) != nil {
+		t.Error("expected no auth cookie for a wrong code")
+	}
+
+	code, err := totp.GenerateCode(testTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatalf("GenerateCode() error = %v", err)
+	}
+	req = postForm("/auth/2fa", url.Values{"code": {code}}, false)
+	req.AddCookie(challenge)
+	rec = httptest.NewRecorder()
+	h.VerifyTwoFactor(rec, req)
+
+	assertStatus(t, rec.Code, http.StatusSeeOther)
+	if rec.Header().Get("Location") != "/app/dashboard" {
+		t.Errorf("expected Location /app/dashboard, got %q", rec.Header().Get("Location"))
+	}
+	if authCookie(rec) == nil {
+		t.Error("expected auth cookie after the second factor")
+	}
+	if cleared := challengeCookie(rec); cleared == nil || cleared.Value != "" {
+		t.Errorf("expected challenge cookie to be cleared, got %+v", cleared)
+	}
+
+	// The challenge can't be completed twice
+	req = postForm("/auth/2fa", url.Values{"code": {code}}, false)
+	req.AddCookie(challenge)
+	rec = httptest.NewRecorder()
+	h.VerifyTwoFactor(rec, req)
+
+	assertStatus(t, rec.Code, http.StatusSeeOther)
+	if rec.Header().Get("Location") != "/auth?notice=2fa-expired" {
+		t.Errorf("expected Location /auth?notice=2fa-expired, got %q", rec.Header().Get("Location"))
+	}
+
+	// The password is only a pending step; the sign-in completes with the second factor
+	want := []struct{ eventType, outcome, reason string }{
+		{model.SecurityEventLogin, model.SecurityOutcomeSuccess, model.SecurityReasonTwoFactorRequired},
+		{model.SecurityEventTwoFactor, model.SecurityOutcomeFailure, model.SecurityReasonInvalidCode},
+		{model.SecurityEventTwoFactor, model.SecurityOutcomeSuccess, ""},
+	}
+	if len(events.events) != len(want) {
+		t.Fatalf("expected %d security events, got %+v", len(want), events.events)
+	}
+	for i, w := range want {
+		got := events.events[i]
+		if got.Type != w.eventType || got.Outcome != w.outcome || got.Reason != w.reason || got.ActorEmail != "2fa@example.com" {
+			t.Errorf("event %d = %s %s (%q) for %s, want %s %s (%q)", i, got.Type, got.Outcome, got.Reason, got.ActorEmail, w.eventType, w.outcome, w.reason)
+		}
+	}
+}
+
+func TestAuthHandler_ShowTwoFactor_WithoutChallenge(t *testing.T) {
+	h := newTestAuthHandler(t)
+	rec := httptest.NewRecorder()
+
+	h.ShowTwoFactor(rec, httptest.NewRequest(http.MethodGet, "/auth/2fa", nil))
+
+	assertStatus(t, rec.Code, http.StatusSeeOther)
+	if rec.Header().Get("Location") != "/auth" {
+		t.Errorf("expected Location /auth, got %q", rec.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"dotsat.work/internal/middleware"
+	"dotsat.work/internal/service"
+	"dotsat.work/internal/ui"
+	"dotsat.work/internal/ui/pages"
+)
+
+// VerifyEmail consumes the verification token from the emailed link
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	_, err := h.authService.VerifyEmail(r.URL.Query().Get("token"), middleware.ClientInfo(r))
+	if err != nil {
+		if !errors.Is(err, service.ErrInvalidToken) {
+			slog.Error("failed to verify email", "error", err)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		ui.Render(w, r, pages.VerifyEmailInvalid())
+		return
+	}
+
+	http.Redirect(w, r, "/auth?notice=email-verified", http.StatusSeeOther)
+}
+
+// ResendVerification sends a fresh verification email to the submitted address
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	email := r.PostFormValue("email")
+	status := "We sent a new verification link. Check your inbox."
+	isError := false
+
+	err = h.authService.ResendVerificationEmail(email)
+	if err != nil {
+		isError = true
+		if errors.Is(err, service.ErrTooManyRequests) {
+			status = "A verification email was sent recently. Please wait a few minutes before trying again."
+		} else {
+			slog.Warn("failed to resend verification email", "error", err)
+			status = "We couldn't send a verification email. Please try again."
+		}
+	}
+
+	if isHTMX(r) {
+		ui.Render(w, r, pages.ResendVerification(email, status, isError))
+		return
+	}
+
+	form := pages.LoginForm{Email: email}
+	if isError {
+		form.Error = status
+	} else {
+		form.Notice = status
+	}
+	ui.Render(w, r, pages.Login(form))
+}
+
+// ConfirmEmailChange consumes the email change token from the link sent to the new address
+func (h *AuthHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	_, err := h.authService.ConfirmEmailChange(r.URL.Query().Get("token"), middleware.ClientInfo(r))
+	if err != nil {
+		message := "This confirmation link is invalid or has expired."
+		switch {
+		case errors.Is(err, service.ErrEmailTaken):
+			message = "That email address is already in use by another account."
+		case !errors.Is(err, service.ErrInvalidToken):
+			slog.Error("failed to confirm email change", "error", err)
+			message = "Something went wrong. Please try again."
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		ui.Render(w, r, pages.EmailChangeInvalid(message))
+		return
+	}
+
+	http.Redirect(w, r, "/app/account?notice=email-changed", http.StatusSeeOther)
+}
@@ -0,0 +1,117 @@
+package keyring
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// manifest is the JSON file listing the keys of a keyring, for example:
+//
+//	{
+//	  "signing_key": "2026-10",
+//	  "keys": [
+//	    {"kid": "2026-10", "alg": "EdDSA", "file": "2026-10.pem"},
+//	    {"kid": "2026-04", "alg": "RS256", "file": "2026-04.pem", "retired_at": "2026-10-01T00:00:00Z"}
+//	  ]
+//	}
+//
+// Key files are resolved relative to the manifest. RS256 and EdDSA keys are PEM encoded
+// private keys (PKCS#8, or PKCS#1 for RSA); HS256 keys are files holding the raw secret.
+type manifest struct {
+	SigningKey string          `json:"signing_key"`
+	Keys       []manifestEntry `json:"keys"`
+}
+
+type manifestEntry struct {
+	ID        string     `json:"kid"`
+	Algorithm string     `json:"alg"`
+	File      string     `json:"file"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+// LoadFile reads a keyring from a JSON manifest and the key files it references
+func LoadFile(path string, grace time.Duration) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring manifest: %w", err)
+	}
+
+	var m manifest
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse keyring manifest: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	keys := make([]*Key, 0, len(m.Keys))
+	for _, entry := range m.Keys {
+		file := entry.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+
+		key, err := loadKey(entry.ID, entry.Algorithm, file)
+		if err != nil {
+			return nil, err
+		}
+		key.RetiredAt = entry.RetiredAt
+		keys = append(keys, key)
+	}
+
+	return New(m.SigningKey, grace, keys...)
+}
+
+// loadKey reads a single key file for the given algorithm
+func loadKey(id, algorithm, file string) (*Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %q: %w", id, err)
+	}
+
+	if algorithm == "HS256" {
+		return NewHMACKey(id, bytes.TrimRight(data, "\r\n"))
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %q: no PEM data found in %s", id, file)
+	}
+
+	var private any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %q: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %q: failed to parse private key: %w", id, err)
+	}
+
+	switch algorithm {
+	case "RS256":
+		rsaKey, ok := private.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: key %q is not an RSA key", ErrAlgorithmType, id)
+		}
+		return NewRSAKey(id, rsaKey)
+	case "EdDSA":
+		edKey, ok := private.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: key %q is not an Ed25519 key", ErrAlgorithmType, id)
+		}
+		return NewEd25519Key(id, edKey)
+	default:
+		return nil, fmt.Errorf("key %q: unsupported algorithm %q (use HS256, RS256 or EdDSA)", id, algorithm)
+	}
+}
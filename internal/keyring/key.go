@@ -0,0 +1,97 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// MinHMACSecretLength is the minimum HS256 secret size in bytes (the size of the hash output)
+	MinHMACSecretLength = 32
+	// MinRSAKeyBits is the minimum RS256 modulus size
+	MinRSAKeyBits = 2048
+)
+
+var (
+	ErrInvalidKeyID  = errors.New("key id must not be empty")
+	ErrWeakKey       = errors.New("key is too weak")
+	ErrAlgorithmType = errors.New("key type does not match algorithm")
+)
+
+// Key is a single JWT signing key identified by the kid header
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// RetiredAt stops the key from signing; it keeps verifying for the keyring's grace period
+	RetiredAt *time.Time
+
+	private any // []byte, *rsa.PrivateKey or ed25519.PrivateKey
+	public  any // []byte, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// NewHMACKey creates an HS256 key from a shared secret
+func NewHMACKey(id string, secret []byte) (*Key, error) {
+	if id == "" {
+		return nil, ErrInvalidKeyID
+	}
+	if len(secret) < MinHMACSecretLength {
+		return nil, fmt.Errorf("%w: HS256 secret %q must be at least %d bytes", ErrWeakKey, id, MinHMACSecretLength)
+	}
+	return &Key{ID: id, Method: jwt.SigningMethodHS256, private: secret, public: secret}, nil
+}
+
+// NewRSAKey creates an RS256 key from an RSA private key
+func NewRSAKey(id string, key *rsa.PrivateKey) (*Key, error) {
+	if id == "" {
+		return nil, ErrInvalidKeyID
+	}
+	if key.N.BitLen() < MinRSAKeyBits {
+		return nil, fmt.Errorf("%w: RS256 key %q must be at least %d bits", ErrWeakKey, id, MinRSAKeyBits)
+	}
+	return &Key{ID: id, Method: jwt.SigningMethodRS256, private: key, public: &key.PublicKey}, nil
+}
+
+// NewEd25519Key creates an EdDSA key from an Ed25519 private key
+func NewEd25519Key(id string, key ed25519.PrivateKey) (*Key, error) {
+	if id == "" {
+		return nil, ErrInvalidKeyID
+	}
+	return &Key{ID: id, Method: jwt.SigningMethodEdDSA, private: key, public: key.Public()}, nil
+}
+
+// IsRetired reports whether the key has stopped signing at the given time
+func (k *Key) IsRetired(at time.Time) bool {
+	return k.RetiredAt != nil && !at.Before(*k.RetiredAt)
+}
+
+// IsSymmetric reports whether the key is a shared secret that must never be published
+func (k *Key) IsSymmetric() bool {
+	_, ok := k.public.([]byte)
+	return ok
+}
+
+// macSecret derives the key for Keyring.MAC from the private key material. The label keeps
+// MACs from being valid under the key's JWT algorithm, e.g. for an HS256 secret.
+func (k *Key) macSecret() []byte {
+	var material []byte
+	switch private := k.private.(type) {
+	case []byte:
+		material = private
+	case *rsa.PrivateKey:
+		material = x509.MarshalPKCS1PrivateKey(private)
+	case ed25519.PrivateKey:
+		material = private.Seed()
+	}
+
+	h := sha256.New()
+	h.Write([]byte("dotsat.work keyring mac\x00"))
+	h.Write(material)
+	return h.Sum(nil)
+}
@@ -0,0 +1,156 @@
+package keyring
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoSigningKey = errors.New("signing key not found in keyring")
+	ErrDuplicateKey = errors.New("duplicate key id in keyring")
+	ErrUnknownKey   = errors.New("token signed with unknown or expired key")
+)
+
+// Keyring signs JWTs with one key and verifies them with any key that is active
+// or was retired less than the grace period ago, so keys can be rotated without
+// signing everybody out
+type Keyring struct {
+	keys    map[string]*Key
+	signing *Key
+	grace   time.Duration
+	now     func() time.Time
+}
+
+// New builds a keyring that signs with the key identified by signingID
+func New(signingID string, grace time.Duration, keys ...*Key) (*Keyring, error) {
+	k := &Keyring{
+		keys:  make(map[string]*Key, len(keys)),
+		grace: grace,
+		now:   time.Now,
+	}
+
+	for _, key := range keys {
+		if _, ok := k.keys[key.ID]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateKey, key.ID)
+		}
+		k.keys[key.ID] = key
+	}
+
+	signing, ok := k.keys[signingID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNoSigningKey, signingID)
+	}
+	if signing.IsRetired(k.now()) {
+		return nil, fmt.Errorf("signing key %q is retired", signingID)
+	}
+	k.signing = signing
+
+	return k, nil
+}
+
+// SigningKeyID returns the kid new tokens are signed with
+func (k *Keyring) SigningKeyID() string {
+	return k.signing.ID
+}
+
+// Sign signs the claims with the signing key and sets the kid header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	token.Header["kid"] = k.signing.ID
+	return token.SignedString(k.signing.private)
+}
+
+// Parse verifies the token signature with the key named by its kid header and returns the claims
+func (k *Keyring) Parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, k.keyfunc, jwt.WithValidMethods(k.methods()))
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// keyfunc looks up the verification key for a token. The token's alg must match the
+// key's own algorithm so an attacker can't, say, HMAC-sign with a published RSA key.
+func (k *Keyring) keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key := k.verificationKey(kid)
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
+// verificationKey returns the key if it exists and is active or still within the grace period
+func (k *Keyring) verificationKey(kid string) *Key {
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil
+	}
+	if key.RetiredAt != nil && k.now().After(key.RetiredAt.Add(k.grace)) {
+		return nil
+	}
+	return key
+}
+
+// MAC returns an HMAC-SHA256 of message under a secret derived from the signing key,
+// for values that have to be unforgeable without being JWTs, such as CSRF tokens
+func (k *Keyring) MAC(message []byte) []byte {
+	return mac(k.signing, message)
+}
+
+// VerifyMAC reports whether sum is the MAC of message under any key that still verifies
+// tokens, so MACs outlive a key rotation as long as the tokens signed with the old key do
+func (k *Keyring) VerifyMAC(message, sum []byte) bool {
+	for _, key := range k.VerificationKeys() {
+		if hmac.Equal(mac(key, message), sum) {
+			return true
+		}
+	}
+	return false
+}
+
+func mac(key *Key, message []byte) []byte {
+	h := hmac.New(sha256.New, key.macSecret())
+	h.Write(message)
+	return h.Sum(nil)
+}
+
+// VerificationKeys returns every key that currently verifies tokens, sorted by kid
+func (k *Keyring) VerificationKeys() []*Key {
+	var keys []*Key
+	for kid := range k.keys {
+		if key := k.verificationKey(kid); key != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// methods lists the algorithms present in the keyring
+func (k *Keyring) methods() []string {
+	seen := map[string]bool{}
+	var methods []string
+	for _, key := range k.keys {
+		alg := key.Method.Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
@@ -0,0 +1,325 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func mustHMACKey(t *testing.T, id string) *Key {
+	t.Helper()
+
+	key, err := NewHMACKey(id, []byte(strings.Repeat("s", MinHMACSecretLength)))
+	if err != nil {
+		t.Fatalf("NewHMACKey() error = %v", err)
+	}
+	return key
+}
+
+func mustRSAKey(t *testing.T, id string) *Key {
+	t.Helper()
+
+	private, err := rsa.GenerateKey(rand.Reader, MinRSAKeyBits)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	key, err := NewRSAKey(id, private)
+	if err != nil {
+		t.Fatalf("NewRSAKey() error = %v", err)
+	}
+	return key
+}
+
+func mustEd25519Key(t *testing.T, id string) *Key {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	key, err := NewEd25519Key(id, private)
+	if err != nil {
+		t.Fatalf("NewEd25519Key() error = %v", err)
+	}
+	return key
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func TestKeyring_SignAndParse(t *testing.T) {
+	tests := []struct {
+		name string
+		key  func(t *testing.T) *Key
+		alg  string
+	}{
+		{name: "HS256", key: func(t *testing.T) *Key { return mustHMACKey(t, "hmac") }, alg: "HS256"},
+		{name: "RS256", key: func(t *testing.T) *Key { return mustRSAKey(t, "rsa") }, alg: "RS256"},
+		{name: "EdDSA", key: func(t *testing.T) *Key { return mustEd25519Key(t, "ed") }, alg: "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.key(t)
+			ring, err := New(key.ID, time.Hour, key)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			signed, err := ring.Sign(testClaims())
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+
+			token, _, err := jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+			if err != nil {
+				t.Fatalf("failed to decode token: %v", err)
+			}
+			if token.Header["kid"] != key.ID || token.Header["alg"] != tt.alg {
+				t.Errorf("expected kid %q and alg %q, got %v", key.ID, tt.alg, token.Header)
+			}
+
+			claims, err := ring.Parse(signed)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if claims["sub"] != "user-1" {
+				t.Errorf("expected sub claim to round-trip, got %v", claims["sub"])
+			}
+		})
+	}
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	oldKey := mustRSAKey(t, "old")
+	newKey := mustEd25519Key(t, "new")
+
+	oldRing, err := New("old", time.Hour, oldKey)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	oldToken, err := oldRing.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	// Rotate: the new key signs, the old key is retired now
+	retiredAt := time.Now()
+	oldKey.RetiredAt = &retiredAt
+	ring, err := New("new", time.Hour, newKey, oldKey)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if ring.SigningKeyID() != "new" {
+		t.Errorf("expected new key to sign, got %q", ring.SigningKeyID())
+	}
+	if _, err := ring.Parse(oldToken); err != nil {
+		t.Errorf("expected old token to verify during grace period, got %v", err)
+	}
+
+	// After the grace period the old key no longer verifies
+	ring.now = func() time.Time { return retiredAt.Add(2 * time.Hour) }
+	if _, err := ring.Parse(oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey after grace period, got %v", err)
+	}
+	if len(ring.JWKS().Keys) != 1 {
+		t.Errorf("expected only the new key in the JWKS, got %+v", ring.JWKS().Keys)
+	}
+}
+
+func TestKeyring_MAC(t *testing.T) {
+	oldKey := mustHMACKey(t, "old")
+	newKey := mustRSAKey(t, "new")
+
+	oldRing, err := New("old", time.Hour, oldKey)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	sum := oldRing.MAC([]byte("session-1"))
+
+	if !oldRing.VerifyMAC([]byte("session-1"), sum) {
+		t.Error("expected the MAC to verify")
+	}
+	if oldRing.VerifyMAC([]byte("session-2"), sum) {
+		t.Error("expected the MAC not to verify another message")
+	}
+
+	retiredAt := time.Now()
+	oldKey.RetiredAt = &retiredAt
+	ring, err := New("new", time.Hour, newKey, oldKey)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if string(ring.MAC([]byte("session-1"))) == string(sum) {
+		t.Error("expected the new signing key to produce a different MAC")
+	}
+	if !ring.VerifyMAC([]byte("session-1"), sum) {
+		t.Error("expected a MAC from the retired key to verify during the grace period")
+	}
+
+	ring.now = func() time.Time { return retiredAt.Add(2 * time.Hour) }
+	if ring.VerifyMAC([]byte("session-1"), sum) {
+		t.Error("expected a MAC from the retired key to be rejected after the grace period")
+	}
+}
+
+func TestKeyring_Parse_Rejects(t *testing.T) {
+	rsaKey := mustRSAKey(t, "rsa")
+	ring, err := New("rsa", time.Hour, rsaKey)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	otherRing, err := New("other", time.Hour, mustRSAKey(t, "other"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	unknownKid, err := otherRing.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	// HMAC-signed with the published RSA public key under the RSA kid
+	der := x509.MarshalPKCS1PublicKey(rsaKey.public.(*rsa.PublicKey))
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	confused.Header["kid"] = "rsa"
+	algConfusion, err := confused.SignedString(der)
+	if err != nil {
+		t.Fatalf("failed to sign confused token: %v", err)
+	}
+
+	missingKid := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims())
+	noKid, err := missingKid.SignedString(rsaKey.private)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	tests := map[string]string{
+		"unknown kid":   unknownKid,
+		"alg confusion": algConfusion,
+		"missing kid":   noKid,
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ring.Parse(token); err == nil {
+				t.Error("expected token to be rejected")
+			}
+		})
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	retiredAt := time.Now().Add(-time.Minute)
+	retired := mustHMACKey(t, "retired")
+	retired.RetiredAt = &retiredAt
+
+	if _, err := New("missing", time.Hour, mustHMACKey(t, "a")); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("expected ErrNoSigningKey, got %v", err)
+	}
+	if _, err := New("a", time.Hour, mustHMACKey(t, "a"), mustHMACKey(t, "a")); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("expected ErrDuplicateKey, got %v", err)
+	}
+	if _, err := New("retired", time.Hour, retired); err == nil {
+		t.Error("expected retired signing key to be rejected")
+	}
+	if _, err := NewHMACKey("short", []byte("too-short")); !errors.Is(err, ErrWeakKey) {
+		t.Errorf("expected ErrWeakKey, got %v", err)
+	}
+}
+
+func TestKeyring_JWKS(t *testing.T) {
+	ring, err := New("ed", time.Hour, mustEd25519Key(t, "ed"), mustRSAKey(t, "rsa"), mustHMACKey(t, "hmac"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	set := ring.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("expected 2 public keys (HMAC excluded), got %+v", set.Keys)
+	}
+	for _, jwk := range set.Keys {
+		switch jwk.KeyID {
+		case "ed":
+			if jwk.KeyType != "OKP" || jwk.Curve != "Ed25519" || jwk.X == "" {
+				t.Errorf("unexpected Ed25519 JWK: %+v", jwk)
+			}
+		case "rsa":
+			if jwk.KeyType != "RSA" || jwk.N == "" || jwk.E != "AQAB" {
+				t.Errorf("unexpected RSA JWK: %+v", jwk)
+			}
+		default:
+			t.Errorf("unexpected key in JWKS: %+v", jwk)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	if err != nil {
+		t.Fatalf("failed to marshal Ed25519 key: %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "current.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER}))
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, MinRSAKeyBits)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "previous.pem"), pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaPrivate)}))
+	writeFile(t, filepath.Join(dir, "legacy.secret"), []byte(strings.Repeat("x", MinHMACSecretLength)+"\n"))
+
+	writeFile(t, filepath.Join(dir, "keys.json"), []byte(`{
+		"signing_key": "current",
+		"keys": [
+			{"kid": "current", "alg": "EdDSA", "file": "current.pem"},
+			{"kid": "previous", "alg": "RS256", "file": "previous.pem", "retired_at": "2026-01-01T00:00:00Z"},
+			{"kid": "legacy", "alg": "HS256", "file": "legacy.secret"}
+		]
+	}`))
+
+	ring, err := LoadFile(filepath.Join(dir, "keys.json"), 100*365*24*time.Hour)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if ring.SigningKeyID() != "current" {
+		t.Errorf("expected signing key current, got %q", ring.SigningKeyID())
+	}
+	if len(ring.VerificationKeys()) != 3 {
+		t.Errorf("expected 3 verification keys, got %d", len(ring.VerificationKeys()))
+	}
+
+	// A key file whose type doesn't match its declared algorithm is rejected
+	writeFile(t, filepath.Join(dir, "mismatch.json"), []byte(`{
+		"signing_key": "current",
+		"keys": [{"kid": "current", "alg": "RS256", "file": "current.pem"}]
+	}`))
+	if _, err := LoadFile(filepath.Join(dir, "mismatch.json"), time.Hour); !errors.Is(err, ErrAlgorithmType) {
+		t.Errorf("expected ErrAlgorithmType, got %v", err)
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	err := os.WriteFile(path, data, 0o600)
+	if err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
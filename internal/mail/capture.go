@@ -0,0 +1,50 @@
+package mail
+
+import "sync"
+
+// CaptureSender keeps sent messages in memory so tests can inspect them
+type CaptureSender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewCaptureSender() *CaptureSender {
+	return &CaptureSender{}
+}
+
+func (s *CaptureSender) Send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of all captured messages in send order
+func (s *CaptureSender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]Message, len(s.messages))
+	copy(messages, s.messages)
+	return messages
+}
+
+// Last returns the most recently captured message, if any
+func (s *CaptureSender) Last() (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.messages) == 0 {
+		return Message{}, false
+	}
+	return s.messages[len(s.messages)-1], true
+}
+
+// Reset discards all captured messages
+func (s *CaptureSender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = nil
+}
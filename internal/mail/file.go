@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileSender writes every message as an .eml file into an outbox directory.
+// Intended for development: open the files with any mail client to follow links.
+type FileSender struct {
+	dir  string
+	from string
+}
+
+func NewFileSender(dir, from string) *FileSender {
+	return &FileSender{
+		dir:  dir,
+		from: from,
+	}
+}
+
+func (s *FileSender) Send(msg Message) error {
+	err := os.MkdirAll(s.dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	body, err := buildMessage(s.from, msg)
+	if err != nil {
+		return fmt.Errorf("failed to build message: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000"), randomID())
+	path := filepath.Join(s.dir, name)
+
+	// Messages contain live tokens, so keep them private to the current user
+	err = os.WriteFile(path, body, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write message to outbox: %w", err)
+	}
+
+	slog.Info("mail written to outbox", "to", msg.To, "subject", msg.Subject, "path", path)
+	return nil
+}
@@ -0,0 +1,121 @@
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildMessage(t *testing.T) {
+	tests := []struct {
+		name             string
+		msg              Message
+		expectedContains []string
+		notContains      []string
+	}{
+		{
+			name: "plain text",
+			msg:  Message{To: "user@example.com", Subject: "Hello", Text: "plain body"},
+			expectedContains: []string{
+				"From: sender@example.com\r\n",
+				"To: user@example.com\r\n",
+				"Subject: Hello\r\n",
+				"Content-Type: text/plain; charset=utf-8\r\n\r\nplain body",
+			},
+			notContains: []string{"multipart"},
+		},
+		{
+			name: "html alternative",
+			msg:  Message{To: "user@example.com", Subject: "Hello", Text: "plain body", HTML: "<p>html body</p>"},
+			expectedContains: []string{
+				"Content-Type: multipart/alternative; boundary=",
+				"Content-Type: text/plain; charset=utf-8",
+				"Content-Type: text/html; charset=utf-8",
+				"plain body",
+				"<p>html body</p>",
+			},
+		},
+		{
+			name:             "non-ascii subject is encoded",
+			msg:              Message{To: "user@example.com", Subject: "Grüße", Text: "body"},
+			expectedContains: []string{"Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?="},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := buildMessage("sender@example.com", tt.msg)
+			if err != nil {
+				t.Fatalf("buildMessage() error = %v", err)
+			}
+
+			body := string(raw)
+			for _, expected := range tt.expectedContains {
+				if !strings.Contains(body, expected) {
+					t.Errorf("expected message to contain %q, got %q", expected, body)
+				}
+			}
+			for _, unexpected := range tt.notContains {
+				if strings.Contains(body, unexpected) {
+					t.Errorf("expected message not to contain %q, got %q", unexpected, body)
+				}
+			}
+		})
+	}
+}
+
+func TestFileSender_Send(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	sender := NewFileSender(dir, "sender@example.com")
+
+	err := sender.Send(Message{To: "user@example.com", Subject: "Hello", Text: "body with link"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatalf("failed to list outbox: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected 1 message in outbox, got %d", len(files))
+	}
+
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	if !strings.Contains(string(content), "body with link") {
+		t.Errorf("expected message body in outbox file, got %q", content)
+	}
+}
+
+func TestCaptureSender(t *testing.T) {
+	sender := NewCaptureSender()
+
+	if _, ok := sender.Last(); ok {
+		t.Error("expected no messages before sending")
+	}
+
+	for _, to := range []string{"a@example.com", "b@example.com"} {
+		err := sender.Send(Message{To: to})
+		if err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	if got := len(sender.Messages()); got != 2 {
+		t.Errorf("expected 2 messages, got %d", got)
+	}
+
+	last, ok := sender.Last()
+	if !ok || last.To != "b@example.com" {
+		t.Errorf("expected last message to b@example.com, got %+v", last)
+	}
+
+	sender.Reset()
+	if got := len(sender.Messages()); got != 0 {
+		t.Errorf("expected 0 messages after Reset, got %d", got)
+	}
+}
@@ -0,0 +1,160 @@
+package mail
+
+import "fmt"
+
+// MagicLinkMessage builds the sign-in email containing a one-time magic link
+func MagicLinkMessage(to, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "Your dotsat.work sign-in link",
+		Text: fmt.Sprintf(`Hi,
+
+Use the link below to sign in to dotsat.work. It expires in 15 minutes and can only be used once.
+
+%s
+
+If you didn't request this, you can safely ignore this email.
+`, link),
+	}
+}
+
+// PasswordResetMessage builds the email containing a one-time password reset link
+func PasswordResetMessage(to, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "Reset your dotsat.work password",
+		Text: fmt.Sprintf(`Hi,
+
+We received a request to reset the password for your dotsat.work account.
+Use the link below to choose a new password. It expires in 1 hour and can only be used once.
+
+%s
+
+If you didn't request this, you can safely ignore this email. Your password will not change.
+`, link),
+	}
+}
+
+// EmailVerificationMessage builds the email asking a new user to confirm their address
+func EmailVerificationMessage(to, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "Verify your dotsat.work email address",
+		Text: fmt.Sprintf(`Hi,
+
+Please confirm that this is your email address by opening the link below. It expires in 24 hours.
+
+%s
+
+If you didn't create a dotsat.work account, you can safely ignore this email.
+`, link),
+	}
+}
+
+// EmailChangeConfirmMessage builds the email sent to a new address to confirm an email change
+func EmailChangeConfirmMessage(to, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "Confirm your new dotsat.work email address",
+		Text: fmt.Sprintf(`Hi,
+
+You asked to use this address for your dotsat.work account. Open the link below to confirm the change. It expires in 24 hours.
+
+%s
+
+If you didn't request this, you can safely ignore this email.
+`, link),
+	}
+}
+
+// EmailChangeNoticeMessage builds the notice sent to the current address when an email change is requested
+func EmailChangeNoticeMessage(to, newEmail string) Message {
+	return Message{
+		To:      to,
+		Subject: "Your dotsat.work email address is being changed",
+		Text: fmt.Sprintf(`Hi,
+
+Someone requested to change the email address of your dotsat.work account to %s.
+The change takes effect once the new address is confirmed.
+
+If this wasn't you, sign in and cancel the pending change from your account settings, then reset your password.
+`, newEmail),
+	}
+}
+
+// AccountLockedMessage builds the email sent when repeated failed sign-ins lock an account,
+// containing a one-time link that unlocks it
+func AccountLockedMessage(to, link string) Message {
+	return Message{
+		To:      to,
+		Subject: "Your dotsat.work account has been locked",
+		Text: fmt.Sprintf(`Hi,
+
+We temporarily locked your dotsat.work account after several failed sign-in attempts.
+If that was you, open the link below to unlock your account right away. It expires in 1 hour and can only be used once.
+
+%s
+
+If it wasn't you, someone may be guessing your password. The lock lifts on its own after a while;
+consider resetting your password once you are signed in.
+`, link),
+	}
+}
+
+// SSORequiredNoticeMessage tells the account owner that a sign-in without single sign-on was refused
+// because their organization requires it
+func SSORequiredNoticeMessage(to, ssoURL string) Message {
+	return Message{
+		To:      to,
+		Subject: "Sign in to dotsat.work with single sign-on",
+		Text: fmt.Sprintf(`Hi,
+
+Someone tried to sign in to your dotsat.work account with a password or sign-in link.
+Your organization requires single sign-on, so please sign in through your identity provider instead:
+
+%s
+
+If this wasn't you, no action is needed. Your account was not accessed.
+`, ssoURL),
+	}
+}
+
+// PasswordlessNoticeMessage tells the owner of an account without a password that a password
+// sign-in was refused and how to sign in instead
+func PasswordlessNoticeMessage(to, magicLinkURL string) Message {
+	return Message{
+		To:      to,
+		Subject: "Sign in to dotsat.work without a password",
+		Text: fmt.Sprintf(`Hi,
+
+Someone tried to sign in to your dotsat.work account with a password, but your account doesn't have one.
+Request a one-time sign-in link instead:
+
+%s
+
+If this wasn't you, no action is needed. Your account was not accessed.
+`, magicLinkURL),
+	}
+}
+
+// AccountExistsNoticeMessage tells the owner of an account that someone tried to sign up with
+// their email address, and how to get back into the existing account
+func AccountExistsNoticeMessage(to, signInURL, resetURL string) Message {
+	return Message{
+		To:      to,
+		Subject: "You already have a dotsat.work account",
+		Text: fmt.Sprintf(`Hi,
+
+Someone tried to create a new dotsat.work organization with this email address, which already
+has an account. Sign in here:
+
+%s
+
+Forgot your password? Reset it here:
+
+%s
+
+If this wasn't you, no action is needed. Your account was not changed.
+`, signInURL, resetURL),
+	}
+}
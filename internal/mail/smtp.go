@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+)
+
+// SMTPSender delivers messages through an SMTP server
+type SMTPSender struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPSender(host, port, username, password, from string) *SMTPSender {
+	return &SMTPSender{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	body, err := buildMessage(s.from, msg)
+	if err != nil {
+		return fmt.Errorf("failed to build message: %w", err)
+	}
+
+	// Authenticate only when credentials are configured (e.g. local relays don't need it)
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	err = smtp.SendMail(net.JoinHostPort(s.host, s.port), auth, s.from, []string{msg.To}, body)
+	if err != nil {
+		return fmt.Errorf("failed to send mail via smtp: %w", err)
+	}
+
+	return nil
+}
@@ -1,86 +1,289 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strings"
 
 	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/model"
 	"dotsat.work/internal/service"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-// AuthMiddleware checks for JWT token and adds user + profile + tenant to context if valid
-func AuthMiddleware(authService *service.AuthService, userService *service.UserService, profileService *service.ProfileService, tenantService *service.TenantService) func(http.Handler) http.Handler {
+// AuthMiddleware checks for JWT token and adds user + profile + tenant to context if valid.
+// Access tokens that are missing, expired or close to expiry are renewed with the refresh cookie.
+// API clients authenticate with a personal access token or a tenant API key in the Authorization
+// header instead; cookies are ignored for those requests and an invalid token is answered with 401.
+// Platform staff with a running impersonation act as the impersonated user, with themselves
+// added to the context as the impersonator. Rejected bearer tokens are recorded in the
+// security event log, a limited number per client IP.
+func AuthMiddleware(
+	authService *service.AuthService,
+	personalAccessTokenService *service.PersonalAccessTokenService,
+	apiKeyService *service.APIKeyService,
+	impersonationService *service.ImpersonationService,
+	userService *service.UserService,
+	profileService *service.ProfileService,
+	tenantService *service.TenantService,
+	securityEventService *service.SecurityEventService,
+) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get JWT from a cookie
-			cookie, err := r.Cookie("auth_token")
-			if err != nil {
-				// No cookie, continue without auth
-				next.ServeHTTP(w, r)
-				return
-			}
+			if secret, ok := bearerToken(r); ok {
+				var ctx context.Context
+				var err error
+				if strings.HasPrefix(secret, service.APIKeyPrefix) {
+					ctx, err = withAPIKey(r.Context(), secret, apiKeyService, tenantService)
+				} else {
+					ctx, err = withPersonalAccessToken(r.Context(), secret, personalAccessTokenService, userService, profileService, tenantService)
+				}
+				if err != nil {
+					if errors.Is(err, service.ErrInvalidAccessToken) || errors.Is(err, service.ErrInvalidAPIKey) {
+						securityEventService.AnonymousFailure(model.SecurityEventBearerTokenRejected, "", ClientInfo(r), model.SecurityReasonInvalidToken)
+					} else {
+						slog.Warn("failed to authenticate bearer token", "error", err)
+					}
+					unauthorized(w)
+					return
+				}
 
-			// Verify token
-			claims, err := authService.VerifyJWT(cookie.Value)
-			if err != nil {
-				// Invalid token, clear the cookie and continue
-				authService.ClearJWTCookie(w)
-				next.ServeHTTP(w, r)
+				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
 
-			// Get user ID from claims
-			userIDStr, ok := claims["user_id"].(string)
+			claims, ok := authenticate(w, r, authService)
 			if !ok {
-				authService.ClearJWTCookie(w)
+				// No valid session, continue without auth
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			userID, err := uuid.Parse(userIDStr)
+			// Reject revoked, expired or unknown sessions
+			session, err := authService.ValidateSession(claims)
 			if err != nil {
-				authService.ClearJWTCookie(w)
+				authService.ClearSessionCookies(w)
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			// Fetch user from the database
-			user, err := userService.ByID(userID)
+			// Record where the session is used from for the active sessions page
+			err = authService.TouchSession(session, r.UserAgent(), ClientIP(r))
 			if err != nil {
-				authService.ClearJWTCookie(w)
+				slog.Warn("failed to touch session", "error", err, "session_id", session.ID)
+			}
+
+			// Get user ID from claims
+			userIDStr, ok := claims["user_id"].(string)
+			if !ok {
+				authService.ClearSessionCookies(w)
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			// Security: Remove password hash from context
-			user.PasswordHash = nil
-
-			// Fetch profile
-			profile, err := profileService.ByUserID(userID)
+			userID, err := uuid.Parse(userIDStr)
 			if err != nil {
-				// Profile not found - this shouldn't happen but handle gracefully
-				authService.ClearJWTCookie(w)
+				authService.ClearSessionCookies(w)
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			// Fetch tenant
-			tenant, err := tenantService.ByID(user.TenantID)
+			ctx, err := withIdentity(r.Context(), userID, userService, profileService, tenantService)
 			if err != nil {
-				authService.ClearJWTCookie(w)
+				authService.ClearSessionCookies(w)
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			// Add user + profile + tenant to context
-			ctx := ctxkeys.WithUser(r.Context(), user)
-			ctx = ctxkeys.WithProfile(ctx, profile)
-			ctx = ctxkeys.WithTenant(ctx, tenant)
+			if cookie, err := r.Cookie(service.ImpersonationCookie); err == nil {
+				ctx = withImpersonation(ctx, w, cookie.Value, impersonationService, userService, profileService, tenantService)
+			}
+
+			ctx = ctxkeys.WithSession(ctx, session)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// withPersonalAccessToken authenticates a personal access token and adds its user to ctx
+func withPersonalAccessToken(
+	ctx context.Context,
+	secret string,
+	personalAccessTokenService *service.PersonalAccessTokenService,
+	userService *service.UserService,
+	profileService *service.ProfileService,
+	tenantService *service.TenantService,
+) (context.Context, error) {
+	token, err := personalAccessTokenService.Authenticate(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err = withIdentity(ctx, token.UserID, userService, profileService, tenantService)
+	if err != nil {
+		return nil, err
+	}
+	return ctxkeys.WithPersonalAccessToken(ctx, token), nil
+}
+
+// withAPIKey authenticates a tenant API key and adds the key and its tenant to ctx.
+// There is no user: the key belongs to the tenant, not to whoever created it.
+func withAPIKey(ctx context.Context, secret string, apiKeyService *service.APIKeyService, tenantService *service.TenantService) (context.Context, error) {
+	key, err := apiKeyService.Authenticate(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	tenant, err := tenantService.ByID(key.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !tenant.IsActive() {
+		return nil, service.ErrInvalidAPIKey
+	}
+
+	ctx = ctxkeys.WithTenant(ctx, tenant)
+	return ctxkeys.WithAPIKey(ctx, key), nil
+}
+
+// withImpersonation swaps the signed-in staff member in ctx for the user they are impersonating.
+// The staff member's session stays in ctx, so signing out ends both. An impersonation that is
+// invalid, expired or stopped is cleared and the staff member continues as themselves.
+func withImpersonation(
+	ctx context.Context,
+	w http.ResponseWriter,
+	token string,
+	impersonationService *service.ImpersonationService,
+	userService *service.UserService,
+	profileService *service.ProfileService,
+	tenantService *service.TenantService,
+) context.Context {
+	staff := ctxkeys.User(ctx)
+	if !staff.PlatformStaff {
+		impersonationService.ClearCookie(w)
+		return ctx
+	}
+
+	impersonation, err := impersonationService.Validate(token, staff.ID)
+	if err != nil {
+		if !errors.Is(err, service.ErrInvalidImpersonation) {
+			slog.Warn("failed to validate impersonation", "error", err, "user_id", staff.ID)
+		}
+		impersonationService.ClearCookie(w)
+		return ctx
+	}
+
+	impersonated, err := withIdentity(ctx, *impersonation.TargetUserID, userService, profileService, tenantService)
+	if err != nil {
+		slog.Warn("failed to load impersonated user", "error", err, "impersonation_id", impersonation.ID)
+		impersonationService.ClearCookie(w)
+		return ctx
+	}
+	return ctxkeys.WithImpersonator(impersonated, staff)
+}
+
+// withIdentity loads the user with their profile and tenant and adds them to ctx
+func withIdentity(
+	ctx context.Context,
+	userID uuid.UUID,
+	userService *service.UserService,
+	profileService *service.ProfileService,
+	tenantService *service.TenantService,
+) (context.Context, error) {
+	// Fetch user from the database
+	user, err := userService.ByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Security: Remove password hash from context
+	user.PasswordHash = nil
+
+	// Fetch profile; a missing profile shouldn't happen but is handled gracefully
+	profile, err := profileService.ByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch tenant
+	tenant, err := tenantService.ByID(user.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = ctxkeys.WithUser(ctx, user)
+	ctx = ctxkeys.WithProfile(ctx, profile)
+	ctx = ctxkeys.WithTenant(ctx, tenant)
+	return ctx, nil
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// unauthorized rejects an API request whose bearer token could not be authenticated
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+// authenticate returns the claims of a valid access token, refreshing it first when it is
+// missing, expired or about to expire and a refresh cookie is present
+func authenticate(w http.ResponseWriter, r *http.Request, authService *service.AuthService) (jwt.MapClaims, bool) {
+	var claims jwt.MapClaims
+	if cookie, err := r.Cookie(service.AccessTokenCookie); err == nil {
+		claims, _ = authService.VerifyJWT(cookie.Value)
+	}
+	if claims != nil && !authService.NeedsRefresh(claims) {
+		return claims, true
+	}
+
+	refresh, err := r.Cookie(service.RefreshTokenCookie)
+	if err != nil {
+		if claims == nil {
+			// A stale access cookie without a refresh cookie can't be renewed
+			if _, err := r.Cookie(service.AccessTokenCookie); err == nil {
+				authService.ClearSessionCookies(w)
+			}
+			return nil, false
+		}
+		return claims, true
+	}
+
+	tokens, err := authService.RefreshSession(refresh.Value, ClientInfo(r))
+	if err != nil {
+		if claims != nil {
+			// Still valid for a little while; a concurrent request may have refreshed already
+			return claims, true
+		}
+		if errors.Is(err, service.ErrRefreshTokenRotated) {
+			// Keep the cookies; the concurrent response carries the new ones
+			return nil, false
+		}
+		if !errors.Is(err, service.ErrInvalidToken) {
+			slog.Warn("failed to refresh session", "error", err)
+		}
+		authService.ClearSessionCookies(w)
+		return nil, false
+	}
+
+	authService.SetSessionCookies(w, tokens)
+	claims, err = authService.VerifyJWT(tokens.AccessToken)
+	if err != nil {
+		return nil, false
+	}
+	return claims, true
+}
+
 // RequireAuth ensures the user is authenticated
 func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -98,9 +301,8 @@ func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		// Check if user has completed onboarding
-		// Uses profile.Name as indicator (empty = incomplete onboarding)
 		profile := ctxkeys.Profile(r.Context())
-		if profile != nil && profile.Name == "" && r.URL.Path != "/auth/onboarding" {
+		if profile != nil && !profile.IsOnboarded() && !strings.HasPrefix(r.URL.Path, "/auth/onboarding") {
 			// User hasn't completed onboarding, redirect to onboarding
 			if r.Header.Get("HX-Request") == "true" {
 				w.Header().Set("HX-Redirect", "/auth/onboarding")
@@ -133,3 +335,76 @@ func RequireGuest(next http.HandlerFunc) http.HandlerFunc {
 		next.ServeHTTP(w, r)
 	}
 }
+
+// RequireSession ensures the request comes from a signed-in browser rather than an API client.
+// It guards account security settings so a leaked access token can't take over the account.
+func RequireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ctxkeys.Session(r.Context()) == nil {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// BlockImpersonation guards security-sensitive actions, such as changing the email address or
+// creating tokens, that support staff must not take on a user's behalf
+func BlockImpersonation(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ctxkeys.Impersonator(r.Context()) != nil {
+			http.Error(w, "not available while impersonating a user", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// RequireStaff ensures the user is platform staff signed in as themselves
+func RequireStaff(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user := ctxkeys.User(ctx)
+		if user == nil || !user.PlatformStaff || ctxkeys.Impersonator(ctx) != nil {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// RequireScope guards API endpoints. Requests made with a tenant API key need the scope;
+// signed-in users and personal access tokens act as the user and are subject to role checks instead.
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if key := ctxkeys.APIKey(ctx); key != nil {
+			if !key.HasScope(scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ctxkeys.User(ctx) == nil {
+			unauthorized(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// RequireAdmin ensures the user is an admin of their tenant. It runs inside RequireAuth,
+// so a missing user is not expected; everyone else gets a 403.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := ctxkeys.User(r.Context())
+		if user == nil || !user.IsAdmin() {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
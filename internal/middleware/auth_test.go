@@ -0,0 +1,297 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/model"
+)
+
+func TestRequireAuth(t *testing.T) {
+	onboardedAt := time.Now()
+
+	tests := []struct {
+		name             string
+		path             string
+		user             *model.User
+		profile          *model.Profile
+		htmx             bool
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{
+			name:             "guest is redirected to sign in",
+			path:             "/app/dashboard",
+			expectedStatus:   http.StatusSeeOther,
+			expectedLocation: "/auth",
+		},
+		{
+			name:             "guest htmx request uses HX-Redirect",
+			path:             "/app/dashboard",
+			htmx:             true,
+			expectedStatus:   http.StatusSeeOther,
+			expectedLocation: "/auth",
+		},
+		{
+			name:           "onboarded user passes",
+			path:           "/app/dashboard",
+			user:           &model.User{ID: uuid.New()},
+			profile:        &model.Profile{Name: "Ada", OnboardedAt: &onboardedAt},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:             "user without completed onboarding is sent to onboarding",
+			path:             "/app/dashboard",
+			user:             &model.User{ID: uuid.New()},
+			profile:          &model.Profile{Name: "Ada"},
+			expectedStatus:   http.StatusSeeOther,
+			expectedLocation: "/auth/onboarding",
+		},
+		{
+			name:           "onboarding steps are reachable before completion",
+			path:           "/auth/onboarding/details",
+			user:           &model.User{ID: uuid.New()},
+			profile:        &model.Profile{},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.htmx {
+				req.Header.Set("HX-Request", "true")
+			}
+			ctx := req.Context()
+			if tt.user != nil {
+				ctx = ctxkeys.WithUser(ctx, tt.user)
+			}
+			if tt.profile != nil {
+				ctx = ctxkeys.WithProfile(ctx, tt.profile)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req.WithContext(ctx))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+
+			location := rec.Header().Get("Location")
+			if tt.htmx {
+				location = rec.Header().Get("HX-Redirect")
+			}
+			if location != tt.expectedLocation {
+				t.Errorf("expected redirect to %q, got %q", tt.expectedLocation, location)
+			}
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name           string
+		user           *model.User
+		expectedStatus int
+	}{
+		{name: "admin passes", user: &model.User{ID: uuid.New(), Role: "admin"}, expectedStatus: http.StatusOK},
+		{name: "user is forbidden", user: &model.User{ID: uuid.New(), Role: "user"}, expectedStatus: http.StatusForbidden},
+		{name: "viewer is forbidden", user: &model.User{ID: uuid.New(), Role: "viewer"}, expectedStatus: http.StatusForbidden},
+		{name: "guest is forbidden", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/app/organization/sso", nil)
+			if tt.user != nil {
+				req = req.WithContext(ctxkeys.WithUser(req.Context(), tt.user))
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	tests := []struct {
+		name           string
+		session        *model.Session
+		token          *model.PersonalAccessToken
+		expectedStatus int
+	}{
+		{name: "browser session passes", session: &model.Session{ID: uuid.New()}, expectedStatus: http.StatusOK},
+		{name: "access token is forbidden", token: &model.PersonalAccessToken{ID: uuid.New()}, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireSession(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/app/account/tokens", nil)
+			ctx := ctxkeys.WithUser(req.Context(), &model.User{ID: uuid.New(), Role: "user"})
+			if tt.session != nil {
+				ctx = ctxkeys.WithSession(ctx, tt.session)
+			}
+			if tt.token != nil {
+				ctx = ctxkeys.WithPersonalAccessToken(ctx, tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req.WithContext(ctx))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestBlockImpersonation(t *testing.T) {
+	tests := []struct {
+		name           string
+		impersonator   *model.User
+		expectedStatus int
+	}{
+		{name: "user passes", expectedStatus: http.StatusOK},
+		{name: "impersonation is forbidden", impersonator: &model.User{ID: uuid.New(), PlatformStaff: true}, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := BlockImpersonation(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/app/account/email", nil)
+			ctx := ctxkeys.WithUser(req.Context(), &model.User{ID: uuid.New(), Role: "user"})
+			if tt.impersonator != nil {
+				ctx = ctxkeys.WithImpersonator(ctx, tt.impersonator)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req.WithContext(ctx))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestRequireStaff(t *testing.T) {
+	staff := &model.User{ID: uuid.New(), Role: "user", PlatformStaff: true}
+
+	tests := []struct {
+		name           string
+		user           *model.User
+		impersonator   *model.User
+		expectedStatus int
+	}{
+		{name: "staff passes", user: staff, expectedStatus: http.StatusOK},
+		{name: "admin is forbidden", user: &model.User{ID: uuid.New(), Role: "admin"}, expectedStatus: http.StatusForbidden},
+		{name: "staff impersonating a user is forbidden", user: &model.User{ID: uuid.New(), Role: "admin"}, impersonator: staff, expectedStatus: http.StatusForbidden},
+		{name: "guest is forbidden", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireStaff(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/app/staff/impersonate", nil)
+			ctx := req.Context()
+			if tt.user != nil {
+				ctx = ctxkeys.WithUser(ctx, tt.user)
+			}
+			if tt.impersonator != nil {
+				ctx = ctxkeys.WithImpersonator(ctx, tt.impersonator)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req.WithContext(ctx))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+		ok       bool
+	}{
+		{header: "Bearer dsat_pat_abc", expected: "dsat_pat_abc", ok: true},
+		{header: "bearer dsat_pat_abc", expected: "dsat_pat_abc", ok: true},
+		{header: "Bearer ", ok: false},
+		{header: "Basic dXNlcjpwYXNz", ok: false},
+		{header: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		got, ok := bearerToken(req)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("bearerToken(%q) = %q, %v, want %q, %v", tt.header, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	tests := []struct {
+		name           string
+		key            *model.APIKey
+		user           *model.User
+		expectedStatus int
+	}{
+		{name: "key with scope passes", key: &model.APIKey{Scopes: "users:read,deals:read"}, expectedStatus: http.StatusOK},
+		{name: "key without scope is forbidden", key: &model.APIKey{Scopes: "deals:read"}, expectedStatus: http.StatusForbidden},
+		{name: "user passes", user: &model.User{ID: uuid.New(), Role: "user"}, expectedStatus: http.StatusOK},
+		{name: "anonymous is unauthorized", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireScope(model.APIScopeUsersRead, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+			ctx := req.Context()
+			if tt.key != nil {
+				ctx = ctxkeys.WithAPIKey(ctx, tt.key)
+			}
+			if tt.user != nil {
+				ctx = ctxkeys.WithUser(ctx, tt.user)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req.WithContext(ctx))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
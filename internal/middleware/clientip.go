@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"dotsat.work/internal/model"
+)
+
+// RealIP replaces r.RemoteAddr with the client address from X-Forwarded-For.
+// Only enable it behind a reverse proxy that sets the header, otherwise clients can spoof it.
+func RealIP(trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !trustProxy {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The proxy appends the address it saw, so the last entry is the one it vouches for
+			forwarded := r.Header.Get("X-Forwarded-For")
+			if forwarded != "" {
+				parts := strings.Split(forwarded, ",")
+				ip := strings.TrimSpace(parts[len(parts)-1])
+				if net.ParseIP(ip) != nil {
+					r.RemoteAddr = net.JoinHostPort(ip, "0")
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the IP address of the client without the port
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientInfo returns the client's IP address and user agent for the security event log
+func ClientInfo(r *http.Request) model.ClientInfo {
+	return model.ClientInfo{
+		IPAddress: ClientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
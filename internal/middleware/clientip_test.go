@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		forwarded  string
+		expectedIP string
+	}{
+		{
+			name:       "proxy headers ignored by default",
+			forwarded:  "203.0.113.7",
+			expectedIP: "192.0.2.1",
+		},
+		{
+			name:       "trusted proxy sets client ip",
+			trustProxy: true,
+			forwarded:  "203.0.113.7",
+			expectedIP: "203.0.113.7",
+		},
+		{
+			name:       "last hop wins over spoofed entries",
+			trustProxy: true,
+			forwarded:  "10.0.0.1, 203.0.113.7",
+			expectedIP: "203.0.113.7",
+		},
+		{
+			name:       "invalid header is ignored",
+			trustProxy: true,
+			forwarded:  "not-an-ip",
+			expectedIP: "192.0.2.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RealIP(tt.trustProxy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.expectedIP {
+				t.Errorf("expected client IP %q, got %q", tt.expectedIP, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"dotsat.work/internal/csrf"
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/keyring"
+)
+
+const (
+	// CSRFCookie holds the CSRF token of a browser that isn't signed in
+	CSRFCookie = "csrf_token"
+
+	csrfTokenBytes = 32
+	// Form bodies are parsed here, before handlers get to apply their own limits
+	csrfMaxFormBytes = 1 << 20
+)
+
+// CSRF adds the request's CSRF token to the context for templates. Requests with unsafe methods
+// must echo the token in the X-CSRF-Token header or the csrf_token form field.
+//
+// A signed-in session's token is derived from the session with the keyring (see csrf.SessionToken),
+// so a cookie planted by a sibling subdomain can't stand in for it. Browsers that aren't signed in
+// are issued a random token in an HTTP-only cookie instead, which protects the sign-in and signup
+// forms. This has to run after AuthMiddleware, which adds the session to the context.
+//
+// Paths starting with one of exemptPrefixes are not checked, for endpoints that receive cross-site
+// posts by design such as SAML assertion consumers. Neither are requests with a bearer token:
+// browsers never attach one on their own, and AuthMiddleware ignores cookies when one is present.
+func CSRF(keys *keyring.Keyring, secure bool, exemptPrefixes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := ctxkeys.Session(r.Context())
+
+			token := ""
+			if session != nil {
+				token = csrf.SessionToken(keys, session.ID)
+			} else if cookie, err := r.Cookie(CSRFCookie); err == nil && validCSRFToken(cookie.Value) {
+				token = cookie.Value
+			}
+
+			_, hasBearer := bearerToken(r)
+			if !isSafeMethod(r.Method) && !hasBearer && !hasAnyPrefix(r.URL.Path, exemptPrefixes) {
+				submitted := submittedCSRFToken(w, r)
+				var valid bool
+				if session != nil {
+					// Tokens from a retired signing key still verify during its grace period
+					valid = csrf.ValidSessionToken(keys, session.ID, submitted)
+				} else {
+					valid = token != "" && csrfTokensEqual(token, submitted)
+				}
+				if !valid {
+					http.Error(w, "invalid CSRF token", http.StatusForbidden)
+					return
+				}
+			}
+
+			if token == "" {
+				var err error
+				token, err = newCSRFToken()
+				if err != nil {
+					http.Error(w, "internal server error", http.StatusInternalServerError)
+					return
+				}
+				http.SetCookie(w, &http.Cookie{
+					Name:     CSRFCookie,
+					Value:    token,
+					Path:     "/",
+					HttpOnly: true,
+					Secure:   secure,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+
+			ctx := ctxkeys.WithCSRFToken(r.Context(), token)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClearCSRFCookie discards the browser's signed-out CSRF token so the next request is issued a
+// fresh one. Call it when the user signs in or out, so a token from before can't be reused.
+func ClearCSRFCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// submittedCSRFToken returns the token sent with the request, preferring the header
+func submittedCSRFToken(w http.ResponseWriter, r *http.Request) string {
+	if token := r.Header.Get(csrf.Header); token != "" {
+		return token
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, csrfMaxFormBytes)
+	return r.PostFormValue(csrf.FormField)
+}
+
+func csrfTokensEqual(expected, actual string) bool {
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
+
+func newCSRFToken() (string, error) {
+	bytes := make([]byte, csrfTokenBytes)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// validCSRFToken reports whether value looks like a token issued by newCSRFToken
+func validCSRFToken(value string) bool {
+	if len(value) != 2*csrfTokenBytes {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func hasAnyPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
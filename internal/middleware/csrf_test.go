@@ -0,0 +1,232 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/csrf"
+	"dotsat.work/internal/ctxkeys"
+	"dotsat.work/internal/keyring"
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+const testCSRFToken = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// testKeys returns a single-key keyring for deriving session CSRF tokens
+func testKeys(t *testing.T) *keyring.Keyring {
+	t.Helper()
+
+	key, err := keyring.NewHMACKey("test", []byte("test-secret-that-is-at-least-32-bytes"))
+	if err != nil {
+		t.Fatalf("NewHMACKey() error = %v", err)
+	}
+	keys, err := keyring.New(key.ID, time.Hour, key)
+	if err != nil {
+		t.Fatalf("keyring.New() error = %v", err)
+	}
+	return keys
+}
+
+func TestCSRF_IssuesToken(t *testing.T) {
+	var got string
+	handler := CSRF(testKeys(t), false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ctxkeys.CSRFToken(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == CSRFCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("expected a CSRF cookie to be set")
+	}
+	if !cookie.HttpOnly {
+		t.Error("expected the CSRF cookie to be HTTP-only")
+	}
+	if got == "" || got != cookie.Value {
+		t.Errorf("expected context token %q to match cookie %q", got, cookie.Value)
+	}
+}
+
+func TestCSRF_KeepsExistingToken(t *testing.T) {
+	var got string
+	handler := CSRF(testKeys(t), false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ctxkeys.CSRFToken(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: testCSRFToken})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got != testCSRFToken {
+		t.Errorf("expected context token %q, got %q", testCSRFToken, got)
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Error("expected no new cookie when the request already has a token")
+	}
+}
+
+func TestCSRF_UnsafeMethods(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		cookie         string
+		header         string
+		formToken      string
+		bearer         string
+		expectedStatus int
+	}{
+		{
+			name:           "safe method needs no token",
+			method:         http.MethodGet,
+			path:           "/app/account",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing token",
+			method:         http.MethodPost,
+			path:           "/app/account",
+			cookie:         testCSRFToken,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "missing cookie",
+			method:         http.MethodPost,
+			path:           "/app/account",
+			formToken:      testCSRFToken,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "mismatched token",
+			method:         http.MethodPost,
+			path:           "/app/account",
+			cookie:         testCSRFToken,
+			header:         strings.Repeat("f", 64),
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "header token",
+			method:         http.MethodDelete,
+			path:           "/app/account",
+			cookie:         testCSRFToken,
+			header:         testCSRFToken,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "form field token",
+			method:         http.MethodPost,
+			path:           "/app/account",
+			cookie:         testCSRFToken,
+			formToken:      testCSRFToken,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "bearer token requests are exempt",
+			method:         http.MethodPost,
+			path:           "/app/account",
+			bearer:         "dsat_pat_abc",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "exempt path",
+			method:         http.MethodPost,
+			path:           "/auth/sso/saml/acme/acs",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CSRF(testKeys(t), false, "/auth/sso/saml/")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			form := url.Values{}
+			if tt.formToken != "" {
+				form.Set(csrf.FormField, tt.formToken)
+			}
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(csrf.Header, tt.header)
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestCSRF_SessionToken(t *testing.T) {
+	keys := testKeys(t)
+	session := &model.Session{ID: uuid.New()}
+	sessionToken := csrf.SessionToken(keys, session.ID)
+
+	tests := []struct {
+		name           string
+		method         string
+		cookie         string
+		header         string
+		expectedStatus int
+	}{
+		{"issues the session's token", http.MethodGet, "", "", http.StatusOK},
+		{"session token", http.MethodPost, "", sessionToken, http.StatusOK},
+		{"planted cookie and matching header", http.MethodPost, testCSRFToken, testCSRFToken, http.StatusForbidden},
+		{"another session's token", http.MethodPost, "", csrf.SessionToken(keys, uuid.New()), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := CSRF(keys, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ctxkeys.CSRFToken(r.Context())
+			}))
+
+			req := httptest.NewRequest(tt.method, "/app/account", nil)
+			req = req.WithContext(ctxkeys.WithSession(req.Context(), session))
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(csrf.Header, tt.header)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedStatus == http.StatusOK {
+				if got != sessionToken {
+					t.Errorf("expected the session's token in the context, got %q", got)
+				}
+				if len(rec.Result().Cookies()) != 0 {
+					t.Error("expected no CSRF cookie for a signed-in session")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// API key scopes
+const (
+	APIScopeUsersRead   = "users:read"
+	APIScopeUsersManage = "users:manage"
+	APIScopeDealsRead   = "deals:read"
+	APIScopeDealsManage = "deals:manage"
+)
+
+// APIScope describes a permission an API key can be granted
+type APIScope struct {
+	Name        string
+	Description string
+}
+
+// APIScopes are the scopes admins can grant, in the order they are listed
+var APIScopes = []APIScope{
+	{Name: APIScopeUsersRead, Description: "Read users"},
+	{Name: APIScopeUsersManage, Description: "Manage users"},
+	{Name: APIScopeDealsRead, Description: "Read deals"},
+	{Name: APIScopeDealsManage, Description: "Manage deals"},
+}
+
+// APIKey is a machine credential owned by a tenant, so integrations keep working when
+// the person who created it leaves. The key itself is shown once; only its hash is stored.
+type APIKey struct {
+	ID         uuid.UUID  `db:"id"`
+	TenantID   uuid.UUID  `db:"tenant_id"`
+	Name       string     `db:"name"`
+	KeyPrefix  string     `db:"key_prefix"`
+	KeyHash    string     `db:"key_hash"`
+	Scopes     string     `db:"scopes"` // comma separated
+	CreatedBy  *uuid.UUID `db:"created_by"`
+	ExpiresAt  *time.Time `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+// ScopeList returns the scopes granted to the key
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// HasScope returns true if the key was granted scope
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.ScopeList(), scope)
+}
+
+// IsRotated returns true if the key was replaced and only works until ExpiresAt
+func (k *APIKey) IsRotated() bool {
+	return k.ExpiresAt != nil
+}
+
+// IsActive returns true if the key is neither expired nor revoked
+func (k *APIKey) IsActive() bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt)
+}
+
+// IsValidAPIScope returns true if scope is one admins can grant
+func IsValidAPIScope(scope string) bool {
+	return slices.ContainsFunc(APIScopes, func(s APIScope) bool { return s.Name == scope })
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Impersonation records a platform staff member signing in as another user for support
+type Impersonation struct {
+	ID                uuid.UUID  `db:"id"`
+	ImpersonatorID    *uuid.UUID `db:"impersonator_id"`
+	ImpersonatorEmail string     `db:"impersonator_email"`
+	TargetUserID      *uuid.UUID `db:"target_user_id"`
+	TargetEmail       string     `db:"target_email"`
+	TargetTenantID    *uuid.UUID `db:"target_tenant_id"`
+	Reason            string     `db:"reason"`
+	IPAddress         string     `db:"ip_address"`
+	StartedAt         time.Time  `db:"started_at"`
+	ExpiresAt         time.Time  `db:"expires_at"`
+	EndedAt           *time.Time `db:"ended_at"`
+}
+
+// IsActive returns true if the impersonation was neither stopped nor has expired
+func (i *Impersonation) IsActive() bool {
+	return i.EndedAt == nil && time.Now().Before(i.ExpiresAt)
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OIDCConfig is a tenant's OpenID Connect identity provider
+type OIDCConfig struct {
+	TenantID     uuid.UUID `db:"tenant_id"`
+	Issuer       string    `db:"issuer"`
+	ClientID     string    `db:"client_id"`
+	ClientSecret string    `db:"client_secret"`
+	SSOAccess
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// OIDCLoginState holds the PKCE verifier and nonce of a sign-in redirected to the IdP
+type OIDCLoginState struct {
+	ID           uuid.UUID `db:"id"`
+	StateHash    string    `db:"state_hash"`
+	TenantID     uuid.UUID `db:"tenant_id"`
+	CodeVerifier string    `db:"code_verifier"`
+	Nonce        string    `db:"nonce"`
+	ExpiresAt    time.Time `db:"expires_at"`
+	CreatedAt    time.Time `db:"created_at"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TenantPasswordPolicy tightens the global password policy for a tenant's users. Zero
+// values leave the global rule in place.
+type TenantPasswordPolicy struct {
+	TenantID    uuid.UUID `db:"tenant_id"`
+	MinLength   int       `db:"min_length"`
+	MaxLength   int       `db:"max_length"`
+	MinScore    int       `db:"min_score"`
+	HistorySize int       `db:"history_size"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+// PasswordHistoryEntry is the hash of a password a user has replaced
+type PasswordHistoryEntry struct {
+	ID           uuid.UUID `db:"id"`
+	UserID       uuid.UUID `db:"user_id"`
+	PasswordHash string    `db:"password_hash"`
+	CreatedAt    time.Time `db:"created_at"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken is a one-time-use credential that renews a session's access JWT.
+// Only the hash of the token is stored.
+type RefreshToken struct {
+	ID        uuid.UUID  `db:"id"`
+	SessionID uuid.UUID  `db:"session_id"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+// IsUsed returns true if the refresh token has already been exchanged
+func (t *RefreshToken) IsUsed() bool {
+	return t.UsedAt != nil
+}
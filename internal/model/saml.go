@@ -0,0 +1,63 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SAMLConfig is a tenant's SAML 2.0 identity provider
+type SAMLConfig struct {
+	TenantID uuid.UUID `db:"tenant_id"`
+	// IdPMetadata is the metadata XML uploaded by a tenant admin
+	IdPMetadata string `db:"idp_metadata"`
+	IdPEntityID string `db:"idp_entity_id"`
+	// RoleAttribute is the assertion attribute whose values RoleMapping maps to roles
+	RoleAttribute string `db:"role_attribute"`
+	// RoleMapping has one "value = role" pair per line
+	RoleMapping string `db:"role_mapping"`
+	SSOAccess
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// roleRank orders roles by privilege for picking the highest mapped one
+var roleRank = map[string]int{"viewer": 1, "user": 2, "admin": 3}
+
+// RoleMappings returns the attribute value to role pairs of RoleMapping
+func (c *SAMLConfig) RoleMappings() map[string]string {
+	mappings := map[string]string{}
+	for _, line := range strings.Split(c.RoleMapping, "\n") {
+		value, role, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		mappings[strings.TrimSpace(value)] = strings.TrimSpace(role)
+	}
+	return mappings
+}
+
+// MappedRole returns the most privileged role mapped from the given attribute values,
+// or "" when none of them is mapped
+func (c *SAMLConfig) MappedRole(values []string) string {
+	mappings := c.RoleMappings()
+	var mapped string
+	for _, value := range values {
+		role, ok := mappings[strings.TrimSpace(value)]
+		if ok && roleRank[role] > roleRank[mapped] {
+			mapped = role
+		}
+	}
+	return mapped
+}
+
+// SAMLLoginState ties the RelayState of a sign-in redirected to the IdP to its AuthnRequest ID
+type SAMLLoginState struct {
+	ID        uuid.UUID `db:"id"`
+	StateHash string    `db:"state_hash"`
+	TenantID  uuid.UUID `db:"tenant_id"`
+	RequestID string    `db:"request_id"`
+	ExpiresAt time.Time `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
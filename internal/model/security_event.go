@@ -0,0 +1,80 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SecurityEvent records an authentication attempt or a change to how a user signs in
+type SecurityEvent struct {
+	ID         uuid.UUID  `db:"id"`
+	Type       string     `db:"type"`
+	Outcome    string     `db:"outcome"` // "success", "failure"
+	ActorID    *uuid.UUID `db:"actor_id"`
+	ActorEmail string     `db:"actor_email"`
+	TenantID   *uuid.UUID `db:"tenant_id"`
+	IPAddress  string     `db:"ip_address"`
+	UserAgent  string     `db:"user_agent"`
+	Reason     string     `db:"reason"` // Why a failed attempt failed, or that a sign-in awaits its second factor
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+const (
+	SecurityEventLogin                  = "login"
+	SecurityEventMagicLink              = "magic_link"
+	SecurityEventPasskeyLogin           = "passkey_login"
+	SecurityEventSSOLogin               = "sso_login"
+	SecurityEventTwoFactor              = "two_factor"
+	SecurityEventEmailVerified          = "email_verified"
+	SecurityEventAccountUnlocked        = "account_unlocked"
+	SecurityEventPasswordResetRequested = "password_reset_requested"
+	SecurityEventPasswordReset          = "password_reset"
+	SecurityEventPasswordChanged        = "password_changed"
+	SecurityEventEmailChanged           = "email_changed"
+	SecurityEventLogout                 = "logout"
+	SecurityEventSessionRevoked         = "session_revoked"
+	SecurityEventRefreshTokenReused     = "refresh_token_reused"
+	SecurityEventBearerTokenRejected    = "bearer_token_rejected"
+	SecurityEventImpersonationStarted   = "impersonation_started"
+	SecurityEventImpersonationStopped   = "impersonation_stopped"
+)
+
+const (
+	SecurityOutcomeSuccess = "success"
+	SecurityOutcomeFailure = "failure"
+)
+
+const (
+	SecurityReasonUnknownAccount   = "unknown_account"
+	SecurityReasonNoPassword       = "no_password"
+	SecurityReasonInvalidPassword  = "invalid_password"
+	SecurityReasonThrottled        = "throttled"
+	SecurityReasonLocked           = "locked"
+	SecurityReasonSSORequired      = "sso_required"
+	SecurityReasonEmailNotVerified = "email_not_verified"
+	SecurityReasonInvalidToken     = "invalid_token"
+	SecurityReasonInvalidCode      = "invalid_code"
+	SecurityReasonInvalidPasskey   = "invalid_passkey"
+	SecurityReasonSSOFailed        = "sso_failed"
+	// SecurityReasonTwoFactorRequired marks a first sign-in step that went through; whether
+	// the sign-in completed is recorded by the two-factor event that follows
+	SecurityReasonTwoFactorRequired = "two_factor_required"
+)
+
+// Succeeded returns true if the attempt the event records went through
+func (e *SecurityEvent) Succeeded() bool {
+	return e.Outcome == SecurityOutcomeSuccess
+}
+
+// AwaitsSecondFactor returns true if the event records a first sign-in step that went through
+// and was followed by a two-factor challenge
+func (e *SecurityEvent) AwaitsSecondFactor() bool {
+	return e.Succeeded() && e.Reason == SecurityReasonTwoFactorRequired
+}
+
+// ClientInfo identifies where a request came from
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a server-side record of a signed-in browser, referenced by the JWT jti claim
+type Session struct {
+	ID         uuid.UUID  `db:"id"`
+	UserID     uuid.UUID  `db:"user_id"`
+	UserAgent  string     `db:"user_agent"`
+	IPAddress  string     `db:"ip_address"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	LastSeenAt *time.Time `db:"last_seen_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+// IsExpired returns true if the session has expired
+func (s *Session) IsExpired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
+
+// IsRevoked returns true if the session was signed out
+func (s *Session) IsRevoked() bool {
+	return s.RevokedAt != nil
+}
+
+// IsActive returns true if the session is neither expired nor revoked
+func (s *Session) IsActive() bool {
+	return !s.IsExpired() && !s.IsRevoked()
+}
@@ -0,0 +1,37 @@
+package model
+
+import "strings"
+
+// SSOAccess are the settings every single sign-on protocol shares: who may sign in
+// through the tenant's identity provider and what happens on their first sign-in
+type SSOAccess struct {
+	// AllowedDomains are the email domains the IdP may sign in, comma separated
+	AllowedDomains string `db:"allowed_domains"`
+	// JITProvisioning creates unknown users with DefaultRole on their first sign-in
+	JITProvisioning bool   `db:"jit_provisioning"`
+	DefaultRole     string `db:"default_role"`
+	Enabled         bool   `db:"enabled"`
+}
+
+// Domains returns the allowed email domains
+func (a *SSOAccess) Domains() []string {
+	if a.AllowedDomains == "" {
+		return nil
+	}
+	return strings.Split(a.AllowedDomains, ",")
+}
+
+// AllowsEmail returns true if the email's domain is one of the allowed domains
+func (a *SSOAccess) AllowsEmail(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range a.Domains() {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -12,8 +12,10 @@ type Tenant struct {
 	Subdomain string    `db:"subdomain"`
 	Status    string    `db:"status"` // active, suspended, inactive
 	Tier      string    `db:"tier"`   // standard, premium, enterprise
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
+	// SSOEnforced means members can only sign in through the tenant's identity provider
+	SSOEnforced bool      `db:"sso_enforced"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
 }
 
 // IsActive returns true if the tenant is active
@@ -25,3 +27,8 @@ func (t *Tenant) IsActive() bool {
 func (t *Tenant) IsSuspended() bool {
 	return t.Status == "suspended"
 }
+
+// IsEnterprise returns true if the tenant is on the enterprise tier
+func (t *Tenant) IsEnterprise() bool {
+	return t.Tier == "enterprise"
+}
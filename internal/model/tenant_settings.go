@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultPrimaryColor = "#3B82F6"
+	DefaultTimezone     = "UTC"
+)
+
+type TenantSettings struct {
+	ID           uuid.UUID `db:"id"`
+	TenantID     uuid.UUID `db:"tenant_id"`
+	LogoURL      *string   `db:"logo_url"`
+	PrimaryColor string    `db:"primary_color"`
+	Timezone     string    `db:"timezone"`
+	CreatedAt    time.Time `db:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at"`
+}
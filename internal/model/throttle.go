@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ThrottleEvent is one occurrence of a rate limited action, attributed to an email and client IP,
+// and to the account when the limit is per user
+type ThrottleEvent struct {
+	ID        uuid.UUID  `db:"id"`
+	Action    string     `db:"action"` // "login_failure", "magic_link", "verification_resend", "sign_in_notice", "account_exists_notice"
+	Email     string     `db:"email"`
+	IPAddress string     `db:"ip_address"`
+	UserID    *uuid.UUID `db:"user_id"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+const (
+	ThrottleActionLoginFailure       = "login_failure"
+	ThrottleActionMagicLink          = "magic_link"
+	ThrottleActionPasswordReset      = "password_reset"
+	ThrottleActionVerificationResend = "verification_resend"
+	ThrottleActionSignInNotice       = "sign_in_notice"
+	ThrottleActionAccountExists      = "account_exists_notice"
+	ThrottleActionPasswordStrength   = "password_strength"
+	ThrottleActionAnonymousEvent     = "anonymous_security_event"
+	ThrottleActionTwoFactorFailure   = "two_factor_failure"
+)
+
+// ThrottleStats summarises the recent events for an email or IP
+type ThrottleStats struct {
+	Count  int        `db:"count"`
+	LastAt *time.Time `db:"last_at"`
+}
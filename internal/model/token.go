@@ -9,7 +9,7 @@ import (
 type Token struct {
 	ID        uuid.UUID  `db:"id"`
 	UserID    uuid.UUID  `db:"user_id"`
-	Type      string     `db:"type"` // "email_verify", "password_reset", "magic_link", "email_change"
+	Type      string     `db:"type"` // "email_verify", "password_reset", "magic_link", "email_change", "account_unlock"
 	Token     string     `db:"token"`
 	ExpiresAt time.Time  `db:"expires_at"`
 	UsedAt    *time.Time `db:"used_at"`
@@ -21,6 +21,7 @@ const (
 	TokenTypePasswordReset = "password_reset"
 	TokenTypeEmailChange   = "email_change"
 	TokenTypeMagicLink     = "magic_link"
+	TokenTypeAccountUnlock = "account_unlock"
 )
 
 // IsExpired returns true if the token has expired
@@ -7,15 +7,17 @@ import (
 )
 
 type User struct {
-	ID              uuid.UUID  `db:"id"`
-	TenantID        uuid.UUID  `db:"tenant_id"`
-	Email           string     `db:"email"`
-	PasswordHash    *string    `db:"password_hash"` // Nullable for passwordless auth
-	Role            string     `db:"role"`          // admin, user, viewer
-	PendingEmail    *string    `db:"pending_email"`
-	EmailVerifiedAt *time.Time `db:"email_verified_at"`
-	CreatedAt       time.Time  `db:"created_at"`
-	UpdatedAt       time.Time  `db:"updated_at"`
+	ID                uuid.UUID  `db:"id"`
+	TenantID          uuid.UUID  `db:"tenant_id"`
+	Email             string     `db:"email"`
+	PasswordHash      *string    `db:"password_hash"` // Nullable for passwordless auth
+	Role              string     `db:"role"`          // admin, user, viewer
+	PendingEmail      *string    `db:"pending_email"`
+	EmailVerifiedAt   *time.Time `db:"email_verified_at"`
+	PasswordChangedAt *time.Time `db:"password_changed_at"`
+	PlatformStaff     bool       `db:"platform_staff"` // support staff who may impersonate users
+	CreatedAt         time.Time  `db:"created_at"`
+	UpdatedAt         time.Time  `db:"updated_at"`
 }
 
 // HasPassword returns true if the user has a password set
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebAuthn ceremony purposes
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnLogin        = "login"
+	WebAuthnSecondFactor = "second_factor"
+)
+
+// WebAuthnCredential is a passkey or security key registered by a user
+type WebAuthnCredential struct {
+	ID              uuid.UUID  `db:"id"`
+	UserID          uuid.UUID  `db:"user_id"`
+	CredentialID    []byte     `db:"credential_id"`
+	PublicKey       []byte     `db:"public_key"`
+	AttestationType string     `db:"attestation_type"`
+	Transports      string     `db:"transports"`
+	AAGUID          []byte     `db:"aaguid"`
+	SignCount       uint32     `db:"sign_count"`
+	BackupEligible  bool       `db:"backup_eligible"`
+	BackupState     bool       `db:"backup_state"`
+	Name            string     `db:"name"`
+	LastUsedAt      *time.Time `db:"last_used_at"`
+	CreatedAt       time.Time  `db:"created_at"`
+}
+
+// WebAuthnCeremony holds the server side of a registration or assertion in progress
+type WebAuthnCeremony struct {
+	ID          uuid.UUID  `db:"id"`
+	TokenHash   string     `db:"token_hash"`
+	UserID      *uuid.UUID `db:"user_id"`
+	Purpose     string     `db:"purpose"`
+	SessionData []byte     `db:"session_data"` // JSON encoded webauthn.SessionData
+	ExpiresAt   time.Time  `db:"expires_at"`
+	CreatedAt   time.Time  `db:"created_at"`
+}
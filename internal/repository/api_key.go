@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"dotsat.work/internal/model"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+const apiKeyColumns = `id, tenant_id, name, key_prefix, key_hash, scopes, created_by, expires_at, last_used_at, revoked_at, created_at`
+
+type APIKeyRepository interface {
+	Create(key *model.APIKey) error
+	ByID(tenantID, id uuid.UUID) (*model.APIKey, error)
+	ByHash(keyHash string) (*model.APIKey, error)
+	ActiveByTenantID(tenantID uuid.UUID) ([]*model.APIKey, error)
+	Touch(id uuid.UUID, usedAt time.Time) error
+	Rotate(id uuid.UUID, expiresAt time.Time, replacement *model.APIKey) error
+	Revoke(tenantID, id uuid.UUID) error
+}
+
+type apiKeyRepository struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyRepository(db *sqlx.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) Create(key *model.APIKey) error {
+	return createAPIKey(r.db, key)
+}
+
+func createAPIKey(db DBTX, key *model.APIKey) error {
+	if key.ID == uuid.Nil {
+		key.ID = uuid.New()
+	}
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO api_keys (id, tenant_id, name, key_prefix, key_hash, scopes, created_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := db.Exec(query,
+		key.ID,
+		key.TenantID,
+		key.Name,
+		key.KeyPrefix,
+		key.KeyHash,
+		key.Scopes,
+		key.CreatedBy,
+		key.ExpiresAt,
+		key.CreatedAt,
+	)
+	return err
+}
+
+// ByID returns one of the tenant's keys in any state
+func (r *apiKeyRepository) ByID(tenantID, id uuid.UUID) (*model.APIKey, error) {
+	var key model.APIKey
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = $1 AND tenant_id = $2`
+	err := r.db.Get(&key, query, id, tenantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ByHash returns the key whether or not it is still active; callers check IsActive
+func (r *apiKeyRepository) ByHash(keyHash string) (*model.APIKey, error) {
+	var key model.APIKey
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+	err := r.db.Get(&key, query, keyHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ActiveByTenantID lists the tenant's unexpired, unrevoked keys, newest first
+func (r *apiKeyRepository) ActiveByTenantID(tenantID uuid.UUID) ([]*model.APIKey, error) {
+	var keys []*model.APIKey
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE tenant_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > $2)
+		ORDER BY created_at DESC
+	`
+	err := r.db.Select(&keys, query, tenantID, time.Now())
+	return keys, err
+}
+
+// Touch records when the key was last used
+func (r *apiKeyRepository) Touch(id uuid.UUID, usedAt time.Time) error {
+	query := `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`
+	_, err := r.db.Exec(query, usedAt, id)
+	return err
+}
+
+// Rotate stores the replacement key and lets the old one expire at expiresAt, in one transaction.
+// It fails with ErrAPIKeyNotFound if the old key was already rotated or revoked.
+func (r *apiKeyRepository) Rotate(id uuid.UUID, expiresAt time.Time, replacement *model.APIKey) error {
+	return withTx(r.db, func(tx *sqlx.Tx) error {
+		query := `
+			UPDATE api_keys SET expires_at = $1
+			WHERE id = $2 AND tenant_id = $3 AND revoked_at IS NULL AND expires_at IS NULL
+		`
+		result, err := tx.Exec(query, expiresAt, id, replacement.TenantID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrAPIKeyNotFound
+		}
+
+		return createAPIKey(tx, replacement)
+	})
+}
+
+// Revoke revokes one of the tenant's keys immediately
+func (r *apiKeyRepository) Revoke(tenantID, id uuid.UUID) error {
+	query := `UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND tenant_id = $3 AND revoked_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), id, tenantID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestAPIKeyRepository_Rotate(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewAPIKeyRepository(db)
+
+	tenant := createTestTenant(t, db)
+
+	old := &model.APIKey{TenantID: tenant.ID, Name: "CRM sync", KeyPrefix: "dsat_key_old", KeyHash: "old-hash", Scopes: model.APIScopeUsersRead}
+	if err := repo.Create(old); err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+
+	replacement := &model.APIKey{TenantID: tenant.ID, Name: "CRM sync", KeyPrefix: "dsat_key_new", KeyHash: "new-hash", Scopes: model.APIScopeUsersRead}
+	overlapUntil := time.Now().Add(time.Hour)
+	if err := repo.Rotate(old.ID, overlapUntil, replacement); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	keys, err := repo.ActiveByTenantID(tenant.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected both keys to be active during the overlap, got %d", len(keys))
+	}
+
+	found, err := repo.ByHash("old-hash")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !found.IsRotated() || !found.IsActive() {
+		t.Errorf("expected old key to be rotated but still active, got %+v", found)
+	}
+
+	// A rotated key can't be rotated again
+	again := &model.APIKey{TenantID: tenant.ID, Name: "CRM sync", KeyPrefix: "dsat_key_again", KeyHash: "again-hash"}
+	if err := repo.Rotate(old.ID, overlapUntil, again); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected ErrAPIKeyNotFound, got %v", err)
+	}
+	if _, err := repo.ByHash("again-hash"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected the failed rotation to be rolled back, got %v", err)
+	}
+}
+
+func TestAPIKeyRepository_Revoke(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewAPIKeyRepository(db)
+
+	tenant := createTestTenant(t, db)
+
+	key := &model.APIKey{TenantID: tenant.ID, Name: "Reporting", KeyPrefix: "dsat_key_rep", KeyHash: "rep-hash"}
+	if err := repo.Create(key); err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+
+	if err := repo.Revoke(uuid.New(), key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected ErrAPIKeyNotFound revoking another tenant's key, got %v", err)
+	}
+	if err := repo.Revoke(tenant.ID, key.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	keys, err := repo.ActiveByTenantID(tenant.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("expected no active keys, got %d", len(keys))
+	}
+}
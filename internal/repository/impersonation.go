@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+var ErrImpersonationNotFound = errors.New("impersonation not found")
+
+const impersonationColumns = `id, impersonator_id, impersonator_email, target_user_id, target_email, target_tenant_id,
+	reason, ip_address, started_at, expires_at, ended_at`
+
+type ImpersonationRepository interface {
+	Create(impersonation *model.Impersonation) error
+	ByID(id uuid.UUID) (*model.Impersonation, error)
+	End(id uuid.UUID, endedAt time.Time) error
+}
+
+type impersonationRepository struct {
+	db DBTX
+}
+
+func NewImpersonationRepository(db DBTX) ImpersonationRepository {
+	return &impersonationRepository{db: db}
+}
+
+func (r *impersonationRepository) Create(impersonation *model.Impersonation) error {
+	if impersonation.ID == uuid.Nil {
+		impersonation.ID = uuid.New()
+	}
+	if impersonation.StartedAt.IsZero() {
+		impersonation.StartedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO impersonations (` + impersonationColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	_, err := r.db.Exec(query,
+		impersonation.ID,
+		impersonation.ImpersonatorID,
+		impersonation.ImpersonatorEmail,
+		impersonation.TargetUserID,
+		impersonation.TargetEmail,
+		impersonation.TargetTenantID,
+		impersonation.Reason,
+		impersonation.IPAddress,
+		impersonation.StartedAt,
+		impersonation.ExpiresAt,
+		impersonation.EndedAt,
+	)
+	return err
+}
+
+// ByID returns the impersonation whether or not it is still active; callers check IsActive
+func (r *impersonationRepository) ByID(id uuid.UUID) (*model.Impersonation, error) {
+	var impersonation model.Impersonation
+	query := `SELECT ` + impersonationColumns + ` FROM impersonations WHERE id = $1`
+	err := r.db.Get(&impersonation, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrImpersonationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+// End records when the impersonation was stopped. Ending it again keeps the first time.
+func (r *impersonationRepository) End(id uuid.UUID, endedAt time.Time) error {
+	query := `UPDATE impersonations SET ended_at = $1 WHERE id = $2 AND ended_at IS NULL`
+	_, err := r.db.Exec(query, endedAt, id)
+	return err
+}
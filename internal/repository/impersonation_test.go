@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestImpersonationRepository_End(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewImpersonationRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	impersonation := &model.Impersonation{
+		ImpersonatorID:    &user.ID,
+		ImpersonatorEmail: "support@example.com",
+		TargetUserID:      &user.ID,
+		TargetEmail:       user.Email,
+		TargetTenantID:    &tenant.ID,
+		Reason:            "Ticket 1234",
+		ExpiresAt:         time.Now().Add(time.Hour),
+	}
+	if err := repo.Create(impersonation); err != nil {
+		t.Fatalf("failed to create impersonation: %v", err)
+	}
+
+	found, err := repo.ByID(impersonation.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !found.IsActive() || found.Reason != "Ticket 1234" {
+		t.Errorf("expected an active impersonation, got %+v", found)
+	}
+
+	endedAt := time.Now()
+	if err := repo.End(impersonation.ID, endedAt); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := repo.End(impersonation.ID, endedAt.Add(time.Minute)); err != nil {
+		t.Fatalf("expected ending twice to be a no-op, got %v", err)
+	}
+
+	found, err = repo.ByID(impersonation.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if found.IsActive() || found.EndedAt == nil || found.EndedAt.After(endedAt.Add(time.Second)) {
+		t.Errorf("expected the first end time to be kept, got %+v", found.EndedAt)
+	}
+
+	_, err = repo.ByID(uuid.New())
+	if !errors.Is(err, ErrImpersonationNotFound) {
+		t.Errorf("expected ErrImpersonationNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrOIDCConfigNotFound     = errors.New("oidc config not found")
+	ErrOIDCLoginStateNotFound = errors.New("oidc login state not found")
+)
+
+type OIDCRepository interface {
+	ConfigByTenantID(tenantID uuid.UUID) (*model.OIDCConfig, error)
+	UpsertConfig(config *model.OIDCConfig) error
+	DeleteConfig(tenantID uuid.UUID) error
+
+	CreateLoginState(state *model.OIDCLoginState) error
+	ConsumeLoginState(stateHash string) (*model.OIDCLoginState, error)
+}
+
+type oidcRepository struct {
+	db DBTX
+}
+
+func NewOIDCRepository(db DBTX) OIDCRepository {
+	return &oidcRepository{db: db}
+}
+
+func (r *oidcRepository) ConfigByTenantID(tenantID uuid.UUID) (*model.OIDCConfig, error) {
+	var config model.OIDCConfig
+	query := `
+		SELECT tenant_id, issuer, client_id, client_secret, allowed_domains, jit_provisioning,
+		       default_role, enabled, created_at, updated_at
+		FROM tenant_oidc_configs
+		WHERE tenant_id = $1
+	`
+	err := r.db.Get(&config, query, tenantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOIDCConfigNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// UpsertConfig creates the tenant's OIDC config or replaces the existing one
+func (r *oidcRepository) UpsertConfig(config *model.OIDCConfig) error {
+	now := time.Now()
+	if config.CreatedAt.IsZero() {
+		config.CreatedAt = now
+	}
+	config.UpdatedAt = now
+
+	query := `
+		INSERT INTO tenant_oidc_configs (tenant_id, issuer, client_id, client_secret, allowed_domains,
+		                                 jit_provisioning, default_role, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (tenant_id) DO UPDATE
+		SET issuer = EXCLUDED.issuer,
+		    client_id = EXCLUDED.client_id,
+		    client_secret = EXCLUDED.client_secret,
+		    allowed_domains = EXCLUDED.allowed_domains,
+		    jit_provisioning = EXCLUDED.jit_provisioning,
+		    default_role = EXCLUDED.default_role,
+		    enabled = EXCLUDED.enabled,
+		    updated_at = EXCLUDED.updated_at
+		RETURNING created_at
+	`
+	return r.db.QueryRowx(
+		query,
+		config.TenantID,
+		config.Issuer,
+		config.ClientID,
+		config.ClientSecret,
+		config.AllowedDomains,
+		config.JITProvisioning,
+		config.DefaultRole,
+		config.Enabled,
+		config.CreatedAt,
+		config.UpdatedAt,
+	).Scan(&config.CreatedAt)
+}
+
+func (r *oidcRepository) DeleteConfig(tenantID uuid.UUID) error {
+	result, err := r.db.Exec(`DELETE FROM tenant_oidc_configs WHERE tenant_id = $1`, tenantID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrOIDCConfigNotFound
+	}
+	return nil
+}
+
+func (r *oidcRepository) CreateLoginState(state *model.OIDCLoginState) error {
+	if state.ID == uuid.Nil {
+		state.ID = uuid.New()
+	}
+	if state.CreatedAt.IsZero() {
+		state.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO oidc_login_states (id, state_hash, tenant_id, code_verifier, nonce, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.Exec(query, state.ID, state.StateHash, state.TenantID, state.CodeVerifier,
+		state.Nonce, state.ExpiresAt, state.CreatedAt)
+	return err
+}
+
+// ConsumeLoginState atomically deletes and returns an unexpired login state, so each callback is accepted once
+func (r *oidcRepository) ConsumeLoginState(stateHash string) (*model.OIDCLoginState, error) {
+	var state model.OIDCLoginState
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1 AND expires_at > $2
+		RETURNING id, state_hash, tenant_id, code_verifier, nonce, expires_at, created_at
+	`
+	err := r.db.Get(&state, query, stateHash, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOIDCLoginStateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestOIDCRepository_Config(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewOIDCRepository(db)
+	tenant := createTestTenant(t, db)
+
+	if _, err := repo.ConfigByTenantID(tenant.ID); !errors.Is(err, ErrOIDCConfigNotFound) {
+		t.Errorf("expected ErrOIDCConfigNotFound, got %v", err)
+	}
+
+	config := &model.OIDCConfig{
+		TenantID:     tenant.ID,
+		Issuer:       "https://idp.example.com",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		SSOAccess: model.SSOAccess{
+			AllowedDomains: "example.com",
+			DefaultRole:    "user",
+			Enabled:        true,
+		},
+	}
+	if err := repo.UpsertConfig(config); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	createdAt := config.CreatedAt
+
+	config.CreatedAt = time.Time{}
+	config.ClientID = "rotated-client"
+	config.JITProvisioning = true
+	if err := repo.UpsertConfig(config); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !config.CreatedAt.Equal(createdAt) {
+		t.Errorf("expected created_at to be kept on update, got %v want %v", config.CreatedAt, createdAt)
+	}
+
+	found, err := repo.ConfigByTenantID(tenant.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if found.ClientID != "rotated-client" || !found.JITProvisioning {
+		t.Errorf("expected the updated config, got %+v", found)
+	}
+
+	if err := repo.DeleteConfig(tenant.ID); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := repo.DeleteConfig(tenant.ID); !errors.Is(err, ErrOIDCConfigNotFound) {
+		t.Errorf("expected ErrOIDCConfigNotFound, got %v", err)
+	}
+}
+
+func TestOIDCRepository_ConsumeLoginState(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewOIDCRepository(db)
+	tenant := createTestTenant(t, db)
+
+	state := &model.OIDCLoginState{
+		StateHash:    "state-" + uuid.NewString(),
+		TenantID:     tenant.ID,
+		CodeVerifier: "verifier",
+		Nonce:        "nonce",
+		ExpiresAt:    time.Now().Add(10 * time.Minute),
+	}
+	if err := repo.CreateLoginState(state); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	found, err := repo.ConsumeLoginState(state.StateHash)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if found.TenantID != tenant.ID || found.CodeVerifier != "verifier" || found.Nonce != "nonce" {
+		t.Errorf("expected the stored login state, got %+v", found)
+	}
+
+	if _, err := repo.ConsumeLoginState(state.StateHash); !errors.Is(err, ErrOIDCLoginStateNotFound) {
+		t.Errorf("expected ErrOIDCLoginStateNotFound on reuse, got %v", err)
+	}
+
+	expired := &model.OIDCLoginState{
+		StateHash: "state-" + uuid.NewString(),
+		TenantID:  tenant.ID,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	if err := repo.CreateLoginState(expired); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := repo.ConsumeLoginState(expired.StateHash); !errors.Is(err, ErrOIDCLoginStateNotFound) {
+		t.Errorf("expected ErrOIDCLoginStateNotFound when expired, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+)
+
+type PasswordHistoryRepository interface {
+	// Add records a replaced password hash and deletes all but the user's keep most recent ones
+	Add(entry *model.PasswordHistoryEntry, keep int) error
+	// Recent returns the user's limit most recently replaced password hashes, newest first
+	Recent(userID uuid.UUID, limit int) ([]model.PasswordHistoryEntry, error)
+}
+
+type passwordHistoryRepository struct {
+	db DBTX
+}
+
+func NewPasswordHistoryRepository(db DBTX) PasswordHistoryRepository {
+	return &passwordHistoryRepository{db: db}
+}
+
+func (r *passwordHistoryRepository) Add(entry *model.PasswordHistoryEntry, keep int) error {
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO password_history (id, user_id, password_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := r.db.Exec(query, entry.ID, entry.UserID, entry.PasswordHash, entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		DELETE FROM password_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM password_history
+			WHERE user_id = $1
+			ORDER BY created_at DESC
+			LIMIT $2
+		)
+	`
+	_, err = r.db.Exec(query, entry.UserID, keep)
+	return err
+}
+
+func (r *passwordHistoryRepository) Recent(userID uuid.UUID, limit int) ([]model.PasswordHistoryEntry, error) {
+	entries := []model.PasswordHistoryEntry{}
+	query := `
+		SELECT id, user_id, password_hash, created_at
+		FROM password_history
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	err := r.db.Select(&entries, query, userID, limit)
+	return entries, err
+}
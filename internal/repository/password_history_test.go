@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+)
+
+func TestPasswordHistoryRepository_Add(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewPasswordHistoryRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	start := time.Now().Add(-time.Hour)
+	for i := range 4 {
+		err := repo.Add(&model.PasswordHistoryEntry{
+			UserID:       user.ID,
+			PasswordHash: fmt.Sprintf("hash-%d", i),
+			CreatedAt:    start.Add(time.Duration(i) * time.Minute),
+		}, 3)
+		if err != nil {
+			t.Fatalf("failed to add history: %v", err)
+		}
+	}
+	entries, err := repo.Recent(user.ID, 10)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// The oldest hash is pruned
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	for i, want := range []string{"hash-3", "hash-2", "hash-1"} {
+		if entries[i].PasswordHash != want {
+			t.Errorf("expected entry %d to be %q, got %q", i, want, entries[i].PasswordHash)
+		}
+	}
+
+	entries, err = repo.Recent(user.ID, 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(entries) != 1 || entries[0].PasswordHash != "hash-3" {
+		t.Errorf("expected only the newest entry, got %+v", entries)
+	}
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+)
+
+var ErrPasswordPolicyNotFound = errors.New("password policy not found")
+
+type PasswordPolicyRepository interface {
+	ByTenantID(tenantID uuid.UUID) (*model.TenantPasswordPolicy, error)
+	Upsert(policy *model.TenantPasswordPolicy) error
+}
+
+type passwordPolicyRepository struct {
+	db DBTX
+}
+
+func NewPasswordPolicyRepository(db DBTX) PasswordPolicyRepository {
+	return &passwordPolicyRepository{db: db}
+}
+
+func (r *passwordPolicyRepository) ByTenantID(tenantID uuid.UUID) (*model.TenantPasswordPolicy, error) {
+	policy := &model.TenantPasswordPolicy{}
+	query := `
+		SELECT tenant_id, min_length, max_length, min_score, history_size, created_at, updated_at
+		FROM tenant_password_policies
+		WHERE tenant_id = $1
+	`
+
+	err := r.db.Get(policy, query, tenantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPasswordPolicyNotFound
+	}
+
+	return policy, err
+}
+
+// Upsert creates the tenant's policy or updates it if it already exists
+func (r *passwordPolicyRepository) Upsert(policy *model.TenantPasswordPolicy) error {
+	now := time.Now()
+	if policy.CreatedAt.IsZero() {
+		policy.CreatedAt = now
+	}
+	policy.UpdatedAt = now
+
+	query := `
+		INSERT INTO tenant_password_policies (tenant_id, min_length, max_length, min_score, history_size, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (tenant_id) DO UPDATE
+		SET min_length = EXCLUDED.min_length,
+		    max_length = EXCLUDED.max_length,
+		    min_score = EXCLUDED.min_score,
+		    history_size = EXCLUDED.history_size,
+		    updated_at = EXCLUDED.updated_at
+		RETURNING created_at
+	`
+
+	return r.db.QueryRowx(
+		query,
+		policy.TenantID,
+		policy.MinLength,
+		policy.MaxLength,
+		policy.MinScore,
+		policy.HistorySize,
+		policy.CreatedAt,
+		policy.UpdatedAt,
+	).Scan(&policy.CreatedAt)
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+)
+
+func TestPasswordPolicyRepository_Upsert(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	tenant := createTestTenant(t, db)
+	repo := NewPasswordPolicyRepository(db)
+
+	_, err := repo.ByTenantID(tenant.ID)
+	if !errors.Is(err, ErrPasswordPolicyNotFound) {
+		t.Fatalf("expected ErrPasswordPolicyNotFound before upsert, got %v", err)
+	}
+
+	err = repo.Upsert(&model.TenantPasswordPolicy{TenantID: tenant.ID, MinLength: 16, MaxLength: 64, MinScore: 4, HistorySize: 5})
+	if err != nil {
+		t.Fatalf("failed to insert policy: %v", err)
+	}
+
+	found, err := repo.ByTenantID(tenant.ID)
+	if err != nil {
+		t.Fatalf("failed to find policy: %v", err)
+	}
+	if found.MinLength != 16 || found.MaxLength != 64 || found.MinScore != 4 || found.HistorySize != 5 {
+		t.Errorf("expected the inserted policy, got %+v", found)
+	}
+
+	// Upserting again updates the same row
+	err = repo.Upsert(&model.TenantPasswordPolicy{TenantID: tenant.ID, MinLength: 14})
+	if err != nil {
+		t.Fatalf("failed to update policy: %v", err)
+	}
+
+	found, err = repo.ByTenantID(tenant.ID)
+	if err != nil {
+		t.Fatalf("failed to find policy: %v", err)
+	}
+	if found.MinLength != 14 || found.MaxLength != 0 || found.MinScore != 0 || found.HistorySize != 0 {
+		t.Errorf("expected the updated policy, got %+v", found)
+	}
+
+	_, err = repo.ByTenantID(uuid.New())
+	if !errors.Is(err, ErrPasswordPolicyNotFound) {
+		t.Errorf("expected ErrPasswordPolicyNotFound for unknown tenant, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+var ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+
+const personalAccessTokenColumns = `id, user_id, name, token_hash, expires_at, last_used_at, revoked_at, created_at`
+
+type PersonalAccessTokenRepository interface {
+	Create(token *model.PersonalAccessToken) error
+	ByHash(tokenHash string) (*model.PersonalAccessToken, error)
+	ActiveByUserID(userID uuid.UUID) ([]*model.PersonalAccessToken, error)
+	Touch(id uuid.UUID, usedAt time.Time) error
+	Revoke(userID, id uuid.UUID) error
+}
+
+type personalAccessTokenRepository struct {
+	db DBTX
+}
+
+func NewPersonalAccessTokenRepository(db DBTX) PersonalAccessTokenRepository {
+	return &personalAccessTokenRepository{db: db}
+}
+
+func (r *personalAccessTokenRepository) Create(token *model.PersonalAccessToken) error {
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO personal_access_tokens (id, user_id, name, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(query,
+		token.ID,
+		token.UserID,
+		token.Name,
+		token.TokenHash,
+		token.ExpiresAt,
+		token.CreatedAt,
+	)
+	return err
+}
+
+// ByHash returns the token whether or not it is still active; callers check IsActive
+func (r *personalAccessTokenRepository) ByHash(tokenHash string) (*model.PersonalAccessToken, error) {
+	var token model.PersonalAccessToken
+	query := `SELECT ` + personalAccessTokenColumns + ` FROM personal_access_tokens WHERE token_hash = $1`
+	err := r.db.Get(&token, query, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPersonalAccessTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ActiveByUserID lists the user's unexpired, unrevoked tokens, newest first
+func (r *personalAccessTokenRepository) ActiveByUserID(userID uuid.UUID) ([]*model.PersonalAccessToken, error) {
+	var tokens []*model.PersonalAccessToken
+	query := `
+		SELECT ` + personalAccessTokenColumns + `
+		FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY created_at DESC
+	`
+	err := r.db.Select(&tokens, query, userID, time.Now())
+	return tokens, err
+}
+
+// Touch records when the token was last used
+func (r *personalAccessTokenRepository) Touch(id uuid.UUID, usedAt time.Time) error {
+	query := `UPDATE personal_access_tokens SET last_used_at = $1 WHERE id = $2`
+	_, err := r.db.Exec(query, usedAt, id)
+	return err
+}
+
+// Revoke revokes one of the user's active tokens
+func (r *personalAccessTokenRepository) Revoke(userID, id uuid.UUID) error {
+	query := `UPDATE personal_access_tokens SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrPersonalAccessTokenNotFound
+	}
+
+	return nil
+}
+
+// CleanupExpired removes tokens that expired or were revoked more than olderThan ago.
+// Like tokenRepository.CleanupExpired this is an optional maintenance operation.
+func (r *personalAccessTokenRepository) CleanupExpired(olderThan time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-olderThan)
+	query := `
+		DELETE FROM personal_access_tokens
+		WHERE (revoked_at IS NOT NULL AND revoked_at < $1)
+		   OR (expires_at < $1)
+	`
+	result, err := r.db.Exec(query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
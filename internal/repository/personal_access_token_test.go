@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestPersonalAccessTokenRepository_ActiveByUserID(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewPersonalAccessTokenRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	active := &model.PersonalAccessToken{UserID: user.ID, Name: "CI", TokenHash: "active-hash", ExpiresAt: time.Now().Add(time.Hour)}
+	revoked := &model.PersonalAccessToken{UserID: user.ID, Name: "Old script", TokenHash: "revoked-hash", ExpiresAt: time.Now().Add(time.Hour)}
+	expired := &model.PersonalAccessToken{UserID: user.ID, Name: "Expired", TokenHash: "expired-hash", ExpiresAt: time.Now().Add(-time.Hour)}
+	for _, token := range []*model.PersonalAccessToken{active, revoked, expired} {
+		if err := repo.Create(token); err != nil {
+			t.Fatalf("failed to create token: %v", err)
+		}
+	}
+	if err := repo.Revoke(user.ID, revoked.ID); err != nil {
+		t.Fatalf("failed to revoke token: %v", err)
+	}
+
+	usedAt := time.Now()
+	if err := repo.Touch(active.ID, usedAt); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tokens, err := repo.ActiveByUserID(user.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].ID != active.ID {
+		t.Fatalf("expected only the active token, got %+v", tokens)
+	}
+	if tokens[0].LastUsedAt == nil {
+		t.Error("expected last use to be recorded")
+	}
+
+	found, err := repo.ByHash("revoked-hash")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if found.IsActive() {
+		t.Error("expected revoked token to be inactive")
+	}
+}
+
+func TestPersonalAccessTokenRepository_Revoke_NotFound(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewPersonalAccessTokenRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	token := &model.PersonalAccessToken{UserID: user.ID, Name: "CI", TokenHash: "some-hash", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := repo.Create(token); err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	if err := repo.Revoke(uuid.New(), token.ID); !errors.Is(err, ErrPersonalAccessTokenNotFound) {
+		t.Errorf("expected ErrPersonalAccessTokenNotFound revoking another user's token, got %v", err)
+	}
+	if err := repo.Revoke(user.ID, uuid.New()); !errors.Is(err, ErrPersonalAccessTokenNotFound) {
+		t.Errorf("expected ErrPersonalAccessTokenNotFound, got %v", err)
+	}
+	if _, err := repo.ByHash("unknown-hash"); !errors.Is(err, ErrPersonalAccessTokenNotFound) {
+		t.Errorf("expected ErrPersonalAccessTokenNotFound, got %v", err)
+	}
+}
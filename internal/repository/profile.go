@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 
 	"dotsat.work/internal/model"
 )
@@ -16,13 +15,15 @@ type ProfileRepository interface {
 	ByUserID(userID uuid.UUID) (*model.Profile, error)
 	Create(profile *model.Profile) error
 	UpdateName(userID uuid.UUID, name string) error
+	UpdateDetails(userID uuid.UUID, bio, phone *string) error
+	MarkOnboarded(userID uuid.UUID) error
 }
 
 type profileRepository struct {
-	db *sqlx.DB
+	db DBTX
 }
 
-func NewProfileRepository(db *sqlx.DB) ProfileRepository {
+func NewProfileRepository(db DBTX) ProfileRepository {
 	return &profileRepository{db: db}
 }
 
@@ -52,9 +53,9 @@ func (r *profileRepository) Create(profile *model.Profile) error {
 	}
 
 	_, err := r.db.Exec(`
-		INSERT INTO profiles (id, user_id, name, bio, phone, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, profile.ID, profile.UserID, profile.Name, profile.Bio, profile.Phone, profile.CreatedAt, profile.UpdatedAt)
+		INSERT INTO profiles (id, user_id, name, bio, phone, onboarded_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, profile.ID, profile.UserID, profile.Name, profile.Bio, profile.Phone, profile.OnboardedAt, profile.CreatedAt, profile.UpdatedAt)
 
 	return err
 }
@@ -80,3 +81,50 @@ func (r *profileRepository) UpdateName(userID uuid.UUID, name string) error {
 
 	return nil
 }
+
+func (r *profileRepository) UpdateDetails(userID uuid.UUID, bio, phone *string) error {
+	result, err := r.db.Exec(`
+		UPDATE profiles
+		SET bio = $1, phone = $2, updated_at = $3
+		WHERE user_id = $4
+	`, bio, phone, time.Now(), userID)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrProfileNotFound
+	}
+
+	return nil
+}
+
+// MarkOnboarded records that the user finished onboarding.
+// Calling it again keeps the original completion time.
+func (r *profileRepository) MarkOnboarded(userID uuid.UUID) error {
+	now := time.Now()
+	result, err := r.db.Exec(`
+		UPDATE profiles
+		SET onboarded_at = COALESCE(onboarded_at, $1), updated_at = $1
+		WHERE user_id = $2
+	`, now, userID)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrProfileNotFound
+	}
+
+	return nil
+}
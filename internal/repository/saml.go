@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSAMLConfigNotFound     = errors.New("saml config not found")
+	ErrSAMLLoginStateNotFound = errors.New("saml login state not found")
+)
+
+type SAMLRepository interface {
+	ConfigByTenantID(tenantID uuid.UUID) (*model.SAMLConfig, error)
+	UpsertConfig(config *model.SAMLConfig) error
+	DeleteConfig(tenantID uuid.UUID) error
+
+	CreateLoginState(state *model.SAMLLoginState) error
+	ConsumeLoginState(stateHash string) (*model.SAMLLoginState, error)
+}
+
+type samlRepository struct {
+	db DBTX
+}
+
+func NewSAMLRepository(db DBTX) SAMLRepository {
+	return &samlRepository{db: db}
+}
+
+func (r *samlRepository) ConfigByTenantID(tenantID uuid.UUID) (*model.SAMLConfig, error) {
+	var config model.SAMLConfig
+	query := `
+		SELECT tenant_id, idp_metadata, idp_entity_id, role_attribute, role_mapping, allowed_domains,
+		       jit_provisioning, default_role, enabled, created_at, updated_at
+		FROM tenant_saml_configs
+		WHERE tenant_id = $1
+	`
+	err := r.db.Get(&config, query, tenantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSAMLConfigNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// UpsertConfig creates the tenant's SAML config or replaces the existing one
+func (r *samlRepository) UpsertConfig(config *model.SAMLConfig) error {
+	now := time.Now()
+	if config.CreatedAt.IsZero() {
+		config.CreatedAt = now
+	}
+	config.UpdatedAt = now
+
+	query := `
+		INSERT INTO tenant_saml_configs (tenant_id, idp_metadata, idp_entity_id, role_attribute, role_mapping,
+		                                 allowed_domains, jit_provisioning, default_role, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (tenant_id) DO UPDATE
+		SET idp_metadata = EXCLUDED.idp_metadata,
+		    idp_entity_id = EXCLUDED.idp_entity_id,
+		    role_attribute = EXCLUDED.role_attribute,
+		    role_mapping = EXCLUDED.role_mapping,
+		    allowed_domains = EXCLUDED.allowed_domains,
+		    jit_provisioning = EXCLUDED.jit_provisioning,
+		    default_role = EXCLUDED.default_role,
+		    enabled = EXCLUDED.enabled,
+		    updated_at = EXCLUDED.updated_at
+		RETURNING created_at
+	`
+	return r.db.QueryRowx(
+		query,
+		config.TenantID,
+		config.IdPMetadata,
+		config.IdPEntityID,
+		config.RoleAttribute,
+		config.RoleMapping,
+		config.AllowedDomains,
+		config.JITProvisioning,
+		config.DefaultRole,
+		config.Enabled,
+		config.CreatedAt,
+		config.UpdatedAt,
+	).Scan(&config.CreatedAt)
+}
+
+func (r *samlRepository) DeleteConfig(tenantID uuid.UUID) error {
+	result, err := r.db.Exec(`DELETE FROM tenant_saml_configs WHERE tenant_id = $1`, tenantID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrSAMLConfigNotFound
+	}
+	return nil
+}
+
+func (r *samlRepository) CreateLoginState(state *model.SAMLLoginState) error {
+	if state.ID == uuid.Nil {
+		state.ID = uuid.New()
+	}
+	if state.CreatedAt.IsZero() {
+		state.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO saml_login_states (id, state_hash, tenant_id, request_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(query, state.ID, state.StateHash, state.TenantID, state.RequestID, state.ExpiresAt, state.CreatedAt)
+	return err
+}
+
+// ConsumeLoginState atomically deletes and returns an unexpired login state, so each assertion is accepted once
+func (r *samlRepository) ConsumeLoginState(stateHash string) (*model.SAMLLoginState, error) {
+	var state model.SAMLLoginState
+	query := `
+		DELETE FROM saml_login_states
+		WHERE state_hash = $1 AND expires_at > $2
+		RETURNING id, state_hash, tenant_id, request_id, expires_at, created_at
+	`
+	err := r.db.Get(&state, query, stateHash, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSAMLLoginStateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestSAMLRepository_Config(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewSAMLRepository(db)
+	tenant := createTestTenant(t, db)
+
+	if _, err := repo.ConfigByTenantID(tenant.ID); !errors.Is(err, ErrSAMLConfigNotFound) {
+		t.Errorf("expected ErrSAMLConfigNotFound, got %v", err)
+	}
+
+	config := &model.SAMLConfig{
+		TenantID:      tenant.ID,
+		IdPMetadata:   "<EntityDescriptor/>",
+		IdPEntityID:   "https://idp.example.com",
+		RoleAttribute: "groups",
+		RoleMapping:   "Admins = admin",
+		SSOAccess: model.SSOAccess{
+			AllowedDomains: "example.com",
+			DefaultRole:    "user",
+			Enabled:        true,
+		},
+	}
+	if err := repo.UpsertConfig(config); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	config.RoleMapping = "Admins = admin\nGuests = viewer"
+	config.JITProvisioning = true
+	if err := repo.UpsertConfig(config); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	found, err := repo.ConfigByTenantID(tenant.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if found.RoleMapping != config.RoleMapping || !found.JITProvisioning || found.IdPEntityID != config.IdPEntityID {
+		t.Errorf("expected the updated config, got %+v", found)
+	}
+
+	if err := repo.DeleteConfig(tenant.ID); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := repo.DeleteConfig(tenant.ID); !errors.Is(err, ErrSAMLConfigNotFound) {
+		t.Errorf("expected ErrSAMLConfigNotFound, got %v", err)
+	}
+}
+
+func TestSAMLRepository_ConsumeLoginState(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewSAMLRepository(db)
+	tenant := createTestTenant(t, db)
+
+	state := &model.SAMLLoginState{
+		StateHash: "state-" + uuid.NewString(),
+		TenantID:  tenant.ID,
+		RequestID: "id-" + uuid.NewString(),
+		ExpiresAt: time.Now().Add(10 * time.Minute),
+	}
+	if err := repo.CreateLoginState(state); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	found, err := repo.ConsumeLoginState(state.StateHash)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if found.TenantID != tenant.ID || found.RequestID != state.RequestID {
+		t.Errorf("expected the stored login state, got %+v", found)
+	}
+
+	if _, err := repo.ConsumeLoginState(state.StateHash); !errors.Is(err, ErrSAMLLoginStateNotFound) {
+		t.Errorf("expected ErrSAMLLoginStateNotFound on reuse, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+const securityEventColumns = `id, type, outcome, actor_id, actor_email, tenant_id, ip_address, user_agent, reason, created_at`
+
+type SecurityEventRepository interface {
+	Create(event *model.SecurityEvent) error
+	// ByActorID returns the user's limit most recent events, newest first
+	ByActorID(actorID uuid.UUID, limit int) ([]*model.SecurityEvent, error)
+	// ByTenantID returns the limit most recent events of the tenant's users, newest first
+	ByTenantID(tenantID uuid.UUID, limit int) ([]*model.SecurityEvent, error)
+	CleanupExpired(olderThan time.Duration) (int64, error)
+}
+
+type securityEventRepository struct {
+	db DBTX
+}
+
+func NewSecurityEventRepository(db DBTX) SecurityEventRepository {
+	return &securityEventRepository{db: db}
+}
+
+func (r *securityEventRepository) Create(event *model.SecurityEvent) error {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO security_events (` + securityEventColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err := r.db.Exec(query,
+		event.ID,
+		event.Type,
+		event.Outcome,
+		event.ActorID,
+		event.ActorEmail,
+		event.TenantID,
+		event.IPAddress,
+		event.UserAgent,
+		event.Reason,
+		event.CreatedAt,
+	)
+	return err
+}
+
+func (r *securityEventRepository) ByActorID(actorID uuid.UUID, limit int) ([]*model.SecurityEvent, error) {
+	events := []*model.SecurityEvent{}
+	query := `
+		SELECT ` + securityEventColumns + `
+		FROM security_events
+		WHERE actor_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	err := r.db.Select(&events, query, actorID, limit)
+	return events, err
+}
+
+func (r *securityEventRepository) ByTenantID(tenantID uuid.UUID, limit int) ([]*model.SecurityEvent, error) {
+	events := []*model.SecurityEvent{}
+	query := `
+		SELECT ` + securityEventColumns + `
+		FROM security_events
+		WHERE tenant_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	err := r.db.Select(&events, query, tenantID, limit)
+	return events, err
+}
+
+// CleanupExpired removes events older than the given duration, the log's retention period
+func (r *securityEventRepository) CleanupExpired(olderThan time.Duration) (int64, error) {
+	query := `DELETE FROM security_events WHERE created_at < $1`
+	result, err := r.db.Exec(query, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
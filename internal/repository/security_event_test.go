@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+)
+
+func TestSecurityEventRepository_ByActorAndTenant(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewSecurityEventRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	now := time.Now()
+	events := []*model.SecurityEvent{
+		{Type: model.SecurityEventLogin, Outcome: model.SecurityOutcomeFailure, ActorID: &user.ID, ActorEmail: user.Email,
+			TenantID: &tenant.ID, Reason: model.SecurityReasonInvalidPassword, CreatedAt: now.Add(-time.Minute)},
+		{Type: model.SecurityEventLogin, Outcome: model.SecurityOutcomeSuccess, ActorID: &user.ID, ActorEmail: user.Email,
+			TenantID: &tenant.ID, IPAddress: "192.0.2.1", UserAgent: "Mozilla/5.0", CreatedAt: now},
+		// Unknown accounts belong to no user or tenant
+		{Type: model.SecurityEventLogin, Outcome: model.SecurityOutcomeFailure, ActorEmail: "nobody@example.com",
+			Reason: model.SecurityReasonUnknownAccount, CreatedAt: now},
+	}
+	for _, event := range events {
+		if err := repo.Create(event); err != nil {
+			t.Fatalf("failed to create security event: %v", err)
+		}
+	}
+
+	found, err := repo.ByActorID(user.ID, 10)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected 2 events for the user, got %d", len(found))
+	}
+	if !found[0].Succeeded() || found[0].IPAddress != "192.0.2.1" {
+		t.Errorf("expected the newest event first, got %+v", found[0])
+	}
+
+	found, err = repo.ByTenantID(tenant.ID, 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(found) != 1 || found[0].ID != events[1].ID {
+		t.Errorf("expected only the newest tenant event, got %+v", found)
+	}
+
+	old := &model.SecurityEvent{Type: model.SecurityEventLogin, Outcome: model.SecurityOutcomeSuccess, ActorID: &user.ID,
+		ActorEmail: user.Email, TenantID: &tenant.ID, CreatedAt: now.Add(-48 * time.Hour)}
+	if err := repo.Create(old); err != nil {
+		t.Fatalf("failed to create security event: %v", err)
+	}
+	deleted, err := repo.CleanupExpired(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected only the old event to be cleaned up, got %d", deleted)
+	}
+}
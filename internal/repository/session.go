@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+)
+
+const sessionColumns = `id, user_id, user_agent, ip_address, expires_at, revoked_at, last_seen_at, created_at`
+
+type SessionRepository interface {
+	Create(session *model.Session) error
+	ByID(id uuid.UUID) (*model.Session, error)
+	ActiveByUserID(userID uuid.UUID) ([]*model.Session, error)
+	Touch(id uuid.UUID, userAgent, ipAddress string, seenAt time.Time) error
+	Revoke(id uuid.UUID) error
+	RevokeAllByUserID(userID uuid.UUID) error
+	CreateRefreshToken(token *model.RefreshToken) error
+	ConsumeRefreshToken(tokenHash string) (*model.RefreshToken, error)
+	RefreshTokenByHash(tokenHash string) (*model.RefreshToken, error)
+}
+
+type sessionRepository struct {
+	db DBTX
+}
+
+func NewSessionRepository(db DBTX) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(session *model.Session) error {
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+	}
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO sessions (id, user_id, user_agent, ip_address, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(query,
+		session.ID,
+		session.UserID,
+		session.UserAgent,
+		session.IPAddress,
+		session.ExpiresAt,
+		session.CreatedAt,
+	)
+	return err
+}
+
+// ByID returns the session whether or not it is still active; callers check IsActive
+func (r *sessionRepository) ByID(id uuid.UUID) (*model.Session, error) {
+	var session model.Session
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1`
+	err := r.db.Get(&session, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ActiveByUserID lists the user's unexpired, unrevoked sessions, most recently used first
+func (r *sessionRepository) ActiveByUserID(userID uuid.UUID) ([]*model.Session, error) {
+	var sessions []*model.Session
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY COALESCE(last_seen_at, created_at) DESC
+	`
+	err := r.db.Select(&sessions, query, userID, time.Now())
+	return sessions, err
+}
+
+// Touch records the client the session was last used from
+func (r *sessionRepository) Touch(id uuid.UUID, userAgent, ipAddress string, seenAt time.Time) error {
+	query := `UPDATE sessions SET user_agent = $1, ip_address = $2, last_seen_at = $3 WHERE id = $4`
+	_, err := r.db.Exec(query, userAgent, ipAddress, seenAt, id)
+	return err
+}
+
+// Revoke signs out a single session. Revoking an already revoked session is a no-op.
+func (r *sessionRepository) Revoke(id uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	_, err := r.db.Exec(query, time.Now(), id)
+	return err
+}
+
+// RevokeAllByUserID signs out every active session of the user
+func (r *sessionRepository) RevokeAllByUserID(userID uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+	_, err := r.db.Exec(query, time.Now(), userID)
+	return err
+}
+
+func (r *sessionRepository) CreateRefreshToken(token *model.RefreshToken) error {
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO refresh_tokens (id, session_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.db.Exec(query,
+		token.ID,
+		token.SessionID,
+		token.TokenHash,
+		token.ExpiresAt,
+		token.CreatedAt,
+	)
+	return err
+}
+
+// ConsumeRefreshToken atomically marks an unused, unexpired refresh token as used and returns it.
+// Like ConsumeToken, only one of several concurrent requests can succeed.
+func (r *sessionRepository) ConsumeRefreshToken(tokenHash string) (*model.RefreshToken, error) {
+	var t model.RefreshToken
+	now := time.Now()
+
+	query := `
+		UPDATE refresh_tokens
+		SET used_at = $1
+		WHERE token_hash = $2
+		AND used_at IS NULL
+		AND expires_at > $3
+		RETURNING id, session_id, token_hash, expires_at, used_at, created_at
+	`
+	err := r.db.Get(&t, query, now, tokenHash, now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// RefreshTokenByHash returns a refresh token in any state, used to detect reuse
+func (r *sessionRepository) RefreshTokenByHash(tokenHash string) (*model.RefreshToken, error) {
+	var t model.RefreshToken
+	query := `SELECT id, session_id, token_hash, expires_at, used_at, created_at FROM refresh_tokens WHERE token_hash = $1`
+	err := r.db.Get(&t, query, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CleanupExpired removes sessions that expired or were revoked more than olderThan ago.
+// Like tokenRepository.CleanupExpired this is an optional maintenance operation.
+func (r *sessionRepository) CleanupExpired(olderThan time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-olderThan)
+	query := `
+		DELETE FROM sessions
+		WHERE (revoked_at IS NOT NULL AND revoked_at < $1)
+		   OR (expires_at < $1)
+	`
+	result, err := r.db.Exec(query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
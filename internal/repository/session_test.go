@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestSessionRepository_Revoke(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewSessionRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	session := &model.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := repo.Create(session); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	found, err := repo.ByID(session.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !found.IsActive() {
+		t.Error("expected new session to be active")
+	}
+
+	if err := repo.Revoke(session.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	found, err = repo.ByID(session.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if found.IsActive() {
+		t.Error("expected revoked session to be inactive")
+	}
+}
+
+func TestSessionRepository_RevokeAllByUserID(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewSessionRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	sessions := []*model.Session{
+		{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)},
+		{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)},
+	}
+	for _, session := range sessions {
+		if err := repo.Create(session); err != nil {
+			t.Fatalf("failed to create session: %v", err)
+		}
+	}
+
+	if err := repo.RevokeAllByUserID(user.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, session := range sessions {
+		found, err := repo.ByID(session.ID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !found.IsRevoked() {
+			t.Errorf("expected session %s to be revoked", session.ID)
+		}
+	}
+
+	_, err := repo.ByID(uuid.New())
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestSessionRepository_ActiveByUserID(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewSessionRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	active := &model.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	revoked := &model.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	expired := &model.Session{UserID: user.ID, ExpiresAt: time.Now().Add(-time.Hour)}
+	for _, session := range []*model.Session{active, revoked, expired} {
+		if err := repo.Create(session); err != nil {
+			t.Fatalf("failed to create session: %v", err)
+		}
+	}
+	if err := repo.Revoke(revoked.ID); err != nil {
+		t.Fatalf("failed to revoke session: %v", err)
+	}
+
+	seenAt := time.Now()
+	if err := repo.Touch(active.ID, "Mozilla/5.0", "203.0.113.7", seenAt); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	sessions, err := repo.ActiveByUserID(user.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != active.ID {
+		t.Fatalf("expected only the active session, got %+v", sessions)
+	}
+	if sessions[0].UserAgent != "Mozilla/5.0" || sessions[0].IPAddress != "203.0.113.7" || sessions[0].LastSeenAt == nil {
+		t.Errorf("expected client info to be recorded, got %+v", sessions[0])
+	}
+}
+
+func TestSessionRepository_ConsumeRefreshToken(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewSessionRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	session := &model.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := repo.Create(session); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	token := &model.RefreshToken{SessionID: session.ID, TokenHash: "hash-1", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := repo.CreateRefreshToken(token); err != nil {
+		t.Fatalf("failed to create refresh token: %v", err)
+	}
+
+	consumed, err := repo.ConsumeRefreshToken("hash-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !consumed.IsUsed() || consumed.SessionID != session.ID {
+		t.Errorf("expected consumed token of session %s, got %+v", session.ID, consumed)
+	}
+
+	// A second exchange fails, but the token can still be found to detect reuse
+	_, err = repo.ConsumeRefreshToken("hash-1")
+	if !errors.Is(err, ErrRefreshTokenNotFound) {
+		t.Errorf("expected ErrRefreshTokenNotFound, got %v", err)
+	}
+	found, err := repo.RefreshTokenByHash("hash-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !found.IsUsed() {
+		t.Error("expected token to be marked used")
+	}
+}
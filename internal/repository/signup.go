@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"github.com/jmoiron/sqlx"
+
+	"dotsat.work/internal/model"
+)
+
+type SignupRepository interface {
+	CreateOrganization(tenant *model.Tenant, user *model.User, profile *model.Profile) error
+	CreateMember(user *model.User, profile *model.Profile) error
+}
+
+type signupRepository struct {
+	db *sqlx.DB
+}
+
+func NewSignupRepository(db *sqlx.DB) SignupRepository {
+	return &signupRepository{db: db}
+}
+
+// CreateOrganization creates a tenant, its first user and that user's profile in one transaction.
+// If any insert fails nothing is created, so a failed signup never leaves an orphaned tenant.
+func (r *signupRepository) CreateOrganization(tenant *model.Tenant, user *model.User, profile *model.Profile) error {
+	return withTx(r.db, func(tx *sqlx.Tx) error {
+		err := NewTenantRepository(tx).Create(tenant)
+		if err != nil {
+			return err
+		}
+
+		err = NewUserRepository(tx).Create(user)
+		if err != nil {
+			return err
+		}
+
+		return NewProfileRepository(tx).Create(profile)
+	})
+}
+
+// CreateMember adds a user and their profile to an existing tenant in one transaction
+func (r *signupRepository) CreateMember(user *model.User, profile *model.Profile) error {
+	return withTx(r.db, func(tx *sqlx.Tx) error {
+		err := NewUserRepository(tx).Create(user)
+		if err != nil {
+			return err
+		}
+
+		return NewProfileRepository(tx).Create(profile)
+	})
+}
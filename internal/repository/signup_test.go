@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+)
+
+func newSignupModels(subdomain, email string) (*model.Tenant, *model.User, *model.Profile) {
+	tenant := &model.Tenant{
+		ID:        uuid.New(),
+		Name:      "Signup Corp",
+		Subdomain: subdomain,
+		Status:    "active",
+		Tier:      "free",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	user := &model.User{
+		ID:        uuid.New(),
+		TenantID:  tenant.ID,
+		Email:     email,
+		Role:      "admin",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	profile := &model.Profile{
+		UserID: user.ID,
+	}
+	return tenant, user, profile
+}
+
+func TestSignupRepository_CreateOrganization(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewSignupRepository(db)
+	tenant, user, profile := newSignupModels("signup", "admin@signup.example.com")
+
+	err := repo.CreateOrganization(tenant, user, profile)
+	if err != nil {
+		t.Fatalf("failed to create organization: %v", err)
+	}
+
+	if _, err := NewTenantRepository(db).ByID(tenant.ID); err != nil {
+		t.Errorf("expected tenant to exist, got %v", err)
+	}
+	if _, err := NewUserRepository(db).ByID(user.ID); err != nil {
+		t.Errorf("expected user to exist, got %v", err)
+	}
+	if _, err := NewProfileRepository(db).ByUserID(user.ID); err != nil {
+		t.Errorf("expected profile to exist, got %v", err)
+	}
+}
+
+func TestSignupRepository_CreateOrganization_RollsBack(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewSignupRepository(db)
+
+	tenant, user, profile := newSignupModels("first", "taken@example.com")
+	err := repo.CreateOrganization(tenant, user, profile)
+	if err != nil {
+		t.Fatalf("failed to create first organization: %v", err)
+	}
+
+	// The email is already taken, so the new tenant must not survive
+	orphan, duplicate, duplicateProfile := newSignupModels("orphan", "taken@example.com")
+	err = repo.CreateOrganization(orphan, duplicate, duplicateProfile)
+	if !errors.Is(err, ErrDuplicateEmail) {
+		t.Fatalf("expected ErrDuplicateEmail, got %v", err)
+	}
+
+	_, err = NewTenantRepository(db).ByID(orphan.ID)
+	if !errors.Is(err, ErrTenantNotFound) {
+		t.Errorf("expected tenant to be rolled back, got %v", err)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"strings"
 
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 
 	"dotsat.work/internal/model"
 )
@@ -26,17 +25,17 @@ type TenantRepository interface {
 }
 
 type tenantRepository struct {
-	db *sqlx.DB
+	db DBTX
 }
 
-func NewTenantRepository(db *sqlx.DB) TenantRepository {
+func NewTenantRepository(db DBTX) TenantRepository {
 	return &tenantRepository{db: db}
 }
 
 func (r *tenantRepository) Create(tenant *model.Tenant) error {
 	query := `
-		INSERT INTO tenants (id, name, subdomain, status, tier, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO tenants (id, name, subdomain, status, tier, sso_enforced, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 
 	_, err := r.db.Exec(
@@ -46,6 +45,7 @@ func (r *tenantRepository) Create(tenant *model.Tenant) error {
 		tenant.Subdomain,
 		tenant.Status,
 		tenant.Tier,
+		tenant.SSOEnforced,
 		tenant.CreatedAt,
 		tenant.UpdatedAt,
 	)
@@ -87,8 +87,8 @@ func (r *tenantRepository) BySubdomain(subdomain string) (*model.Tenant, error)
 func (r *tenantRepository) Update(tenant *model.Tenant) error {
 	query := `
 		UPDATE tenants
-		SET name = $1, subdomain = $2, status = $3, tier = $4, updated_at = $5
-		WHERE id = $6
+		SET name = $1, subdomain = $2, status = $3, tier = $4, sso_enforced = $5, updated_at = $6
+		WHERE id = $7
 	`
 
 	result, err := r.db.Exec(
@@ -97,6 +97,7 @@ func (r *tenantRepository) Update(tenant *model.Tenant) error {
 		tenant.Subdomain,
 		tenant.Status,
 		tenant.Tier,
+		tenant.SSOEnforced,
 		tenant.UpdatedAt,
 		tenant.ID,
 	)
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+)
+
+var ErrTenantSettingsNotFound = errors.New("tenant settings not found")
+
+type TenantSettingsRepository interface {
+	ByTenantID(tenantID uuid.UUID) (*model.TenantSettings, error)
+	Upsert(settings *model.TenantSettings) error
+}
+
+type tenantSettingsRepository struct {
+	db DBTX
+}
+
+func NewTenantSettingsRepository(db DBTX) TenantSettingsRepository {
+	return &tenantSettingsRepository{db: db}
+}
+
+func (r *tenantSettingsRepository) ByTenantID(tenantID uuid.UUID) (*model.TenantSettings, error) {
+	settings := &model.TenantSettings{}
+	query := `
+		SELECT id, tenant_id, logo_url,
+		       COALESCE(primary_color, $2) AS primary_color,
+		       COALESCE(timezone, $3) AS timezone,
+		       created_at, updated_at
+		FROM tenant_settings
+		WHERE tenant_id = $1
+	`
+
+	err := r.db.Get(settings, query, tenantID, model.DefaultPrimaryColor, model.DefaultTimezone)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTenantSettingsNotFound
+	}
+
+	return settings, err
+}
+
+// Upsert creates the tenant's settings or updates them if they already exist
+func (r *tenantSettingsRepository) Upsert(settings *model.TenantSettings) error {
+	if settings.ID == uuid.Nil {
+		settings.ID = uuid.New()
+	}
+	now := time.Now()
+	if settings.CreatedAt.IsZero() {
+		settings.CreatedAt = now
+	}
+	settings.UpdatedAt = now
+
+	query := `
+		INSERT INTO tenant_settings (id, tenant_id, logo_url, primary_color, timezone, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (tenant_id) DO UPDATE
+		SET logo_url = EXCLUDED.logo_url,
+		    primary_color = EXCLUDED.primary_color,
+		    timezone = EXCLUDED.timezone,
+		    updated_at = EXCLUDED.updated_at
+		RETURNING id, created_at
+	`
+
+	return r.db.QueryRowx(
+		query,
+		settings.ID,
+		settings.TenantID,
+		settings.LogoURL,
+		settings.PrimaryColor,
+		settings.Timezone,
+		settings.CreatedAt,
+		settings.UpdatedAt,
+	).Scan(&settings.ID, &settings.CreatedAt)
+}
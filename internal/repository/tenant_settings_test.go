@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+)
+
+func TestTenantSettingsRepository_Upsert(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	tenant := createTestTenant(t, db)
+	repo := NewTenantSettingsRepository(db)
+
+	_, err := repo.ByTenantID(tenant.ID)
+	if !errors.Is(err, ErrTenantSettingsNotFound) {
+		t.Fatalf("expected ErrTenantSettingsNotFound before upsert, got %v", err)
+	}
+
+	logoURL := "https://cdn.example.com/logo.png"
+	settings := &model.TenantSettings{
+		TenantID:     tenant.ID,
+		LogoURL:      &logoURL,
+		PrimaryColor: "#112233",
+		Timezone:     "Europe/Berlin",
+	}
+
+	err = repo.Upsert(settings)
+	if err != nil {
+		t.Fatalf("failed to insert settings: %v", err)
+	}
+	firstID := settings.ID
+
+	// Upserting again updates the same row
+	updated := &model.TenantSettings{
+		TenantID:     tenant.ID,
+		PrimaryColor: "#445566",
+		Timezone:     "UTC",
+	}
+	err = repo.Upsert(updated)
+	if err != nil {
+		t.Fatalf("failed to update settings: %v", err)
+	}
+
+	if updated.ID != firstID {
+		t.Errorf("expected upsert to keep ID %v, got %v", firstID, updated.ID)
+	}
+
+	found, err := repo.ByTenantID(tenant.ID)
+	if err != nil {
+		t.Fatalf("failed to find settings: %v", err)
+	}
+
+	if found.PrimaryColor != "#445566" {
+		t.Errorf("expected primary color %q, got %q", "#445566", found.PrimaryColor)
+	}
+
+	if found.LogoURL != nil {
+		t.Errorf("expected logo URL to be cleared, got %q", *found.LogoURL)
+	}
+
+	_, err = repo.ByTenantID(uuid.New())
+	if !errors.Is(err, ErrTenantSettingsNotFound) {
+		t.Errorf("expected ErrTenantSettingsNotFound for unknown tenant, got %v", err)
+	}
+}
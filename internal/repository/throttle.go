@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+type ThrottleRepository interface {
+	Record(event *model.ThrottleEvent) error
+	StatsByEmailSince(action, email string, since time.Time) (*model.ThrottleStats, error)
+	StatsByIPSince(action, ipAddress string, since time.Time) (*model.ThrottleStats, error)
+	StatsByUserSince(action string, userID uuid.UUID, since time.Time) (*model.ThrottleStats, error)
+	DeleteByEmail(action, email string) error
+	CleanupExpired(olderThan time.Duration) (int64, error)
+}
+
+type throttleRepository struct {
+	db DBTX
+}
+
+func NewThrottleRepository(db DBTX) ThrottleRepository {
+	return &throttleRepository{db: db}
+}
+
+func (r *throttleRepository) Record(event *model.ThrottleEvent) error {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO throttle_events (id, action, email, ip_address, user_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(query, event.ID, event.Action, event.Email, event.IPAddress, event.UserID, event.CreatedAt)
+	return err
+}
+
+// StatsByEmailSince counts the events of the given action for an email since the given time
+func (r *throttleRepository) StatsByEmailSince(action, email string, since time.Time) (*model.ThrottleStats, error) {
+	var stats model.ThrottleStats
+	query := `
+		SELECT COUNT(*) AS count, MAX(created_at) AS last_at
+		FROM throttle_events
+		WHERE action = $1 AND email = $2 AND created_at >= $3
+	`
+	err := r.db.Get(&stats, query, action, email, since)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// StatsByIPSince counts the events of the given action from a client IP since the given time
+func (r *throttleRepository) StatsByIPSince(action, ipAddress string, since time.Time) (*model.ThrottleStats, error) {
+	var stats model.ThrottleStats
+	query := `
+		SELECT COUNT(*) AS count, MAX(created_at) AS last_at
+		FROM throttle_events
+		WHERE action = $1 AND ip_address = $2 AND created_at >= $3
+	`
+	err := r.db.Get(&stats, query, action, ipAddress, since)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// StatsByUserSince counts the events of the given action for an account since the given time
+func (r *throttleRepository) StatsByUserSince(action string, userID uuid.UUID, since time.Time) (*model.ThrottleStats, error) {
+	var stats model.ThrottleStats
+	query := `
+		SELECT COUNT(*) AS count, MAX(created_at) AS last_at
+		FROM throttle_events
+		WHERE action = $1 AND user_id = $2 AND created_at >= $3
+	`
+	err := r.db.Get(&stats, query, action, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// DeleteByEmail forgets the email's events of the given action, e.g. after a successful sign-in
+func (r *throttleRepository) DeleteByEmail(action, email string) error {
+	query := `DELETE FROM throttle_events WHERE action = $1 AND email = $2`
+	_, err := r.db.Exec(query, action, email)
+	return err
+}
+
+// CleanupExpired removes events older than the given duration.
+// Events only matter within their throttling window, so this is run periodically.
+func (r *throttleRepository) CleanupExpired(olderThan time.Duration) (int64, error) {
+	query := `DELETE FROM throttle_events WHERE created_at < $1`
+	result, err := r.db.Exec(query, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
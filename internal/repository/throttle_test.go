@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+)
+
+func TestThrottleRepository_Stats(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	if _, err := db.Exec("TRUNCATE TABLE throttle_events"); err != nil {
+		t.Fatalf("failed to clean throttle events: %v", err)
+	}
+
+	repo := NewThrottleRepository(db)
+
+	now := time.Now()
+	events := []*model.ThrottleEvent{
+		{Action: model.ThrottleActionLoginFailure, Email: "a@example.com", IPAddress: "192.0.2.1", CreatedAt: now.Add(-time.Hour)},
+		{Action: model.ThrottleActionLoginFailure, Email: "a@example.com", IPAddress: "192.0.2.1", CreatedAt: now.Add(-time.Minute)},
+		{Action: model.ThrottleActionLoginFailure, Email: "b@example.com", IPAddress: "192.0.2.1", CreatedAt: now},
+		{Action: model.ThrottleActionMagicLink, Email: "a@example.com", IPAddress: "192.0.2.2", CreatedAt: now},
+	}
+	for _, event := range events {
+		if err := repo.Record(event); err != nil {
+			t.Fatalf("failed to record event: %v", err)
+		}
+	}
+
+	stats, err := repo.StatsByEmailSince(model.ThrottleActionLoginFailure, "a@example.com", now.Add(-10*time.Minute))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stats.Count != 1 || stats.LastAt == nil || !stats.LastAt.Equal(events[1].CreatedAt.Truncate(time.Microsecond)) {
+		t.Errorf("expected 1 recent failure for a@example.com, got %+v", stats)
+	}
+
+	stats, err = repo.StatsByIPSince(model.ThrottleActionLoginFailure, "192.0.2.1", now.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stats.Count != 3 {
+		t.Errorf("expected 3 failures from 192.0.2.1, got %d", stats.Count)
+	}
+
+	if err := repo.DeleteByEmail(model.ThrottleActionLoginFailure, "a@example.com"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	stats, err = repo.StatsByEmailSince(model.ThrottleActionLoginFailure, "a@example.com", now.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stats.Count != 0 || stats.LastAt != nil {
+		t.Errorf("expected no failures after delete, got %+v", stats)
+	}
+
+	// Other actions for the same email are kept
+	stats, err = repo.StatsByEmailSince(model.ThrottleActionMagicLink, "a@example.com", now.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stats.Count != 1 {
+		t.Errorf("expected magic link event to be kept, got %d", stats.Count)
+	}
+
+	old := &model.ThrottleEvent{Action: model.ThrottleActionMagicLink, Email: "a@example.com", IPAddress: "192.0.2.2", CreatedAt: now.Add(-48 * time.Hour)}
+	if err := repo.Record(old); err != nil {
+		t.Fatalf("failed to record event: %v", err)
+	}
+	deleted, err := repo.CleanupExpired(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected only the old event to be cleaned up, got %d", deleted)
+	}
+}
+
+func TestThrottleRepository_StatsByUserSince(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewThrottleRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	now := time.Now()
+	events := []*model.ThrottleEvent{
+		{Action: model.ThrottleActionTwoFactorFailure, Email: user.Email, UserID: &user.ID, CreatedAt: now.Add(-time.Hour)},
+		{Action: model.ThrottleActionTwoFactorFailure, Email: user.Email, UserID: &user.ID, CreatedAt: now},
+		{Action: model.ThrottleActionLoginFailure, Email: user.Email, UserID: &user.ID, CreatedAt: now},
+	}
+	for _, event := range events {
+		if err := repo.Record(event); err != nil {
+			t.Fatalf("failed to record event: %v", err)
+		}
+	}
+
+	stats, err := repo.StatsByUserSince(model.ThrottleActionTwoFactorFailure, user.ID, now.Add(-10*time.Minute))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stats.Count != 1 || stats.LastAt == nil {
+		t.Errorf("expected 1 recent failure for the user, got %+v", stats)
+	}
+}
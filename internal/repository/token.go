@@ -7,7 +7,6 @@ import (
 
 	"dotsat.work/internal/model"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 )
 
 var (
@@ -18,15 +17,17 @@ var (
 
 type TokenRepository interface {
 	Create(token *model.Token) error
-	ConsumeToken(token string) (*model.Token, error)
+	// ConsumeToken marks an unused, unexpired token of the given type as used and returns it
+	ConsumeToken(token, tokenType string) (*model.Token, error)
+	ByToken(token string) (*model.Token, error)
 	DeleteByUserAndType(userID uuid.UUID, tokenType string) error
 }
 
 type tokenRepository struct {
-	db *sqlx.DB
+	db DBTX
 }
 
-func NewTokenRepository(db *sqlx.DB) TokenRepository {
+func NewTokenRepository(db DBTX) TokenRepository {
 	return &tokenRepository{db: db}
 }
 
@@ -55,8 +56,9 @@ func (r *tokenRepository) Create(token *model.Token) error {
 
 // ConsumeToken atomically marks the token as used and returns it
 // This prevents race conditions where two requests could use the same token
-// Only the first request will succeed, the second will get ErrTokenNotFound
-func (r *tokenRepository) ConsumeToken(token string) (*model.Token, error) {
+// Only the first request will succeed, the second will get ErrTokenNotFound.
+// A token of another type is left alone, so a link opened at the wrong endpoint keeps working.
+func (r *tokenRepository) ConsumeToken(token, tokenType string) (*model.Token, error) {
 	var t model.Token
 	now := time.Now()
 
@@ -66,12 +68,35 @@ func (r *tokenRepository) ConsumeToken(token string) (*model.Token, error) {
 		UPDATE tokens
 		SET used_at = $1
 		WHERE token = $2
+		AND type = $3
 		AND used_at IS NULL
-		AND expires_at > $3
+		AND expires_at > $4
 		RETURNING id, user_id, type, token, expires_at, used_at, created_at
 	`
 
-	err := r.db.Get(&t, query, now, token, now)
+	err := r.db.Get(&t, query, now, token, tokenType, now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// ByToken returns the token if it can still be consumed, without consuming it
+func (r *tokenRepository) ByToken(token string) (*model.Token, error) {
+	var t model.Token
+	query := `
+		SELECT id, user_id, type, token, expires_at, used_at, created_at
+		FROM tokens
+		WHERE token = $1
+		AND used_at IS NULL
+		AND expires_at > $2
+	`
+
+	err := r.db.Get(&t, query, token, time.Now())
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, ErrTokenNotFound
 	}
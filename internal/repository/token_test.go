@@ -135,8 +135,14 @@ func TestTokenRepository_ConsumeToken(t *testing.T) {
 		t.Fatalf("failed to create token: %v", err)
 	}
 
+	// A token presented as another type is left unused
+	_, err = repo.ConsumeToken("valid-token", model.TokenTypePasswordReset)
+	if !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("expected ErrTokenNotFound for the wrong type, got %v", err)
+	}
+
 	// Consume the token
-	consumed, err := repo.ConsumeToken(`valid-token`)
+	consumed, err := repo.ConsumeToken("valid-token", model.TokenTypeMagicLink)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -146,12 +152,56 @@ func TestTokenRepository_ConsumeToken(t *testing.T) {
 	}
 
 	// Try to consume again - should fail
-	_, err = repo.ConsumeToken("valid-token")
+	_, err = repo.ConsumeToken("valid-token", model.TokenTypeMagicLink)
 	if !errors.Is(err, ErrTokenNotFound) {
 		t.Errorf("expected ErrTokenNotFound, got %v", err)
 	}
 }
 
+func TestTokenRepository_ByToken(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewTokenRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	token := &model.Token{
+		UserID:    user.ID,
+		Type:      model.TokenTypePasswordReset,
+		Token:     "valid-token",
+		ExpiresAt: time.Now().Add(15 * time.Minute),
+	}
+	err := repo.Create(token)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	found, err := repo.ByToken("valid-token")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if found.UserID != user.ID || found.UsedAt != nil {
+		t.Errorf("expected the unused token, got %+v", found)
+	}
+
+	// Looking the token up doesn't consume it
+	_, err = repo.ConsumeToken("valid-token", model.TokenTypePasswordReset)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	_, err = repo.ByToken("valid-token")
+	if !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("expected ErrTokenNotFound for a used token, got %v", err)
+	}
+}
+
 func TestTokenRepository_ConsumeToken_Expired(t *testing.T) {
 	db := setupTokenTestDB(t)
 	defer func() {
@@ -179,7 +229,7 @@ func TestTokenRepository_ConsumeToken_Expired(t *testing.T) {
 	}
 
 	// Try to consume - should fail
-	_, err = repo.ConsumeToken("expired-token")
+	_, err = repo.ConsumeToken("expired-token", model.TokenTypeMagicLink)
 	if !errors.Is(err, ErrTokenNotFound) {
 		t.Errorf("expected ErrTokenNotFound for expired token, got %v", err)
 	}
@@ -236,18 +286,18 @@ func TestTokenRepository_DeleteByUserAndType(t *testing.T) {
 	}
 
 	// Magic link tokens should be gone
-	_, err = repo.ConsumeToken("token-1")
+	_, err = repo.ConsumeToken("token-1", model.TokenTypeMagicLink)
 	if !errors.Is(err, ErrTokenNotFound) {
 		t.Error("expected token-1 to be deleted")
 	}
 
-	_, err = repo.ConsumeToken("token-2")
+	_, err = repo.ConsumeToken("token-2", model.TokenTypeMagicLink)
 	if !errors.Is(err, ErrTokenNotFound) {
 		t.Error("expected token-2 to be deleted")
 	}
 
 	// Password reset token should still exist
-	_, err = repo.ConsumeToken("token-3")
+	_, err = repo.ConsumeToken("token-3", model.TokenTypePasswordReset)
 	if err != nil {
 		t.Error("expected token-3 to still exist")
 	}
@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTOTPNotFound         = errors.New("totp credential not found")
+	ErrTOTPStepUsed         = errors.New("totp code already used")
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+	ErrChallengeNotFound    = errors.New("two-factor challenge not found")
+)
+
+type TwoFactorRepository interface {
+	UpsertTOTP(credential *model.TOTPCredential) error
+	TOTPByUserID(userID uuid.UUID) (*model.TOTPCredential, error)
+	ConfirmTOTP(userID uuid.UUID) error
+	MarkTOTPStepUsed(userID uuid.UUID, step int64) error
+	DeleteTOTP(userID uuid.UUID) error
+
+	ReplaceRecoveryCodes(userID uuid.UUID, codeHashes []string) error
+	ConsumeRecoveryCode(userID uuid.UUID, codeHash string) error
+	CountUnusedRecoveryCodes(userID uuid.UUID) (int, error)
+
+	CreateChallenge(challenge *model.TwoFactorChallenge) error
+	ActiveChallengeByHash(tokenHash string) (*model.TwoFactorChallenge, error)
+	IncrementChallengeAttempts(id uuid.UUID) (int, error)
+	ConsumeChallenge(id uuid.UUID) error
+	CleanupExpiredChallenges(olderThan time.Duration) (int64, error)
+}
+
+type twoFactorRepository struct {
+	db DBTX
+}
+
+func NewTwoFactorRepository(db DBTX) TwoFactorRepository {
+	return &twoFactorRepository{db: db}
+}
+
+// UpsertTOTP stores a new, unconfirmed secret, replacing any earlier enrollment attempt
+func (r *twoFactorRepository) UpsertTOTP(credential *model.TOTPCredential) error {
+	now := time.Now()
+	credential.CreatedAt = now
+	credential.UpdatedAt = now
+
+	query := `
+		INSERT INTO totp_credentials (user_id, secret, created_at, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, confirmed_at = NULL, last_used_step = NULL, updated_at = EXCLUDED.updated_at
+	`
+	_, err := r.db.Exec(query, credential.UserID, credential.Secret, credential.CreatedAt, credential.UpdatedAt)
+	return err
+}
+
+func (r *twoFactorRepository) TOTPByUserID(userID uuid.UUID) (*model.TOTPCredential, error) {
+	var credential model.TOTPCredential
+	query := `
+		SELECT user_id, secret, confirmed_at, last_used_step, created_at, updated_at
+		FROM totp_credentials
+		WHERE user_id = $1
+	`
+	err := r.db.Get(&credential, query, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTOTPNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (r *twoFactorRepository) ConfirmTOTP(userID uuid.UUID) error {
+	query := `UPDATE totp_credentials SET confirmed_at = $1, updated_at = $1 WHERE user_id = $2`
+	result, err := r.db.Exec(query, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrTOTPNotFound
+	}
+
+	return nil
+}
+
+// MarkTOTPStepUsed atomically records the time step of an accepted code.
+// It fails with ErrTOTPStepUsed for the same or an earlier step, so a code can't be replayed.
+func (r *twoFactorRepository) MarkTOTPStepUsed(userID uuid.UUID, step int64) error {
+	query := `
+		UPDATE totp_credentials
+		SET last_used_step = $1, updated_at = $2
+		WHERE user_id = $3
+		AND (last_used_step IS NULL OR last_used_step < $1)
+	`
+	result, err := r.db.Exec(query, step, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrTOTPStepUsed
+	}
+
+	return nil
+}
+
+// DeleteTOTP removes the authenticator and the recovery codes that belong to it
+func (r *twoFactorRepository) DeleteTOTP(userID uuid.UUID) error {
+	query := `
+		WITH codes AS (DELETE FROM recovery_codes WHERE user_id = $1)
+		DELETE FROM totp_credentials WHERE user_id = $1
+	`
+	_, err := r.db.Exec(query, userID)
+	return err
+}
+
+// ReplaceRecoveryCodes atomically swaps all of the user's recovery codes for new ones
+func (r *twoFactorRepository) ReplaceRecoveryCodes(userID uuid.UUID, codeHashes []string) error {
+	query := `
+		WITH deleted AS (DELETE FROM recovery_codes WHERE user_id = $1)
+		INSERT INTO recovery_codes (user_id, code_hash, created_at)
+		SELECT $1, code_hash, $3 FROM unnest($2::text[]) AS code_hash
+	`
+	_, err := r.db.Exec(query, userID, codeHashes, time.Now())
+	return err
+}
+
+// ConsumeRecoveryCode atomically marks an unused recovery code as used
+func (r *twoFactorRepository) ConsumeRecoveryCode(userID uuid.UUID, codeHash string) error {
+	query := `UPDATE recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+
+	return nil
+}
+
+func (r *twoFactorRepository) CountUnusedRecoveryCodes(userID uuid.UUID) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	err := r.db.Get(&count, query, userID)
+	return count, err
+}
+
+func (r *twoFactorRepository) CreateChallenge(challenge *model.TwoFactorChallenge) error {
+	if challenge.ID == uuid.Nil {
+		challenge.ID = uuid.New()
+	}
+	if challenge.CreatedAt.IsZero() {
+		challenge.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO two_factor_challenges (id, user_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.db.Exec(query, challenge.ID, challenge.UserID, challenge.TokenHash, challenge.ExpiresAt, challenge.CreatedAt)
+	return err
+}
+
+// ActiveChallengeByHash returns an unexpired, unconsumed challenge
+func (r *twoFactorRepository) ActiveChallengeByHash(tokenHash string) (*model.TwoFactorChallenge, error) {
+	var challenge model.TwoFactorChallenge
+	query := `
+		SELECT id, user_id, token_hash, attempts, expires_at, consumed_at, created_at
+		FROM two_factor_challenges
+		WHERE token_hash = $1 AND consumed_at IS NULL AND expires_at > $2
+	`
+	err := r.db.Get(&challenge, query, tokenHash, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// IncrementChallengeAttempts counts a verification attempt and returns the new total
+func (r *twoFactorRepository) IncrementChallengeAttempts(id uuid.UUID) (int, error) {
+	var attempts int
+	query := `UPDATE two_factor_challenges SET attempts = attempts + 1 WHERE id = $1 RETURNING attempts`
+	err := r.db.Get(&attempts, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrChallengeNotFound
+	}
+	return attempts, err
+}
+
+// ConsumeChallenge atomically marks the challenge as completed; only one request can succeed
+func (r *twoFactorRepository) ConsumeChallenge(id uuid.UUID) error {
+	query := `UPDATE two_factor_challenges SET consumed_at = $1 WHERE id = $2 AND consumed_at IS NULL`
+	result, err := r.db.Exec(query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrChallengeNotFound
+	}
+
+	return nil
+}
+
+// CleanupExpiredChallenges removes challenges that expired more than olderThan ago.
+// Consumed challenges expire like any other, so they are removed too.
+func (r *twoFactorRepository) CleanupExpiredChallenges(olderThan time.Duration) (int64, error) {
+	query := `DELETE FROM two_factor_challenges WHERE expires_at < $1`
+	result, err := r.db.Exec(query, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
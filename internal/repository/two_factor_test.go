@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+)
+
+func TestTwoFactorRepository_MarkTOTPStepUsed(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewTwoFactorRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	if err := repo.UpsertTOTP(&model.TOTPCredential{UserID: user.ID, Secret: "JBSWY3DPEHPK3PXP"}); err != nil {
+		t.Fatalf("failed to store totp credential: %v", err)
+	}
+	if err := repo.ConfirmTOTP(user.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := repo.MarkTOTPStepUsed(user.ID, 100); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, step := range []int64{100, 99} {
+		if err := repo.MarkTOTPStepUsed(user.ID, step); !errors.Is(err, ErrTOTPStepUsed) {
+			t.Errorf("step %d: expected ErrTOTPStepUsed, got %v", step, err)
+		}
+	}
+
+	found, err := repo.TOTPByUserID(user.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !found.IsConfirmed() || found.LastUsedStep == nil || *found.LastUsedStep != 100 {
+		t.Errorf("expected confirmed credential at step 100, got %+v", found)
+	}
+}
+
+func TestTwoFactorRepository_RecoveryCodes(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewTwoFactorRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	if err := repo.ReplaceRecoveryCodes(user.ID, []string{"hash-a", "hash-b"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := repo.ConsumeRecoveryCode(user.ID, "hash-a"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := repo.ConsumeRecoveryCode(user.ID, "hash-a"); !errors.Is(err, ErrRecoveryCodeNotFound) {
+		t.Errorf("expected ErrRecoveryCodeNotFound for a used code, got %v", err)
+	}
+
+	count, err := repo.CountUnusedRecoveryCodes(user.ID)
+	if err != nil || count != 1 {
+		t.Errorf("expected 1 unused code, got %d (%v)", count, err)
+	}
+
+	// Replacing drops the old set, used or not
+	if err := repo.ReplaceRecoveryCodes(user.ID, []string{"hash-c"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := repo.ConsumeRecoveryCode(user.ID, "hash-b"); !errors.Is(err, ErrRecoveryCodeNotFound) {
+		t.Errorf("expected ErrRecoveryCodeNotFound for a replaced code, got %v", err)
+	}
+}
+
+func TestTwoFactorRepository_Challenge(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewTwoFactorRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	challenge := &model.TwoFactorChallenge{UserID: user.ID, TokenHash: "challenge-hash", ExpiresAt: time.Now().Add(time.Minute)}
+	if err := repo.CreateChallenge(challenge); err != nil {
+		t.Fatalf("failed to create challenge: %v", err)
+	}
+
+	attempts, err := repo.IncrementChallengeAttempts(challenge.ID)
+	if err != nil || attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d (%v)", attempts, err)
+	}
+
+	if err := repo.ConsumeChallenge(challenge.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := repo.ConsumeChallenge(challenge.ID); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("expected ErrChallengeNotFound on second consume, got %v", err)
+	}
+	if _, err := repo.ActiveChallengeByHash("challenge-hash"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("expected consumed challenge to be inactive, got %v", err)
+	}
+
+	expired := &model.TwoFactorChallenge{UserID: user.ID, TokenHash: "expired-hash", ExpiresAt: time.Now().Add(-2 * time.Hour)}
+	if err := repo.CreateChallenge(expired); err != nil {
+		t.Fatalf("failed to create challenge: %v", err)
+	}
+	deleted, err := repo.CleanupExpiredChallenges(time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected only the long expired challenge to be cleaned up, got %d", deleted)
+	}
+}
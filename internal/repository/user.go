@@ -6,7 +6,6 @@ import (
 	"strings"
 
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 
 	"dotsat.work/internal/model"
 )
@@ -21,23 +20,26 @@ type UserRepository interface {
 	Create(user *model.User) error
 	ByID(id uuid.UUID) (*model.User, error)
 	ByEmail(email string) (*model.User, error)
+	ByTenantAndEmail(tenantID uuid.UUID, email string) (*model.User, error)
 	ByTenantID(tenantID uuid.UUID) ([]*model.User, error)
 	Update(user *model.User) error
+	UpdatePasswordHash(id uuid.UUID, oldHash, newHash string) error
+	ConfirmPendingEmail(id uuid.UUID) error
 	Delete(id uuid.UUID) error
 }
 
 type userRepository struct {
-	db *sqlx.DB
+	db DBTX
 }
 
-func NewUserRepository(db *sqlx.DB) UserRepository {
+func NewUserRepository(db DBTX) UserRepository {
 	return &userRepository{db: db}
 }
 
 func (r *userRepository) Create(user *model.User) error {
 	query := `
-		INSERT INTO users (id, tenant_id, email, password_hash, role, pending_email, email_verified_at, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO users (id, tenant_id, email, password_hash, role, pending_email, email_verified_at, password_changed_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
 
 	_, err := r.db.Exec(
@@ -49,6 +51,7 @@ func (r *userRepository) Create(user *model.User) error {
 		user.Role,
 		user.PendingEmail,
 		user.EmailVerifiedAt,
+		user.PasswordChangedAt,
 		user.CreatedAt,
 		user.UpdatedAt,
 	)
@@ -87,6 +90,18 @@ func (r *userRepository) ByEmail(email string) (*model.User, error) {
 	return user, err
 }
 
+func (r *userRepository) ByTenantAndEmail(tenantID uuid.UUID, email string) (*model.User, error) {
+	user := &model.User{}
+	query := `SELECT * FROM users WHERE tenant_id = $1 AND email = $2`
+
+	err := r.db.Get(user, query, tenantID, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+
+	return user, err
+}
+
 func (r *userRepository) ByTenantID(tenantID uuid.UUID) ([]*model.User, error) {
 	var users []*model.User
 	query := `SELECT * FROM users WHERE tenant_id = $1 ORDER BY created_at DESC`
@@ -98,8 +113,8 @@ func (r *userRepository) ByTenantID(tenantID uuid.UUID) ([]*model.User, error) {
 func (r *userRepository) Update(user *model.User) error {
 	query := `
 		UPDATE users
-		SET email = $1, password_hash = $2, role = $3, pending_email = $4, email_verified_at = $5, updated_at = $6
-		WHERE id = $7
+		SET email = $1, password_hash = $2, role = $3, pending_email = $4, email_verified_at = $5, password_changed_at = $6, updated_at = $7
+		WHERE id = $8
 	`
 
 	result, err := r.db.Exec(
@@ -109,6 +124,7 @@ func (r *userRepository) Update(user *model.User) error {
 		user.Role,
 		user.PendingEmail,
 		user.EmailVerifiedAt,
+		user.PasswordChangedAt,
 		user.UpdatedAt,
 		user.ID,
 	)
@@ -128,6 +144,45 @@ func (r *userRepository) Update(user *model.User) error {
 	return nil
 }
 
+// UpdatePasswordHash replaces a password hash with a rehash of the same password. It only
+// applies while the hash is still oldHash, so a concurrent password change wins.
+func (r *userRepository) UpdatePasswordHash(id uuid.UUID, oldHash, newHash string) error {
+	query := `UPDATE users SET password_hash = $1 WHERE id = $2 AND password_hash = $3`
+
+	_, err := r.db.Exec(query, newHash, id, oldHash)
+	return err
+}
+
+// ConfirmPendingEmail atomically replaces the user's email with their pending email.
+// The global unique constraint on email is enforced by the same statement,
+// so a concurrent signup with the new address makes this fail with ErrDuplicateEmail.
+func (r *userRepository) ConfirmPendingEmail(id uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET email = pending_email, pending_email = NULL, email_verified_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND pending_email IS NOT NULL
+	`
+
+	result, err := r.db.Exec(query, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value") {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
 func (r *userRepository) Delete(id uuid.UUID) error {
 	query := `DELETE FROM users WHERE id = $1`
 
@@ -411,6 +411,155 @@ func TestUserRepository_Update_NotFound(t *testing.T) {
 	}
 }
 
+func TestUserRepository_UpdatePasswordHash(t *testing.T) {
+	db, tenantID := setupUserTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewUserRepository(db)
+
+	passwordHash := "$2a$10$legacy"
+	user := &model.User{
+		ID:           uuid.New(),
+		TenantID:     tenantID,
+		Email:        "rehash@example.com",
+		PasswordHash: &passwordHash,
+		Role:         "user",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	err := repo.Create(user)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	// A stale old hash means the password changed meanwhile; that change wins
+	err = repo.UpdatePasswordHash(user.ID, "$2a$10$stale", "$argon2id$stale")
+	if err != nil {
+		t.Fatalf("failed to update password hash: %v", err)
+	}
+	found, err := repo.ByID(user.ID)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if *found.PasswordHash != passwordHash {
+		t.Errorf("expected hash %q to be kept, got %q", passwordHash, *found.PasswordHash)
+	}
+
+	err = repo.UpdatePasswordHash(user.ID, passwordHash, "$argon2id$new")
+	if err != nil {
+		t.Fatalf("failed to update password hash: %v", err)
+	}
+	found, err = repo.ByID(user.ID)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if *found.PasswordHash != "$argon2id$new" {
+		t.Errorf("expected hash to be replaced, got %q", *found.PasswordHash)
+	}
+}
+
+func TestUserRepository_ConfirmPendingEmail(t *testing.T) {
+	db, tenantID := setupUserTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewUserRepository(db)
+
+	pendingEmail := "new@example.com"
+	user := &model.User{
+		ID:           uuid.New(),
+		TenantID:     tenantID,
+		Email:        "old@example.com",
+		Role:         "user",
+		PendingEmail: &pendingEmail,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	err := repo.Create(user)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	err = repo.ConfirmPendingEmail(user.ID)
+	if err != nil {
+		t.Fatalf("failed to confirm pending email: %v", err)
+	}
+
+	found, err := repo.ByID(user.ID)
+	if err != nil {
+		t.Fatalf("failed to find user: %v", err)
+	}
+
+	if found.Email != "new@example.com" {
+		t.Errorf("expected email %q, got %q", "new@example.com", found.Email)
+	}
+
+	if found.PendingEmail != nil {
+		t.Errorf("expected pending email to be cleared, got %q", *found.PendingEmail)
+	}
+
+	if found.EmailVerifiedAt == nil {
+		t.Error("expected confirmed email to be verified")
+	}
+
+	// Nothing pending anymore
+	err = repo.ConfirmPendingEmail(user.ID)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound without pending email, got %v", err)
+	}
+}
+
+func TestUserRepository_ConfirmPendingEmail_Duplicate(t *testing.T) {
+	db, tenantID := setupUserTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewUserRepository(db)
+
+	taken := &model.User{
+		ID:        uuid.New(),
+		TenantID:  tenantID,
+		Email:     "taken@example.com",
+		Role:      "user",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	pendingEmail := "taken@example.com"
+	user := &model.User{
+		ID:           uuid.New(),
+		TenantID:     tenantID,
+		Email:        "old@example.com",
+		Role:         "user",
+		PendingEmail: &pendingEmail,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	for _, u := range []*model.User{taken, user} {
+		if err := repo.Create(u); err != nil {
+			t.Fatalf("failed to create user %s: %v", u.Email, err)
+		}
+	}
+
+	err := repo.ConfirmPendingEmail(user.ID)
+	if !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("expected ErrDuplicateEmail, got %v", err)
+	}
+}
+
 func TestUserRepository_Delete(t *testing.T) {
 	db, tenantID := setupUserTestDB(t)
 	defer func() {
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrWebAuthnCredentialNotFound  = errors.New("webauthn credential not found")
+	ErrDuplicateWebAuthnCredential = errors.New("webauthn credential already registered")
+	ErrWebAuthnCeremonyNotFound    = errors.New("webauthn ceremony not found")
+)
+
+const webAuthnCredentialColumns = `id, user_id, credential_id, public_key, attestation_type, transports, aaguid,
+	sign_count, backup_eligible, backup_state, name, last_used_at, created_at`
+
+type WebAuthnRepository interface {
+	CreateCredential(credential *model.WebAuthnCredential) error
+	CredentialsByUserID(userID uuid.UUID) ([]*model.WebAuthnCredential, error)
+	UpdateCredentialUse(credential *model.WebAuthnCredential) error
+	DeleteCredential(userID, id uuid.UUID) error
+
+	CreateCeremony(ceremony *model.WebAuthnCeremony) error
+	ConsumeCeremony(tokenHash string) (*model.WebAuthnCeremony, error)
+}
+
+type webAuthnRepository struct {
+	db DBTX
+}
+
+func NewWebAuthnRepository(db DBTX) WebAuthnRepository {
+	return &webAuthnRepository{db: db}
+}
+
+func (r *webAuthnRepository) CreateCredential(credential *model.WebAuthnCredential) error {
+	if credential.ID == uuid.Nil {
+		credential.ID = uuid.New()
+	}
+	if credential.CreatedAt.IsZero() {
+		credential.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO webauthn_credentials (` + webAuthnCredentialColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+	_, err := r.db.Exec(query,
+		credential.ID, credential.UserID, credential.CredentialID, credential.PublicKey,
+		credential.AttestationType, credential.Transports, credential.AAGUID,
+		int64(credential.SignCount), credential.BackupEligible, credential.BackupState,
+		credential.Name, credential.LastUsedAt, credential.CreatedAt,
+	)
+	if err != nil {
+		// Check for unique constraint violation
+		if strings.Contains(err.Error(), "duplicate key value") {
+			return ErrDuplicateWebAuthnCredential
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *webAuthnRepository) CredentialsByUserID(userID uuid.UUID) ([]*model.WebAuthnCredential, error) {
+	var credentials []*model.WebAuthnCredential
+	query := `
+		SELECT ` + webAuthnCredentialColumns + `
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+	err := r.db.Select(&credentials, query, userID)
+	return credentials, err
+}
+
+// UpdateCredentialUse stores the signature counter and backup state reported by the
+// authenticator on a successful assertion
+func (r *webAuthnRepository) UpdateCredentialUse(credential *model.WebAuthnCredential) error {
+	query := `
+		UPDATE webauthn_credentials
+		SET sign_count = $1, backup_state = $2, last_used_at = $3
+		WHERE id = $4
+	`
+	result, err := r.db.Exec(query, int64(credential.SignCount), credential.BackupState, credential.LastUsedAt, credential.ID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+
+	return nil
+}
+
+// DeleteCredential removes one of the user's credentials; other users' credentials are never matched
+func (r *webAuthnRepository) DeleteCredential(userID, id uuid.UUID) error {
+	query := `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`
+	result, err := r.db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+
+	return nil
+}
+
+func (r *webAuthnRepository) CreateCeremony(ceremony *model.WebAuthnCeremony) error {
+	if ceremony.ID == uuid.Nil {
+		ceremony.ID = uuid.New()
+	}
+	if ceremony.CreatedAt.IsZero() {
+		ceremony.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO webauthn_ceremonies (id, token_hash, user_id, purpose, session_data, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.Exec(query, ceremony.ID, ceremony.TokenHash, ceremony.UserID, ceremony.Purpose,
+		string(ceremony.SessionData), ceremony.ExpiresAt, ceremony.CreatedAt)
+	return err
+}
+
+// ConsumeCeremony atomically deletes and returns an unexpired ceremony, so each challenge is answered once
+func (r *webAuthnRepository) ConsumeCeremony(tokenHash string) (*model.WebAuthnCeremony, error) {
+	var ceremony model.WebAuthnCeremony
+	query := `
+		DELETE FROM webauthn_ceremonies
+		WHERE token_hash = $1 AND expires_at > $2
+		RETURNING id, token_hash, user_id, purpose, session_data, expires_at, created_at
+	`
+	err := r.db.Get(&ceremony, query, tokenHash, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWebAuthnCeremonyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ceremony, nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestWebAuthnRepository_Credentials(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewWebAuthnRepository(db)
+
+	tenant := createTestTenant(t, db)
+	user := createTestUser(t, db, tenant.ID)
+
+	credential := &model.WebAuthnCredential{
+		UserID:          user.ID,
+		CredentialID:    []byte("credential-" + uuid.NewString()),
+		PublicKey:       []byte{0xa5, 0x01, 0x02},
+		AttestationType: "none",
+		Transports:      "internal,hybrid",
+		SignCount:       1,
+		BackupEligible:  true,
+		Name:            "Laptop",
+	}
+	if err := repo.CreateCredential(credential); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	duplicate := *credential
+	if err := repo.CreateCredential(&duplicate); !errors.Is(err, ErrDuplicateWebAuthnCredential) {
+		t.Errorf("expected ErrDuplicateWebAuthnCredential, got %v", err)
+	}
+
+	now := time.Now()
+	credential.SignCount = 7
+	credential.BackupState = true
+	credential.LastUsedAt = &now
+	if err := repo.UpdateCredentialUse(credential); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	found, err := repo.CredentialsByUserID(user.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(found) != 1 || found[0].SignCount != 7 || !found[0].BackupState || found[0].LastUsedAt == nil {
+		t.Errorf("expected the updated credential, got %+v", found)
+	}
+
+	other := createTestUser(t, db, tenant.ID)
+	if err := repo.DeleteCredential(other.ID, credential.ID); !errors.Is(err, ErrWebAuthnCredentialNotFound) {
+		t.Errorf("expected ErrWebAuthnCredentialNotFound for another user, got %v", err)
+	}
+	if err := repo.DeleteCredential(user.ID, credential.ID); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestWebAuthnRepository_ConsumeCeremony(t *testing.T) {
+	db := setupTokenTestDB(t)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close database: %v", err)
+		}
+	}()
+
+	repo := NewWebAuthnRepository(db)
+
+	ceremony := &model.WebAuthnCeremony{
+		TokenHash:   "ceremony-" + uuid.NewString(),
+		Purpose:     model.WebAuthnLogin,
+		SessionData: []byte(`{"challenge":"abc"}`),
+		ExpiresAt:   time.Now().Add(5 * time.Minute),
+	}
+	if err := repo.CreateCeremony(ceremony); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	found, err := repo.ConsumeCeremony(ceremony.TokenHash)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if found.Purpose != model.WebAuthnLogin || found.UserID != nil {
+		t.Errorf("expected a login ceremony without user, got %+v", found)
+	}
+
+	if _, err := repo.ConsumeCeremony(ceremony.TokenHash); !errors.Is(err, ErrWebAuthnCeremonyNotFound) {
+		t.Errorf("expected ErrWebAuthnCeremonyNotFound on reuse, got %v", err)
+	}
+
+	expired := &model.WebAuthnCeremony{
+		TokenHash:   "ceremony-" + uuid.NewString(),
+		Purpose:     model.WebAuthnLogin,
+		SessionData: []byte(`{}`),
+		ExpiresAt:   time.Now().Add(-time.Minute),
+	}
+	if err := repo.CreateCeremony(expired); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := repo.ConsumeCeremony(expired.TokenHash); !errors.Is(err, ErrWebAuthnCeremonyNotFound) {
+		t.Errorf("expected ErrWebAuthnCeremonyNotFound when expired, got %v", err)
+	}
+}
@@ -6,11 +6,22 @@ import (
 	"dotsat.work/internal/app"
 	"dotsat.work/internal/handler"
 	"dotsat.work/internal/middleware"
+	"dotsat.work/internal/model"
 )
 
 func SetupRoutes(a *app.App) http.Handler {
 	// Handlers
 	home := handler.NewHomeHandler()
+	auth := handler.NewAuthHandler(a.AuthService, a.TwoFactorService, a.PasskeyService, a.OIDCService, a.SAMLService, a.ImpersonationService, a.SecurityEventService)
+	dashboard := handler.NewDashboardHandler()
+	account := handler.NewAccountHandler(a.AuthService, a.UserService, a.TwoFactorService, a.PasskeyService, a.PersonalAccessTokenService, a.SecurityEventService)
+	signup := handler.NewSignupHandler(a.SignupService)
+	onboarding := handler.NewOnboardingHandler(a.ProfileService, a.TenantService)
+	jwks := handler.NewJWKSHandler(a.Keys)
+	api := handler.NewAPIHandler(a.UserService)
+	organization := handler.NewOrganizationHandler(a.TenantService, a.OIDCService, a.SAMLService, a.APIKeyService, a.PasswordPolicyService, a.SecurityEventService)
+	passwordStrength := handler.NewPasswordStrengthHandler(a.AuthService, a.PasswordPolicyService)
+	impersonation := handler.NewImpersonationHandler(a.ImpersonationService)
 
 	mux := http.NewServeMux()
 
@@ -21,10 +32,111 @@ func SetupRoutes(a *app.App) http.Handler {
 	// Home
 	mux.Handle("GET /{$}", home)
 
+	// Public JWT verification keys for downstream services
+	mux.Handle("GET /.well-known/jwks.json", jwks)
+
+	// ============================================================================
+	// AUTH ROUTES (/auth/*)
+	// ============================================================================
+
+	mux.HandleFunc("GET /auth", middleware.RequireGuest(auth.ShowLogin))
+	mux.HandleFunc("POST /auth/login", middleware.RequireGuest(auth.Login))
+	mux.HandleFunc("GET /auth/2fa", middleware.RequireGuest(auth.ShowTwoFactor))
+	mux.HandleFunc("POST /auth/2fa", middleware.RequireGuest(auth.VerifyTwoFactor))
+	mux.HandleFunc("POST /auth/2fa/passkey/options", middleware.RequireGuest(auth.TwoFactorPasskeyOptions))
+	mux.HandleFunc("POST /auth/2fa/passkey", middleware.RequireGuest(auth.VerifyTwoFactorPasskey))
+	mux.HandleFunc("POST /auth/passkey/options", middleware.RequireGuest(auth.PasskeyLoginOptions))
+	mux.HandleFunc("POST /auth/passkey", middleware.RequireGuest(auth.PasskeyLogin))
+	mux.HandleFunc("GET /auth/sso", middleware.RequireGuest(auth.ShowSSO))
+	mux.HandleFunc("POST /auth/sso", middleware.RequireGuest(auth.StartSSO))
+	mux.HandleFunc("GET /auth/sso/oidc/callback", middleware.RequireGuest(auth.OIDCCallback))
+	mux.HandleFunc("GET /auth/sso/saml/{organization}/metadata", auth.SAMLMetadata)
+	mux.HandleFunc("POST /auth/sso/saml/{organization}/acs", middleware.RequireGuest(auth.SAMLACS))
+	mux.HandleFunc("GET /auth/magic-link", middleware.RequireGuest(auth.ShowMagicLink))
+	mux.HandleFunc("POST /auth/magic-link", middleware.RequireGuest(auth.SendMagicLink))
+	mux.HandleFunc("GET /auth/magic-link/verify", auth.VerifyMagicLink)
+	mux.HandleFunc("GET /auth/forgot-password", middleware.RequireGuest(auth.ShowForgotPassword))
+	mux.HandleFunc("POST /auth/forgot-password", middleware.RequireGuest(auth.ForgotPassword))
+	mux.HandleFunc("GET /auth/reset-password", auth.ShowResetPassword)
+	mux.HandleFunc("POST /auth/reset-password", auth.ResetPassword)
+	mux.Handle("POST /auth/password-strength", passwordStrength)
+	mux.HandleFunc("GET /auth/verify", auth.VerifyEmail)
+	mux.HandleFunc("POST /auth/verify/resend", middleware.RequireGuest(auth.ResendVerification))
+	mux.HandleFunc("GET /auth/email-change/confirm", auth.ConfirmEmailChange)
+	mux.HandleFunc("GET /auth/unlock", auth.UnlockAccount)
+	mux.HandleFunc("POST /auth/logout", auth.Logout)
+	mux.HandleFunc("POST /auth/impersonation/stop", impersonation.Stop)
+
+	// Self-service signup creates a new tenant with its first admin
+	mux.HandleFunc("GET /auth/signup", middleware.RequireGuest(signup.Show))
+	mux.HandleFunc("POST /auth/signup", middleware.RequireGuest(signup.Signup))
+	mux.HandleFunc("GET /auth/signup/subdomain", middleware.RequireGuest(signup.CheckSubdomain))
+
+	// Onboarding requires a signed-in user; RequireAuth lets /auth/onboarding* through
+	mux.HandleFunc("GET /auth/onboarding", middleware.RequireAuth(onboarding.Start))
+	mux.HandleFunc("GET /auth/onboarding/name", middleware.RequireAuth(onboarding.ShowName))
+	mux.HandleFunc("POST /auth/onboarding/name", middleware.RequireAuth(onboarding.SaveName))
+	mux.HandleFunc("GET /auth/onboarding/details", middleware.RequireAuth(onboarding.ShowDetails))
+	mux.HandleFunc("POST /auth/onboarding/details", middleware.RequireAuth(onboarding.SaveDetails))
+	mux.HandleFunc("GET /auth/onboarding/organization", middleware.RequireAuth(onboarding.ShowOrganization))
+	mux.HandleFunc("POST /auth/onboarding/organization", middleware.RequireAuth(onboarding.SaveOrganization))
+
 	// ============================================================================
 	// PROTECTED ROUTES (/app/*)
 	// ============================================================================
-	// TODO: Add protected routes here
+
+	appMux := http.NewServeMux()
+	appMux.Handle("GET /app/dashboard", dashboard)
+	// Account settings can't be changed with a personal access token or by support staff
+	// impersonating the user
+	appMux.HandleFunc("GET /app/account", middleware.RequireSession(account.Show))
+	appMux.HandleFunc("POST /app/account/email", middleware.RequireSession(middleware.BlockImpersonation(account.ChangeEmail)))
+	appMux.HandleFunc("POST /app/account/email/cancel", middleware.RequireSession(middleware.BlockImpersonation(account.CancelEmailChange)))
+	appMux.HandleFunc("POST /app/account/password", middleware.RequireSession(middleware.BlockImpersonation(account.ChangePassword)))
+	appMux.HandleFunc("GET /app/account/2fa", middleware.RequireSession(account.TwoFactor))
+	appMux.HandleFunc("POST /app/account/2fa/setup", middleware.RequireSession(middleware.BlockImpersonation(account.BeginTwoFactorSetup)))
+	appMux.HandleFunc("POST /app/account/2fa/confirm", middleware.RequireSession(middleware.BlockImpersonation(account.ConfirmTwoFactor)))
+	appMux.HandleFunc("POST /app/account/2fa/recovery-codes", middleware.RequireSession(middleware.BlockImpersonation(account.RegenerateRecoveryCodes)))
+	appMux.HandleFunc("POST /app/account/2fa/disable", middleware.RequireSession(middleware.BlockImpersonation(account.DisableTwoFactor)))
+	appMux.HandleFunc("GET /app/account/passkeys", middleware.RequireSession(account.Passkeys))
+	appMux.HandleFunc("POST /app/account/passkeys/options", middleware.RequireSession(middleware.BlockImpersonation(account.PasskeyRegistrationOptions)))
+	appMux.HandleFunc("POST /app/account/passkeys", middleware.RequireSession(middleware.BlockImpersonation(account.RegisterPasskey)))
+	appMux.HandleFunc("POST /app/account/passkeys/{id}/delete", middleware.RequireSession(middleware.BlockImpersonation(account.DeletePasskey)))
+	appMux.HandleFunc("GET /app/account/tokens", middleware.RequireSession(account.AccessTokens))
+	appMux.HandleFunc("POST /app/account/tokens", middleware.RequireSession(middleware.BlockImpersonation(account.CreateAccessToken)))
+	appMux.HandleFunc("POST /app/account/tokens/{id}/revoke", middleware.RequireSession(middleware.BlockImpersonation(account.RevokeAccessToken)))
+	appMux.HandleFunc("GET /app/account/sessions", middleware.RequireSession(account.Sessions))
+	appMux.HandleFunc("POST /app/account/sessions/{id}/revoke", middleware.RequireSession(middleware.BlockImpersonation(account.RevokeSession)))
+	appMux.HandleFunc("POST /app/account/sessions/revoke-all", middleware.RequireSession(middleware.BlockImpersonation(account.SignOutEverywhere)))
+	appMux.HandleFunc("GET /app/account/security", middleware.RequireSession(account.SecurityActivity))
+
+	// Organization settings are limited to tenant admins signed in with a browser; support staff
+	// impersonating an admin can look but not change them
+	appMux.HandleFunc("GET /app/organization/sso", middleware.RequireAdmin(middleware.RequireSession(organization.SSO)))
+	appMux.HandleFunc("POST /app/organization/sso/oidc", middleware.RequireAdmin(middleware.RequireSession(middleware.BlockImpersonation(organization.SaveOIDC))))
+	appMux.HandleFunc("POST /app/organization/sso/saml", middleware.RequireAdmin(middleware.RequireSession(middleware.BlockImpersonation(organization.SaveSAML))))
+	appMux.HandleFunc("POST /app/organization/sso/enforce", middleware.RequireAdmin(middleware.RequireSession(middleware.BlockImpersonation(organization.EnforceSSO))))
+	appMux.HandleFunc("GET /app/organization/password-policy", middleware.RequireAdmin(middleware.RequireSession(organization.PasswordPolicy)))
+	appMux.HandleFunc("POST /app/organization/password-policy", middleware.RequireAdmin(middleware.RequireSession(middleware.BlockImpersonation(organization.SavePasswordPolicy))))
+	appMux.HandleFunc("GET /app/organization/security-events", middleware.RequireAdmin(middleware.RequireSession(organization.SecurityEvents)))
+	appMux.HandleFunc("GET /app/organization/api-keys", middleware.RequireAdmin(middleware.RequireSession(organization.APIKeys)))
+	appMux.HandleFunc("POST /app/organization/api-keys", middleware.RequireAdmin(middleware.RequireSession(middleware.BlockImpersonation(organization.CreateAPIKey))))
+	appMux.HandleFunc("POST /app/organization/api-keys/{id}/rotate", middleware.RequireAdmin(middleware.RequireSession(middleware.BlockImpersonation(organization.RotateAPIKey))))
+	appMux.HandleFunc("POST /app/organization/api-keys/{id}/revoke", middleware.RequireAdmin(middleware.RequireSession(middleware.BlockImpersonation(organization.RevokeAPIKey))))
+
+	// Platform staff can sign in as a user to see what they see
+	appMux.HandleFunc("GET /app/staff/impersonate", middleware.RequireStaff(impersonation.Show))
+	appMux.HandleFunc("POST /app/staff/impersonate", middleware.RequireStaff(impersonation.Start))
+
+	// Every /app/* route requires an authenticated user
+	mux.HandleFunc("/app/", middleware.RequireAuth(appMux.ServeHTTP))
+
+	// ============================================================================
+	// API ROUTES (/api/*)
+	// ============================================================================
+
+	// Tenant API keys need the route's scope; users and personal access tokens act as the user
+	mux.HandleFunc("GET /api/v1/users", middleware.RequireScope(model.APIScopeUsersRead, api.Users))
 
 	// ============================================================================
 	// FALLBACK
@@ -36,7 +148,11 @@ func SetupRoutes(a *app.App) http.Handler {
 	// Global middleware - executed in order (top to bottom)
 	handler := middleware.Chain(
 		mux,
-		middleware.AuthMiddleware(a.AuthService, a.UserService, a.ProfileService, a.TenantService),
+		middleware.RealIP(a.Cfg.TrustProxy),
+		middleware.AuthMiddleware(a.AuthService, a.PersonalAccessTokenService, a.APIKeyService, a.ImpersonationService, a.UserService, a.ProfileService, a.TenantService, a.SecurityEventService),
+		// Signed-in CSRF tokens are derived from the session AuthMiddleware adds to the context.
+		// The SAML assertion consumer receives cross-site posts from identity providers.
+		middleware.CSRF(a.Keys, a.Cfg.IsProduction(), "/auth/sso/saml/"),
 	)
 
 	return handler
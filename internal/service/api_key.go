@@ -0,0 +1,207 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidAPIKey   = errors.New("api key is invalid, expired or revoked")
+	ErrAPIKeyNotFound  = errors.New("api key not found")
+	ErrAPIKeyRotated   = errors.New("api key was already rotated")
+	ErrInvalidKeyName  = errors.New("key name is required and must be at most 64 characters")
+	ErrInvalidAPIScope = errors.New("choose at least one valid scope")
+)
+
+const (
+	// APIKeyPrefix marks tenant API keys so they are recognisable in Authorization headers
+	// and by secret scanners
+	APIKeyPrefix = "dsat_key_"
+
+	// The public part of a key after APIKeyPrefix, shown so admins can tell keys apart
+	apiKeyIDBytes = 6
+
+	maxKeyNameLength = 64
+
+	// A rotated key keeps working this long so integrations can switch to the new one
+	apiKeyRotationOverlap = 24 * time.Hour
+
+	// Last use of a key is written at most once per interval
+	apiKeyTouchInterval = time.Minute
+)
+
+// APIKeyService manages the machine credentials tenant admins create for integrations
+type APIKeyService struct {
+	apiKeyRepository repository.APIKeyRepository
+}
+
+func NewAPIKeyService(apiKeyRepository repository.APIKeyRepository) *APIKeyService {
+	return &APIKeyService{
+		apiKeyRepository: apiKeyRepository,
+	}
+}
+
+// Create issues a key for the tenant with the given scopes. The returned secret is shown to
+// the admin once; only its hash is stored.
+func (s *APIKeyService) Create(tenantID, createdBy uuid.UUID, name string, scopes []string) (string, *model.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxKeyNameLength {
+		return "", nil, ErrInvalidKeyName
+	}
+	scopes, err := normalizeAPIScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret, key, err := newAPIKey(tenantID, createdBy, name, strings.Join(scopes, ","))
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = s.apiKeyRepository.Create(key)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	slog.Info("api key created", "tenant_id", tenantID, "key_id", key.ID, "created_by", createdBy)
+	return secret, key, nil
+}
+
+// Rotate replaces a key with a new one with the same name and scopes. The old key keeps
+// working for apiKeyRotationOverlap so integrations can switch over without downtime.
+func (s *APIKeyService) Rotate(tenantID, rotatedBy, id uuid.UUID) (string, *model.APIKey, error) {
+	old, err := s.apiKeyRepository.ByID(tenantID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			return "", nil, ErrAPIKeyNotFound
+		}
+		return "", nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	if !old.IsActive() {
+		return "", nil, ErrAPIKeyNotFound
+	}
+	if old.IsRotated() {
+		return "", nil, ErrAPIKeyRotated
+	}
+
+	secret, replacement, err := newAPIKey(tenantID, rotatedBy, old.Name, old.Scopes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = s.apiKeyRepository.Rotate(old.ID, time.Now().Add(apiKeyRotationOverlap), replacement)
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		// Rotated or revoked concurrently
+		return "", nil, ErrAPIKeyRotated
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to rotate api key: %w", err)
+	}
+
+	slog.Info("api key rotated", "tenant_id", tenantID, "key_id", old.ID, "replacement_id", replacement.ID, "rotated_by", rotatedBy)
+	return secret, replacement, nil
+}
+
+// Authenticate resolves a bearer token to an active API key and records its use
+func (s *APIKeyService) Authenticate(secret string) (*model.APIKey, error) {
+	if !strings.HasPrefix(secret, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.apiKeyRepository.ByHash(hashToken(secret))
+	if err != nil {
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	if !key.IsActive() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		err = s.apiKeyRepository.Touch(key.ID, now)
+		if err != nil {
+			slog.Warn("failed to record api key use", "error", err, "key_id", key.ID)
+		} else {
+			key.LastUsedAt = &now
+		}
+	}
+
+	return key, nil
+}
+
+// Keys lists the tenant's active keys, including rotated keys that haven't expired yet
+func (s *APIKeyService) Keys(tenantID uuid.UUID) ([]*model.APIKey, error) {
+	keys, err := s.apiKeyRepository.ActiveByTenantID(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke revokes one of the tenant's keys immediately
+func (s *APIKeyService) Revoke(tenantID, revokedBy, id uuid.UUID) error {
+	err := s.apiKeyRepository.Revoke(tenantID, id)
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	slog.Info("api key revoked", "tenant_id", tenantID, "key_id", id, "revoked_by", revokedBy)
+	return nil
+}
+
+// newAPIKey generates a key secret of the form dsat_key_<public id>_<secret>
+func newAPIKey(tenantID, createdBy uuid.UUID, name, scopes string) (string, *model.APIKey, error) {
+	publicID, err := randomHex(apiKeyIDBytes)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate api key: %w", err)
+	}
+	value, err := randomToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	prefix := APIKeyPrefix + publicID
+	secret := prefix + "_" + value
+	return secret, &model.APIKey{
+		TenantID:  tenantID,
+		Name:      name,
+		KeyPrefix: prefix,
+		KeyHash:   hashToken(secret),
+		Scopes:    scopes,
+		CreatedBy: &createdBy,
+	}, nil
+}
+
+// normalizeAPIScopes validates and de-duplicates scopes, keeping the order of model.APIScopes
+func normalizeAPIScopes(scopes []string) ([]string, error) {
+	var normalized []string
+	for _, scope := range model.APIScopes {
+		if slices.Contains(scopes, scope.Name) {
+			normalized = append(normalized, scope.Name)
+		}
+	}
+	for _, scope := range scopes {
+		if !model.IsValidAPIScope(scope) {
+			return nil, ErrInvalidAPIScope
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, ErrInvalidAPIScope
+	}
+	return normalized, nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+func TestAPIKeyService_CreateAndAuthenticate(t *testing.T) {
+	repo := newFakeAPIKeyRepository()
+	service := NewAPIKeyService(repo)
+	tenantID, adminID := uuid.New(), uuid.New()
+
+	secret, key, err := service.Create(tenantID, adminID, "CRM sync", []string{model.APIScopeDealsManage, model.APIScopeUsersRead, model.APIScopeUsersRead})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !strings.HasPrefix(secret, key.KeyPrefix+"_") || !strings.HasPrefix(key.KeyPrefix, APIKeyPrefix) {
+		t.Errorf("expected secret %q to start with its public prefix %q", secret, key.KeyPrefix)
+	}
+	if key.Scopes != "users:read,deals:manage" {
+		t.Errorf("expected de-duplicated scopes in canonical order, got %q", key.Scopes)
+	}
+	if key.CreatedBy == nil || *key.CreatedBy != adminID {
+		t.Errorf("expected key to record its creator, got %v", key.CreatedBy)
+	}
+
+	authenticated, err := service.Authenticate(secret)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if authenticated.TenantID != tenantID || !authenticated.HasScope(model.APIScopeUsersRead) || authenticated.HasScope(model.APIScopeUsersManage) {
+		t.Errorf("unexpected key %+v", authenticated)
+	}
+	if repo.keys[key.ID].LastUsedAt == nil {
+		t.Error("expected last use to be recorded")
+	}
+}
+
+func TestAPIKeyService_Create_Invalid(t *testing.T) {
+	service := NewAPIKeyService(newFakeAPIKeyRepository())
+
+	tests := []struct {
+		name    string
+		keyName string
+		scopes  []string
+		wantErr error
+	}{
+		{name: "blank name", keyName: " ", scopes: []string{model.APIScopeUsersRead}, wantErr: ErrInvalidKeyName},
+		{name: "no scopes", keyName: "CRM sync", wantErr: ErrInvalidAPIScope},
+		{name: "unknown scope", keyName: "CRM sync", scopes: []string{model.APIScopeUsersRead, "admin:all"}, wantErr: ErrInvalidAPIScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := service.Create(uuid.New(), uuid.New(), tt.keyName, tt.scopes); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Create() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPIKeyService_Rotate(t *testing.T) {
+	repo := newFakeAPIKeyRepository()
+	service := NewAPIKeyService(repo)
+	tenantID, adminID := uuid.New(), uuid.New()
+
+	oldSecret, old, err := service.Create(tenantID, adminID, "CRM sync", []string{model.APIScopeDealsRead})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	newSecret, replacement, err := service.Rotate(tenantID, adminID, old.ID)
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if replacement.Name != old.Name || replacement.Scopes != old.Scopes || replacement.KeyPrefix == old.KeyPrefix {
+		t.Errorf("expected a new key with the same name and scopes, got %+v", replacement)
+	}
+
+	// Both keys work during the overlap
+	for _, secret := range []string{oldSecret, newSecret} {
+		if _, err := service.Authenticate(secret); err != nil {
+			t.Errorf("Authenticate() during overlap error = %v", err)
+		}
+	}
+	if _, _, err := service.Rotate(tenantID, adminID, old.ID); !errors.Is(err, ErrAPIKeyRotated) {
+		t.Errorf("Rotate() of a rotated key error = %v, want ErrAPIKeyRotated", err)
+	}
+
+	expired := time.Now().Add(-time.Second)
+	repo.keys[old.ID].ExpiresAt = &expired
+	if _, err := service.Authenticate(oldSecret); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Authenticate() after overlap error = %v, want ErrInvalidAPIKey", err)
+	}
+	if _, err := service.Authenticate(newSecret); err != nil {
+		t.Errorf("Authenticate() with replacement error = %v", err)
+	}
+}
+
+func TestAPIKeyService_Revoke(t *testing.T) {
+	service := NewAPIKeyService(newFakeAPIKeyRepository())
+	tenantID, adminID := uuid.New(), uuid.New()
+
+	secret, key, err := service.Create(tenantID, adminID, "Reporting", []string{model.APIScopeUsersRead})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if err := service.Revoke(uuid.New(), adminID, key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Revoke() from another tenant error = %v, want ErrAPIKeyNotFound", err)
+	}
+	if err := service.Revoke(tenantID, adminID, key.ID); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if _, err := service.Authenticate(secret); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Authenticate() after revoke error = %v, want ErrInvalidAPIKey", err)
+	}
+	if _, _, err := service.Rotate(tenantID, adminID, key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Rotate() of a revoked key error = %v, want ErrAPIKeyNotFound", err)
+	}
+}
@@ -6,96 +6,279 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
+	"dotsat.work/internal/keyring"
+	"dotsat.work/internal/mail"
 	"dotsat.work/internal/model"
 	"dotsat.work/internal/repository"
 	"dotsat.work/internal/validation"
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("invalid email or password")
 	ErrEmailNotVerified   = errors.New("email not verified")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrTooManyRequests    = errors.New("too many requests, please try again later")
+	ErrEmailTaken         = errors.New("email address is already in use")
+	ErrEmailUnchanged     = errors.New("new email address is the same as the current one")
+	ErrNoPendingEmail     = errors.New("no email change is pending")
+)
+
+const (
+	passwordResetTTL = time.Hour
+	emailVerifyTTL   = 24 * time.Hour
+	emailChangeTTL   = 24 * time.Hour
 )
 
 type AuthService struct {
-	userRepository  repository.UserRepository
-	tokenRepository repository.TokenRepository
-	jwtSecret       string
-	isProduction    bool
-	jwtExpiry       time.Duration
+	userRepository     repository.UserRepository
+	tenantRepository   repository.TenantRepository
+	tokenRepository    repository.TokenRepository
+	sessionRepository  repository.SessionRepository
+	throttleRepository repository.ThrottleRepository
+	mailer             mail.Sender
+	appURL             string
+	keys               *keyring.Keyring
+	passwordHasher     *PasswordHasher
+	passwordPolicy     *PasswordPolicyService
+	securityEvents     *SecurityEventService
+	isProduction       bool
+	sessionExpiry      time.Duration
+	accessExpiry       time.Duration
+
+	// dummyPasswordHash is compared against when an account has no password hash, so signing in
+	// to a missing or passwordless account takes as long as a wrong password
+	dummyPasswordHash func() string
 }
 
 func NewAuthService(
 	userRepository repository.UserRepository,
+	tenantRepository repository.TenantRepository,
 	tokenRepository repository.TokenRepository,
-	jwtSecret string,
+	sessionRepository repository.SessionRepository,
+	throttleRepository repository.ThrottleRepository,
+	mailer mail.Sender,
+	appURL string,
+	keys *keyring.Keyring,
+	passwordHasher *PasswordHasher,
+	passwordPolicy *PasswordPolicyService,
+	securityEvents *SecurityEventService,
 	isProduction bool,
-	jwtExpiry time.Duration,
+	sessionExpiry time.Duration,
+	accessExpiry time.Duration,
 ) *AuthService {
 	return &AuthService{
-		userRepository:  userRepository,
-		tokenRepository: tokenRepository,
-		jwtSecret:       jwtSecret,
-		isProduction:    isProduction,
-		jwtExpiry:       jwtExpiry,
+		userRepository:     userRepository,
+		tenantRepository:   tenantRepository,
+		tokenRepository:    tokenRepository,
+		sessionRepository:  sessionRepository,
+		throttleRepository: throttleRepository,
+		mailer:             mailer,
+		appURL:             strings.TrimRight(appURL, "/"),
+		keys:               keys,
+		passwordHasher:     passwordHasher,
+		passwordPolicy:     passwordPolicy,
+		securityEvents:     securityEvents,
+		isProduction:       isProduction,
+		sessionExpiry:      sessionExpiry,
+		accessExpiry:       accessExpiry,
+		dummyPasswordHash: sync.OnceValue(func() string {
+			hash, err := passwordHasher.Hash("dummy password for constant time")
+			if err != nil {
+				panic(err)
+			}
+			return hash
+		}),
 	}
 }
 
-// Login authenticates a user with email and password
-func (s *AuthService) Login(email, password string) (*model.User, error) {
+// Login authenticates a user with email and password.
+// Failed attempts are throttled per email and per client IP, see checkLoginThrottle.
+// Unknown, passwordless and single sign-on accounts all fail like a wrong password;
+// the account owner learns the real reason by email, see notifySignInRefused.
+// Password hashes made with bcrypt or outdated argon2id parameters are upgraded on success.
+// Refused attempts are recorded in the security event log; a successful one is recorded by
+// the caller, once it knows whether a two-factor challenge follows.
+func (s *AuthService) Login(email, password string, client model.ClientInfo) (*model.User, error) {
 	email = strings.TrimSpace(strings.ToLower(email))
 
-	user, err := s.userRepository.ByEmail(email)
+	err := s.checkLoginThrottle(email, client.IPAddress)
 	if err != nil {
-		if errors.Is(err, repository.ErrUserNotFound) {
-			return nil, fmt.Errorf("invalid credentials: %w", ErrInvalidCredentials)
+		var retryErr *RetryAfterError
+		if errors.As(err, &retryErr) {
+			s.securityEvents.AnonymousFailure(model.SecurityEventLogin, email, client, loginFailureReason(err))
 		}
+		return nil, err
+	}
+
+	user, err := s.userRepository.ByEmail(email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		s.compareDummyPassword(password)
+		s.securityEvents.AnonymousFailure(model.SecurityEventLogin, email, client, model.SecurityReasonUnknownAccount)
+		return nil, s.loginFailed(nil, email, client.IPAddress)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	if !user.HasPassword() {
-		return nil, fmt.Errorf("this account uses passwordless login. Please use the magic link option")
+		s.compareDummyPassword(password)
+		s.notifySignInRefused(user)
+		s.securityEvents.Failure(model.SecurityEventLogin, user, email, client, model.SecurityReasonNoPassword)
+		return nil, s.loginFailed(user, email, client.IPAddress)
+	}
+
+	needsRehash, err := s.passwordHasher.Verify(password, *user.PasswordHash)
+	if err != nil {
+		if !errors.Is(err, ErrPasswordMismatch) {
+			slog.Error("failed to verify password", "error", err, "user_id", user.ID)
+		}
+		s.notifySignInRefused(user)
+		s.securityEvents.Failure(model.SecurityEventLogin, user, email, client, model.SecurityReasonInvalidPassword)
+		return nil, s.loginFailed(user, email, client.IPAddress)
+	}
+	s.clearLoginFailures(email)
+
+	if needsRehash {
+		s.rehashPassword(user, password)
 	}
 
-	err = s.ComparePassword(password, *user.PasswordHash)
+	// Only someone who knows the password gets to learn the account's state
+	err = s.CheckSSOEnforced(user)
 	if err != nil {
-		return nil, fmt.Errorf("invalid credentials: %w", ErrInvalidCredentials)
+		s.securityEvents.Failure(model.SecurityEventLogin, user, email, client, model.SecurityReasonSSORequired)
+		return nil, err
 	}
 
 	if user.EmailVerifiedAt == nil {
+		s.securityEvents.Failure(model.SecurityEventLogin, user, email, client, model.SecurityReasonEmailNotVerified)
 		return nil, fmt.Errorf("email not verified: %w", ErrEmailNotVerified)
 	}
 
 	return user, nil
 }
 
-// ValidatePassword validates password strength
-func (s *AuthService) ValidatePassword(password string) error {
-	return validation.ValidatePassword(password)
+// compareDummyPassword spends as long as ComparePassword does on a real hash
+func (s *AuthService) compareDummyPassword(password string) {
+	_ = s.ComparePassword(password, s.dummyPasswordHash())
 }
 
-// HashPassword hashes a password using bcrypt
-func (s *AuthService) HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// rehashPassword replaces the user's password hash with one made with the current parameters.
+// Failing to do so doesn't fail the sign-in; the next sign-in tries again.
+func (s *AuthService) rehashPassword(user *model.User, password string) {
+	hash, err := s.passwordHasher.Hash(password)
 	if err != nil {
-		return "", err
+		slog.Warn("failed to rehash password", "error", err, "user_id", user.ID)
+		return
+	}
+
+	err = s.userRepository.UpdatePasswordHash(user.ID, *user.PasswordHash, hash)
+	if err != nil {
+		slog.Warn("failed to store rehashed password", "error", err, "user_id", user.ID)
+		return
+	}
+	user.PasswordHash = &hash
+}
+
+// notifySignInRefused emails the account owner why a sign-in that was answered like a wrong
+// password really failed: their organization requires single sign-on, or the account has no
+// password. Ordinary wrong passwords send nothing.
+func (s *AuthService) notifySignInRefused(user *model.User) {
+	var msg mail.Message
+	err := s.CheckSSOEnforced(user)
+	switch {
+	case errors.Is(err, ErrSSORequired):
+		msg = mail.SSORequiredNoticeMessage(user.Email, s.appURL+"/auth/sso")
+	case err != nil:
+		slog.Warn("failed to check single sign-on for sign-in notice", "error", err, "user_id", user.ID)
+		return
+	case !user.HasPassword():
+		msg = mail.PasswordlessNoticeMessage(user.Email, s.appURL+"/auth/magic-link")
+	default:
+		return
+	}
+
+	s.sendNotice(model.ThrottleActionSignInNotice, user, msg)
+}
+
+// NotifyAccountExists emails the owner of an existing account that someone tried to sign up
+// with their address, so the signup form can answer the same whether or not the email is taken
+func (s *AuthService) NotifyAccountExists(user *model.User) {
+	msg := mail.AccountExistsNoticeMessage(user.Email, s.appURL+"/auth", s.appURL+"/auth/forgot-password")
+	s.sendNotice(model.ThrottleActionAccountExists, user, msg)
+}
+
+// sendNotice emails the user an unrequested notice, at most once per signInNoticeWindow for
+// each kind of notice so the form that triggers it can't be used to flood their inbox
+func (s *AuthService) sendNotice(action string, user *model.User, msg mail.Message) {
+	stats, err := s.throttleRepository.StatsByEmailSince(action, user.Email, time.Now().Add(-signInNoticeWindow))
+	if err != nil {
+		slog.Warn("failed to count notices", "error", err, "action", action, "user_id", user.ID)
+		return
 	}
-	return string(hashedBytes), nil
+	if stats.Count > 0 {
+		return
+	}
+
+	err = s.throttleRepository.Record(&model.ThrottleEvent{Action: action, Email: user.Email})
+	if err != nil {
+		slog.Warn("failed to record notice", "error", err, "action", action, "user_id", user.ID)
+		return
+	}
+
+	err = s.mailer.Send(msg)
+	if err != nil {
+		slog.Warn("failed to send notice", "error", err, "action", action, "user_id", user.ID)
+	}
+}
+
+// CheckSSOEnforced returns ErrSSORequired if the user's tenant only allows signing in
+// through its identity provider, for every sign-in method other than single sign-on
+func (s *AuthService) CheckSSOEnforced(user *model.User) error {
+	tenant, err := s.tenantRepository.ByID(user.TenantID)
+	if err != nil {
+		return fmt.Errorf("failed to get tenant: %w", err)
+	}
+	if tenant.SSOEnforced {
+		return ErrSSORequired
+	}
+	return nil
+}
+
+// ValidatePassword checks a password for a new account against the global password policy
+func (s *AuthService) ValidatePassword(password string, context validation.PasswordContext) error {
+	return s.passwordPolicy.Validate(uuid.Nil, password, context)
+}
+
+// HashPassword hashes a password using argon2id
+func (s *AuthService) HashPassword(password string) (string, error) {
+	return s.passwordHasher.Hash(password)
 }
 
 // ComparePassword compares a password with a hash
 func (s *AuthService) ComparePassword(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	_, err := s.passwordHasher.Verify(password, hash)
+	return err
 }
 
 // GenerateToken generates a random token for magic links, password reset, etc.
 func (s *AuthService) GenerateToken() (string, error) {
-	bytes := make([]byte, 32)
+	return randomToken()
+}
+
+// randomToken returns 256 random bits, hex encoded
+func randomToken() (string, error) {
+	return randomHex(32)
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) (string, error) {
+	bytes := make([]byte, n)
 	_, err := rand.Read(bytes)
 	if err != nil {
 		return "", err
@@ -103,132 +286,401 @@ func (s *AuthService) GenerateToken() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-// GenerateJWT generates a JWT token for a user
-func (s *AuthService) GenerateJWT(user *model.User) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id":   user.ID.String(),
-		"tenant_id": user.TenantID.String(),
-		"email":     user.Email,
-		"exp":       time.Now().Add(s.jwtExpiry).Unix(),
-		"iat":       time.Now().Unix(),
+// SendMagicLink generates a magic link and emails it to the user, rate limited per recipient.
+// Unknown emails and organizations requiring single sign-on get the same response as a sent link
+// so it doesn't reveal which accounts exist; the latter are emailed a notice instead.
+func (s *AuthService) SendMagicLink(email, ipAddress string) error {
+	email = strings.TrimSpace(strings.ToLower(email))
+
+	// Validate email
+	err := validation.ValidateEmail(email)
+	if err != nil {
+		return fmt.Errorf("invalid email: %w", err)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	err = s.checkRecipientThrottle(magicLinkLimit, email, ipAddress)
+	if err != nil {
+		return err
+	}
 
-	tokenString, err := token.SignedString([]byte(s.jwtSecret))
+	// Check if a user exists
+	user, err := s.userRepository.ByEmail(email)
 	if err != nil {
-		return "", err
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	err = s.CheckSSOEnforced(user)
+	if errors.Is(err, ErrSSORequired) {
+		s.notifySignInRefused(user)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Delete any existing magic link tokens for this user
+	err = s.tokenRepository.DeleteByUserAndType(user.ID, model.TokenTypeMagicLink)
+	if err != nil {
+		slog.Warn("failed to delete old magic link tokens", "error", err, "user_id", user.ID)
+	}
+
+	// Generate and save magic link token
+	magicToken, err := s.issueToken(user.ID, model.TokenTypeMagicLink, 15*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(mail.MagicLinkMessage(user.Email, s.link("/auth/magic-link/verify", magicToken)))
+	if err != nil {
+		return fmt.Errorf("failed to send magic link: %w", err)
 	}
 
-	return tokenString, nil
+	slog.Info("magic link sent", "user_id", user.ID)
+	return nil
 }
 
-// VerifyJWT verifies a JWT token and returns the claims
-func (s *AuthService) VerifyJWT(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// RequestPasswordReset emails a one-time password reset link to the user.
+// Unknown emails are ignored so the response doesn't reveal which accounts exist.
+func (s *AuthService) RequestPasswordReset(email string, client model.ClientInfo) error {
+	email = strings.TrimSpace(strings.ToLower(email))
+
+	err := validation.ValidateEmail(email)
+	if err != nil {
+		return fmt.Errorf("invalid email: %w", err)
+	}
+
+	err = s.checkRecipientThrottle(passwordResetLimit, email, client.IPAddress)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepository.ByEmail(email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			s.securityEvents.AnonymousFailure(model.SecurityEventPasswordResetRequested, email, client, model.SecurityReasonUnknownAccount)
+			return nil
 		}
-		return []byte(s.jwtSecret), nil
-	})
+		return fmt.Errorf("failed to get user: %w", err)
+	}
 
+	resetToken, err := s.issueToken(user.ID, model.TokenTypePasswordReset, passwordResetTTL)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		return claims, nil
+	err = s.mailer.Send(mail.PasswordResetMessage(user.Email, s.link("/auth/reset-password", resetToken)))
+	if err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
 	}
 
-	return nil, fmt.Errorf("invalid token")
+	s.securityEvents.Success(model.SecurityEventPasswordResetRequested, user, client)
+	slog.Info("password reset requested", "user_id", user.ID)
+	return nil
 }
 
-// SetJWTCookie sets the JWT token as an HTTP-only cookie
-func (s *AuthService) SetJWTCookie(w http.ResponseWriter, token string, expiry time.Time) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "auth_token",
-		Value:    token,
-		Expires:  expiry,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   s.isProduction,
-		SameSite: http.SameSiteLaxMode,
-	})
+// PasswordResetUser returns the user a password reset token was issued to, without consuming it
+func (s *AuthService) PasswordResetUser(token string) (*model.User, error) {
+	tokenModel, err := s.tokenRepository.ByToken(token)
+	if err != nil {
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to get token: %w", err)
+	}
+
+	if tokenModel.Type != model.TokenTypePasswordReset {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.userRepository.ByID(tokenModel.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
 }
 
-// ClearJWTCookie clears the JWT cookie
-func (s *AuthService) ClearJWTCookie(w http.ResponseWriter) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "auth_token",
-		Value:    "",
-		Expires:  time.Unix(0, 0),
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   s.isProduction,
-		SameSite: http.SameSiteLaxMode,
-	})
+// ResetPassword consumes a password reset token and sets a new password.
+// All other outstanding reset tokens are invalidated and existing sessions are signed out.
+func (s *AuthService) ResetPassword(token, newPassword string, client model.ClientInfo) error {
+	user, err := s.PasswordResetUser(token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			s.securityEvents.AnonymousFailure(model.SecurityEventPasswordReset, "", client, model.SecurityReasonInvalidToken)
+		}
+		return err
+	}
+
+	// Validate before consuming so a weak password doesn't burn the token
+	err = s.passwordPolicy.ValidateChange(user, newPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.tokenRepository.ConsumeToken(token, model.TokenTypePasswordReset)
+	if err != nil {
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			s.securityEvents.Failure(model.SecurityEventPasswordReset, user, "", client, model.SecurityReasonInvalidToken)
+			return ErrInvalidToken
+		}
+		return fmt.Errorf("failed to consume token: %w", err)
+	}
+
+	err = s.passwordPolicy.Remember(user)
+	if err != nil {
+		return err
+	}
+
+	hash, err := s.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	now := time.Now()
+	user.PasswordHash = &hash
+	user.PasswordChangedAt = &now
+	user.UpdatedAt = now
+
+	// The reset link proves ownership of the address
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &now
+	}
+
+	err = s.userRepository.Update(user)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	err = s.tokenRepository.DeleteByUserAndType(user.ID, model.TokenTypePasswordReset)
+	if err != nil {
+		slog.Warn("failed to delete old password reset tokens", "error", err, "user_id", user.ID)
+	}
+
+	// Whoever had the old password may still be signed in somewhere
+	err = s.RevokeAllSessions(user.ID)
+	if err != nil {
+		return err
+	}
+
+	s.securityEvents.Success(model.SecurityEventPasswordReset, user, client)
+	slog.Info("password reset", "user_id", user.ID)
+	return nil
+}
+
+// SendVerificationEmail issues an email verification token and emails the link to the user
+func (s *AuthService) SendVerificationEmail(user *model.User) error {
+	verifyToken, err := s.issueToken(user.ID, model.TokenTypeEmailVerify, emailVerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(mail.EmailVerificationMessage(user.Email, s.link("/auth/verify", verifyToken)))
+	if err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+
+	slog.Info("verification email sent", "user_id", user.ID)
+	return nil
 }
 
-// SendMagicLink generates a magic link and sends it to the user's email
-// For now, this just generates the token - email sending will be added later
-func (s *AuthService) SendMagicLink(email string) (string, error) {
+// ResendVerificationEmail sends a fresh verification link, throttled per recipient.
+// Unknown and already verified emails are ignored so the response doesn't reveal account state.
+func (s *AuthService) ResendVerificationEmail(email string) error {
 	email = strings.TrimSpace(strings.ToLower(email))
 
-	// Validate email
 	err := validation.ValidateEmail(email)
 	if err != nil {
-		return "", fmt.Errorf("invalid email: %w", err)
+		return fmt.Errorf("invalid email: %w", err)
+	}
+
+	err = s.checkRecipientThrottle(verificationResendLimit, email, "")
+	if err != nil {
+		return err
 	}
 
-	// Check if a user exists
 	user, err := s.userRepository.ByEmail(email)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
-			return "", fmt.Errorf("user not found")
+			return nil
 		}
-		return "", fmt.Errorf("failed to get user: %w", err)
+		return fmt.Errorf("failed to get user: %w", err)
 	}
 
-	// Delete any existing magic link tokens for this user
-	err = s.tokenRepository.DeleteByUserAndType(user.ID, model.TokenTypeMagicLink)
+	if user.IsEmailVerified() {
+		return nil
+	}
+
+	return s.SendVerificationEmail(user)
+}
+
+// VerifyEmail consumes an email verification token and marks the user's email as verified
+func (s *AuthService) VerifyEmail(token string, client model.ClientInfo) (*model.User, error) {
+	tokenModel, err := s.tokenRepository.ConsumeToken(token, model.TokenTypeEmailVerify)
 	if err != nil {
-		slog.Warn("failed to delete old magic link tokens", "error", err, "user_id", user.ID)
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			s.securityEvents.AnonymousFailure(model.SecurityEventEmailVerified, "", client, model.SecurityReasonInvalidToken)
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to consume token: %w", err)
 	}
 
-	// Generate magic link token
-	magicToken, err := s.GenerateToken()
+	user, err := s.userRepository.ByID(tokenModel.UserID)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %w", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	// Save token to the database
-	token := &model.Token{
-		UserID:    user.ID,
-		Type:      model.TokenTypeMagicLink,
-		Token:     magicToken,
-		ExpiresAt: time.Now().Add(15 * time.Minute),
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		user.UpdatedAt = now
+
+		err = s.userRepository.Update(user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify email: %w", err)
+		}
 	}
-	err = s.tokenRepository.Create(token)
+
+	err = s.tokenRepository.DeleteByUserAndType(user.ID, model.TokenTypeEmailVerify)
 	if err != nil {
-		return "", fmt.Errorf("failed to create token: %w", err)
+		slog.Warn("failed to delete old verification tokens", "error", err, "user_id", user.ID)
 	}
 
-	slog.Info("magic link generated", "email", user.Email, "token", magicToken)
-	return magicToken, nil
+	s.securityEvents.Success(model.SecurityEventEmailVerified, user, client)
+	slog.Info("email verified", "user_id", user.ID)
+	return user, nil
 }
 
-// VerifyMagicLink verifies the magic link token and returns the authenticated user
-func (s *AuthService) VerifyMagicLink(token string) (*model.User, error) {
-	// ConsumeToken atomically marks token as used (prevents race conditions)
-	tokenModel, err := s.tokenRepository.ConsumeToken(token)
+// RequestEmailChange stores newEmail as the user's pending email, emails a confirmation
+// link to the new address and a notice to the current one.
+// The email is only replaced once the link is confirmed.
+func (s *AuthService) RequestEmailChange(userID uuid.UUID, newEmail string) error {
+	newEmail = strings.TrimSpace(strings.ToLower(newEmail))
+
+	err := validation.ValidateEmail(newEmail)
 	if err != nil {
-		return nil, fmt.Errorf("invalid or expired magic link")
+		return err
+	}
+
+	user, err := s.userRepository.ByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if newEmail == user.Email {
+		return ErrEmailUnchanged
+	}
+
+	_, err = s.userRepository.ByEmail(newEmail)
+	if err == nil {
+		return ErrEmailTaken
+	}
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		return fmt.Errorf("failed to check email: %w", err)
+	}
+
+	// Links for a previously requested address must not confirm the new one
+	err = s.tokenRepository.DeleteByUserAndType(user.ID, model.TokenTypeEmailChange)
+	if err != nil {
+		return fmt.Errorf("failed to delete old email change tokens: %w", err)
+	}
+
+	user.PendingEmail = &newEmail
+	user.UpdatedAt = time.Now()
+	err = s.userRepository.Update(user)
+	if err != nil {
+		return fmt.Errorf("failed to save pending email: %w", err)
+	}
+
+	changeToken, err := s.issueToken(user.ID, model.TokenTypeEmailChange, emailChangeTTL)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(mail.EmailChangeConfirmMessage(newEmail, s.link("/auth/email-change/confirm", changeToken)))
+	if err != nil {
+		return fmt.Errorf("failed to send email change confirmation: %w", err)
+	}
+
+	err = s.mailer.Send(mail.EmailChangeNoticeMessage(user.Email, newEmail))
+	if err != nil {
+		slog.Warn("failed to send email change notice", "error", err, "user_id", user.ID)
+	}
+
+	slog.Info("email change requested", "user_id", user.ID)
+	return nil
+}
+
+// ConfirmEmailChange consumes an email change token and swaps in the pending email
+func (s *AuthService) ConfirmEmailChange(token string, client model.ClientInfo) (*model.User, error) {
+	tokenModel, err := s.tokenRepository.ConsumeToken(token, model.TokenTypeEmailChange)
+	if err != nil {
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			s.securityEvents.AnonymousFailure(model.SecurityEventEmailChanged, "", client, model.SecurityReasonInvalidToken)
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to consume token: %w", err)
 	}
 
-	// Verify token type
-	if tokenModel.Type != model.TokenTypeMagicLink {
-		return nil, fmt.Errorf("invalid token type")
+	err = s.userRepository.ConfirmPendingEmail(tokenModel.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrDuplicateEmail):
+			return nil, ErrEmailTaken
+		case errors.Is(err, repository.ErrUserNotFound):
+			// The change was cancelled after the link was sent
+			return nil, ErrInvalidToken
+		default:
+			return nil, fmt.Errorf("failed to confirm email change: %w", err)
+		}
+	}
+
+	user, err := s.userRepository.ByID(tokenModel.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	s.securityEvents.Success(model.SecurityEventEmailChanged, user, client)
+	slog.Info("email changed", "user_id", user.ID)
+	return user, nil
+}
+
+// CancelEmailChange discards the user's pending email and invalidates its confirmation link
+func (s *AuthService) CancelEmailChange(userID uuid.UUID) error {
+	user, err := s.userRepository.ByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user.PendingEmail == nil {
+		return ErrNoPendingEmail
+	}
+
+	err = s.tokenRepository.DeleteByUserAndType(user.ID, model.TokenTypeEmailChange)
+	if err != nil {
+		return fmt.Errorf("failed to delete email change tokens: %w", err)
+	}
+
+	user.PendingEmail = nil
+	user.UpdatedAt = time.Now()
+	err = s.userRepository.Update(user)
+	if err != nil {
+		return fmt.Errorf("failed to clear pending email: %w", err)
+	}
+
+	slog.Info("email change cancelled", "user_id", user.ID)
+	return nil
+}
+
+// VerifyMagicLink verifies the magic link token and returns the authenticated user.
+// Like Login, only refused links are recorded here.
+func (s *AuthService) VerifyMagicLink(token string, client model.ClientInfo) (*model.User, error) {
+	// ConsumeToken atomically marks token as used (prevents race conditions)
+	tokenModel, err := s.tokenRepository.ConsumeToken(token, model.TokenTypeMagicLink)
+	if err != nil {
+		s.securityEvents.AnonymousFailure(model.SecurityEventMagicLink, "", client, model.SecurityReasonInvalidToken)
+		return nil, fmt.Errorf("invalid or expired magic link")
 	}
 
 	// Get user
@@ -237,6 +689,12 @@ func (s *AuthService) VerifyMagicLink(token string) (*model.User, error) {
 		return nil, fmt.Errorf("user not found: %w", err)
 	}
 
+	err = s.CheckSSOEnforced(user)
+	if err != nil {
+		s.securityEvents.Failure(model.SecurityEventMagicLink, user, "", client, model.SecurityReasonSSORequired)
+		return nil, err
+	}
+
 	// Auto-verify email if not already verified
 	if user.EmailVerifiedAt == nil {
 		now := time.Now()
@@ -250,3 +708,29 @@ func (s *AuthService) VerifyMagicLink(token string) (*model.User, error) {
 	slog.Info("user authenticated via magic link", "user_id", user.ID, "email", user.Email)
 	return user, nil
 }
+
+// issueToken generates a one-time token of the given type and saves it to the database
+func (s *AuthService) issueToken(userID uuid.UUID, tokenType string, ttl time.Duration) (string, error) {
+	value, err := s.GenerateToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	token := &model.Token{
+		UserID:    userID,
+		Type:      tokenType,
+		Token:     value,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	err = s.tokenRepository.Create(token)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return value, nil
+}
+
+// link builds an absolute URL to path carrying the given token
+func (s *AuthService) link(path, token string) string {
+	return s.appURL + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,602 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"dotsat.work/internal/keyring"
+	"dotsat.work/internal/mail"
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/validation"
+)
+
+type authTestEnv struct {
+	users    *fakeUserRepository
+	tenants  *fakeTenantRepository
+	tokens   *fakeTokenRepository
+	sessions *fakeSessionRepository
+	throttle *fakeThrottleRepository
+	policies *fakePasswordPolicyRepository
+	history  *fakePasswordHistoryRepository
+	profiles *fakeProfileRepository
+	events   *fakeSecurityEventRepository
+	mailer   *mail.CaptureSender
+	policy   *PasswordPolicyService
+	service  *AuthService
+}
+
+func newAuthTestEnv(t *testing.T) *authTestEnv {
+	t.Helper()
+
+	env := &authTestEnv{
+		users:    newFakeUserRepository(),
+		tenants:  newFakeTenantRepository(),
+		tokens:   &fakeTokenRepository{},
+		sessions: newFakeSessionRepository(),
+		throttle: &fakeThrottleRepository{},
+		policies: newFakePasswordPolicyRepository(),
+		history:  newFakePasswordHistoryRepository(),
+		profiles: newFakeProfileRepository(),
+		events:   &fakeSecurityEventRepository{},
+		mailer:   mail.NewCaptureSender(),
+	}
+	env.policy = NewPasswordPolicyService(validation.DefaultPasswordPolicy, env.policies, env.history, env.tenants, env.profiles, testPasswordHasher(), nil)
+	env.service = NewAuthService(env.users, env.tenants, env.tokens, env.sessions, env.throttle, env.mailer, "http://localhost:8090/", testKeyring(t), testPasswordHasher(), env.policy, NewSecurityEventService(env.events, env.throttle, 24*time.Hour), false, time.Hour, 15*time.Minute)
+	return env
+}
+
+// testIP is the client address used for sign-in attempts in tests
+const testIP = "192.0.2.1"
+
+// testClient is the client the security event log attributes test requests to
+var testClient = model.ClientInfo{IPAddress: testIP, UserAgent: "Mozilla/5.0 (X11; Linux x86_64) Firefox/130.0"}
+
+// testPasswordHasher returns an argon2id hasher with minimal cost parameters for tests
+func testPasswordHasher() *PasswordHasher {
+	return NewPasswordHasher(Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1})
+}
+
+// testKeyring returns a single-key HS256 keyring for tests
+func testKeyring(t *testing.T) *keyring.Keyring {
+	t.Helper()
+
+	key, err := keyring.NewHMACKey("test", []byte("test-secret-that-is-at-least-32-bytes"))
+	if err != nil {
+		t.Fatalf("NewHMACKey() error = %v", err)
+	}
+	keys, err := keyring.New(key.ID, time.Hour, key)
+	if err != nil {
+		t.Fatalf("keyring.New() error = %v", err)
+	}
+	return keys
+}
+
+// addUser stores a user with the given password ("" for passwordless)
+func (env *authTestEnv) addUser(t *testing.T, email, password string, verified bool) *model.User {
+	t.Helper()
+
+	tenant := &model.Tenant{ID: uuid.New(), Subdomain: uuid.NewString(), Status: "active", Tier: "standard"}
+	if err := env.tenants.Create(tenant); err != nil {
+		t.Fatalf("failed to create tenant: %v", err)
+	}
+	user := &model.User{
+		ID:       uuid.New(),
+		TenantID: tenant.ID,
+		Email:    email,
+		Role:     "user",
+	}
+	if password != "" {
+		hash, err := env.service.HashPassword(password)
+		if err != nil {
+			t.Fatalf("failed to hash password: %v", err)
+		}
+		user.PasswordHash = &hash
+	}
+	if verified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	err := env.users.Create(user)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return user
+}
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// lastLinkToken extracts the token query parameter from the link in the last sent email
+func (env *authTestEnv) lastLinkToken(t *testing.T) (string, mail.Message) {
+	t.Helper()
+
+	msg, ok := env.mailer.Last()
+	if !ok {
+		t.Fatal("expected an email to be sent")
+	}
+	return linkToken(t, msg), msg
+}
+
+// linkToken extracts the token query parameter from the link in msg
+func linkToken(t *testing.T, msg mail.Message) string {
+	t.Helper()
+
+	link := linkPattern.FindString(msg.Text)
+	if link == "" {
+		t.Fatalf("expected a link in email body, got %q", msg.Text)
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("failed to parse link %q: %v", link, err)
+	}
+	return u.Query().Get("token")
+}
+
+func TestAuthService_SendMagicLink(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "magic@example.com", "", false)
+
+	err := env.service.SendMagicLink("  Magic@Example.com ", testIP)
+	if err != nil {
+		t.Fatalf("SendMagicLink() error = %v", err)
+	}
+
+	token, msg := env.lastLinkToken(t)
+	if msg.To != "magic@example.com" {
+		t.Errorf("expected email to magic@example.com, got %q", msg.To)
+	}
+	if !strings.Contains(msg.Text, "http://localhost:8090/auth/magic-link/verify?token=") {
+		t.Errorf("expected verify link in email body, got %q", msg.Text)
+	}
+
+	verified, err := env.service.VerifyMagicLink(token, testClient)
+	if err != nil {
+		t.Fatalf("VerifyMagicLink() error = %v", err)
+	}
+	if verified.ID != user.ID {
+		t.Errorf("expected user %v, got %v", user.ID, verified.ID)
+	}
+	if !verified.IsEmailVerified() {
+		t.Error("expected magic link to verify the email address")
+	}
+
+	// Magic links are single-use
+	_, err = env.service.VerifyMagicLink(token, testClient)
+	if err == nil {
+		t.Error("expected second use of magic link to fail")
+	}
+}
+
+func TestAuthService_SendMagicLink_UnknownEmail(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	// Unknown addresses get the same response as known ones
+	err := env.service.SendMagicLink("nobody@example.com", testIP)
+	if err != nil {
+		t.Errorf("SendMagicLink() error = %v, want nil", err)
+	}
+	if got := len(env.mailer.Messages()); got != 0 {
+		t.Errorf("expected no emails to be sent, got %d", got)
+	}
+}
+
+func TestAuthService_SSOEnforced(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "member@acme.test", "a-long-enough-password", true)
+
+	err := env.service.SendMagicLink("member@acme.test", testIP)
+	if err != nil {
+		t.Fatalf("SendMagicLink() error = %v", err)
+	}
+	token, _ := env.lastLinkToken(t)
+
+	env.tenants.tenants[user.TenantID].SSOEnforced = true
+
+	if _, err := env.service.Login("member@acme.test", "a-long-enough-password", testClient); !errors.Is(err, ErrSSORequired) {
+		t.Errorf("Login() error = %v, want ErrSSORequired", err)
+	}
+	// A wrong password looks like any other, the owner is told about single sign-on by email
+	if _, err := env.service.Login("member@acme.test", "wrong-password-entirely", testClient); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() with wrong password error = %v, want ErrInvalidCredentials", err)
+	}
+	if msg, ok := env.mailer.Last(); !ok || !strings.Contains(msg.Text, "http://localhost:8090/auth/sso") {
+		t.Errorf("expected single sign-on notice, got %+v", msg)
+	}
+	// Magic link requests are answered like any other, without sending a link or repeating the notice
+	env.throttle.backdate(magicLinkLimit.cooldown)
+	if err := env.service.SendMagicLink("member@acme.test", testIP); err != nil {
+		t.Errorf("SendMagicLink() error = %v, want nil", err)
+	}
+	// Links sent before single sign-on was required stop working too
+	if _, err := env.service.VerifyMagicLink(token, testClient); !errors.Is(err, ErrSSORequired) {
+		t.Errorf("VerifyMagicLink() error = %v, want ErrSSORequired", err)
+	}
+	if got := len(env.mailer.Messages()); got != 2 {
+		t.Errorf("expected only the first magic link and one notice email, got %d", got)
+	}
+}
+
+func TestAuthService_ResetPassword(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "reset@example.com", "old-password-is-long", true)
+
+	oldSession := mustStartSession(t, env.service, user)
+
+	// Two outstanding reset links; using one must invalidate the other
+	var err error
+	for range 2 {
+		env.throttle.backdate(passwordResetLimit.cooldown)
+		err = env.service.RequestPasswordReset("reset@example.com", testClient)
+		if err != nil {
+			t.Fatalf("RequestPasswordReset() error = %v", err)
+		}
+	}
+	messages := env.mailer.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 reset emails, got %d", len(messages))
+	}
+	firstToken := linkToken(t, messages[0])
+	token, _ := env.lastLinkToken(t)
+
+	// A weak password is rejected without consuming the token
+	err = env.service.ResetPassword(token, "short", testClient)
+	if err == nil {
+		t.Fatal("expected weak password to be rejected")
+	}
+
+	err = env.service.ResetPassword(token, "brand-new-password-2024", testClient)
+	if err != nil {
+		t.Fatalf("ResetPassword() error = %v", err)
+	}
+
+	_, err = env.service.Login("reset@example.com", "brand-new-password-2024", testClient)
+	if err != nil {
+		t.Errorf("expected login with new password to succeed, got %v", err)
+	}
+	_, err = env.service.Login("reset@example.com", "old-password-is-long", testClient)
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected old password to be rejected, got %v", err)
+	}
+
+	// Both the used and the other outstanding token are now invalid
+	for _, tok := range []string{token, firstToken} {
+		err = env.service.ResetPassword(tok, "another-new-password-2024", testClient)
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected ErrInvalidToken for reused token, got %v", err)
+		}
+	}
+
+	// Sessions issued before the reset are revoked
+	claims, err := env.service.VerifyJWT(oldSession.AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyJWT() error = %v", err)
+	}
+	if _, err := env.service.ValidateSession(claims); !errors.Is(err, ErrInvalidSession) {
+		t.Error("expected session issued before reset to be revoked")
+	}
+	newClaims, err := env.service.VerifyJWT(mustStartSession(t, env.service, user).AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyJWT() error = %v", err)
+	}
+	if _, err := env.service.ValidateSession(newClaims); err != nil {
+		t.Errorf("expected session issued after reset to be accepted, got %v", err)
+	}
+}
+
+func TestAuthService_ResetPassword_WrongTokenType(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.addUser(t, "magic@example.com", "", true)
+
+	err := env.service.SendMagicLink("magic@example.com", testIP)
+	if err != nil {
+		t.Fatalf("SendMagicLink() error = %v", err)
+	}
+	token, _ := env.lastLinkToken(t)
+
+	err = env.service.ResetPassword(token, "brand-new-password-2024", testClient)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for magic link token, got %v", err)
+	}
+}
+
+func TestAuthService_RequestPasswordReset_UnknownEmail(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	err := env.service.RequestPasswordReset("nobody@example.com", testClient)
+	if err != nil {
+		t.Errorf("expected no error for unknown email, got %v", err)
+	}
+	if got := len(env.mailer.Messages()); got != 0 {
+		t.Errorf("expected no emails to be sent, got %d", got)
+	}
+}
+
+// mustStartSession starts a session for the user and returns its tokens
+func mustStartSession(t *testing.T, s *AuthService, user *model.User) *SessionTokens {
+	t.Helper()
+
+	tokens, err := s.StartSession(user)
+	if err != nil {
+		t.Fatalf("StartSession() error = %v", err)
+	}
+	return tokens
+}
+
+func TestAuthService_VerifyEmail(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "new@example.com", "a-long-enough-password", false)
+
+	_, err := env.service.Login("new@example.com", "a-long-enough-password", testClient)
+	if !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatalf("expected ErrEmailNotVerified before verification, got %v", err)
+	}
+
+	err = env.service.SendVerificationEmail(user)
+	if err != nil {
+		t.Fatalf("SendVerificationEmail() error = %v", err)
+	}
+	token, msg := env.lastLinkToken(t)
+	if !strings.Contains(msg.Text, "http://localhost:8090/auth/verify?token=") {
+		t.Errorf("expected verify link in email body, got %q", msg.Text)
+	}
+
+	// Opening the link at the wrong endpoint doesn't burn it
+	if _, err := env.service.VerifyMagicLink(token, testClient); err == nil {
+		t.Fatal("expected a verification token to be refused as a magic link")
+	}
+
+	verified, err := env.service.VerifyEmail(token, testClient)
+	if err != nil {
+		t.Fatalf("VerifyEmail() error = %v", err)
+	}
+	if !verified.IsEmailVerified() {
+		t.Error("expected email to be verified")
+	}
+	if event := env.events.last(); event == nil || event.Type != model.SecurityEventEmailVerified || !event.Succeeded() {
+		t.Errorf("expected the verification to be recorded, got %+v", event)
+	}
+
+	_, err = env.service.Login("new@example.com", "a-long-enough-password", testClient)
+	if err != nil {
+		t.Errorf("expected login to succeed after verification, got %v", err)
+	}
+
+	_, err = env.service.VerifyEmail(token, testClient)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for reused token, got %v", err)
+	}
+}
+
+func TestAuthService_ResendVerificationEmail(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.addUser(t, "new@example.com", "a-long-enough-password", false)
+	env.addUser(t, "verified@example.com", "a-long-enough-password", true)
+
+	err := env.service.ResendVerificationEmail("new@example.com")
+	if err != nil {
+		t.Fatalf("ResendVerificationEmail() error = %v", err)
+	}
+
+	// A second request within the cooldown is throttled
+	err = env.service.ResendVerificationEmail("new@example.com")
+	if !errors.Is(err, ErrTooManyRequests) {
+		t.Errorf("expected ErrTooManyRequests within cooldown, got %v", err)
+	}
+
+	// Once the cooldown has passed, the hourly limit still applies
+	for range verificationResendLimit.max - 1 {
+		env.throttle.backdate(verificationResendLimit.cooldown)
+		err = env.service.ResendVerificationEmail("new@example.com")
+		if err != nil {
+			t.Fatalf("ResendVerificationEmail() error = %v", err)
+		}
+	}
+	env.throttle.backdate(verificationResendLimit.cooldown)
+	err = env.service.ResendVerificationEmail("new@example.com")
+	if !errors.Is(err, ErrTooManyRequests) {
+		t.Errorf("expected ErrTooManyRequests after hourly limit, got %v", err)
+	}
+
+	// Unknown and already verified addresses are silently ignored, and throttled the same way
+	for _, email := range []string{"nobody@example.com", "verified@example.com"} {
+		err = env.service.ResendVerificationEmail(email)
+		if err != nil {
+			t.Errorf("expected no error for %s, got %v", email, err)
+		}
+		err = env.service.ResendVerificationEmail(email)
+		if !errors.Is(err, ErrTooManyRequests) {
+			t.Errorf("expected ErrTooManyRequests within cooldown for %s, got %v", email, err)
+		}
+	}
+	if got := len(env.mailer.Messages()); got != verificationResendLimit.max {
+		t.Errorf("expected exactly %d verification emails, got %d", verificationResendLimit.max, got)
+	}
+}
+
+func TestAuthService_Login_IndistinguishableFailures(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.addUser(t, "password@example.com", "a-long-enough-password", true)
+	env.addUser(t, "passwordless@example.com", "", true)
+
+	for _, email := range []string{"password@example.com", "passwordless@example.com", "nobody@example.com"} {
+		_, err := env.service.Login(email, "wrong-password-entirely", testClient)
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Login(%s) error = %v, want ErrInvalidCredentials", email, err)
+		}
+		if err.Error() != "invalid credentials: invalid email or password" {
+			t.Errorf("Login(%s) error = %q, want the same message for every account", email, err)
+		}
+	}
+
+	// Only the passwordless owner is told why, by email
+	messages := env.mailer.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 notice email, got %d", len(messages))
+	}
+	if messages[0].To != "passwordless@example.com" || !strings.Contains(messages[0].Text, "http://localhost:8090/auth/magic-link") {
+		t.Errorf("expected passwordless notice with a magic link pointer, got %+v", messages[0])
+	}
+
+	// Repeated attempts don't flood the owner's inbox
+	_, _ = env.service.Login("passwordless@example.com", "another-wrong-password", model.ClientInfo{IPAddress: "198.51.100.7"})
+	if got := len(env.mailer.Messages()); got != 1 {
+		t.Errorf("expected notices to be throttled, got %d emails", got)
+	}
+}
+
+func TestAuthService_EmailChange(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "old@example.com", "a-long-enough-password", true)
+
+	err := env.service.RequestEmailChange(user.ID, " New@Example.com ")
+	if err != nil {
+		t.Fatalf("RequestEmailChange() error = %v", err)
+	}
+
+	messages := env.mailer.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("expected confirmation and notice emails, got %d", len(messages))
+	}
+	if messages[0].To != "new@example.com" || !strings.Contains(messages[0].Text, "/auth/email-change/confirm?token=") {
+		t.Errorf("expected confirmation link sent to new address, got %+v", messages[0])
+	}
+	if messages[1].To != "old@example.com" || !strings.Contains(messages[1].Text, "new@example.com") {
+		t.Errorf("expected notice sent to old address, got %+v", messages[1])
+	}
+
+	pending, err := env.users.ByID(user.ID)
+	if err != nil {
+		t.Fatalf("failed to reload user: %v", err)
+	}
+	if pending.Email != "old@example.com" || pending.PendingEmail == nil || *pending.PendingEmail != "new@example.com" {
+		t.Fatalf("expected email unchanged with pending new@example.com, got %q / %v", pending.Email, pending.PendingEmail)
+	}
+
+	changed, err := env.service.ConfirmEmailChange(linkToken(t, messages[0]), testClient)
+	if err != nil {
+		t.Fatalf("ConfirmEmailChange() error = %v", err)
+	}
+	if changed.Email != "new@example.com" || changed.PendingEmail != nil {
+		t.Errorf("expected email swapped to new@example.com, got %q / %v", changed.Email, changed.PendingEmail)
+	}
+}
+
+func TestAuthService_RequestEmailChange_Errors(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "old@example.com", "a-long-enough-password", true)
+	env.addUser(t, "taken@example.com", "a-long-enough-password", true)
+
+	tests := []struct {
+		name     string
+		newEmail string
+		wantErr  error
+	}{
+		{"same address", "OLD@example.com", ErrEmailUnchanged},
+		{"address in use", "taken@example.com", ErrEmailTaken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := env.service.RequestEmailChange(user.ID, tt.newEmail)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	err := env.service.RequestEmailChange(user.ID, "not-an-email")
+	if err == nil {
+		t.Error("expected invalid email to be rejected")
+	}
+	if got := len(env.mailer.Messages()); got != 0 {
+		t.Errorf("expected no emails to be sent, got %d", got)
+	}
+}
+
+func TestAuthService_CancelEmailChange(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "old@example.com", "a-long-enough-password", true)
+
+	err := env.service.RequestEmailChange(user.ID, "new@example.com")
+	if err != nil {
+		t.Fatalf("RequestEmailChange() error = %v", err)
+	}
+	token := linkToken(t, env.mailer.Messages()[0])
+
+	err = env.service.CancelEmailChange(user.ID)
+	if err != nil {
+		t.Fatalf("CancelEmailChange() error = %v", err)
+	}
+
+	_, err = env.service.ConfirmEmailChange(token, testClient)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken after cancel, got %v", err)
+	}
+
+	err = env.service.CancelEmailChange(user.ID)
+	if !errors.Is(err, ErrNoPendingEmail) {
+		t.Errorf("expected ErrNoPendingEmail, got %v", err)
+	}
+}
+
+func TestAuthService_ConfirmEmailChange_TakenMeanwhile(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "old@example.com", "a-long-enough-password", true)
+
+	err := env.service.RequestEmailChange(user.ID, "new@example.com")
+	if err != nil {
+		t.Fatalf("RequestEmailChange() error = %v", err)
+	}
+	token := linkToken(t, env.mailer.Messages()[0])
+
+	// Someone else registers the address before the link is confirmed
+	env.addUser(t, "new@example.com", "a-long-enough-password", true)
+
+	_, err = env.service.ConfirmEmailChange(token, testClient)
+	if !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("expected ErrEmailTaken, got %v", err)
+	}
+}
+
+func TestAuthService_Login_RehashesPassword(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "legacy@example.com", "", true)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct-horse-battery-staple"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword() error = %v", err)
+	}
+	hash := string(legacy)
+	env.users.users[user.ID].PasswordHash = &hash
+
+	if _, err := env.service.Login("legacy@example.com", "wrong-horse-battery-staple", testClient); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login() with wrong password error = %v, want ErrInvalidCredentials", err)
+	}
+	if *env.users.users[user.ID].PasswordHash != hash {
+		t.Error("expected a failed sign-in to keep the old hash")
+	}
+
+	if _, err := env.service.Login("legacy@example.com", "correct-horse-battery-staple", testClient); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	rehashed := *env.users.users[user.ID].PasswordHash
+	if !strings.HasPrefix(rehashed, "$argon2id$") {
+		t.Fatalf("expected the bcrypt hash to be upgraded to argon2id, got %q", rehashed)
+	}
+
+	// The upgraded hash keeps working and isn't rehashed again
+	if _, err := env.service.Login("legacy@example.com", "correct-horse-battery-staple", testClient); err != nil {
+		t.Fatalf("Login() after rehash error = %v", err)
+	}
+	if *env.users.users[user.ID].PasswordHash != rehashed {
+		t.Error("expected a current hash not to be rehashed")
+	}
+}
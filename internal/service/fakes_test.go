@@ -0,0 +1,1090 @@
+package service
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+)
+
+// fakeUserRepository is an in-memory repository.UserRepository
+type fakeUserRepository struct {
+	users map[uuid.UUID]*model.User
+}
+
+func newFakeUserRepository() *fakeUserRepository {
+	return &fakeUserRepository{users: map[uuid.UUID]*model.User{}}
+}
+
+func (f *fakeUserRepository) Create(user *model.User) error {
+	for _, u := range f.users {
+		if u.Email == user.Email {
+			return repository.ErrDuplicateEmail
+		}
+	}
+	copied := *user
+	f.users[user.ID] = &copied
+	return nil
+}
+
+func (f *fakeUserRepository) ByID(id uuid.UUID) (*model.User, error) {
+	u, ok := f.users[id]
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+	copied := *u
+	return &copied, nil
+}
+
+func (f *fakeUserRepository) ByEmail(email string) (*model.User, error) {
+	for _, u := range f.users {
+		if u.Email == email {
+			copied := *u
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (f *fakeUserRepository) ByTenantAndEmail(tenantID uuid.UUID, email string) (*model.User, error) {
+	for _, u := range f.users {
+		if u.TenantID == tenantID && u.Email == email {
+			copied := *u
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (f *fakeUserRepository) ByTenantID(tenantID uuid.UUID) ([]*model.User, error) {
+	var users []*model.User
+	for _, u := range f.users {
+		if u.TenantID == tenantID {
+			copied := *u
+			users = append(users, &copied)
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeUserRepository) Update(user *model.User) error {
+	if _, ok := f.users[user.ID]; !ok {
+		return repository.ErrUserNotFound
+	}
+	copied := *user
+	f.users[user.ID] = &copied
+	return nil
+}
+
+func (f *fakeUserRepository) UpdatePasswordHash(id uuid.UUID, oldHash, newHash string) error {
+	if u, ok := f.users[id]; ok && u.PasswordHash != nil && *u.PasswordHash == oldHash {
+		u.PasswordHash = &newHash
+	}
+	return nil
+}
+
+func (f *fakeUserRepository) ConfirmPendingEmail(id uuid.UUID) error {
+	u, ok := f.users[id]
+	if !ok || u.PendingEmail == nil {
+		return repository.ErrUserNotFound
+	}
+	for _, other := range f.users {
+		if other.ID != id && other.Email == *u.PendingEmail {
+			return repository.ErrDuplicateEmail
+		}
+	}
+	now := time.Now()
+	u.Email = *u.PendingEmail
+	u.PendingEmail = nil
+	u.EmailVerifiedAt = &now
+	return nil
+}
+
+func (f *fakeUserRepository) Delete(id uuid.UUID) error {
+	if _, ok := f.users[id]; !ok {
+		return repository.ErrUserNotFound
+	}
+	delete(f.users, id)
+	return nil
+}
+
+// fakeTokenRepository is an in-memory repository.TokenRepository
+type fakeTokenRepository struct {
+	tokens []*model.Token
+}
+
+func (f *fakeTokenRepository) Create(token *model.Token) error {
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	copied := *token
+	f.tokens = append(f.tokens, &copied)
+	return nil
+}
+
+func (f *fakeTokenRepository) ConsumeToken(token, tokenType string) (*model.Token, error) {
+	for _, t := range f.tokens {
+		if t.Token == token && t.Type == tokenType && t.IsValid() {
+			now := time.Now()
+			t.UsedAt = &now
+			copied := *t
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrTokenNotFound
+}
+
+func (f *fakeTokenRepository) ByToken(token string) (*model.Token, error) {
+	for _, t := range f.tokens {
+		if t.Token == token && t.IsValid() {
+			copied := *t
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrTokenNotFound
+}
+
+func (f *fakeTokenRepository) DeleteByUserAndType(userID uuid.UUID, tokenType string) error {
+	kept := f.tokens[:0]
+	for _, t := range f.tokens {
+		if t.UserID == userID && t.Type == tokenType && t.UsedAt == nil {
+			continue
+		}
+		kept = append(kept, t)
+	}
+	f.tokens = kept
+	return nil
+}
+
+// fakeTenantRepository is an in-memory repository.TenantRepository
+type fakeTenantRepository struct {
+	tenants map[uuid.UUID]*model.Tenant
+}
+
+func newFakeTenantRepository() *fakeTenantRepository {
+	return &fakeTenantRepository{tenants: map[uuid.UUID]*model.Tenant{}}
+}
+
+func (f *fakeTenantRepository) Create(tenant *model.Tenant) error {
+	for _, t := range f.tenants {
+		if t.Subdomain == tenant.Subdomain {
+			return repository.ErrDuplicateSubdomain
+		}
+	}
+	copied := *tenant
+	f.tenants[tenant.ID] = &copied
+	return nil
+}
+
+func (f *fakeTenantRepository) ByID(id uuid.UUID) (*model.Tenant, error) {
+	t, ok := f.tenants[id]
+	if !ok {
+		return nil, repository.ErrTenantNotFound
+	}
+	copied := *t
+	return &copied, nil
+}
+
+func (f *fakeTenantRepository) BySubdomain(subdomain string) (*model.Tenant, error) {
+	for _, t := range f.tenants {
+		if t.Subdomain == subdomain {
+			copied := *t
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrTenantNotFound
+}
+
+func (f *fakeTenantRepository) Update(tenant *model.Tenant) error {
+	if _, ok := f.tenants[tenant.ID]; !ok {
+		return repository.ErrTenantNotFound
+	}
+	copied := *tenant
+	f.tenants[tenant.ID] = &copied
+	return nil
+}
+
+func (f *fakeTenantRepository) Delete(id uuid.UUID) error {
+	if _, ok := f.tenants[id]; !ok {
+		return repository.ErrTenantNotFound
+	}
+	delete(f.tenants, id)
+	return nil
+}
+
+func (f *fakeTenantRepository) List() ([]*model.Tenant, error) {
+	var tenants []*model.Tenant
+	for _, t := range f.tenants {
+		copied := *t
+		tenants = append(tenants, &copied)
+	}
+	return tenants, nil
+}
+
+// fakeSignupRepository writes to the fake tenant and user repositories,
+// undoing the tenant when the user insert fails like the real transaction would
+type fakeSignupRepository struct {
+	tenants  *fakeTenantRepository
+	users    *fakeUserRepository
+	profiles []*model.Profile
+}
+
+func (f *fakeSignupRepository) CreateOrganization(tenant *model.Tenant, user *model.User, profile *model.Profile) error {
+	err := f.tenants.Create(tenant)
+	if err != nil {
+		return err
+	}
+
+	err = f.users.Create(user)
+	if err != nil {
+		delete(f.tenants.tenants, tenant.ID)
+		return err
+	}
+
+	copied := *profile
+	f.profiles = append(f.profiles, &copied)
+	return nil
+}
+
+func (f *fakeSignupRepository) CreateMember(user *model.User, profile *model.Profile) error {
+	err := f.users.Create(user)
+	if err != nil {
+		return err
+	}
+
+	copied := *profile
+	f.profiles = append(f.profiles, &copied)
+	return nil
+}
+
+// fakeSessionRepository is an in-memory repository.SessionRepository
+type fakeSessionRepository struct {
+	sessions      map[uuid.UUID]*model.Session
+	refreshTokens map[string]*model.RefreshToken
+}
+
+func newFakeSessionRepository() *fakeSessionRepository {
+	return &fakeSessionRepository{
+		sessions:      map[uuid.UUID]*model.Session{},
+		refreshTokens: map[string]*model.RefreshToken{},
+	}
+}
+
+func (f *fakeSessionRepository) Create(session *model.Session) error {
+	copied := *session
+	f.sessions[session.ID] = &copied
+	return nil
+}
+
+func (f *fakeSessionRepository) ByID(id uuid.UUID) (*model.Session, error) {
+	session, ok := f.sessions[id]
+	if !ok {
+		return nil, repository.ErrSessionNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (f *fakeSessionRepository) ActiveByUserID(userID uuid.UUID) ([]*model.Session, error) {
+	var sessions []*model.Session
+	for _, session := range f.sessions {
+		if session.UserID == userID && session.IsActive() {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions, nil
+}
+
+func (f *fakeSessionRepository) Touch(id uuid.UUID, userAgent, ipAddress string, seenAt time.Time) error {
+	if session, ok := f.sessions[id]; ok {
+		session.UserAgent = userAgent
+		session.IPAddress = ipAddress
+		session.LastSeenAt = &seenAt
+	}
+	return nil
+}
+
+func (f *fakeSessionRepository) Revoke(id uuid.UUID) error {
+	if session, ok := f.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+func (f *fakeSessionRepository) RevokeAllByUserID(userID uuid.UUID) error {
+	for id, session := range f.sessions {
+		if session.UserID == userID {
+			_ = f.Revoke(id)
+		}
+	}
+	return nil
+}
+
+func (f *fakeSessionRepository) CreateRefreshToken(token *model.RefreshToken) error {
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+	copied := *token
+	f.refreshTokens[token.TokenHash] = &copied
+	return nil
+}
+
+func (f *fakeSessionRepository) ConsumeRefreshToken(tokenHash string) (*model.RefreshToken, error) {
+	token, ok := f.refreshTokens[tokenHash]
+	if !ok || token.IsUsed() || time.Now().After(token.ExpiresAt) {
+		return nil, repository.ErrRefreshTokenNotFound
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	copied := *token
+	return &copied, nil
+}
+
+func (f *fakeSessionRepository) RefreshTokenByHash(tokenHash string) (*model.RefreshToken, error) {
+	token, ok := f.refreshTokens[tokenHash]
+	if !ok {
+		return nil, repository.ErrRefreshTokenNotFound
+	}
+	copied := *token
+	return &copied, nil
+}
+
+// backdateRefreshTokenUse pretends the refresh token was exchanged ago in the past
+func (f *fakeSessionRepository) backdateRefreshTokenUse(tokenHash string, ago time.Duration) {
+	usedAt := time.Now().Add(-ago)
+	f.refreshTokens[tokenHash].UsedAt = &usedAt
+}
+
+// fakeTwoFactorRepository is an in-memory repository.TwoFactorRepository
+type fakeTwoFactorRepository struct {
+	credentials   map[uuid.UUID]*model.TOTPCredential
+	recoveryCodes map[uuid.UUID]map[string]bool // code hash -> used
+	challenges    map[uuid.UUID]*model.TwoFactorChallenge
+}
+
+func newFakeTwoFactorRepository() *fakeTwoFactorRepository {
+	return &fakeTwoFactorRepository{
+		credentials:   map[uuid.UUID]*model.TOTPCredential{},
+		recoveryCodes: map[uuid.UUID]map[string]bool{},
+		challenges:    map[uuid.UUID]*model.TwoFactorChallenge{},
+	}
+}
+
+func (f *fakeTwoFactorRepository) UpsertTOTP(credential *model.TOTPCredential) error {
+	copied := *credential
+	copied.ConfirmedAt = nil
+	copied.LastUsedStep = nil
+	f.credentials[credential.UserID] = &copied
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) TOTPByUserID(userID uuid.UUID) (*model.TOTPCredential, error) {
+	credential, ok := f.credentials[userID]
+	if !ok {
+		return nil, repository.ErrTOTPNotFound
+	}
+	copied := *credential
+	return &copied, nil
+}
+
+func (f *fakeTwoFactorRepository) ConfirmTOTP(userID uuid.UUID) error {
+	credential, ok := f.credentials[userID]
+	if !ok {
+		return repository.ErrTOTPNotFound
+	}
+	now := time.Now()
+	credential.ConfirmedAt = &now
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) MarkTOTPStepUsed(userID uuid.UUID, step int64) error {
+	credential, ok := f.credentials[userID]
+	if !ok || (credential.LastUsedStep != nil && *credential.LastUsedStep >= step) {
+		return repository.ErrTOTPStepUsed
+	}
+	credential.LastUsedStep = &step
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) DeleteTOTP(userID uuid.UUID) error {
+	delete(f.credentials, userID)
+	delete(f.recoveryCodes, userID)
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) ReplaceRecoveryCodes(userID uuid.UUID, codeHashes []string) error {
+	codes := map[string]bool{}
+	for _, hash := range codeHashes {
+		codes[hash] = false
+	}
+	f.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) ConsumeRecoveryCode(userID uuid.UUID, codeHash string) error {
+	used, ok := f.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return repository.ErrRecoveryCodeNotFound
+	}
+	f.recoveryCodes[userID][codeHash] = true
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) CountUnusedRecoveryCodes(userID uuid.UUID) (int, error) {
+	count := 0
+	for _, used := range f.recoveryCodes[userID] {
+		if !used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *fakeTwoFactorRepository) CreateChallenge(challenge *model.TwoFactorChallenge) error {
+	if challenge.ID == uuid.Nil {
+		challenge.ID = uuid.New()
+	}
+	copied := *challenge
+	f.challenges[challenge.ID] = &copied
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) ActiveChallengeByHash(tokenHash string) (*model.TwoFactorChallenge, error) {
+	for _, challenge := range f.challenges {
+		if challenge.TokenHash == tokenHash && challenge.ConsumedAt == nil && time.Now().Before(challenge.ExpiresAt) {
+			copied := *challenge
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrChallengeNotFound
+}
+
+func (f *fakeTwoFactorRepository) IncrementChallengeAttempts(id uuid.UUID) (int, error) {
+	challenge, ok := f.challenges[id]
+	if !ok {
+		return 0, repository.ErrChallengeNotFound
+	}
+	challenge.Attempts++
+	return challenge.Attempts, nil
+}
+
+func (f *fakeTwoFactorRepository) ConsumeChallenge(id uuid.UUID) error {
+	challenge, ok := f.challenges[id]
+	if !ok || challenge.ConsumedAt != nil {
+		return repository.ErrChallengeNotFound
+	}
+	now := time.Now()
+	challenge.ConsumedAt = &now
+	return nil
+}
+
+func (f *fakeTwoFactorRepository) CleanupExpiredChallenges(olderThan time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-olderThan)
+	var deleted int64
+	for id, challenge := range f.challenges {
+		if challenge.ExpiresAt.Before(cutoff) {
+			delete(f.challenges, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// fakeWebAuthnRepository is an in-memory repository.WebAuthnRepository
+type fakeWebAuthnRepository struct {
+	credentials map[uuid.UUID]*model.WebAuthnCredential
+	ceremonies  map[string]*model.WebAuthnCeremony // token hash -> ceremony
+}
+
+func newFakeWebAuthnRepository() *fakeWebAuthnRepository {
+	return &fakeWebAuthnRepository{
+		credentials: map[uuid.UUID]*model.WebAuthnCredential{},
+		ceremonies:  map[string]*model.WebAuthnCeremony{},
+	}
+}
+
+func (f *fakeWebAuthnRepository) CreateCredential(credential *model.WebAuthnCredential) error {
+	for _, existing := range f.credentials {
+		if bytes.Equal(existing.CredentialID, credential.CredentialID) {
+			return repository.ErrDuplicateWebAuthnCredential
+		}
+	}
+	credential.ID = uuid.New()
+	credential.CreatedAt = time.Now()
+	f.credentials[credential.ID] = credential
+	return nil
+}
+
+func (f *fakeWebAuthnRepository) CredentialsByUserID(userID uuid.UUID) ([]*model.WebAuthnCredential, error) {
+	var credentials []*model.WebAuthnCredential
+	for _, credential := range f.credentials {
+		if credential.UserID == userID {
+			copied := *credential
+			credentials = append(credentials, &copied)
+		}
+	}
+	return credentials, nil
+}
+
+func (f *fakeWebAuthnRepository) UpdateCredentialUse(credential *model.WebAuthnCredential) error {
+	stored, ok := f.credentials[credential.ID]
+	if !ok {
+		return repository.ErrWebAuthnCredentialNotFound
+	}
+	stored.SignCount = credential.SignCount
+	stored.BackupState = credential.BackupState
+	stored.LastUsedAt = credential.LastUsedAt
+	return nil
+}
+
+func (f *fakeWebAuthnRepository) DeleteCredential(userID, id uuid.UUID) error {
+	credential, ok := f.credentials[id]
+	if !ok || credential.UserID != userID {
+		return repository.ErrWebAuthnCredentialNotFound
+	}
+	delete(f.credentials, id)
+	return nil
+}
+
+func (f *fakeWebAuthnRepository) CreateCeremony(ceremony *model.WebAuthnCeremony) error {
+	ceremony.ID = uuid.New()
+	f.ceremonies[ceremony.TokenHash] = ceremony
+	return nil
+}
+
+func (f *fakeWebAuthnRepository) ConsumeCeremony(tokenHash string) (*model.WebAuthnCeremony, error) {
+	ceremony, ok := f.ceremonies[tokenHash]
+	if !ok || time.Now().After(ceremony.ExpiresAt) {
+		return nil, repository.ErrWebAuthnCeremonyNotFound
+	}
+	delete(f.ceremonies, tokenHash)
+	return ceremony, nil
+}
+
+// fakeOIDCRepository is an in-memory repository.OIDCRepository
+type fakeOIDCRepository struct {
+	configs map[uuid.UUID]*model.OIDCConfig
+	states  map[string]*model.OIDCLoginState // state hash -> login state
+}
+
+func newFakeOIDCRepository() *fakeOIDCRepository {
+	return &fakeOIDCRepository{
+		configs: map[uuid.UUID]*model.OIDCConfig{},
+		states:  map[string]*model.OIDCLoginState{},
+	}
+}
+
+func (f *fakeOIDCRepository) ConfigByTenantID(tenantID uuid.UUID) (*model.OIDCConfig, error) {
+	config, ok := f.configs[tenantID]
+	if !ok {
+		return nil, repository.ErrOIDCConfigNotFound
+	}
+	copied := *config
+	return &copied, nil
+}
+
+func (f *fakeOIDCRepository) UpsertConfig(config *model.OIDCConfig) error {
+	now := time.Now()
+	if existing, ok := f.configs[config.TenantID]; ok {
+		config.CreatedAt = existing.CreatedAt
+	} else {
+		config.CreatedAt = now
+	}
+	config.UpdatedAt = now
+	copied := *config
+	f.configs[config.TenantID] = &copied
+	return nil
+}
+
+func (f *fakeOIDCRepository) DeleteConfig(tenantID uuid.UUID) error {
+	if _, ok := f.configs[tenantID]; !ok {
+		return repository.ErrOIDCConfigNotFound
+	}
+	delete(f.configs, tenantID)
+	return nil
+}
+
+func (f *fakeOIDCRepository) CreateLoginState(state *model.OIDCLoginState) error {
+	state.ID = uuid.New()
+	state.CreatedAt = time.Now()
+	copied := *state
+	f.states[state.StateHash] = &copied
+	return nil
+}
+
+func (f *fakeOIDCRepository) ConsumeLoginState(stateHash string) (*model.OIDCLoginState, error) {
+	state, ok := f.states[stateHash]
+	if !ok || time.Now().After(state.ExpiresAt) {
+		return nil, repository.ErrOIDCLoginStateNotFound
+	}
+	delete(f.states, stateHash)
+	return state, nil
+}
+
+// fakeSAMLRepository is an in-memory repository.SAMLRepository
+type fakeSAMLRepository struct {
+	configs map[uuid.UUID]*model.SAMLConfig
+	states  map[string]*model.SAMLLoginState // state hash -> login state
+}
+
+func newFakeSAMLRepository() *fakeSAMLRepository {
+	return &fakeSAMLRepository{
+		configs: map[uuid.UUID]*model.SAMLConfig{},
+		states:  map[string]*model.SAMLLoginState{},
+	}
+}
+
+func (f *fakeSAMLRepository) ConfigByTenantID(tenantID uuid.UUID) (*model.SAMLConfig, error) {
+	config, ok := f.configs[tenantID]
+	if !ok {
+		return nil, repository.ErrSAMLConfigNotFound
+	}
+	copied := *config
+	return &copied, nil
+}
+
+func (f *fakeSAMLRepository) UpsertConfig(config *model.SAMLConfig) error {
+	now := time.Now()
+	if existing, ok := f.configs[config.TenantID]; ok {
+		config.CreatedAt = existing.CreatedAt
+	} else {
+		config.CreatedAt = now
+	}
+	config.UpdatedAt = now
+	copied := *config
+	f.configs[config.TenantID] = &copied
+	return nil
+}
+
+func (f *fakeSAMLRepository) DeleteConfig(tenantID uuid.UUID) error {
+	if _, ok := f.configs[tenantID]; !ok {
+		return repository.ErrSAMLConfigNotFound
+	}
+	delete(f.configs, tenantID)
+	return nil
+}
+
+func (f *fakeSAMLRepository) CreateLoginState(state *model.SAMLLoginState) error {
+	state.ID = uuid.New()
+	state.CreatedAt = time.Now()
+	copied := *state
+	f.states[state.StateHash] = &copied
+	return nil
+}
+
+func (f *fakeSAMLRepository) ConsumeLoginState(stateHash string) (*model.SAMLLoginState, error) {
+	state, ok := f.states[stateHash]
+	if !ok || time.Now().After(state.ExpiresAt) {
+		return nil, repository.ErrSAMLLoginStateNotFound
+	}
+	delete(f.states, stateHash)
+	return state, nil
+}
+
+// fakeThrottleRepository is an in-memory repository.ThrottleRepository
+type fakeThrottleRepository struct {
+	events []*model.ThrottleEvent
+}
+
+func (f *fakeThrottleRepository) Record(event *model.ThrottleEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	copied := *event
+	f.events = append(f.events, &copied)
+	return nil
+}
+
+func (f *fakeThrottleRepository) StatsByEmailSince(action, email string, since time.Time) (*model.ThrottleStats, error) {
+	return f.stats(func(e *model.ThrottleEvent) bool {
+		return e.Action == action && e.Email == email && !e.CreatedAt.Before(since)
+	}), nil
+}
+
+func (f *fakeThrottleRepository) StatsByIPSince(action, ipAddress string, since time.Time) (*model.ThrottleStats, error) {
+	return f.stats(func(e *model.ThrottleEvent) bool {
+		return e.Action == action && e.IPAddress == ipAddress && !e.CreatedAt.Before(since)
+	}), nil
+}
+
+func (f *fakeThrottleRepository) StatsByUserSince(action string, userID uuid.UUID, since time.Time) (*model.ThrottleStats, error) {
+	return f.stats(func(e *model.ThrottleEvent) bool {
+		return e.Action == action && e.UserID != nil && *e.UserID == userID && !e.CreatedAt.Before(since)
+	}), nil
+}
+
+func (f *fakeThrottleRepository) DeleteByEmail(action, email string) error {
+	kept := f.events[:0]
+	for _, e := range f.events {
+		if e.Action != action || e.Email != email {
+			kept = append(kept, e)
+		}
+	}
+	f.events = kept
+	return nil
+}
+
+func (f *fakeThrottleRepository) CleanupExpired(olderThan time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-olderThan)
+	kept := f.events[:0]
+	for _, e := range f.events {
+		if !e.CreatedAt.Before(cutoff) {
+			kept = append(kept, e)
+		}
+	}
+	deleted := int64(len(f.events) - len(kept))
+	f.events = kept
+	return deleted, nil
+}
+
+func (f *fakeThrottleRepository) stats(match func(*model.ThrottleEvent) bool) *model.ThrottleStats {
+	stats := &model.ThrottleStats{}
+	for _, e := range f.events {
+		if !match(e) {
+			continue
+		}
+		stats.Count++
+		if stats.LastAt == nil || e.CreatedAt.After(*stats.LastAt) {
+			lastAt := e.CreatedAt
+			stats.LastAt = &lastAt
+		}
+	}
+	return stats
+}
+
+// backdate moves every recorded event into the past, as if ago had elapsed
+func (f *fakeThrottleRepository) backdate(ago time.Duration) {
+	for _, e := range f.events {
+		e.CreatedAt = e.CreatedAt.Add(-ago)
+	}
+}
+
+// fakePersonalAccessTokenRepository is an in-memory repository.PersonalAccessTokenRepository
+type fakePersonalAccessTokenRepository struct {
+	tokens map[uuid.UUID]*model.PersonalAccessToken
+}
+
+func newFakePersonalAccessTokenRepository() *fakePersonalAccessTokenRepository {
+	return &fakePersonalAccessTokenRepository{tokens: map[uuid.UUID]*model.PersonalAccessToken{}}
+}
+
+func (f *fakePersonalAccessTokenRepository) Create(token *model.PersonalAccessToken) error {
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+	token.CreatedAt = time.Now()
+	copied := *token
+	f.tokens[token.ID] = &copied
+	return nil
+}
+
+func (f *fakePersonalAccessTokenRepository) ByHash(tokenHash string) (*model.PersonalAccessToken, error) {
+	for _, token := range f.tokens {
+		if token.TokenHash == tokenHash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrPersonalAccessTokenNotFound
+}
+
+func (f *fakePersonalAccessTokenRepository) ActiveByUserID(userID uuid.UUID) ([]*model.PersonalAccessToken, error) {
+	var tokens []*model.PersonalAccessToken
+	for _, token := range f.tokens {
+		if token.UserID == userID && token.IsActive() {
+			copied := *token
+			tokens = append(tokens, &copied)
+		}
+	}
+	return tokens, nil
+}
+
+func (f *fakePersonalAccessTokenRepository) Touch(id uuid.UUID, usedAt time.Time) error {
+	if token, ok := f.tokens[id]; ok {
+		token.LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+func (f *fakePersonalAccessTokenRepository) Revoke(userID, id uuid.UUID) error {
+	token, ok := f.tokens[id]
+	if !ok || token.UserID != userID || token.RevokedAt != nil {
+		return repository.ErrPersonalAccessTokenNotFound
+	}
+	now := time.Now()
+	token.RevokedAt = &now
+	return nil
+}
+
+// fakeAPIKeyRepository is an in-memory repository.APIKeyRepository
+type fakeAPIKeyRepository struct {
+	keys map[uuid.UUID]*model.APIKey
+}
+
+func newFakeAPIKeyRepository() *fakeAPIKeyRepository {
+	return &fakeAPIKeyRepository{keys: map[uuid.UUID]*model.APIKey{}}
+}
+
+func (f *fakeAPIKeyRepository) Create(key *model.APIKey) error {
+	if key.ID == uuid.Nil {
+		key.ID = uuid.New()
+	}
+	key.CreatedAt = time.Now()
+	copied := *key
+	f.keys[key.ID] = &copied
+	return nil
+}
+
+func (f *fakeAPIKeyRepository) ByID(tenantID, id uuid.UUID) (*model.APIKey, error) {
+	key, ok := f.keys[id]
+	if !ok || key.TenantID != tenantID {
+		return nil, repository.ErrAPIKeyNotFound
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (f *fakeAPIKeyRepository) ByHash(keyHash string) (*model.APIKey, error) {
+	for _, key := range f.keys {
+		if key.KeyHash == keyHash {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrAPIKeyNotFound
+}
+
+func (f *fakeAPIKeyRepository) ActiveByTenantID(tenantID uuid.UUID) ([]*model.APIKey, error) {
+	var keys []*model.APIKey
+	for _, key := range f.keys {
+		if key.TenantID == tenantID && key.IsActive() {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	return keys, nil
+}
+
+func (f *fakeAPIKeyRepository) Touch(id uuid.UUID, usedAt time.Time) error {
+	if key, ok := f.keys[id]; ok {
+		key.LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+func (f *fakeAPIKeyRepository) Rotate(id uuid.UUID, expiresAt time.Time, replacement *model.APIKey) error {
+	key, ok := f.keys[id]
+	if !ok || key.TenantID != replacement.TenantID || key.RevokedAt != nil || key.ExpiresAt != nil {
+		return repository.ErrAPIKeyNotFound
+	}
+	key.ExpiresAt = &expiresAt
+	return f.Create(replacement)
+}
+
+func (f *fakeAPIKeyRepository) Revoke(tenantID, id uuid.UUID) error {
+	key, ok := f.keys[id]
+	if !ok || key.TenantID != tenantID || key.RevokedAt != nil {
+		return repository.ErrAPIKeyNotFound
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	return nil
+}
+
+// fakeImpersonationRepository is an in-memory repository.ImpersonationRepository
+type fakeImpersonationRepository struct {
+	impersonations map[uuid.UUID]*model.Impersonation
+}
+
+func newFakeImpersonationRepository() *fakeImpersonationRepository {
+	return &fakeImpersonationRepository{impersonations: map[uuid.UUID]*model.Impersonation{}}
+}
+
+func (f *fakeImpersonationRepository) Create(impersonation *model.Impersonation) error {
+	copied := *impersonation
+	f.impersonations[impersonation.ID] = &copied
+	return nil
+}
+
+func (f *fakeImpersonationRepository) ByID(id uuid.UUID) (*model.Impersonation, error) {
+	impersonation, ok := f.impersonations[id]
+	if !ok {
+		return nil, repository.ErrImpersonationNotFound
+	}
+	copied := *impersonation
+	return &copied, nil
+}
+
+func (f *fakeImpersonationRepository) End(id uuid.UUID, endedAt time.Time) error {
+	if impersonation, ok := f.impersonations[id]; ok && impersonation.EndedAt == nil {
+		impersonation.EndedAt = &endedAt
+	}
+	return nil
+}
+
+// fakePasswordPolicyRepository is an in-memory repository.PasswordPolicyRepository
+type fakePasswordPolicyRepository struct {
+	policies map[uuid.UUID]*model.TenantPasswordPolicy
+}
+
+func newFakePasswordPolicyRepository() *fakePasswordPolicyRepository {
+	return &fakePasswordPolicyRepository{policies: map[uuid.UUID]*model.TenantPasswordPolicy{}}
+}
+
+func (f *fakePasswordPolicyRepository) ByTenantID(tenantID uuid.UUID) (*model.TenantPasswordPolicy, error) {
+	policy, ok := f.policies[tenantID]
+	if !ok {
+		return nil, repository.ErrPasswordPolicyNotFound
+	}
+	copied := *policy
+	return &copied, nil
+}
+
+func (f *fakePasswordPolicyRepository) Upsert(policy *model.TenantPasswordPolicy) error {
+	copied := *policy
+	f.policies[policy.TenantID] = &copied
+	return nil
+}
+
+// fakePasswordHistoryRepository is an in-memory repository.PasswordHistoryRepository
+type fakePasswordHistoryRepository struct {
+	// entries are kept newest first
+	entries map[uuid.UUID][]model.PasswordHistoryEntry
+}
+
+func newFakePasswordHistoryRepository() *fakePasswordHistoryRepository {
+	return &fakePasswordHistoryRepository{entries: map[uuid.UUID][]model.PasswordHistoryEntry{}}
+}
+
+func (f *fakePasswordHistoryRepository) Add(entry *model.PasswordHistoryEntry, keep int) error {
+	entries := append([]model.PasswordHistoryEntry{*entry}, f.entries[entry.UserID]...)
+	f.entries[entry.UserID] = entries[:min(len(entries), keep)]
+	return nil
+}
+
+func (f *fakePasswordHistoryRepository) Recent(userID uuid.UUID, limit int) ([]model.PasswordHistoryEntry, error) {
+	entries := f.entries[userID]
+	return entries[:min(len(entries), limit)], nil
+}
+
+// fakeProfileRepository is an in-memory repository.ProfileRepository
+type fakeProfileRepository struct {
+	profiles map[uuid.UUID]*model.Profile
+}
+
+func newFakeProfileRepository() *fakeProfileRepository {
+	return &fakeProfileRepository{profiles: map[uuid.UUID]*model.Profile{}}
+}
+
+func (f *fakeProfileRepository) ByUserID(userID uuid.UUID) (*model.Profile, error) {
+	profile, ok := f.profiles[userID]
+	if !ok {
+		return nil, repository.ErrProfileNotFound
+	}
+	copied := *profile
+	return &copied, nil
+}
+
+func (f *fakeProfileRepository) Create(profile *model.Profile) error {
+	copied := *profile
+	f.profiles[profile.UserID] = &copied
+	return nil
+}
+
+func (f *fakeProfileRepository) UpdateName(userID uuid.UUID, name string) error {
+	profile, ok := f.profiles[userID]
+	if !ok {
+		return repository.ErrProfileNotFound
+	}
+	profile.Name = name
+	return nil
+}
+
+func (f *fakeProfileRepository) UpdateDetails(userID uuid.UUID, bio, phone *string) error {
+	profile, ok := f.profiles[userID]
+	if !ok {
+		return repository.ErrProfileNotFound
+	}
+	profile.Bio = bio
+	profile.Phone = phone
+	return nil
+}
+
+func (f *fakeProfileRepository) MarkOnboarded(userID uuid.UUID) error {
+	profile, ok := f.profiles[userID]
+	if !ok {
+		return repository.ErrProfileNotFound
+	}
+	now := time.Now()
+	profile.OnboardedAt = &now
+	return nil
+}
+
+// fakeSecurityEventRepository is an in-memory repository.SecurityEventRepository
+type fakeSecurityEventRepository struct {
+	// events are kept in the order they were recorded
+	events []*model.SecurityEvent
+}
+
+func (f *fakeSecurityEventRepository) Create(event *model.SecurityEvent) error {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	copied := *event
+	f.events = append(f.events, &copied)
+	return nil
+}
+
+func (f *fakeSecurityEventRepository) ByActorID(actorID uuid.UUID, limit int) ([]*model.SecurityEvent, error) {
+	return f.newest(limit, func(event *model.SecurityEvent) bool {
+		return event.ActorID != nil && *event.ActorID == actorID
+	}), nil
+}
+
+func (f *fakeSecurityEventRepository) ByTenantID(tenantID uuid.UUID, limit int) ([]*model.SecurityEvent, error) {
+	return f.newest(limit, func(event *model.SecurityEvent) bool {
+		return event.TenantID != nil && *event.TenantID == tenantID
+	}), nil
+}
+
+func (f *fakeSecurityEventRepository) CleanupExpired(olderThan time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-olderThan)
+	kept := f.events[:0]
+	for _, event := range f.events {
+		if !event.CreatedAt.Before(cutoff) {
+			kept = append(kept, event)
+		}
+	}
+	deleted := int64(len(f.events) - len(kept))
+	f.events = kept
+	return deleted, nil
+}
+
+func (f *fakeSecurityEventRepository) newest(limit int, match func(*model.SecurityEvent) bool) []*model.SecurityEvent {
+	events := []*model.SecurityEvent{}
+	for i := len(f.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if match(f.events[i]) {
+			events = append(events, f.events[i])
+		}
+	}
+	return events
+}
+
+// last returns the most recently recorded event, or nil if there is none
+func (f *fakeSecurityEventRepository) last() *model.SecurityEvent {
+	if len(f.events) == 0 {
+		return nil
+	}
+	return f.events[len(f.events)-1]
+}
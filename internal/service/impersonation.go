@@ -0,0 +1,236 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"dotsat.work/internal/keyring"
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotPlatformStaff            = errors.New("only platform staff can impersonate users")
+	ErrImpersonationTargetNotFound = errors.New("no user with that email address")
+	ErrCannotImpersonate           = errors.New("platform staff and yourself can't be impersonated")
+	ErrImpersonationReason         = errors.New("a reason of at most 500 characters is required")
+	ErrInvalidImpersonation        = errors.New("impersonation is invalid, expired or stopped")
+)
+
+const (
+	// ImpersonationCookie holds the impersonation JWT next to the staff member's own session cookies
+	ImpersonationCookie = "impersonation_token"
+
+	// Impersonations can't be renewed; staff start a new one, with a new reason, when this runs out
+	impersonationTTL = 30 * time.Minute
+
+	// impersonationTokenType is the typ claim that keeps impersonation and session JWTs apart
+	impersonationTokenType = "impersonation"
+
+	maxImpersonationReasonLength = 500
+)
+
+// ImpersonationService lets platform staff sign in as another user to see what they see.
+// Every impersonation needs a reason and is recorded with its start and stop time.
+type ImpersonationService struct {
+	impersonationRepository repository.ImpersonationRepository
+	userRepository          repository.UserRepository
+	securityEvents          *SecurityEventService
+	keys                    *keyring.Keyring
+	isProduction            bool
+}
+
+func NewImpersonationService(
+	impersonationRepository repository.ImpersonationRepository,
+	userRepository repository.UserRepository,
+	securityEvents *SecurityEventService,
+	keys *keyring.Keyring,
+	isProduction bool,
+) *ImpersonationService {
+	return &ImpersonationService{
+		impersonationRepository: impersonationRepository,
+		userRepository:          userRepository,
+		securityEvents:          securityEvents,
+		keys:                    keys,
+		isProduction:            isProduction,
+	}
+}
+
+// Start records an impersonation of the user with targetEmail and returns a short-lived JWT
+// carrying both the staff member's and the target's user IDs. The start is recorded as a
+// security event of the staff member in the target's tenant.
+func (s *ImpersonationService) Start(staff *model.User, targetEmail, reason string, client model.ClientInfo) (string, *model.Impersonation, error) {
+	if !staff.PlatformStaff {
+		return "", nil, ErrNotPlatformStaff
+	}
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" || utf8.RuneCountInString(reason) > maxImpersonationReasonLength {
+		return "", nil, ErrImpersonationReason
+	}
+
+	target, err := s.userRepository.ByEmail(strings.ToLower(strings.TrimSpace(targetEmail)))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return "", nil, ErrImpersonationTargetNotFound
+		}
+		return "", nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if target.ID == staff.ID || target.PlatformStaff {
+		return "", nil, ErrCannotImpersonate
+	}
+
+	now := time.Now()
+	impersonation := &model.Impersonation{
+		ID:                uuid.New(),
+		ImpersonatorID:    &staff.ID,
+		ImpersonatorEmail: staff.Email,
+		TargetUserID:      &target.ID,
+		TargetEmail:       target.Email,
+		TargetTenantID:    &target.TenantID,
+		Reason:            reason,
+		IPAddress:         client.IPAddress,
+		StartedAt:         now,
+		ExpiresAt:         now.Add(impersonationTTL),
+	}
+	err = s.impersonationRepository.Create(impersonation)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to record impersonation: %w", err)
+	}
+
+	token, err := s.keys.Sign(jwt.MapClaims{
+		"jti":             impersonation.ID.String(),
+		"typ":             impersonationTokenType,
+		"user_id":         target.ID.String(),
+		"tenant_id":       target.TenantID.String(),
+		"impersonator_id": staff.ID.String(),
+		"exp":             impersonation.ExpiresAt.Unix(),
+		"iat":             now.Unix(),
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to sign impersonation token: %w", err)
+	}
+
+	slog.Warn("impersonation started",
+		"impersonation_id", impersonation.ID,
+		"impersonator_id", staff.ID,
+		"target_user_id", target.ID,
+		"reason", reason,
+		"ip_address", client.IPAddress,
+	)
+	s.securityEvents.SuccessInTenant(model.SecurityEventImpersonationStarted, staff, target.TenantID, client)
+	return token, impersonation, nil
+}
+
+// Validate checks that the impersonation token was issued to the staff member signed in
+// underneath it and that the impersonation is still running
+func (s *ImpersonationService) Validate(token string, staffID uuid.UUID) (*model.Impersonation, error) {
+	claims, err := s.keys.Parse(token)
+	if err != nil {
+		return nil, ErrInvalidImpersonation
+	}
+	if claims["typ"] != impersonationTokenType || claims["impersonator_id"] != staffID.String() {
+		return nil, ErrInvalidImpersonation
+	}
+
+	impersonation, err := s.impersonationByClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	if !impersonation.IsActive() || impersonation.TargetUserID == nil ||
+		impersonation.TargetUserID.String() != claims["user_id"] {
+		return nil, ErrInvalidImpersonation
+	}
+
+	return impersonation, nil
+}
+
+// Stop ends the impersonation the token belongs to. Tokens that no longer verify
+// belong to impersonations that have already expired, so there is nothing to end.
+func (s *ImpersonationService) Stop(token string, client model.ClientInfo) error {
+	claims, err := s.keys.Parse(token)
+	if err != nil || claims["typ"] != impersonationTokenType {
+		return nil
+	}
+
+	impersonation, err := s.impersonationByClaims(claims)
+	if errors.Is(err, ErrInvalidImpersonation) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.impersonationRepository.End(impersonation.ID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to end impersonation: %w", err)
+	}
+
+	slog.Warn("impersonation stopped",
+		"impersonation_id", impersonation.ID,
+		"impersonator_id", impersonation.ImpersonatorID,
+		"target_user_id", impersonation.TargetUserID,
+	)
+
+	// Both are cleared when the staff member or the tenant is deleted; there is then
+	// nobody left to record the stop for
+	if impersonation.ImpersonatorID == nil || impersonation.TargetTenantID == nil {
+		return nil
+	}
+	staff, err := s.userRepository.ByID(*impersonation.ImpersonatorID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	s.securityEvents.SuccessInTenant(model.SecurityEventImpersonationStopped, staff, *impersonation.TargetTenantID, client)
+	return nil
+}
+
+// SetCookie stores the impersonation token until the impersonation expires
+func (s *ImpersonationService) SetCookie(w http.ResponseWriter, token string) {
+	s.setCookie(w, token, time.Now().Add(impersonationTTL))
+}
+
+// ClearCookie removes the impersonation token, returning the staff member to their own account
+func (s *ImpersonationService) ClearCookie(w http.ResponseWriter) {
+	s.setCookie(w, "", time.Unix(0, 0))
+}
+
+func (s *ImpersonationService) setCookie(w http.ResponseWriter, value string, expiry time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     ImpersonationCookie,
+		Value:    value,
+		Expires:  expiry,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   s.isProduction,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// impersonationByClaims loads the impersonation referenced by the jti claim
+func (s *ImpersonationService) impersonationByClaims(claims jwt.MapClaims) (*model.Impersonation, error) {
+	jti, _ := claims["jti"].(string)
+	id, err := uuid.Parse(jti)
+	if err != nil {
+		return nil, ErrInvalidImpersonation
+	}
+
+	impersonation, err := s.impersonationRepository.ByID(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrImpersonationNotFound) {
+			return nil, ErrInvalidImpersonation
+		}
+		return nil, fmt.Errorf("failed to get impersonation: %w", err)
+	}
+	return impersonation, nil
+}
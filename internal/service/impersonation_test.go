@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+	"github.com/google/uuid"
+)
+
+type impersonationTestEnv struct {
+	service        *ImpersonationService
+	impersonations *fakeImpersonationRepository
+	users          *fakeUserRepository
+	events         *fakeSecurityEventRepository
+	staff          *model.User
+	target         *model.User
+}
+
+func newImpersonationTestEnv(t *testing.T) *impersonationTestEnv {
+	t.Helper()
+
+	env := &impersonationTestEnv{
+		impersonations: newFakeImpersonationRepository(),
+		users:          newFakeUserRepository(),
+		events:         &fakeSecurityEventRepository{},
+		staff:          &model.User{ID: uuid.New(), TenantID: uuid.New(), Email: "support@dotsat.work", Role: "user", PlatformStaff: true},
+		target:         &model.User{ID: uuid.New(), TenantID: uuid.New(), Email: "partner@example.com", Role: "admin"},
+	}
+	for _, user := range []*model.User{env.staff, env.target} {
+		if err := env.users.Create(user); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	env.service = NewImpersonationService(env.impersonations, env.users, NewSecurityEventService(env.events, &fakeThrottleRepository{}, 24*time.Hour), testKeyring(t), false)
+	return env
+}
+
+func TestImpersonationService_StartAndValidate(t *testing.T) {
+	env := newImpersonationTestEnv(t)
+
+	token, impersonation, err := env.service.Start(env.staff, " Partner@Example.com ", "Ticket 1234: dashboard is empty", testClient)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if *impersonation.TargetUserID != env.target.ID || *impersonation.ImpersonatorID != env.staff.ID || impersonation.IPAddress != testIP {
+		t.Errorf("unexpected impersonation record %+v", impersonation)
+	}
+	if event := env.events.last(); event == nil || event.Type != model.SecurityEventImpersonationStarted ||
+		*event.ActorID != env.staff.ID || *event.TenantID != env.target.TenantID {
+		t.Errorf("expected the start to be recorded for the staff member in the target's tenant, got %+v", event)
+	}
+	if until := time.Until(impersonation.ExpiresAt); until <= 0 || until > impersonationTTL {
+		t.Errorf("expected a short-lived impersonation, expires in %v", until)
+	}
+
+	claims, err := testKeyring(t).Parse(token)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if claims["user_id"] != env.target.ID.String() || claims["impersonator_id"] != env.staff.ID.String() {
+		t.Errorf("expected token to carry both user IDs, got %v", claims)
+	}
+
+	validated, err := env.service.Validate(token, env.staff.ID)
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if validated.ID != impersonation.ID {
+		t.Errorf("expected impersonation %s, got %s", impersonation.ID, validated.ID)
+	}
+
+	// The token only works on top of the staff member's own session
+	if _, err := env.service.Validate(token, uuid.New()); !errors.Is(err, ErrInvalidImpersonation) {
+		t.Errorf("Validate() for another user error = %v, want ErrInvalidImpersonation", err)
+	}
+}
+
+func TestImpersonationService_Start_Refused(t *testing.T) {
+	env := newImpersonationTestEnv(t)
+	otherStaff := &model.User{ID: uuid.New(), Email: "ops@dotsat.work", PlatformStaff: true}
+	if err := env.users.Create(otherStaff); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		staff   *model.User
+		email   string
+		reason  string
+		wantErr error
+	}{
+		{name: "not staff", staff: env.target, email: env.staff.Email, reason: "curious", wantErr: ErrNotPlatformStaff},
+		{name: "no reason", staff: env.staff, email: env.target.Email, reason: "  ", wantErr: ErrImpersonationReason},
+		{name: "unknown user", staff: env.staff, email: "nobody@example.com", reason: "Ticket 1", wantErr: ErrImpersonationTargetNotFound},
+		{name: "self", staff: env.staff, email: env.staff.Email, reason: "Ticket 1", wantErr: ErrCannotImpersonate},
+		{name: "other staff", staff: env.staff, email: otherStaff.Email, reason: "Ticket 1", wantErr: ErrCannotImpersonate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := env.service.Start(tt.staff, tt.email, tt.reason, testClient); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Start() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if len(env.impersonations.impersonations) != 0 {
+		t.Errorf("expected refused impersonations not to be recorded, got %d", len(env.impersonations.impersonations))
+	}
+	if len(env.events.events) != 0 {
+		t.Errorf("expected refused impersonations not to be logged as security events, got %+v", env.events.events)
+	}
+}
+
+func TestImpersonationService_Stop(t *testing.T) {
+	env := newImpersonationTestEnv(t)
+
+	token, impersonation, err := env.service.Start(env.staff, env.target.Email, "Ticket 1234", testClient)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	if err := env.service.Stop(token, testClient); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if env.impersonations.impersonations[impersonation.ID].EndedAt == nil {
+		t.Error("expected the stop to be recorded")
+	}
+	if event := env.events.last(); event == nil || event.Type != model.SecurityEventImpersonationStopped ||
+		*event.ActorID != env.staff.ID || *event.TenantID != env.target.TenantID {
+		t.Errorf("expected the stop to be recorded for the staff member in the target's tenant, got %+v", event)
+	}
+	if _, err := env.service.Validate(token, env.staff.ID); !errors.Is(err, ErrInvalidImpersonation) {
+		t.Errorf("Validate() after stop error = %v, want ErrInvalidImpersonation", err)
+	}
+	if err := env.service.Stop("not-a-token", testClient); err != nil {
+		t.Errorf("Stop() with a stale token error = %v", err)
+	}
+}
+
+func TestImpersonationService_Validate_RejectsSessionTokens(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "staff@example.com", "long-enough-password", true)
+	impersonations := NewImpersonationService(newFakeImpersonationRepository(), env.users, NewSecurityEventService(env.events, env.throttle, 24*time.Hour), testKeyring(t), false)
+
+	accessToken := mustStartSession(t, env.service, user).AccessToken
+	if _, err := impersonations.Validate(accessToken, user.ID); !errors.Is(err, ErrInvalidImpersonation) {
+		t.Errorf("Validate() with a session token error = %v, want ErrInvalidImpersonation", err)
+	}
+}
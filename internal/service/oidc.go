@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrInvalidOIDCIssuer  = errors.New("invalid issuer: must be an https URL serving OpenID Connect discovery")
+	ErrOIDCClientRequired = errors.New("client ID and client secret are required")
+)
+
+const (
+	// OIDCStateCookie binds the IdP callback to the browser that started the sign-in
+	OIDCStateCookie = "oidc_state"
+
+	oidcCallbackPath = "/auth/sso/oidc/callback"
+	oidcStateTTL     = 10 * time.Minute
+	oidcHTTPTimeout  = 10 * time.Second
+)
+
+// OIDCConfigInput is a tenant admin's OIDC settings. An empty ClientSecret keeps the stored one.
+type OIDCConfigInput struct {
+	Issuer          string
+	ClientID        string
+	ClientSecret    string
+	AllowedDomains  string
+	JITProvisioning bool
+	DefaultRole     string
+	Enabled         bool
+}
+
+// OIDCService signs users in through their tenant's OpenID Connect provider
+// with the authorization code flow and PKCE
+type OIDCService struct {
+	oidcRepository   repository.OIDCRepository
+	tenantRepository repository.TenantRepository
+	members          ssoMembers
+	appURL           string
+	isProduction     bool
+	httpClient       *http.Client
+
+	// providers caches discovery documents and key sets by issuer
+	mu        sync.Mutex
+	providers map[string]*oidc.Provider
+}
+
+func NewOIDCService(
+	oidcRepository repository.OIDCRepository,
+	tenantRepository repository.TenantRepository,
+	userRepository repository.UserRepository,
+	signupRepository repository.SignupRepository,
+	appURL string,
+	isProduction bool,
+) *OIDCService {
+	return &OIDCService{
+		oidcRepository:   oidcRepository,
+		tenantRepository: tenantRepository,
+		members:          ssoMembers{userRepository: userRepository, signupRepository: signupRepository},
+		appURL:           strings.TrimRight(appURL, "/"),
+		isProduction:     isProduction,
+		httpClient:       &http.Client{Timeout: oidcHTTPTimeout},
+		providers:        map[string]*oidc.Provider{},
+	}
+}
+
+// Config returns the tenant's OIDC settings
+func (s *OIDCService) Config(tenantID uuid.UUID) (*model.OIDCConfig, error) {
+	config, err := s.oidcRepository.ConfigByTenantID(tenantID)
+	if errors.Is(err, repository.ErrOIDCConfigNotFound) {
+		return nil, ErrSSONotConfigured
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oidc config: %w", err)
+	}
+	return config, nil
+}
+
+// CallbackURL is the redirect URI tenants register with their identity provider
+func (s *OIDCService) CallbackURL() string {
+	return s.appURL + oidcCallbackPath
+}
+
+// SaveConfig validates and stores the tenant's OIDC settings. The issuer must answer discovery.
+func (s *OIDCService) SaveConfig(ctx context.Context, tenant *model.Tenant, input OIDCConfigInput) (*model.OIDCConfig, error) {
+	if !tenant.IsEnterprise() {
+		return nil, ErrSSONotAvailable
+	}
+
+	existing, err := s.Config(tenant.ID)
+	if err != nil && !errors.Is(err, ErrSSONotConfigured) {
+		return nil, err
+	}
+
+	config := &model.OIDCConfig{
+		TenantID:     tenant.ID,
+		Issuer:       strings.TrimRight(strings.TrimSpace(input.Issuer), "/"),
+		ClientID:     strings.TrimSpace(input.ClientID),
+		ClientSecret: input.ClientSecret,
+	}
+	if config.ClientSecret == "" && existing != nil {
+		config.ClientSecret = existing.ClientSecret
+	}
+
+	if err := s.validateIssuer(config.Issuer); err != nil {
+		return nil, err
+	}
+	if config.ClientID == "" || config.ClientSecret == "" {
+		return nil, ErrOIDCClientRequired
+	}
+	config.SSOAccess, err = newSSOAccess(input.AllowedDomains, input.JITProvisioning, input.DefaultRole, input.Enabled)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled && tenant.SSOEnforced {
+		return nil, ErrSSOEnforced
+	}
+
+	_, err = s.provider(ctx, config.Issuer)
+	if err != nil {
+		slog.Warn("oidc discovery failed", "error", err, "issuer", config.Issuer, "tenant_id", tenant.ID)
+		return nil, ErrInvalidOIDCIssuer
+	}
+
+	err = s.oidcRepository.UpsertConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save oidc config: %w", err)
+	}
+
+	slog.Info("oidc config saved", "tenant_id", tenant.ID, "issuer", config.Issuer)
+	return config, nil
+}
+
+// BeginLogin returns the IdP authorization URL for the tenant with the given subdomain,
+// and the state to keep in OIDCStateCookie until the callback
+func (s *OIDCService) BeginLogin(ctx context.Context, subdomain string) (authURL, state string, err error) {
+	tenant, config, err := s.enabledConfig(strings.ToLower(strings.TrimSpace(subdomain)))
+	if err != nil {
+		return "", "", err
+	}
+
+	oauthConfig, _, err := s.oauthConfig(ctx, config)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err = randomToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	err = s.oidcRepository.CreateLoginState(&model.OIDCLoginState{
+		StateHash:    hashToken(state),
+		TenantID:     tenant.ID,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to store oidc login state: %w", err)
+	}
+
+	authURL = oauthConfig.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return authURL, state, nil
+}
+
+// CompleteLogin exchanges the authorization code, verifies the ID token and returns the tenant
+// user for its verified email, creating the user if the tenant allows just-in-time provisioning.
+// cookieState is the value of OIDCStateCookie and state the value the IdP sent back.
+func (s *OIDCService) CompleteLogin(ctx context.Context, cookieState, state, code string) (*model.User, error) {
+	if state == "" || subtle.ConstantTimeCompare([]byte(cookieState), []byte(state)) != 1 {
+		return nil, ErrInvalidSSOState
+	}
+
+	loginState, err := s.oidcRepository.ConsumeLoginState(hashToken(state))
+	if errors.Is(err, repository.ErrOIDCLoginStateNotFound) {
+		return nil, ErrInvalidSSOState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume oidc login state: %w", err)
+	}
+
+	config, err := s.Config(loginState.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled {
+		return nil, ErrSSONotConfigured
+	}
+
+	oauthConfig, provider, err := s.oauthConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = oidc.ClientContext(ctx, s.httpClient)
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(loginState.CodeVerifier))
+	if err != nil {
+		slog.Warn("oidc code exchange failed", "error", err, "tenant_id", config.TenantID)
+		return nil, ErrSSOFailed
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		slog.Warn("oidc token response has no id_token", "tenant_id", config.TenantID)
+		return nil, ErrSSOFailed
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		slog.Warn("oidc id token failed verification", "error", err, "tenant_id", config.TenantID)
+		return nil, ErrSSOFailed
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(loginState.Nonce)) != 1 {
+		slog.Warn("oidc id token nonce mismatch", "tenant_id", config.TenantID)
+		return nil, ErrSSOFailed
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	err = idToken.Claims(&claims)
+	if err != nil {
+		slog.Warn("oidc id token claims invalid", "error", err, "tenant_id", config.TenantID)
+		return nil, ErrSSOFailed
+	}
+
+	return s.members.user(config.TenantID, &config.SSOAccess, ssoIdentity{
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	})
+}
+
+// SetStateCookie stores the state until the IdP redirects back. It has to be SameSite=Lax
+// because the callback is a top-level navigation from the IdP's site.
+func (s *OIDCService) SetStateCookie(w http.ResponseWriter, state string) {
+	s.setStateCookie(w, state, time.Now().Add(oidcStateTTL))
+}
+
+// ClearStateCookie removes the state once the callback has been handled
+func (s *OIDCService) ClearStateCookie(w http.ResponseWriter) {
+	s.setStateCookie(w, "", time.Unix(0, 0))
+}
+
+func (s *OIDCService) setStateCookie(w http.ResponseWriter, value string, expiry time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     OIDCStateCookie,
+		Value:    value,
+		Expires:  expiry,
+		Path:     oidcCallbackPath,
+		HttpOnly: true,
+		Secure:   s.isProduction,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// enabledConfig returns the tenant with the given subdomain and its enabled OIDC config
+func (s *OIDCService) enabledConfig(subdomain string) (*model.Tenant, *model.OIDCConfig, error) {
+	tenant, err := s.tenantRepository.BySubdomain(subdomain)
+	if errors.Is(err, repository.ErrTenantNotFound) {
+		return nil, nil, ErrSSONotConfigured
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+	if !tenant.IsActive() || !tenant.IsEnterprise() {
+		return nil, nil, ErrSSONotConfigured
+	}
+
+	config, err := s.Config(tenant.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !config.Enabled {
+		return nil, nil, ErrSSONotConfigured
+	}
+	return tenant, config, nil
+}
+
+func (s *OIDCService) oauthConfig(ctx context.Context, config *model.OIDCConfig) (*oauth2.Config, *oidc.Provider, error) {
+	provider, err := s.provider(ctx, config.Issuer)
+	if err != nil {
+		slog.Error("oidc discovery failed", "error", err, "issuer", config.Issuer, "tenant_id", config.TenantID)
+		return nil, nil, ErrSSOFailed
+	}
+
+	return &oauth2.Config{
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  s.CallbackURL(),
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}, provider, nil
+}
+
+// provider returns the discovered provider for issuer, fetching it on first use
+func (s *OIDCService) provider(ctx context.Context, issuer string) (*oidc.Provider, error) {
+	s.mu.Lock()
+	provider, ok := s.providers[issuer]
+	s.mu.Unlock()
+	if ok {
+		return provider, nil
+	}
+
+	// The provider keeps this context for fetching signing keys later, so it must not be request scoped
+	provider, err := oidc.NewProvider(oidc.ClientContext(context.WithoutCancel(ctx), s.httpClient), issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.providers[issuer] = provider
+	s.mu.Unlock()
+	return provider, nil
+}
+
+// validateIssuer requires https, except outside production where a local provider may use http
+func (s *OIDCService) validateIssuer(issuer string) error {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return ErrInvalidOIDCIssuer
+	}
+	if u.Scheme != "https" && (s.isProduction || u.Scheme != "http") {
+		return ErrInvalidOIDCIssuer
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+)
+
+const (
+	testOIDCClientID     = "dotsat-client"
+	testOIDCClientSecret = "dotsat-secret"
+	testOIDCAppURL       = "http://localhost:8090"
+	testOIDCKeyID        = "idp-key"
+)
+
+// testIdP is a stand-in OpenID Connect provider serving discovery, keys,
+// the authorization endpoint and the token endpoint on a local server
+type testIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// claims are put in the ID token of the next sign-in
+	claims jwt.MapClaims
+	grants map[string]testIdPGrant // code -> grant
+}
+
+// testIdPGrant is what the provider remembers between authorization and token exchange
+type testIdPGrant struct {
+	nonce         string
+	codeChallenge string
+	claims        jwt.MapClaims
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	idp := &testIdP{t: t, key: key, grants: map[string]testIdPGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("GET /keys", idp.keys)
+	mux.HandleFunc("GET /authorize", idp.authorize)
+	mux.HandleFunc("POST /token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func writeJSONResponse(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (p *testIdP) issuer() string {
+	return p.server.URL
+}
+
+func (p *testIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, http.StatusOK, map[string]any{
+		"issuer":                                p.issuer(),
+		"authorization_endpoint":                p.issuer() + "/authorize",
+		"token_endpoint":                        p.issuer() + "/token",
+		"jwks_uri":                              p.issuer() + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *testIdP) keys(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": testOIDCKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize signs the user in immediately and redirects back with a code
+func (p *testIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != testOIDCClientID ||
+		query.Get("redirect_uri") != testOIDCAppURL+oidcCallbackPath ||
+		query.Get("response_type") != "code" ||
+		query.Get("code_challenge_method") != "S256" ||
+		query.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := uuid.NewString()
+	p.grants[code] = testIdPGrant{
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		claims:        p.claims,
+	}
+
+	callback, _ := url.Parse(query.Get("redirect_uri"))
+	callback.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+// token exchanges a code for an ID token once the client and PKCE verifier check out
+func (p *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != testOIDCClientID || clientSecret != testOIDCClientSecret {
+		writeJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostFormValue("code")
+	grant, ok := p.grants[code]
+	delete(p.grants, code)
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(challenge[:]) != grant.codeChallenge {
+		writeJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   p.issuer(),
+		"sub":   uuid.NewString(),
+		"aud":   testOIDCClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": grant.nonce,
+	}
+	for name, value := range grant.claims {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testOIDCKeyID
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		p.t.Errorf("SignedString() error = %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, map[string]any{
+		"access_token": uuid.NewString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// signIn follows the authorization URL like a browser and returns the state and code
+// the provider sends back to the callback
+func (p *testIdP) signIn(authURL string) (state, code string) {
+	p.t.Helper()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		p.t.Fatalf("GET authorization URL error = %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusFound {
+		p.t.Fatalf("authorization status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		p.t.Fatalf("Parse(Location) error = %v", err)
+	}
+	return location.Query().Get("state"), location.Query().Get("code")
+}
+
+type oidcTestEnv struct {
+	idp     *testIdP
+	tenant  *model.Tenant
+	oidc    *fakeOIDCRepository
+	users   *fakeUserRepository
+	signups *fakeSignupRepository
+	service *OIDCService
+}
+
+// newOIDCTestEnv sets up an enterprise tenant "acme" signing in through the stand-in provider
+func newOIDCTestEnv(t *testing.T) *oidcTestEnv {
+	t.Helper()
+
+	idp := newTestIdP(t)
+	idp.claims = jwt.MapClaims{"email": "member@acme.test", "email_verified": true, "name": "Ada Member"}
+
+	tenants := newFakeTenantRepository()
+	tenant := &model.Tenant{ID: uuid.New(), Name: "Acme", Subdomain: "acme", Status: "active", Tier: "enterprise"}
+	if err := tenants.Create(tenant); err != nil {
+		t.Fatalf("Create(tenant) error = %v", err)
+	}
+	users := newFakeUserRepository()
+	signups := &fakeSignupRepository{tenants: tenants, users: users}
+	oidcRepo := newFakeOIDCRepository()
+
+	s := NewOIDCService(oidcRepo, tenants, users, signups, testOIDCAppURL, false)
+	_, err := s.SaveConfig(context.Background(), tenant, OIDCConfigInput{
+		Issuer:         idp.issuer(),
+		ClientID:       testOIDCClientID,
+		ClientSecret:   testOIDCClientSecret,
+		AllowedDomains: "acme.test",
+		DefaultRole:    "viewer",
+		Enabled:        true,
+	})
+	if err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+
+	return &oidcTestEnv{idp: idp, tenant: tenant, oidc: oidcRepo, users: users, signups: signups, service: s}
+}
+
+func (env *oidcTestEnv) addUser(t *testing.T, email string) *model.User {
+	t.Helper()
+
+	user := &model.User{ID: uuid.New(), TenantID: env.tenant.ID, Email: email, Role: "user"}
+	if err := env.users.Create(user); err != nil {
+		t.Fatalf("Create(user) error = %v", err)
+	}
+	return user
+}
+
+// login runs a whole sign-in from the organization prompt to the callback
+func (env *oidcTestEnv) login(t *testing.T) (*model.User, error) {
+	t.Helper()
+
+	ctx := context.Background()
+	authURL, cookieState, err := env.service.BeginLogin(ctx, "Acme")
+	if err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+	state, code := env.idp.signIn(authURL)
+	return env.service.CompleteLogin(ctx, cookieState, state, code)
+}
+
+func TestOIDCService_Login(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	existing := env.addUser(t, "member@acme.test")
+	env.idp.claims["email"] = "Member@Acme.test"
+
+	user, err := env.login(t)
+	if err != nil {
+		t.Fatalf("CompleteLogin() error = %v", err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("CompleteLogin() user = %v, want existing user %v", user.ID, existing.ID)
+	}
+	if len(env.oidc.states) != 0 {
+		t.Errorf("login states left = %d, want 0", len(env.oidc.states))
+	}
+}
+
+func TestOIDCService_Login_JITProvisioning(t *testing.T) {
+	env := newOIDCTestEnv(t)
+
+	if _, err := env.login(t); !errors.Is(err, ErrSSOUserNotFound) {
+		t.Fatalf("CompleteLogin() without JIT error = %v, want ErrSSOUserNotFound", err)
+	}
+
+	config := env.oidc.configs[env.tenant.ID]
+	config.JITProvisioning = true
+
+	user, err := env.login(t)
+	if err != nil {
+		t.Fatalf("CompleteLogin() error = %v", err)
+	}
+	if user.TenantID != env.tenant.ID || user.Email != "member@acme.test" || user.Role != "viewer" {
+		t.Errorf("provisioned user = %+v, want a viewer in the tenant", user)
+	}
+	if user.EmailVerifiedAt == nil || user.PasswordHash != nil {
+		t.Errorf("provisioned user should be verified and passwordless, got %+v", user)
+	}
+	if len(env.signups.profiles) != 1 || env.signups.profiles[0].Name != "Ada Member" {
+		t.Errorf("provisioned profiles = %+v, want one named Ada Member", env.signups.profiles)
+	}
+
+	again, err := env.login(t)
+	if err != nil {
+		t.Fatalf("second CompleteLogin() error = %v", err)
+	}
+	if again.ID != user.ID || len(env.signups.profiles) != 1 {
+		t.Errorf("second sign-in should reuse the provisioned user")
+	}
+}
+
+func TestOIDCService_Login_Rejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   error
+	}{
+		{"unverified email", jwt.MapClaims{"email": "member@acme.test", "email_verified": false}, ErrSSOEmailNotVerified},
+		{"missing email", jwt.MapClaims{"email_verified": true}, ErrSSOEmailNotVerified},
+		{"other domain", jwt.MapClaims{"email": "member@evil.test", "email_verified": true}, ErrSSODomainNotAllowed},
+		{"subdomain of allowed domain", jwt.MapClaims{"email": "member@x.acme.test", "email_verified": true}, ErrSSODomainNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newOIDCTestEnv(t)
+			env.addUser(t, "member@acme.test")
+			env.idp.claims = tt.claims
+
+			if _, err := env.login(t); !errors.Is(err, tt.want) {
+				t.Errorf("CompleteLogin() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCService_Login_InvalidState(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	env.addUser(t, "member@acme.test")
+	ctx := context.Background()
+
+	authURL, cookieState, err := env.service.BeginLogin(ctx, "acme")
+	if err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+	state, code := env.idp.signIn(authURL)
+
+	// A callback in another browser has no matching cookie
+	if _, err := env.service.CompleteLogin(ctx, "", state, code); !errors.Is(err, ErrInvalidSSOState) {
+		t.Errorf("CompleteLogin() without cookie error = %v, want ErrInvalidSSOState", err)
+	}
+
+	if _, err := env.service.CompleteLogin(ctx, cookieState, state, code); err != nil {
+		t.Fatalf("CompleteLogin() error = %v", err)
+	}
+	if _, err := env.service.CompleteLogin(ctx, cookieState, state, code); !errors.Is(err, ErrInvalidSSOState) {
+		t.Errorf("replayed CompleteLogin() error = %v, want ErrInvalidSSOState", err)
+	}
+}
+
+func TestOIDCService_Login_WrongCodeVerifier(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	env.addUser(t, "member@acme.test")
+	ctx := context.Background()
+
+	authURL, cookieState, err := env.service.BeginLogin(ctx, "acme")
+	if err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+	state, code := env.idp.signIn(authURL)
+
+	// An attacker who stole the code cannot redeem it without the verifier
+	for _, loginState := range env.oidc.states {
+		loginState.CodeVerifier = "stolen-code-without-the-verifier-000000000000"
+	}
+	if _, err := env.service.CompleteLogin(ctx, cookieState, state, code); !errors.Is(err, ErrSSOFailed) {
+		t.Errorf("CompleteLogin() error = %v, want ErrSSOFailed", err)
+	}
+}
+
+func TestOIDCService_BeginLogin_NotConfigured(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	ctx := context.Background()
+
+	if _, _, err := env.service.BeginLogin(ctx, "unknown"); !errors.Is(err, ErrSSONotConfigured) {
+		t.Errorf("BeginLogin(unknown) error = %v, want ErrSSONotConfigured", err)
+	}
+
+	env.oidc.configs[env.tenant.ID].Enabled = false
+	if _, _, err := env.service.BeginLogin(ctx, "acme"); !errors.Is(err, ErrSSONotConfigured) {
+		t.Errorf("BeginLogin() when disabled error = %v, want ErrSSONotConfigured", err)
+	}
+}
+
+func TestOIDCService_SaveConfig(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	ctx := context.Background()
+
+	valid := OIDCConfigInput{
+		Issuer:         env.idp.issuer() + "/",
+		ClientID:       testOIDCClientID,
+		AllowedDomains: " Acme.test, acme.example ,acme.test",
+		DefaultRole:    "user",
+		Enabled:        true,
+	}
+	config, err := env.service.SaveConfig(ctx, env.tenant, valid)
+	if err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+	if config.ClientSecret != testOIDCClientSecret {
+		t.Errorf("SaveConfig() with a blank secret should keep the stored one")
+	}
+	if config.Issuer != env.idp.issuer() || config.AllowedDomains != "acme.test,acme.example" {
+		t.Errorf("SaveConfig() = %+v, want normalized issuer and domains", config)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*OIDCConfigInput)
+		want   error
+	}{
+		{"invalid issuer", func(in *OIDCConfigInput) { in.Issuer = "ftp://idp.test" }, ErrInvalidOIDCIssuer},
+		{"issuer without discovery", func(in *OIDCConfigInput) { in.Issuer = env.idp.issuer() + "/missing" }, ErrInvalidOIDCIssuer},
+		{"missing client id", func(in *OIDCConfigInput) { in.ClientID = " " }, ErrOIDCClientRequired},
+		{"invalid role", func(in *OIDCConfigInput) { in.DefaultRole = "owner" }, ErrInvalidRole},
+		{"no domains", func(in *OIDCConfigInput) { in.AllowedDomains = " , " }, ErrEmailDomainsRequired},
+		{"invalid domain", func(in *OIDCConfigInput) { in.AllowedDomains = "acme.test, @evil" }, ErrInvalidEmailDomain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := valid
+			tt.modify(&input)
+			if _, err := env.service.SaveConfig(ctx, env.tenant, input); !errors.Is(err, tt.want) {
+				t.Errorf("SaveConfig() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	standard := &model.Tenant{ID: uuid.New(), Subdomain: "small", Status: "active", Tier: "standard"}
+	if _, err := env.service.SaveConfig(ctx, standard, valid); !errors.Is(err, ErrSSONotAvailable) {
+		t.Errorf("SaveConfig() on standard tier error = %v, want ErrSSONotAvailable", err)
+	}
+}
+
+func TestOIDCService_SaveConfig_RequiresHTTPSInProduction(t *testing.T) {
+	s := NewOIDCService(newFakeOIDCRepository(), newFakeTenantRepository(), newFakeUserRepository(), nil, testOIDCAppURL, true)
+	tenant := &model.Tenant{ID: uuid.New(), Status: "active", Tier: "enterprise"}
+
+	_, err := s.SaveConfig(context.Background(), tenant, OIDCConfigInput{
+		Issuer:         "http://idp.test",
+		ClientID:       testOIDCClientID,
+		ClientSecret:   testOIDCClientSecret,
+		AllowedDomains: "acme.test",
+	})
+	if !errors.Is(err, ErrInvalidOIDCIssuer) {
+		t.Errorf("SaveConfig() error = %v, want ErrInvalidOIDCIssuer", err)
+	}
+}
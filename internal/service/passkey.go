@@ -0,0 +1,485 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrPasskeyNotFound = errors.New("passkey not found")
+	ErrPasskeyExists   = errors.New("this passkey is already registered")
+	// ErrInvalidCeremony means the options expired or were already used; the browser has to start over
+	ErrInvalidCeremony = errors.New("passkey request is invalid or expired")
+	// ErrPasskeyVerification covers every way an authenticator response can fail verification
+	ErrPasskeyVerification = errors.New("passkey could not be verified")
+)
+
+const (
+	// WebAuthnCeremonyCookie links the browser to the challenge it was given
+	WebAuthnCeremonyCookie = "webauthn_ceremony"
+
+	webAuthnCeremonyTTL  = 5 * time.Minute
+	maxPasskeyNameLength = 64
+	defaultPasskeyName   = "Passkey"
+)
+
+// PasskeyService registers WebAuthn credentials and verifies assertions, both for
+// passwordless sign-in with a discoverable passkey and as a second factor
+type PasskeyService struct {
+	webAuthn           *webauthn.WebAuthn
+	webAuthnRepository repository.WebAuthnRepository
+	userRepository     repository.UserRepository
+	isProduction       bool
+}
+
+// NewPasskeyService uses the host of appURL as the relying party ID and its origin as the only allowed origin
+func NewPasskeyService(
+	webAuthnRepository repository.WebAuthnRepository,
+	userRepository repository.UserRepository,
+	appName string,
+	appURL string,
+	isProduction bool,
+) (*PasskeyService, error) {
+	u, err := url.Parse(appURL)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid app URL %q for WebAuthn", appURL)
+	}
+
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: appName,
+		RPOrigins:     []string{u.Scheme + "://" + u.Host},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure WebAuthn: %w", err)
+	}
+
+	return &PasskeyService{
+		webAuthn:           wa,
+		webAuthnRepository: webAuthnRepository,
+		userRepository:     userRepository,
+		isProduction:       isProduction,
+	}, nil
+}
+
+// Passkeys lists the user's registered credentials
+func (s *PasskeyService) Passkeys(userID uuid.UUID) ([]*model.WebAuthnCredential, error) {
+	credentials, err := s.webAuthnRepository.CredentialsByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+	return credentials, nil
+}
+
+// HasPasskeys reports whether the user can use a passkey
+func (s *PasskeyService) HasPasskeys(userID uuid.UUID) (bool, error) {
+	credentials, err := s.Passkeys(userID)
+	return len(credentials) > 0, err
+}
+
+// BeginRegistration returns the options for navigator.credentials.create and the ceremony token
+func (s *PasskeyService) BeginRegistration(user *model.User) (*protocol.CredentialCreation, string, error) {
+	waUser, err := s.loadWebAuthnUser(user)
+	if err != nil {
+		return nil, "", err
+	}
+
+	requireResidentKey := true
+	creation, session, err := s.webAuthn.BeginRegistration(waUser,
+		// Passkeys must be discoverable so they can be used without typing an email first
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: &requireResidentKey,
+			UserVerification:   protocol.VerificationPreferred,
+		}),
+		webauthn.WithExclusions(webauthn.Credentials(waUser.WebAuthnCredentials()).CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin passkey registration: %w", err)
+	}
+
+	token, err := s.saveCeremony(model.WebAuthnRegistration, &user.ID, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return creation, token, nil
+}
+
+// FinishRegistration verifies the authenticator's attestation and stores the new passkey
+func (s *PasskeyService) FinishRegistration(user *model.User, token, name string, response io.Reader) (*model.WebAuthnCredential, error) {
+	session, err := s.consumeCeremony(token, model.WebAuthnRegistration, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(response)
+	if err != nil {
+		slog.Warn("invalid passkey registration response", "error", err, "user_id", user.ID)
+		return nil, ErrPasskeyVerification
+	}
+
+	waUser, err := s.loadWebAuthnUser(user)
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.webAuthn.CreateCredential(waUser, *session, parsed)
+	if err != nil {
+		slog.Warn("passkey registration failed verification", "error", err, "user_id", user.ID)
+		return nil, ErrPasskeyVerification
+	}
+
+	credential := &model.WebAuthnCredential{
+		UserID:          user.ID,
+		CredentialID:    created.ID,
+		PublicKey:       created.PublicKey,
+		AttestationType: created.AttestationType,
+		Transports:      joinTransports(created.Transport),
+		AAGUID:          created.Authenticator.AAGUID,
+		SignCount:       created.Authenticator.SignCount,
+		BackupEligible:  created.Flags.BackupEligible,
+		BackupState:     created.Flags.BackupState,
+		Name:            passkeyName(name),
+	}
+	err = s.webAuthnRepository.CreateCredential(credential)
+	if errors.Is(err, repository.ErrDuplicateWebAuthnCredential) {
+		return nil, ErrPasskeyExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store passkey: %w", err)
+	}
+
+	slog.Info("passkey registered", "user_id", user.ID, "passkey_id", credential.ID)
+	return credential, nil
+}
+
+// BeginLogin returns the options for a passwordless sign-in where the browser offers
+// any passkey it holds for this site
+func (s *PasskeyService) BeginLogin() (*protocol.CredentialAssertion, string, error) {
+	// The passkey replaces both the password and the second factor, so the
+	// authenticator has to verify the user (PIN or biometric), not just their presence
+	assertion, session, err := s.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin passkey login: %w", err)
+	}
+
+	token, err := s.saveCeremony(model.WebAuthnLogin, nil, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, token, nil
+}
+
+// FinishLogin verifies a discoverable passkey assertion and returns the user it belongs to
+func (s *PasskeyService) FinishLogin(token string, response io.Reader) (*model.User, error) {
+	session, err := s.consumeCeremony(token, model.WebAuthnLogin, uuid.Nil)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(response)
+	if err != nil {
+		slog.Warn("invalid passkey login response", "error", err)
+		return nil, ErrPasskeyVerification
+	}
+
+	var waUser *webAuthnUser
+	_, credential, err := s.webAuthn.ValidatePasskeyLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		user, err := s.userRepository.ByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		waUser, err = s.loadWebAuthnUser(user)
+		return waUser, err
+	}, *session, parsed)
+	if err != nil {
+		slog.Warn("passkey login failed verification", "error", err)
+		return nil, ErrPasskeyVerification
+	}
+
+	err = s.recordUse(waUser, credential)
+	if err != nil {
+		return nil, err
+	}
+	return waUser.user, nil
+}
+
+// BeginSecondFactor returns assertion options limited to the user's own passkeys
+func (s *PasskeyService) BeginSecondFactor(userID uuid.UUID) (*protocol.CredentialAssertion, string, error) {
+	user, err := s.userRepository.ByID(userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get user: %w", err)
+	}
+	waUser, err := s.loadWebAuthnUser(user)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(waUser.credentials) == 0 {
+		return nil, "", ErrPasskeyNotFound
+	}
+
+	assertion, session, err := s.webAuthn.BeginLogin(waUser, webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin passkey assertion: %w", err)
+	}
+
+	token, err := s.saveCeremony(model.WebAuthnSecondFactor, &userID, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, token, nil
+}
+
+// VerifySecondFactor verifies an assertion from one of the user's passkeys
+func (s *PasskeyService) VerifySecondFactor(userID uuid.UUID, token string, response io.Reader) error {
+	session, err := s.consumeCeremony(token, model.WebAuthnSecondFactor, userID)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(response)
+	if err != nil {
+		slog.Warn("invalid passkey assertion", "error", err, "user_id", userID)
+		return ErrPasskeyVerification
+	}
+
+	user, err := s.userRepository.ByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	waUser, err := s.loadWebAuthnUser(user)
+	if err != nil {
+		return err
+	}
+
+	credential, err := s.webAuthn.ValidateLogin(waUser, *session, parsed)
+	if err != nil {
+		slog.Warn("passkey assertion failed verification", "error", err, "user_id", userID)
+		return ErrPasskeyVerification
+	}
+
+	return s.recordUse(waUser, credential)
+}
+
+// Delete removes one of the user's passkeys
+func (s *PasskeyService) Delete(userID, id uuid.UUID) error {
+	err := s.webAuthnRepository.DeleteCredential(userID, id)
+	if errors.Is(err, repository.ErrWebAuthnCredentialNotFound) {
+		return ErrPasskeyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+
+	slog.Info("passkey deleted", "user_id", userID, "passkey_id", id)
+	return nil
+}
+
+// SetCeremonyCookie stores the ceremony token until the authenticator responds
+func (s *PasskeyService) SetCeremonyCookie(w http.ResponseWriter, token string) {
+	s.setCeremonyCookie(w, token, time.Now().Add(webAuthnCeremonyTTL))
+}
+
+// ClearCeremonyCookie removes the ceremony token once it has been used
+func (s *PasskeyService) ClearCeremonyCookie(w http.ResponseWriter) {
+	s.setCeremonyCookie(w, "", time.Unix(0, 0))
+}
+
+func (s *PasskeyService) setCeremonyCookie(w http.ResponseWriter, value string, expiry time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     WebAuthnCeremonyCookie,
+		Value:    value,
+		Expires:  expiry,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   s.isProduction,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// recordUse rejects cloned authenticators and stores the new signature counter
+func (s *PasskeyService) recordUse(waUser *webAuthnUser, validated *webauthn.Credential) error {
+	stored := waUser.credential(validated.ID)
+	if stored == nil {
+		return ErrPasskeyVerification
+	}
+
+	// A counter that didn't increase means a copy of the private key is in use elsewhere
+	if validated.Authenticator.CloneWarning {
+		slog.Warn("passkey signature counter went backwards, possible clone", "user_id", stored.UserID, "passkey_id", stored.ID)
+		return ErrPasskeyVerification
+	}
+
+	now := time.Now()
+	stored.SignCount = validated.Authenticator.SignCount
+	stored.BackupState = validated.Flags.BackupState
+	stored.LastUsedAt = &now
+	err := s.webAuthnRepository.UpdateCredentialUse(stored)
+	if err != nil {
+		return fmt.Errorf("failed to update passkey: %w", err)
+	}
+	return nil
+}
+
+// saveCeremony stores the WebAuthn session data and returns the token that refers to it
+func (s *PasskeyService) saveCeremony(purpose string, userID *uuid.UUID, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode webauthn session: %w", err)
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate ceremony token: %w", err)
+	}
+
+	err = s.webAuthnRepository.CreateCeremony(&model.WebAuthnCeremony{
+		TokenHash:   hashToken(token),
+		UserID:      userID,
+		Purpose:     purpose,
+		SessionData: data,
+		ExpiresAt:   time.Now().Add(webAuthnCeremonyTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store webauthn ceremony: %w", err)
+	}
+	return token, nil
+}
+
+// consumeCeremony returns the session data for a ceremony started for the same purpose and user
+// (uuid.Nil for passkey sign-in). The ceremony can't be used again either way.
+func (s *PasskeyService) consumeCeremony(token, purpose string, userID uuid.UUID) (*webauthn.SessionData, error) {
+	if token == "" {
+		return nil, ErrInvalidCeremony
+	}
+
+	ceremony, err := s.webAuthnRepository.ConsumeCeremony(hashToken(token))
+	if errors.Is(err, repository.ErrWebAuthnCeremonyNotFound) {
+		return nil, ErrInvalidCeremony
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume webauthn ceremony: %w", err)
+	}
+
+	var ceremonyUserID uuid.UUID
+	if ceremony.UserID != nil {
+		ceremonyUserID = *ceremony.UserID
+	}
+	if ceremony.Purpose != purpose || ceremonyUserID != userID {
+		return nil, ErrInvalidCeremony
+	}
+
+	var session webauthn.SessionData
+	err = json.Unmarshal(ceremony.SessionData, &session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode webauthn session: %w", err)
+	}
+	return &session, nil
+}
+
+func (s *PasskeyService) loadWebAuthnUser(user *model.User) (*webAuthnUser, error) {
+	credentials, err := s.Passkeys(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+// webAuthnUser adapts a user and their stored credentials to webauthn.User.
+// The user handle is the user ID, which lets discoverable sign-in find the account.
+type webAuthnUser struct {
+	user        *model.User
+	credentials []*model.WebAuthnCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return u.user.ID[:]
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.credentials))
+	for i, c := range u.credentials {
+		credentials[i] = webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       splitTransports(c.Transports),
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		}
+	}
+	return credentials
+}
+
+// credential finds the stored credential with the given WebAuthn credential ID
+func (u *webAuthnUser) credential(credentialID []byte) *model.WebAuthnCredential {
+	for _, c := range u.credentials {
+		if bytes.Equal(c.CredentialID, credentialID) {
+			return c
+		}
+	}
+	return nil
+}
+
+func joinTransports(transports []protocol.AuthenticatorTransport) string {
+	values := make([]string, len(transports))
+	for i, t := range transports {
+		values[i] = string(t)
+	}
+	return strings.Join(values, ",")
+}
+
+func splitTransports(transports string) []protocol.AuthenticatorTransport {
+	if transports == "" {
+		return nil
+	}
+	values := strings.Split(transports, ",")
+	result := make([]protocol.AuthenticatorTransport, len(values))
+	for i, v := range values {
+		result[i] = protocol.AuthenticatorTransport(v)
+	}
+	return result
+}
+
+// passkeyName trims the user's label for a passkey, falling back to a default
+func passkeyName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultPasskeyName
+	}
+	if runes := []rune(name); len(runes) > maxPasskeyNameLength {
+		name = string(runes[:maxPasskeyNameLength])
+	}
+	return name
+}
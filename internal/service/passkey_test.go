@@ -0,0 +1,491 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+)
+
+const (
+	testRPOrigin = "http://localhost:8080"
+	testRPID     = "localhost"
+)
+
+// softAuthenticator is a software passkey: an ES256 key pair that answers WebAuthn
+// options the way a browser and platform authenticator would
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	// origin is put in clientDataJSON; a phishing site would send its own
+	origin string
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatalf("rand.Read() error = %v", err)
+	}
+	return &softAuthenticator{t: t, key: key, credentialID: credentialID, origin: testRPOrigin}
+}
+
+// webAuthnOptions is the part of the JSON options the authenticator needs
+type webAuthnOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RPID      string `json:"rpId"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+// decodeOptions round-trips options through JSON like the browser receives them
+func (a *softAuthenticator) decodeOptions(options any) webAuthnOptions {
+	a.t.Helper()
+
+	data, err := json.Marshal(options)
+	if err != nil {
+		a.t.Fatalf("Marshal(options) error = %v", err)
+	}
+	var decoded webAuthnOptions
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		a.t.Fatalf("Unmarshal(options) error = %v", err)
+	}
+	return decoded
+}
+
+// register answers navigator.credentials.create with a "none" attestation
+func (a *softAuthenticator) register(options any) io.Reader {
+	a.t.Helper()
+
+	opts := a.decodeOptions(options)
+	userHandle, err := base64.RawURLEncoding.DecodeString(opts.PublicKey.User.ID)
+	if err != nil {
+		a.t.Fatalf("decode user handle: %v", err)
+	}
+	a.userHandle = userHandle
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatalf("Marshal(public key) error = %v", err)
+	}
+
+	// Attested credential data: AAGUID, credential ID length and ID, COSE public key
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	// User present, user verified, attested credential data included
+	authData := a.authenticatorData(opts.PublicKey.RP.ID, 0x45, attested)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		a.t.Fatalf("Marshal(attestation) error = %v", err)
+	}
+
+	return a.credentialJSON(map[string]any{
+		"clientDataJSON":    encodeBase64URL(a.clientData("webauthn.create", opts.PublicKey.Challenge)),
+		"attestationObject": encodeBase64URL(attestation),
+		"transports":        []string{"internal"},
+	})
+}
+
+// assert answers navigator.credentials.get with a signature from the key
+func (a *softAuthenticator) assert(options any) io.Reader {
+	a.t.Helper()
+
+	opts := a.decodeOptions(options)
+	a.signCount++
+	// User present, user verified
+	authData := a.authenticatorData(opts.PublicKey.RPID, 0x05, nil)
+	clientData := a.clientData("webauthn.get", opts.PublicKey.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("SignASN1() error = %v", err)
+	}
+
+	return a.credentialJSON(map[string]any{
+		"clientDataJSON":    encodeBase64URL(clientData),
+		"authenticatorData": encodeBase64URL(authData),
+		"signature":         encodeBase64URL(signature),
+		"userHandle":        encodeBase64URL(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) authenticatorData(rpID string, flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) clientData(ceremony, challenge string) []byte {
+	data, err := json.Marshal(map[string]any{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    a.origin,
+	})
+	if err != nil {
+		a.t.Fatalf("Marshal(client data) error = %v", err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) credentialJSON(response map[string]any) io.Reader {
+	data, err := json.Marshal(map[string]any{
+		"id":       encodeBase64URL(a.credentialID),
+		"rawId":    encodeBase64URL(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatalf("Marshal(credential) error = %v", err)
+	}
+	return bytes.NewReader(data)
+}
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+type passkeyTestEnv struct {
+	users     *fakeUserRepository
+	webAuthn  *fakeWebAuthnRepository
+	twoFactor *fakeTwoFactorRepository
+	service   *PasskeyService
+	twoFA     *TwoFactorService
+}
+
+func newPasskeyTestEnv(t *testing.T) *passkeyTestEnv {
+	t.Helper()
+
+	env := &passkeyTestEnv{
+		users:     newFakeUserRepository(),
+		webAuthn:  newFakeWebAuthnRepository(),
+		twoFactor: newFakeTwoFactorRepository(),
+	}
+	service, err := NewPasskeyService(env.webAuthn, env.users, "dotsat.work", testRPOrigin, false)
+	if err != nil {
+		t.Fatalf("NewPasskeyService() error = %v", err)
+	}
+	env.service = service
+	events := NewSecurityEventService(&fakeSecurityEventRepository{}, &fakeThrottleRepository{}, 24*time.Hour)
+	env.twoFA = NewTwoFactorService(env.twoFactor, env.users, &fakeThrottleRepository{}, service, events, "dotsat.work", false)
+	return env
+}
+
+func (env *passkeyTestEnv) addUser(t *testing.T, email string) *model.User {
+	t.Helper()
+
+	user := &model.User{ID: uuid.New(), TenantID: uuid.New(), Email: email, Role: "user"}
+	if err := env.users.Create(user); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return user
+}
+
+// registerPasskey runs a full registration ceremony for the user
+func (env *passkeyTestEnv) registerPasskey(t *testing.T, user *model.User, authenticator *softAuthenticator) *model.WebAuthnCredential {
+	t.Helper()
+
+	options, token, err := env.service.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("BeginRegistration() error = %v", err)
+	}
+	credential, err := env.service.FinishRegistration(user, token, " Laptop ", authenticator.register(options))
+	if err != nil {
+		t.Fatalf("FinishRegistration() error = %v", err)
+	}
+	return credential
+}
+
+func TestPasskeyService_Registration(t *testing.T) {
+	env := newPasskeyTestEnv(t)
+	user := env.addUser(t, "alice@example.com")
+	authenticator := newSoftAuthenticator(t)
+
+	credential := env.registerPasskey(t, user, authenticator)
+
+	if credential.Name != "Laptop" {
+		t.Errorf("expected trimmed name Laptop, got %q", credential.Name)
+	}
+	if !bytes.Equal(credential.CredentialID, authenticator.credentialID) {
+		t.Error("expected the authenticator's credential ID to be stored")
+	}
+	if credential.Transports != "internal" {
+		t.Errorf("expected transports internal, got %q", credential.Transports)
+	}
+
+	hasPasskeys, err := env.service.HasPasskeys(user.ID)
+	if err != nil || !hasPasskeys {
+		t.Errorf("expected user to have a passkey, got %v, %v", hasPasskeys, err)
+	}
+
+	// Registering the same authenticator again is rejected
+	options, token, err := env.service.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("BeginRegistration() error = %v", err)
+	}
+	_, err = env.service.FinishRegistration(user, token, "", authenticator.register(options))
+	if !errors.Is(err, ErrPasskeyExists) {
+		t.Errorf("expected ErrPasskeyExists, got %v", err)
+	}
+}
+
+func TestPasskeyService_Registration_Rejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(env *passkeyTestEnv, user *model.User, a *softAuthenticator, token string) (string, *model.User)
+		wantErr error
+	}{
+		{
+			name: "wrong origin",
+			tamper: func(env *passkeyTestEnv, user *model.User, a *softAuthenticator, token string) (string, *model.User) {
+				a.origin = "https://evil.example.com"
+				return token, user
+			},
+			wantErr: ErrPasskeyVerification,
+		},
+		{
+			name: "missing ceremony",
+			tamper: func(env *passkeyTestEnv, user *model.User, a *softAuthenticator, token string) (string, *model.User) {
+				return "", user
+			},
+			wantErr: ErrInvalidCeremony,
+		},
+		{
+			name: "ceremony of another user",
+			tamper: func(env *passkeyTestEnv, user *model.User, a *softAuthenticator, token string) (string, *model.User) {
+				return token, env.addUser(t, "mallory@example.com")
+			},
+			wantErr: ErrInvalidCeremony,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newPasskeyTestEnv(t)
+			user := env.addUser(t, "alice@example.com")
+			authenticator := newSoftAuthenticator(t)
+
+			options, token, err := env.service.BeginRegistration(user)
+			if err != nil {
+				t.Fatalf("BeginRegistration() error = %v", err)
+			}
+			token, finishUser := tt.tamper(env, user, authenticator, token)
+
+			_, err = env.service.FinishRegistration(finishUser, token, "", authenticator.register(options))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPasskeyService_Login(t *testing.T) {
+	env := newPasskeyTestEnv(t)
+	user := env.addUser(t, "alice@example.com")
+	authenticator := newSoftAuthenticator(t)
+	credential := env.registerPasskey(t, user, authenticator)
+
+	options, token, err := env.service.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+	response := authenticator.assert(options)
+
+	got, err := env.service.FinishLogin(token, response)
+	if err != nil {
+		t.Fatalf("FinishLogin() error = %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("expected user %s, got %s", user.ID, got.ID)
+	}
+
+	stored := env.webAuthn.credentials[credential.ID]
+	if stored.SignCount != 1 || stored.LastUsedAt == nil {
+		t.Errorf("expected sign count 1 and last used time, got %d, %v", stored.SignCount, stored.LastUsedAt)
+	}
+
+	// The ceremony is single use
+	_, err = env.service.FinishLogin(token, authenticator.assert(options))
+	if !errors.Is(err, ErrInvalidCeremony) {
+		t.Errorf("expected ErrInvalidCeremony for a reused ceremony, got %v", err)
+	}
+}
+
+func TestPasskeyService_Login_ClonedAuthenticator(t *testing.T) {
+	env := newPasskeyTestEnv(t)
+	user := env.addUser(t, "alice@example.com")
+	authenticator := newSoftAuthenticator(t)
+	env.registerPasskey(t, user, authenticator)
+
+	for i := 0; i < 2; i++ {
+		options, token, err := env.service.BeginLogin()
+		if err != nil {
+			t.Fatalf("BeginLogin() error = %v", err)
+		}
+		if _, err := env.service.FinishLogin(token, authenticator.assert(options)); err != nil {
+			t.Fatalf("FinishLogin() error = %v", err)
+		}
+	}
+
+	// A copy of the key still at the old counter
+	authenticator.signCount = 0
+	options, token, err := env.service.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+	_, err = env.service.FinishLogin(token, authenticator.assert(options))
+	if !errors.Is(err, ErrPasskeyVerification) {
+		t.Errorf("expected ErrPasskeyVerification for a counter that went backwards, got %v", err)
+	}
+}
+
+func TestPasskeyService_Login_UnknownPasskey(t *testing.T) {
+	env := newPasskeyTestEnv(t)
+	user := env.addUser(t, "alice@example.com")
+	env.registerPasskey(t, user, newSoftAuthenticator(t))
+
+	// A key the server has never seen, claiming to belong to alice
+	stranger := newSoftAuthenticator(t)
+	stranger.userHandle = user.ID[:]
+
+	options, token, err := env.service.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+	_, err = env.service.FinishLogin(token, stranger.assert(options))
+	if !errors.Is(err, ErrPasskeyVerification) {
+		t.Errorf("expected ErrPasskeyVerification, got %v", err)
+	}
+}
+
+func TestPasskeyService_SecondFactor(t *testing.T) {
+	env := newPasskeyTestEnv(t)
+	alice := env.addUser(t, "alice@example.com")
+	bob := env.addUser(t, "bob@example.com")
+	aliceKey := newSoftAuthenticator(t)
+	bobKey := newSoftAuthenticator(t)
+	env.registerPasskey(t, alice, aliceKey)
+	env.registerPasskey(t, bob, bobKey)
+
+	options, token, err := env.service.BeginSecondFactor(alice.ID)
+	if err != nil {
+		t.Fatalf("BeginSecondFactor() error = %v", err)
+	}
+
+	// Bob's passkey can't complete Alice's second factor
+	err = env.service.VerifySecondFactor(alice.ID, token, bobKey.assert(options))
+	if !errors.Is(err, ErrPasskeyVerification) {
+		t.Errorf("expected ErrPasskeyVerification for another user's passkey, got %v", err)
+	}
+
+	options, token, err = env.service.BeginSecondFactor(alice.ID)
+	if err != nil {
+		t.Fatalf("BeginSecondFactor() error = %v", err)
+	}
+	if err := env.service.VerifySecondFactor(alice.ID, token, aliceKey.assert(options)); err != nil {
+		t.Errorf("VerifySecondFactor() error = %v", err)
+	}
+
+	_, _, err = env.service.BeginSecondFactor(env.addUser(t, "carol@example.com").ID)
+	if !errors.Is(err, ErrPasskeyNotFound) {
+		t.Errorf("expected ErrPasskeyNotFound for a user without passkeys, got %v", err)
+	}
+}
+
+func TestTwoFactorService_PasskeyChallenge(t *testing.T) {
+	env := newPasskeyTestEnv(t)
+	user := env.addUser(t, "alice@example.com")
+	authenticator := newSoftAuthenticator(t)
+	env.registerPasskey(t, user, authenticator)
+
+	challenge, err := env.twoFA.BeginChallenge(user.ID)
+	if err != nil {
+		t.Fatalf("BeginChallenge() error = %v", err)
+	}
+	if !env.twoFA.ChallengeOffersPasskey(challenge) {
+		t.Error("expected the challenge to offer the user's passkey")
+	}
+
+	options, ceremony, err := env.twoFA.BeginPasskeyChallenge(challenge)
+	if err != nil {
+		t.Fatalf("BeginPasskeyChallenge() error = %v", err)
+	}
+	got, err := env.twoFA.CompletePasskeyChallenge(challenge, ceremony, authenticator.assert(options), testClient)
+	if err != nil {
+		t.Fatalf("CompletePasskeyChallenge() error = %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("expected user %s, got %s", user.ID, got.ID)
+	}
+
+	_, _, err = env.twoFA.BeginPasskeyChallenge(challenge)
+	if !errors.Is(err, ErrInvalidChallenge) {
+		t.Errorf("expected completed challenge to be rejected, got %v", err)
+	}
+}
+
+func TestPasskeyService_Delete(t *testing.T) {
+	env := newPasskeyTestEnv(t)
+	alice := env.addUser(t, "alice@example.com")
+	bob := env.addUser(t, "bob@example.com")
+	credential := env.registerPasskey(t, alice, newSoftAuthenticator(t))
+
+	err := env.service.Delete(bob.ID, credential.ID)
+	if !errors.Is(err, ErrPasskeyNotFound) {
+		t.Errorf("expected ErrPasskeyNotFound when deleting another user's passkey, got %v", err)
+	}
+
+	if err := env.service.Delete(alice.ID, credential.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	hasPasskeys, _ := env.service.HasPasskeys(alice.ID)
+	if hasPasskeys {
+		t.Error("expected passkey to be deleted")
+	}
+}
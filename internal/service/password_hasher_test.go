@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher_HashAndVerify(t *testing.T) {
+	hasher := testPasswordHasher()
+
+	hash, err := hasher.Hash("correct-horse-battery-staple")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("expected an argon2id PHC string, got %q", hash)
+	}
+
+	other, err := hasher.Hash("correct-horse-battery-staple")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if other == hash {
+		t.Error("expected hashes of the same password to use different salts")
+	}
+
+	needsRehash, err := hasher.Verify("correct-horse-battery-staple", hash)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if needsRehash {
+		t.Error("expected a hash with current parameters not to need a rehash")
+	}
+
+	if _, err := hasher.Verify("wrong-horse-battery-staple", hash); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("Verify() with wrong password error = %v, want ErrPasswordMismatch", err)
+	}
+}
+
+func TestPasswordHasher_Verify_NeedsRehash(t *testing.T) {
+	hasher := testPasswordHasher()
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("correct-horse-battery-staple"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword() error = %v", err)
+	}
+	outdated, err := NewPasswordHasher(Argon2Params{Memory: 32, Iterations: 1, Parallelism: 1}).Hash("correct-horse-battery-staple")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "legacy bcrypt", hash: string(bcryptHash)},
+		{name: "outdated argon2id parameters", hash: outdated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needsRehash, err := hasher.Verify("correct-horse-battery-staple", tt.hash)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if !needsRehash {
+				t.Error("expected the hash to need a rehash")
+			}
+
+			if _, err := hasher.Verify("wrong-horse-battery-staple", tt.hash); !errors.Is(err, ErrPasswordMismatch) {
+				t.Errorf("Verify() with wrong password error = %v, want ErrPasswordMismatch", err)
+			}
+		})
+	}
+}
+
+func TestPasswordHasher_Verify_Malformed(t *testing.T) {
+	hasher := testPasswordHasher()
+
+	tests := []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$not base64!$a2V5a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ",
+	}
+
+	for _, hash := range tests {
+		if _, err := hasher.Verify("correct-horse-battery-staple", hash); !errors.Is(err, ErrUnsupportedHashFormat) {
+			t.Errorf("Verify(%q) error = %v, want ErrUnsupportedHashFormat", hash, err)
+		}
+	}
+}
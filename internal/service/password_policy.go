@@ -0,0 +1,263 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"dotsat.work/internal/validation"
+)
+
+var ErrInvalidPasswordPolicy = errors.New("invalid password policy")
+
+// PasswordPolicyService decides which passwords users may choose. The global policy applies to
+// everyone; a tenant's own policy can only make it stricter.
+type PasswordPolicyService struct {
+	global            validation.PasswordPolicy
+	policyRepository  repository.PasswordPolicyRepository
+	historyRepository repository.PasswordHistoryRepository
+	tenantRepository  repository.TenantRepository
+	profileRepository repository.ProfileRepository
+	passwordHasher    *PasswordHasher
+	breachedPasswords validation.BreachedPasswordChecker
+}
+
+func NewPasswordPolicyService(
+	global validation.PasswordPolicy,
+	policyRepository repository.PasswordPolicyRepository,
+	historyRepository repository.PasswordHistoryRepository,
+	tenantRepository repository.TenantRepository,
+	profileRepository repository.ProfileRepository,
+	passwordHasher *PasswordHasher,
+	breachedPasswords validation.BreachedPasswordChecker,
+) *PasswordPolicyService {
+	return &PasswordPolicyService{
+		global:            global,
+		policyRepository:  policyRepository,
+		historyRepository: historyRepository,
+		tenantRepository:  tenantRepository,
+		profileRepository: profileRepository,
+		passwordHasher:    passwordHasher,
+		breachedPasswords: breachedPasswords,
+	}
+}
+
+// Global returns the policy that applies to every tenant
+func (s *PasswordPolicyService) Global() validation.PasswordPolicy {
+	return s.global
+}
+
+// Policy returns the policy for the tenant's users, or the global policy for uuid.Nil
+func (s *PasswordPolicyService) Policy(tenantID uuid.UUID) (validation.PasswordPolicy, error) {
+	if tenantID == uuid.Nil {
+		return s.global, nil
+	}
+
+	tenantPolicy, err := s.policyRepository.ByTenantID(tenantID)
+	if errors.Is(err, repository.ErrPasswordPolicyNotFound) {
+		return s.global, nil
+	}
+	if err != nil {
+		return s.global, fmt.Errorf("failed to get password policy: %w", err)
+	}
+
+	return s.global.Merge(validation.PasswordPolicy{
+		MinLength:   tenantPolicy.MinLength,
+		MaxLength:   tenantPolicy.MaxLength,
+		MinScore:    tenantPolicy.MinScore,
+		HistorySize: tenantPolicy.HistorySize,
+	}), nil
+}
+
+// TenantPolicy returns the tenant's own policy, or an empty one if none was saved yet
+func (s *PasswordPolicyService) TenantPolicy(tenantID uuid.UUID) (*model.TenantPasswordPolicy, error) {
+	policy, err := s.policyRepository.ByTenantID(tenantID)
+	if errors.Is(err, repository.ErrPasswordPolicyNotFound) {
+		return &model.TenantPasswordPolicy{TenantID: tenantID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get password policy: %w", err)
+	}
+	return policy, nil
+}
+
+// UpdateTenantPolicy validates and saves the tenant's own policy. Rules weaker than the global
+// policy are accepted but have no effect. A maximum length of 0 keeps the global one.
+func (s *PasswordPolicyService) UpdateTenantPolicy(policy *model.TenantPasswordPolicy) error {
+	if policy.MinLength < 0 || policy.MinLength > s.global.MaxLength ||
+		policy.MaxLength < 0 || policy.MaxLength > validation.MaxPasswordLength ||
+		(policy.MaxLength > 0 && policy.MaxLength < max(policy.MinLength, s.global.MinLength)) ||
+		policy.MinScore < 0 || policy.MinScore > 4 ||
+		policy.HistorySize < 0 || policy.HistorySize > validation.MaxPasswordHistory {
+		return ErrInvalidPasswordPolicy
+	}
+
+	err := s.policyRepository.Upsert(policy)
+	if err != nil {
+		return fmt.Errorf("failed to save password policy: %w", err)
+	}
+
+	slog.Info("password policy updated", "tenant_id", policy.TenantID,
+		"min_length", policy.MinLength, "max_length", policy.MaxLength, "min_score", policy.MinScore, "history_size", policy.HistorySize)
+	return nil
+}
+
+// Check scores a password for a new account for the strength meter. Neither Check nor
+// CheckChange look up breaches or the password history, which are only checked when the
+// password is set.
+func (s *PasswordPolicyService) Check(password string, context validation.PasswordContext) validation.PasswordCheck {
+	return s.global.Check(password, context)
+}
+
+// CheckChange scores a new password for an existing user for the strength meter
+func (s *PasswordPolicyService) CheckChange(user *model.User, password string) (validation.PasswordCheck, error) {
+	policy, err := s.Policy(user.TenantID)
+	if err != nil {
+		return validation.PasswordCheck{}, err
+	}
+
+	context, err := s.UserContext(user)
+	if err != nil {
+		return validation.PasswordCheck{}, err
+	}
+
+	return policy.Check(password, context), nil
+}
+
+// Validate checks a password for a new account, or one that isn't known yet
+func (s *PasswordPolicyService) Validate(tenantID uuid.UUID, password string, context validation.PasswordContext) error {
+	policy, err := s.Policy(tenantID)
+	if err != nil {
+		return err
+	}
+
+	context, err = s.withTenant(tenantID, context)
+	if err != nil {
+		return err
+	}
+
+	return policy.Validate(password, context, s.breachedPasswords)
+}
+
+// UserContext returns what is known about the user to keep out of their password
+func (s *PasswordPolicyService) UserContext(user *model.User) (validation.PasswordContext, error) {
+	context := validation.PasswordContext{Email: user.Email}
+
+	profile, err := s.profileRepository.ByUserID(user.ID)
+	if err == nil {
+		context.Name = profile.Name
+	} else if !errors.Is(err, repository.ErrProfileNotFound) {
+		return context, fmt.Errorf("failed to get profile: %w", err)
+	}
+
+	return s.withTenant(user.TenantID, context)
+}
+
+// ValidateChange checks a new password for an existing user, including whether they have used
+// it recently
+func (s *PasswordPolicyService) ValidateChange(user *model.User, password string) error {
+	policy, err := s.Policy(user.TenantID)
+	if err != nil {
+		return err
+	}
+
+	context, err := s.UserContext(user)
+	if err != nil {
+		return err
+	}
+
+	err = policy.Validate(password, context, s.breachedPasswords)
+	if err != nil {
+		return err
+	}
+
+	reused, err := s.isReused(user, password, policy.HistorySize)
+	if err != nil {
+		return err
+	}
+	if reused {
+		return &validation.PasswordError{Reasons: []validation.PasswordReason{validation.PasswordReusedReason}}
+	}
+
+	return nil
+}
+
+// Remember adds the user's current password to their history before it is replaced, as far
+// back as the policy looks
+func (s *PasswordPolicyService) Remember(user *model.User) error {
+	if !user.HasPassword() {
+		return nil
+	}
+
+	policy, err := s.Policy(user.TenantID)
+	if err != nil {
+		return err
+	}
+
+	// The new password takes the place of the current one in the history
+	keep := policy.HistorySize - 1
+	if keep <= 0 {
+		return nil
+	}
+
+	err = s.historyRepository.Add(&model.PasswordHistoryEntry{
+		UserID:       user.ID,
+		PasswordHash: *user.PasswordHash,
+	}, keep)
+	if err != nil {
+		return fmt.Errorf("failed to save password history: %w", err)
+	}
+	return nil
+}
+
+// isReused reports whether the password is the user's current one or one of their
+// historySize-1 previous ones
+func (s *PasswordPolicyService) isReused(user *model.User, password string, historySize int) (bool, error) {
+	if historySize <= 0 {
+		return false, nil
+	}
+
+	var hashes []string
+	if user.HasPassword() {
+		hashes = append(hashes, *user.PasswordHash)
+	}
+	if historySize > 1 {
+		entries, err := s.historyRepository.Recent(user.ID, historySize-1)
+		if err != nil {
+			return false, fmt.Errorf("failed to get password history: %w", err)
+		}
+		for _, entry := range entries {
+			hashes = append(hashes, entry.PasswordHash)
+		}
+	}
+
+	for _, hash := range hashes {
+		_, err := s.passwordHasher.Verify(password, hash)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, ErrPasswordMismatch) {
+			slog.Warn("failed to compare password history", "error", err, "user_id", user.ID)
+		}
+	}
+	return false, nil
+}
+
+// withTenant adds the tenant's name and subdomain to the context
+func (s *PasswordPolicyService) withTenant(tenantID uuid.UUID, context validation.PasswordContext) (validation.PasswordContext, error) {
+	if tenantID == uuid.Nil {
+		return context, nil
+	}
+
+	tenant, err := s.tenantRepository.ByID(tenantID)
+	if err != nil {
+		return context, fmt.Errorf("failed to get tenant: %w", err)
+	}
+	context.OrganizationName = tenant.Name
+	context.Subdomain = tenant.Subdomain
+	return context, nil
+}
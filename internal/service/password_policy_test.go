@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/validation"
+)
+
+func TestPasswordPolicyService_Policy(t *testing.T) {
+	env := newAuthTestEnv(t)
+	tenantID := uuid.New()
+
+	policy, err := env.policy.Policy(tenantID)
+	if err != nil {
+		t.Fatalf("Policy() error = %v", err)
+	}
+	if policy != validation.DefaultPasswordPolicy {
+		t.Errorf("Policy() without tenant policy = %+v, want the global policy", policy)
+	}
+
+	// Only the stricter rules of the tenant's policy apply
+	err = env.policy.UpdateTenantPolicy(&model.TenantPasswordPolicy{TenantID: tenantID, MinLength: 16, MinScore: 1, HistorySize: 5})
+	if err != nil {
+		t.Fatalf("UpdateTenantPolicy() error = %v", err)
+	}
+	policy, err = env.policy.Policy(tenantID)
+	if err != nil {
+		t.Fatalf("Policy() error = %v", err)
+	}
+	want := validation.PasswordPolicy{MinLength: 16, MaxLength: validation.MaxPasswordLength, MinScore: 3, HistorySize: 5}
+	if policy != want {
+		t.Errorf("Policy() = %+v, want %+v", policy, want)
+	}
+
+	err = env.policy.UpdateTenantPolicy(&model.TenantPasswordPolicy{TenantID: tenantID, MinLength: 16, MaxLength: 64})
+	if err != nil {
+		t.Fatalf("UpdateTenantPolicy() error = %v", err)
+	}
+	policy, err = env.policy.Policy(tenantID)
+	if err != nil {
+		t.Fatalf("Policy() error = %v", err)
+	}
+	if policy.MaxLength != 64 {
+		t.Errorf("Policy() MaxLength = %d, want the tenant's 64", policy.MaxLength)
+	}
+
+	invalid := []*model.TenantPasswordPolicy{
+		{TenantID: tenantID, MinScore: 5},
+		{TenantID: tenantID, MaxLength: validation.MaxPasswordLength + 1},
+		{TenantID: tenantID, MinLength: 20, MaxLength: 16},
+		{TenantID: tenantID, MaxLength: validation.MinPasswordLength - 1},
+	}
+	for _, policy := range invalid {
+		err = env.policy.UpdateTenantPolicy(policy)
+		if !errors.Is(err, ErrInvalidPasswordPolicy) {
+			t.Errorf("UpdateTenantPolicy(%+v) error = %v, want ErrInvalidPasswordPolicy", policy, err)
+		}
+	}
+}
+
+func TestPasswordPolicyService_Validate_Tenant(t *testing.T) {
+	env := newAuthTestEnv(t)
+	tenant := &model.Tenant{ID: uuid.New(), Name: "Tangerine Labs", Subdomain: "tangerine", Status: "active", Tier: "standard"}
+	if err := env.tenants.Create(tenant); err != nil {
+		t.Fatalf("failed to create tenant: %v", err)
+	}
+
+	err := env.policy.Validate(tenant.ID, "tangerine-orbit-lantern-42", validation.PasswordContext{})
+	var passwordErr *validation.PasswordError
+	if !errors.As(err, &passwordErr) || !passwordErr.HasReason(validation.PasswordPersonalInfo) {
+		t.Errorf("Validate() with the tenant's subdomain error = %v, want personal info", err)
+	}
+
+	err = env.policy.Validate(tenant.ID, "copper-orbit-lantern-42", validation.PasswordContext{})
+	if err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+}
+
+func TestPasswordPolicyService_ValidateChange_History(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "history@example.com", "first-password-is-long", true)
+	if err := env.profiles.Create(&model.Profile{UserID: user.ID, Name: "Morgan Quill"}); err != nil {
+		t.Fatalf("failed to create profile: %v", err)
+	}
+
+	err := env.policy.UpdateTenantPolicy(&model.TenantPasswordPolicy{TenantID: user.TenantID, HistorySize: 2})
+	if err != nil {
+		t.Fatalf("UpdateTenantPolicy() error = %v", err)
+	}
+
+	// The profile name is checked as well
+	err = env.policy.ValidateChange(user, "morgan-orbit-lantern-42")
+	var passwordErr *validation.PasswordError
+	if !errors.As(err, &passwordErr) || !passwordErr.HasReason(validation.PasswordPersonalInfo) {
+		t.Errorf("ValidateChange() with the user's name error = %v, want personal info", err)
+	}
+
+	// The current password counts towards the history
+	err = env.policy.ValidateChange(user, "first-password-is-long")
+	if !errors.As(err, &passwordErr) || !passwordErr.HasReason(validation.PasswordReused) {
+		t.Errorf("ValidateChange() with the current password error = %v, want reused", err)
+	}
+
+	changePassword := func(password string) {
+		t.Helper()
+		if err := env.policy.Remember(user); err != nil {
+			t.Fatalf("Remember() error = %v", err)
+		}
+		hash, err := env.service.HashPassword(password)
+		if err != nil {
+			t.Fatalf("failed to hash password: %v", err)
+		}
+		user.PasswordHash = &hash
+	}
+
+	changePassword("second-password-is-long")
+	err = env.policy.ValidateChange(user, "first-password-is-long")
+	if !errors.As(err, &passwordErr) || !passwordErr.HasReason(validation.PasswordReused) {
+		t.Errorf("ValidateChange() with the previous password error = %v, want reused", err)
+	}
+
+	// Passwords older than the history size can be used again
+	changePassword("third-password-is-long")
+	err = env.policy.ValidateChange(user, "first-password-is-long")
+	if err != nil {
+		t.Errorf("ValidateChange() with an old password error = %v, want nil", err)
+	}
+}
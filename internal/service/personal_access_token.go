@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidAccessToken          = errors.New("access token is invalid, expired or revoked")
+	ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+	ErrInvalidTokenName            = errors.New("token name is required and must be at most 64 characters")
+	ErrInvalidTokenLifetime        = errors.New("token lifetime is not one of the allowed options")
+)
+
+const (
+	// PersonalAccessTokenPrefix marks personal access tokens so they are recognisable in
+	// Authorization headers and by secret scanners
+	PersonalAccessTokenPrefix = "dsat_pat_"
+
+	maxTokenNameLength = 64
+
+	// Last use of a token is written at most once per interval
+	personalAccessTokenTouchInterval = time.Minute
+)
+
+// PersonalAccessTokenLifetimes are the expiry options offered when creating a token, in days
+var PersonalAccessTokenLifetimes = []int{7, 30, 90, 365}
+
+// PersonalAccessTokenService manages the bearer tokens users create for scripts and integrations
+type PersonalAccessTokenService struct {
+	tokenRepository repository.PersonalAccessTokenRepository
+}
+
+func NewPersonalAccessTokenService(tokenRepository repository.PersonalAccessTokenRepository) *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{
+		tokenRepository: tokenRepository,
+	}
+}
+
+// Create issues a token that expires after lifetimeDays. The returned secret is shown to the
+// user once; only its hash is stored.
+func (s *PersonalAccessTokenService) Create(userID uuid.UUID, name string, lifetimeDays int) (string, *model.PersonalAccessToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxTokenNameLength {
+		return "", nil, ErrInvalidTokenName
+	}
+	if !slices.Contains(PersonalAccessTokenLifetimes, lifetimeDays) {
+		return "", nil, ErrInvalidTokenLifetime
+	}
+
+	value, err := randomToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	secret := PersonalAccessTokenPrefix + value
+
+	token := &model.PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashToken(secret),
+		ExpiresAt: time.Now().AddDate(0, 0, lifetimeDays),
+	}
+	err = s.tokenRepository.Create(token)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create personal access token: %w", err)
+	}
+
+	slog.Info("personal access token created", "user_id", userID, "token_id", token.ID)
+	return secret, token, nil
+}
+
+// Authenticate resolves a bearer token to an active personal access token and records its use
+func (s *PersonalAccessTokenService) Authenticate(secret string) (*model.PersonalAccessToken, error) {
+	if !strings.HasPrefix(secret, PersonalAccessTokenPrefix) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	token, err := s.tokenRepository.ByHash(hashToken(secret))
+	if err != nil {
+		if errors.Is(err, repository.ErrPersonalAccessTokenNotFound) {
+			return nil, ErrInvalidAccessToken
+		}
+		return nil, fmt.Errorf("failed to get personal access token: %w", err)
+	}
+	if !token.IsActive() {
+		return nil, ErrInvalidAccessToken
+	}
+
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= personalAccessTokenTouchInterval {
+		err = s.tokenRepository.Touch(token.ID, now)
+		if err != nil {
+			slog.Warn("failed to record personal access token use", "error", err, "token_id", token.ID)
+		} else {
+			token.LastUsedAt = &now
+		}
+	}
+
+	return token, nil
+}
+
+// Tokens lists the user's active tokens
+func (s *PersonalAccessTokenService) Tokens(userID uuid.UUID) ([]*model.PersonalAccessToken, error) {
+	tokens, err := s.tokenRepository.ActiveByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list personal access tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// Revoke revokes one of the user's tokens; API clients using it are rejected from the next request
+func (s *PersonalAccessTokenService) Revoke(userID, id uuid.UUID) error {
+	err := s.tokenRepository.Revoke(userID, id)
+	if errors.Is(err, repository.ErrPersonalAccessTokenNotFound) {
+		return ErrPersonalAccessTokenNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke personal access token: %w", err)
+	}
+
+	slog.Info("personal access token revoked", "user_id", userID, "token_id", id)
+	return nil
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPersonalAccessTokenService_CreateAndAuthenticate(t *testing.T) {
+	repo := newFakePersonalAccessTokenRepository()
+	service := NewPersonalAccessTokenService(repo)
+	userID := uuid.New()
+
+	secret, token, err := service.Create(userID, "  Deploy script ", 30)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !strings.HasPrefix(secret, PersonalAccessTokenPrefix) {
+		t.Errorf("expected secret to start with %q, got %q", PersonalAccessTokenPrefix, secret)
+	}
+	if token.Name != "Deploy script" {
+		t.Errorf("expected trimmed name, got %q", token.Name)
+	}
+	if token.TokenHash == secret || strings.Contains(token.TokenHash, secret) {
+		t.Error("expected only a hash of the secret to be stored")
+	}
+	if until := time.Until(token.ExpiresAt); until < 29*24*time.Hour || until > 30*24*time.Hour {
+		t.Errorf("expected token to expire in 30 days, got %v", until)
+	}
+
+	authenticated, err := service.Authenticate(secret)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if authenticated.ID != token.ID || authenticated.UserID != userID {
+		t.Errorf("expected token %s of user %s, got %+v", token.ID, userID, authenticated)
+	}
+	if repo.tokens[token.ID].LastUsedAt == nil {
+		t.Error("expected last use to be recorded")
+	}
+}
+
+func TestPersonalAccessTokenService_Create_Invalid(t *testing.T) {
+	service := NewPersonalAccessTokenService(newFakePersonalAccessTokenRepository())
+
+	if _, _, err := service.Create(uuid.New(), "   ", 30); !errors.Is(err, ErrInvalidTokenName) {
+		t.Errorf("Create() with blank name error = %v, want ErrInvalidTokenName", err)
+	}
+	if _, _, err := service.Create(uuid.New(), strings.Repeat("x", maxTokenNameLength+1), 30); !errors.Is(err, ErrInvalidTokenName) {
+		t.Errorf("Create() with long name error = %v, want ErrInvalidTokenName", err)
+	}
+	if _, _, err := service.Create(uuid.New(), "CI", 10000); !errors.Is(err, ErrInvalidTokenLifetime) {
+		t.Errorf("Create() with unsupported lifetime error = %v, want ErrInvalidTokenLifetime", err)
+	}
+}
+
+func TestPersonalAccessTokenService_Authenticate_Rejected(t *testing.T) {
+	repo := newFakePersonalAccessTokenRepository()
+	service := NewPersonalAccessTokenService(repo)
+	userID := uuid.New()
+
+	revokedSecret, revoked, err := service.Create(userID, "Revoked", 7)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := service.Revoke(userID, revoked.ID); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+
+	expiredSecret, expired, err := service.Create(userID, "Expired", 7)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	repo.tokens[expired.ID].ExpiresAt = time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{name: "revoked", secret: revokedSecret},
+		{name: "expired", secret: expiredSecret},
+		{name: "unknown", secret: PersonalAccessTokenPrefix + strings.Repeat("0", 64)},
+		{name: "missing prefix", secret: strings.TrimPrefix(revokedSecret, PersonalAccessTokenPrefix)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.Authenticate(tt.secret); !errors.Is(err, ErrInvalidAccessToken) {
+				t.Errorf("Authenticate() error = %v, want ErrInvalidAccessToken", err)
+			}
+		})
+	}
+}
+
+func TestPersonalAccessTokenService_Revoke_OtherUser(t *testing.T) {
+	service := NewPersonalAccessTokenService(newFakePersonalAccessTokenRepository())
+	owner := uuid.New()
+
+	secret, token, err := service.Create(owner, "CI", 90)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if err := service.Revoke(uuid.New(), token.ID); !errors.Is(err, ErrPersonalAccessTokenNotFound) {
+		t.Errorf("Revoke() by another user error = %v, want ErrPersonalAccessTokenNotFound", err)
+	}
+	if _, err := service.Authenticate(secret); err != nil {
+		t.Errorf("expected token to stay usable, got %v", err)
+	}
+
+	tokens, err := service.Tokens(owner)
+	if err != nil {
+		t.Fatalf("Tokens() error = %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].ID != token.ID {
+		t.Errorf("expected the owner's token to be listed, got %+v", tokens)
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"strings"
 
 	"github.com/google/uuid"
@@ -10,6 +11,10 @@ import (
 	"dotsat.work/internal/validation"
 )
 
+const MaxBioLength = 500
+
+var ErrBioTooLong = errors.New("bio is too long (max 500 characters)")
+
 type ProfileService struct {
 	profileRepo repository.ProfileRepository
 }
@@ -38,3 +43,35 @@ func (s *ProfileService) UpdateName(userID uuid.UUID, name string) error {
 
 	return s.profileRepo.UpdateName(userID, name)
 }
+
+// UpdateDetails sets the optional bio and phone; empty values clear them
+func (s *ProfileService) UpdateDetails(userID uuid.UUID, bio, phone string) error {
+	bio = strings.TrimSpace(bio)
+	phone = strings.TrimSpace(phone)
+
+	if len(bio) > MaxBioLength {
+		return ErrBioTooLong
+	}
+
+	if phone != "" {
+		err := validation.ValidatePhone(phone)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.profileRepo.UpdateDetails(userID, optionalString(bio), optionalString(phone))
+}
+
+// CompleteOnboarding marks the user's onboarding as finished
+func (s *ProfileService) CompleteOnboarding(userID uuid.UUID) error {
+	return s.profileRepo.MarkOnboarded(userID)
+}
+
+// optionalString returns nil for empty strings so they are stored as NULL
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
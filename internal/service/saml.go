@@ -0,0 +1,480 @@
+package service
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"github.com/crewjam/saml"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidIdPMetadata    = errors.New("invalid identity provider metadata: upload the SAML 2.0 metadata XML of your identity provider")
+	ErrIdPMetadataRequired   = errors.New("identity provider metadata is required")
+	ErrInvalidRoleMapping    = errors.New("invalid role mapping: enter one \"value = role\" per line, where role is admin, user or viewer")
+	ErrRoleAttributeRequired = errors.New("a role attribute is required to map roles")
+)
+
+const (
+	// SAMLStateCookie binds the assertion posted by the IdP to the browser that started the sign-in
+	SAMLStateCookie = "saml_state"
+
+	samlPathPrefix = "/auth/sso/saml/"
+	samlStateTTL   = 10 * time.Minute
+)
+
+// samlEmailAttributes and samlNameAttributes are the attribute names common IdPs use, matched case-insensitively
+var (
+	samlEmailAttributes = []string{
+		"email",
+		"mail",
+		"emailaddress",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+	}
+	samlNameAttributes = []string{
+		"name",
+		"displayname",
+		"http://schemas.microsoft.com/identity/claims/displayname",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+	}
+)
+
+var whitespacePattern = regexp.MustCompile(`\s+`)
+
+// SAMLConfigInput is a tenant admin's SAML settings. An empty IdPMetadata keeps the stored metadata.
+type SAMLConfigInput struct {
+	IdPMetadata     string
+	RoleAttribute   string
+	RoleMapping     string
+	AllowedDomains  string
+	JITProvisioning bool
+	DefaultRole     string
+	Enabled         bool
+}
+
+// SAMLService makes each tenant a SAML 2.0 service provider signing users in through the
+// tenant's identity provider. Only SP-initiated sign-ins are accepted: every assertion must
+// answer an AuthnRequest this browser started, which rules out replayed and injected assertions.
+type SAMLService struct {
+	samlRepository   repository.SAMLRepository
+	tenantRepository repository.TenantRepository
+	members          ssoMembers
+	appURL           string
+	isProduction     bool
+}
+
+func NewSAMLService(
+	samlRepository repository.SAMLRepository,
+	tenantRepository repository.TenantRepository,
+	userRepository repository.UserRepository,
+	signupRepository repository.SignupRepository,
+	appURL string,
+	isProduction bool,
+) *SAMLService {
+	return &SAMLService{
+		samlRepository:   samlRepository,
+		tenantRepository: tenantRepository,
+		members:          ssoMembers{userRepository: userRepository, signupRepository: signupRepository},
+		appURL:           strings.TrimRight(appURL, "/"),
+		isProduction:     isProduction,
+	}
+}
+
+// Config returns the tenant's SAML settings
+func (s *SAMLService) Config(tenantID uuid.UUID) (*model.SAMLConfig, error) {
+	config, err := s.samlRepository.ConfigByTenantID(tenantID)
+	if errors.Is(err, repository.ErrSAMLConfigNotFound) {
+		return nil, ErrSSONotConfigured
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saml config: %w", err)
+	}
+	return config, nil
+}
+
+// EntityID is the tenant's SP entity ID, which is also where its metadata is served
+func (s *SAMLService) EntityID(subdomain string) string {
+	return s.appURL + samlPathPrefix + subdomain + "/metadata"
+}
+
+// ACSURL is the tenant's assertion consumer service URL the IdP posts assertions to
+func (s *SAMLService) ACSURL(subdomain string) string {
+	return s.appURL + samlPathPrefix + subdomain + "/acs"
+}
+
+// Metadata returns the SP metadata XML of the tenant with the given subdomain,
+// for its admins to register with their IdP
+func (s *SAMLService) Metadata(subdomain string) ([]byte, error) {
+	tenant, err := s.tenantRepository.BySubdomain(strings.ToLower(strings.TrimSpace(subdomain)))
+	if errors.Is(err, repository.ErrTenantNotFound) {
+		return nil, ErrSSONotConfigured
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+	if !tenant.IsActive() || !tenant.IsEnterprise() {
+		return nil, ErrSSONotConfigured
+	}
+
+	metadata := s.serviceProvider(tenant, nil).Metadata()
+	// Assertions are only accepted through the HTTP-POST binding
+	for i := range metadata.SPSSODescriptors {
+		descriptor := &metadata.SPSSODescriptors[i]
+		var services []saml.IndexedEndpoint
+		for _, service := range descriptor.AssertionConsumerServices {
+			if service.Binding == saml.HTTPPostBinding {
+				services = append(services, service)
+			}
+		}
+		descriptor.AssertionConsumerServices = services
+	}
+
+	data, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode saml metadata: %w", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// SaveConfig validates and stores the tenant's SAML settings
+func (s *SAMLService) SaveConfig(tenant *model.Tenant, input SAMLConfigInput) (*model.SAMLConfig, error) {
+	if !tenant.IsEnterprise() {
+		return nil, ErrSSONotAvailable
+	}
+
+	existing, err := s.Config(tenant.ID)
+	if err != nil && !errors.Is(err, ErrSSONotConfigured) {
+		return nil, err
+	}
+
+	config := &model.SAMLConfig{
+		TenantID:      tenant.ID,
+		IdPMetadata:   strings.TrimSpace(input.IdPMetadata),
+		RoleAttribute: strings.TrimSpace(input.RoleAttribute),
+	}
+	if config.IdPMetadata == "" && existing != nil {
+		config.IdPMetadata = existing.IdPMetadata
+	}
+	if config.IdPMetadata == "" {
+		return nil, ErrIdPMetadataRequired
+	}
+
+	idp, err := parseIdPMetadata([]byte(config.IdPMetadata))
+	if err != nil {
+		slog.Warn("invalid saml idp metadata", "error", err, "tenant_id", tenant.ID)
+		return nil, ErrInvalidIdPMetadata
+	}
+	config.IdPEntityID = idp.EntityID
+
+	config.RoleMapping, err = normalizeRoleMapping(input.RoleMapping)
+	if err != nil {
+		return nil, err
+	}
+	if config.RoleMapping != "" && config.RoleAttribute == "" {
+		return nil, ErrRoleAttributeRequired
+	}
+	config.SSOAccess, err = newSSOAccess(input.AllowedDomains, input.JITProvisioning, input.DefaultRole, input.Enabled)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled && tenant.SSOEnforced {
+		return nil, ErrSSOEnforced
+	}
+
+	err = s.samlRepository.UpsertConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save saml config: %w", err)
+	}
+
+	slog.Info("saml config saved", "tenant_id", tenant.ID, "idp_entity_id", config.IdPEntityID)
+	return config, nil
+}
+
+// BeginLogin returns the IdP URL carrying an AuthnRequest for the tenant with the given subdomain,
+// and the state to keep in SAMLStateCookie until the IdP posts the assertion back
+func (s *SAMLService) BeginLogin(subdomain string) (redirectURL, state string, err error) {
+	tenant, err := s.tenantRepository.BySubdomain(strings.ToLower(strings.TrimSpace(subdomain)))
+	if errors.Is(err, repository.ErrTenantNotFound) {
+		return "", "", ErrSSONotConfigured
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get tenant: %w", err)
+	}
+	sp, _, err := s.enabledServiceProvider(tenant)
+	if err != nil {
+		return "", "", err
+	}
+
+	request, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create authn request: %w", err)
+	}
+
+	state, err = randomToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	err = s.samlRepository.CreateLoginState(&model.SAMLLoginState{
+		StateHash: hashToken(state),
+		TenantID:  tenant.ID,
+		RequestID: request.ID,
+		ExpiresAt: time.Now().Add(samlStateTTL),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to store saml login state: %w", err)
+	}
+
+	// The state is hex, so it needs no escaping as the RelayState
+	redirect, err := request.Redirect(state, sp)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode authn request: %w", err)
+	}
+	return redirect.String(), state, nil
+}
+
+// CompleteLogin validates the signed SAMLResponse posted to the ACS URL of the tenant with the given
+// subdomain and returns the tenant user it asserts, creating the user if the tenant allows just-in-time
+// provisioning. cookieState is the value of SAMLStateCookie and relayState the value the IdP posted back.
+func (s *SAMLService) CompleteLogin(subdomain, cookieState, relayState, samlResponse string) (*model.User, error) {
+	if relayState == "" || subtle.ConstantTimeCompare([]byte(cookieState), []byte(relayState)) != 1 {
+		return nil, ErrInvalidSSOState
+	}
+
+	loginState, err := s.samlRepository.ConsumeLoginState(hashToken(relayState))
+	if errors.Is(err, repository.ErrSAMLLoginStateNotFound) {
+		return nil, ErrInvalidSSOState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume saml login state: %w", err)
+	}
+
+	tenant, err := s.tenantRepository.ByID(loginState.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+	if tenant.Subdomain != strings.ToLower(subdomain) {
+		return nil, ErrInvalidSSOState
+	}
+	sp, config, err := s.enabledServiceProvider(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		slog.Warn("saml response is not base64", "tenant_id", tenant.ID)
+		return nil, ErrSSOFailed
+	}
+	// Verifies the signature against the IdP certificate, the destination, audience,
+	// validity window and that the assertion answers this sign-in's AuthnRequest
+	assertion, err := sp.ParseXMLResponse(raw, []string{loginState.RequestID})
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		slog.Warn("saml response rejected", "error", err, "tenant_id", tenant.ID)
+		return nil, ErrSSOFailed
+	}
+
+	identity := ssoIdentity{
+		Email: samlAttribute(assertion, samlEmailAttributes...),
+		// The IdP is authoritative for the tenant's allowed domains
+		EmailVerified: true,
+		Name:          samlAttribute(assertion, samlNameAttributes...),
+	}
+	if identity.Email == "" && assertion.Subject != nil && assertion.Subject.NameID != nil &&
+		assertion.Subject.NameID.Format == string(saml.EmailAddressNameIDFormat) {
+		identity.Email = assertion.Subject.NameID.Value
+	}
+	if config.RoleAttribute != "" {
+		identity.Role = config.MappedRole(samlAttributeValues(assertion, config.RoleAttribute))
+	}
+
+	return s.members.user(tenant.ID, &config.SSOAccess, identity)
+}
+
+// SetStateCookie stores the state until the IdP posts the assertion back. The post is a
+// cross-site request, so in production the cookie must be SameSite=None to come along.
+func (s *SAMLService) SetStateCookie(w http.ResponseWriter, state string) {
+	s.setStateCookie(w, state, time.Now().Add(samlStateTTL))
+}
+
+// ClearStateCookie removes the state once the assertion has been handled
+func (s *SAMLService) ClearStateCookie(w http.ResponseWriter) {
+	s.setStateCookie(w, "", time.Unix(0, 0))
+}
+
+func (s *SAMLService) setStateCookie(w http.ResponseWriter, value string, expiry time.Time) {
+	sameSite := http.SameSiteLaxMode
+	if s.isProduction {
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SAMLStateCookie,
+		Value:    value,
+		Expires:  expiry,
+		Path:     samlPathPrefix,
+		HttpOnly: true,
+		Secure:   s.isProduction,
+		SameSite: sameSite,
+	})
+}
+
+// enabledServiceProvider returns the service provider of an active enterprise tenant with enabled SAML
+func (s *SAMLService) enabledServiceProvider(tenant *model.Tenant) (*saml.ServiceProvider, *model.SAMLConfig, error) {
+	if !tenant.IsActive() || !tenant.IsEnterprise() {
+		return nil, nil, ErrSSONotConfigured
+	}
+
+	config, err := s.Config(tenant.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !config.Enabled {
+		return nil, nil, ErrSSONotConfigured
+	}
+
+	idp, err := parseIdPMetadata([]byte(config.IdPMetadata))
+	if err != nil {
+		slog.Error("stored saml idp metadata is invalid", "error", err, "tenant_id", tenant.ID)
+		return nil, nil, ErrSSOFailed
+	}
+	return s.serviceProvider(tenant, idp), config, nil
+}
+
+func (s *SAMLService) serviceProvider(tenant *model.Tenant, idp *saml.EntityDescriptor) *saml.ServiceProvider {
+	metadataURL, _ := url.Parse(s.EntityID(tenant.Subdomain))
+	acsURL, _ := url.Parse(s.ACSURL(tenant.Subdomain))
+	return &saml.ServiceProvider{
+		EntityID:          metadataURL.String(),
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idp,
+		AuthnNameIDFormat: saml.EmailAddressNameIDFormat,
+	}
+}
+
+// parseIdPMetadata reads an IdP's EntityDescriptor, or the first IdP of an EntitiesDescriptor,
+// and checks it has a redirect sign-in endpoint and a signing certificate
+func parseIdPMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	idp := &saml.EntityDescriptor{}
+	err := xml.Unmarshal(data, idp)
+	if err != nil || len(idp.IDPSSODescriptors) == 0 {
+		var entities saml.EntitiesDescriptor
+		if xml.Unmarshal(data, &entities) != nil {
+			return nil, fmt.Errorf("no EntityDescriptor or EntitiesDescriptor: %w", err)
+		}
+		idp = firstIdP(&entities)
+		if idp == nil {
+			return nil, errors.New("no IDPSSODescriptor")
+		}
+	}
+	if idp.EntityID == "" {
+		return nil, errors.New("no entityID")
+	}
+
+	var hasRedirect, hasCertificate bool
+	for _, descriptor := range idp.IDPSSODescriptors {
+		for _, service := range descriptor.SingleSignOnServices {
+			if service.Binding == saml.HTTPRedirectBinding && service.Location != "" {
+				hasRedirect = true
+			}
+		}
+		for _, key := range descriptor.KeyDescriptors {
+			if key.Use != "" && key.Use != "signing" {
+				continue
+			}
+			for _, certificate := range key.KeyInfo.X509Data.X509Certificates {
+				der, err := base64.StdEncoding.DecodeString(whitespacePattern.ReplaceAllString(certificate.Data, ""))
+				if err != nil {
+					return nil, fmt.Errorf("invalid signing certificate: %w", err)
+				}
+				if _, err := x509.ParseCertificate(der); err != nil {
+					return nil, fmt.Errorf("invalid signing certificate: %w", err)
+				}
+				hasCertificate = true
+			}
+		}
+	}
+	if !hasRedirect {
+		return nil, errors.New("no HTTP-Redirect SingleSignOnService")
+	}
+	if !hasCertificate {
+		return nil, errors.New("no signing certificate")
+	}
+	return idp, nil
+}
+
+func firstIdP(entities *saml.EntitiesDescriptor) *saml.EntityDescriptor {
+	for i := range entities.EntityDescriptors {
+		if len(entities.EntityDescriptors[i].IDPSSODescriptors) > 0 {
+			return &entities.EntityDescriptors[i]
+		}
+	}
+	for i := range entities.EntitiesDescriptors {
+		if idp := firstIdP(&entities.EntitiesDescriptors[i]); idp != nil {
+			return idp
+		}
+	}
+	return nil
+}
+
+// normalizeRoleMapping validates "value = role" lines and returns them trimmed, one per line
+func normalizeRoleMapping(mapping string) (string, error) {
+	var lines []string
+	for _, line := range strings.Split(mapping, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		value, role, ok := strings.Cut(line, "=")
+		value, role = strings.TrimSpace(value), strings.ToLower(strings.TrimSpace(role))
+		if !ok || value == "" || !isValidRole(role) {
+			return "", ErrInvalidRoleMapping
+		}
+		lines = append(lines, value+" = "+role)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// samlAttribute returns the first value of the first of the named attributes the assertion carries
+func samlAttribute(assertion *saml.Assertion, names ...string) string {
+	for _, name := range names {
+		if values := samlAttributeValues(assertion, name); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// samlAttributeValues returns the values of the attribute with the given name or friendly name
+func samlAttributeValues(assertion *saml.Assertion, name string) []string {
+	var values []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if !strings.EqualFold(attribute.Name, name) && !strings.EqualFold(attribute.FriendlyName, name) {
+				continue
+			}
+			for _, value := range attribute.Values {
+				if value.Value != "" {
+					values = append(values, value.Value)
+				}
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,440 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+)
+
+// testSAMLIdP is a stand-in SAML identity provider answering AuthnRequests with signed responses
+type testSAMLIdP struct {
+	t   *testing.T
+	idp *saml.IdentityProvider
+	sp  *saml.EntityDescriptor
+	// session is asserted on the next sign-in
+	session *saml.Session
+}
+
+func newTestSAMLIdP(t *testing.T) *testSAMLIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.acme.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+
+	p := &testSAMLIdP{t: t}
+	p.idp = &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             certificate,
+		MetadataURL:             url.URL{Scheme: "https", Host: "idp.acme.test", Path: "/metadata"},
+		SSOURL:                  url.URL{Scheme: "https", Host: "idp.acme.test", Path: "/sso"},
+		ServiceProviderProvider: p,
+	}
+	p.session = &saml.Session{
+		ID:           uuid.NewString(),
+		NameID:       "member@acme.test",
+		NameIDFormat: string(saml.EmailAddressNameIDFormat),
+	}
+	return p
+}
+
+// GetServiceProvider implements saml.ServiceProviderProvider with the SP metadata registered by the test
+func (p *testSAMLIdP) GetServiceProvider(_ *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	if p.sp == nil || p.sp.EntityID != serviceProviderID {
+		return nil, os.ErrNotExist
+	}
+	return p.sp, nil
+}
+
+func (p *testSAMLIdP) metadata() string {
+	p.t.Helper()
+
+	data, err := xml.Marshal(p.idp.Metadata())
+	if err != nil {
+		p.t.Fatalf("Marshal(metadata) error = %v", err)
+	}
+	return string(data)
+}
+
+// attributes sets the attributes asserted on the next sign-in
+func (p *testSAMLIdP) attributes(attributes map[string][]string) {
+	p.session.CustomAttributes = nil
+	for name, values := range attributes {
+		attribute := saml.Attribute{Name: name, NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"}
+		for _, value := range values {
+			attribute.Values = append(attribute.Values, saml.AttributeValue{Type: "xs:string", Value: value})
+		}
+		p.session.CustomAttributes = append(p.session.CustomAttributes, attribute)
+	}
+}
+
+// signIn follows the redirect carrying the AuthnRequest and returns the form the IdP posts to the ACS
+func (p *testSAMLIdP) signIn(redirectURL string) saml.IdpAuthnRequestForm {
+	p.t.Helper()
+
+	req, err := saml.NewIdpAuthnRequest(p.idp, httptest.NewRequest(http.MethodGet, redirectURL, nil))
+	if err != nil {
+		p.t.Fatalf("NewIdpAuthnRequest() error = %v", err)
+	}
+	if err := req.Validate(); err != nil {
+		p.t.Fatalf("Validate() error = %v", err)
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, p.session); err != nil {
+		p.t.Fatalf("MakeAssertion() error = %v", err)
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		p.t.Fatalf("PostBinding() error = %v", err)
+	}
+	return form
+}
+
+type samlTestEnv struct {
+	idp     *testSAMLIdP
+	tenant  *model.Tenant
+	saml    *fakeSAMLRepository
+	users   *fakeUserRepository
+	signups *fakeSignupRepository
+	service *SAMLService
+}
+
+// newSAMLTestEnv sets up an enterprise tenant "acme" signing in through the stand-in IdP,
+// mapping its "groups" attribute onto roles
+func newSAMLTestEnv(t *testing.T) *samlTestEnv {
+	t.Helper()
+
+	idp := newTestSAMLIdP(t)
+
+	tenants := newFakeTenantRepository()
+	tenant := &model.Tenant{ID: uuid.New(), Name: "Acme", Subdomain: "acme", Status: "active", Tier: "enterprise"}
+	if err := tenants.Create(tenant); err != nil {
+		t.Fatalf("Create(tenant) error = %v", err)
+	}
+	users := newFakeUserRepository()
+	signups := &fakeSignupRepository{tenants: tenants, users: users}
+	samlRepo := newFakeSAMLRepository()
+
+	s := NewSAMLService(samlRepo, tenants, users, signups, testOIDCAppURL, false)
+	_, err := s.SaveConfig(tenant, SAMLConfigInput{
+		IdPMetadata:    idp.metadata(),
+		RoleAttribute:  "groups",
+		RoleMapping:    "Admins = admin\nStaff = user",
+		AllowedDomains: "acme.test",
+		DefaultRole:    "viewer",
+		Enabled:        true,
+	})
+	if err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+
+	metadata, err := s.Metadata("acme")
+	if err != nil {
+		t.Fatalf("Metadata() error = %v", err)
+	}
+	idp.sp = &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(metadata, idp.sp); err != nil {
+		t.Fatalf("Unmarshal(sp metadata) error = %v", err)
+	}
+
+	return &samlTestEnv{idp: idp, tenant: tenant, saml: samlRepo, users: users, signups: signups, service: s}
+}
+
+func (env *samlTestEnv) addUser(t *testing.T, email, role string) *model.User {
+	t.Helper()
+
+	user := &model.User{ID: uuid.New(), TenantID: env.tenant.ID, Email: email, Role: role}
+	if err := env.users.Create(user); err != nil {
+		t.Fatalf("Create(user) error = %v", err)
+	}
+	return user
+}
+
+// begin starts a sign-in and returns the state cookie and the form the IdP posts back
+func (env *samlTestEnv) begin(t *testing.T) (string, saml.IdpAuthnRequestForm) {
+	t.Helper()
+
+	redirectURL, cookieState, err := env.service.BeginLogin("Acme")
+	if err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+	return cookieState, env.idp.signIn(redirectURL)
+}
+
+// login runs a whole sign-in from the organization prompt to the ACS
+func (env *samlTestEnv) login(t *testing.T) (*model.User, error) {
+	t.Helper()
+
+	cookieState, form := env.begin(t)
+	return env.service.CompleteLogin("acme", cookieState, form.RelayState, form.SAMLResponse)
+}
+
+func TestSAMLService_Login(t *testing.T) {
+	env := newSAMLTestEnv(t)
+	existing := env.addUser(t, "member@acme.test", "user")
+	env.idp.attributes(map[string][]string{"groups": {"Staff", "Everyone", "Admins"}})
+
+	user, err := env.login(t)
+	if err != nil {
+		t.Fatalf("CompleteLogin() error = %v", err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("CompleteLogin() user = %v, want existing user %v", user.ID, existing.ID)
+	}
+	if user.Role != "admin" || env.users.users[existing.ID].Role != "admin" {
+		t.Errorf("role = %q, want the mapped role admin stored", user.Role)
+	}
+	if len(env.saml.states) != 0 {
+		t.Errorf("login states left = %d, want 0", len(env.saml.states))
+	}
+
+	// Unmapped values keep the user's role
+	env.idp.attributes(map[string][]string{"groups": {"Everyone"}})
+	user, err = env.login(t)
+	if err != nil {
+		t.Fatalf("second CompleteLogin() error = %v", err)
+	}
+	if user.Role != "admin" {
+		t.Errorf("role without a mapped value = %q, want admin kept", user.Role)
+	}
+}
+
+func TestSAMLService_Login_JITProvisioning(t *testing.T) {
+	env := newSAMLTestEnv(t)
+	env.idp.attributes(map[string][]string{
+		"email":       {"Member@Acme.test"},
+		"displayName": {"Ada Member"},
+		"groups":      {"Staff"},
+	})
+
+	if _, err := env.login(t); !errors.Is(err, ErrSSOUserNotFound) {
+		t.Fatalf("CompleteLogin() without JIT error = %v, want ErrSSOUserNotFound", err)
+	}
+
+	env.saml.configs[env.tenant.ID].JITProvisioning = true
+
+	user, err := env.login(t)
+	if err != nil {
+		t.Fatalf("CompleteLogin() error = %v", err)
+	}
+	if user.TenantID != env.tenant.ID || user.Email != "member@acme.test" || user.Role != "user" {
+		t.Errorf("provisioned user = %+v, want a user with the mapped role", user)
+	}
+	if user.EmailVerifiedAt == nil || user.PasswordHash != nil {
+		t.Errorf("provisioned user should be verified and passwordless, got %+v", user)
+	}
+	if len(env.signups.profiles) != 1 || env.signups.profiles[0].Name != "Ada Member" {
+		t.Errorf("provisioned profiles = %+v, want one named Ada Member", env.signups.profiles)
+	}
+
+	// Without a mapped role new members get the default role
+	env.idp.session.NameID = "other@acme.test"
+	env.idp.attributes(nil)
+	other, err := env.login(t)
+	if err != nil {
+		t.Fatalf("CompleteLogin() for another member error = %v", err)
+	}
+	if other.Email != "other@acme.test" || other.Role != "viewer" {
+		t.Errorf("provisioned user = %+v, want a viewer", other)
+	}
+}
+
+func TestSAMLService_Login_Rejected(t *testing.T) {
+	t.Run("other domain", func(t *testing.T) {
+		env := newSAMLTestEnv(t)
+		env.idp.session.NameID = "member@evil.test"
+
+		if _, err := env.login(t); !errors.Is(err, ErrSSODomainNotAllowed) {
+			t.Errorf("CompleteLogin() error = %v, want ErrSSODomainNotAllowed", err)
+		}
+	})
+
+	t.Run("tampered assertion", func(t *testing.T) {
+		env := newSAMLTestEnv(t)
+		member := env.addUser(t, "member@acme.test", "viewer")
+		env.idp.attributes(map[string][]string{"groups": {"Staff"}})
+
+		cookieState, form := env.begin(t)
+		raw, err := base64.StdEncoding.DecodeString(form.SAMLResponse)
+		if err != nil {
+			t.Fatalf("DecodeString() error = %v", err)
+		}
+		tampered := bytes.ReplaceAll(raw, []byte(">Staff<"), []byte(">Admins<"))
+		if bytes.Equal(raw, tampered) {
+			t.Fatal("response did not contain the group to tamper with")
+		}
+
+		_, err = env.service.CompleteLogin("acme", cookieState, form.RelayState, base64.StdEncoding.EncodeToString(tampered))
+		if !errors.Is(err, ErrSSOFailed) {
+			t.Errorf("CompleteLogin() error = %v, want ErrSSOFailed", err)
+		}
+		if role := env.users.users[member.ID].Role; role == "admin" {
+			t.Errorf("tampered assertion changed the role to %q", role)
+		}
+	})
+
+	t.Run("signed by another key", func(t *testing.T) {
+		env := newSAMLTestEnv(t)
+		env.addUser(t, "member@acme.test", "user")
+
+		impostor := newTestSAMLIdP(t)
+		impostor.idp.MetadataURL = env.idp.idp.MetadataURL
+		impostor.idp.SSOURL = env.idp.idp.SSOURL
+		impostor.sp = env.idp.sp
+
+		redirectURL, cookieState, err := env.service.BeginLogin("acme")
+		if err != nil {
+			t.Fatalf("BeginLogin() error = %v", err)
+		}
+		form := impostor.signIn(redirectURL)
+
+		_, err = env.service.CompleteLogin("acme", cookieState, form.RelayState, form.SAMLResponse)
+		if !errors.Is(err, ErrSSOFailed) {
+			t.Errorf("CompleteLogin() error = %v, want ErrSSOFailed", err)
+		}
+	})
+}
+
+func TestSAMLService_Login_InvalidState(t *testing.T) {
+	env := newSAMLTestEnv(t)
+	env.addUser(t, "member@acme.test", "user")
+
+	cookieState, form := env.begin(t)
+
+	// An assertion posted in another browser has no matching cookie
+	if _, err := env.service.CompleteLogin("acme", "", form.RelayState, form.SAMLResponse); !errors.Is(err, ErrInvalidSSOState) {
+		t.Errorf("CompleteLogin() without cookie error = %v, want ErrInvalidSSOState", err)
+	}
+
+	if _, err := env.service.CompleteLogin("acme", cookieState, form.RelayState, form.SAMLResponse); err != nil {
+		t.Fatalf("CompleteLogin() error = %v", err)
+	}
+	if _, err := env.service.CompleteLogin("acme", cookieState, form.RelayState, form.SAMLResponse); !errors.Is(err, ErrInvalidSSOState) {
+		t.Errorf("replayed CompleteLogin() error = %v, want ErrInvalidSSOState", err)
+	}
+
+	// An assertion for one tenant can't be posted to another tenant's ACS
+	cookieState, form = env.begin(t)
+	if _, err := env.service.CompleteLogin("globex", cookieState, form.RelayState, form.SAMLResponse); !errors.Is(err, ErrInvalidSSOState) {
+		t.Errorf("CompleteLogin() at another tenant error = %v, want ErrInvalidSSOState", err)
+	}
+}
+
+func TestSAMLService_BeginLogin_NotConfigured(t *testing.T) {
+	env := newSAMLTestEnv(t)
+
+	if _, _, err := env.service.BeginLogin("unknown"); !errors.Is(err, ErrSSONotConfigured) {
+		t.Errorf("BeginLogin(unknown) error = %v, want ErrSSONotConfigured", err)
+	}
+
+	env.saml.configs[env.tenant.ID].Enabled = false
+	if _, _, err := env.service.BeginLogin("acme"); !errors.Is(err, ErrSSONotConfigured) {
+		t.Errorf("BeginLogin() when disabled error = %v, want ErrSSONotConfigured", err)
+	}
+}
+
+func TestSAMLService_Metadata(t *testing.T) {
+	env := newSAMLTestEnv(t)
+
+	if env.idp.sp.EntityID != testOIDCAppURL+"/auth/sso/saml/acme/metadata" {
+		t.Errorf("entity ID = %q, want the tenant's metadata URL", env.idp.sp.EntityID)
+	}
+	services := env.idp.sp.SPSSODescriptors[0].AssertionConsumerServices
+	if len(services) != 1 || services[0].Binding != saml.HTTPPostBinding || services[0].Location != testOIDCAppURL+"/auth/sso/saml/acme/acs" {
+		t.Errorf("assertion consumer services = %+v, want only the HTTP-POST ACS", services)
+	}
+
+	if _, err := env.service.Metadata("unknown"); !errors.Is(err, ErrSSONotConfigured) {
+		t.Errorf("Metadata(unknown) error = %v, want ErrSSONotConfigured", err)
+	}
+}
+
+func TestSAMLService_SaveConfig(t *testing.T) {
+	env := newSAMLTestEnv(t)
+
+	valid := SAMLConfigInput{
+		RoleAttribute:  "groups",
+		RoleMapping:    "  Admins=ADMIN \n\n Read Only =viewer",
+		AllowedDomains: "acme.test",
+		DefaultRole:    "user",
+		Enabled:        true,
+	}
+	config, err := env.service.SaveConfig(env.tenant, valid)
+	if err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+	if config.IdPEntityID != "https://idp.acme.test/metadata" || config.IdPMetadata == "" {
+		t.Errorf("SaveConfig() without metadata should keep the stored metadata, got %+v", config)
+	}
+	if config.RoleMapping != "Admins = admin\nRead Only = viewer" {
+		t.Errorf("RoleMapping = %q, want normalized lines", config.RoleMapping)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(input *SAMLConfigInput)
+		want   error
+	}{
+		{"not xml", func(input *SAMLConfigInput) { input.IdPMetadata = "not metadata" }, ErrInvalidIdPMetadata},
+		{"sp metadata", func(input *SAMLConfigInput) {
+			data, _ := env.service.Metadata("acme")
+			input.IdPMetadata = string(data)
+		}, ErrInvalidIdPMetadata},
+		{"unknown role", func(input *SAMLConfigInput) { input.RoleMapping = "Admins = owner" }, ErrInvalidRoleMapping},
+		{"mapping without value", func(input *SAMLConfigInput) { input.RoleMapping = "admin" }, ErrInvalidRoleMapping},
+		{"mapping without attribute", func(input *SAMLConfigInput) { input.RoleAttribute = " " }, ErrRoleAttributeRequired},
+		{"no domains", func(input *SAMLConfigInput) { input.AllowedDomains = "" }, ErrEmailDomainsRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := valid
+			tt.modify(&input)
+			if _, err := env.service.SaveConfig(env.tenant, input); !errors.Is(err, tt.want) {
+				t.Errorf("SaveConfig() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	standard := &model.Tenant{ID: uuid.New(), Subdomain: "globex", Status: "active", Tier: "standard"}
+	if _, err := env.service.SaveConfig(standard, valid); !errors.Is(err, ErrSSONotAvailable) {
+		t.Errorf("SaveConfig() on standard tier error = %v, want ErrSSONotAvailable", err)
+	}
+
+	env.tenant.SSOEnforced = true
+	disabled := valid
+	disabled.Enabled = false
+	if _, err := env.service.SaveConfig(env.tenant, disabled); !errors.Is(err, ErrSSOEnforced) {
+		t.Errorf("SaveConfig() disabling enforced SSO error = %v, want ErrSSOEnforced", err)
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+)
+
+const (
+	// securityEventLimit is how many events the activity pages show
+	securityEventLimit = 50
+
+	// maxSecurityEventUserAgent caps the stored user agent, which the client controls
+	maxSecurityEventUserAgent = 512
+)
+
+// Anyone can send a request that fails without naming an account, so each client IP only
+// gets this many of those recorded; the rest are dropped
+var anonymousEventLimit = ipLimit{action: model.ThrottleActionAnonymousEvent, window: time.Hour, max: 20}
+
+// SecurityEventService keeps the log of sign-ins and account security changes.
+// Recording never fails the action being recorded; errors are only logged.
+type SecurityEventService struct {
+	securityEventRepository repository.SecurityEventRepository
+	throttleRepository      repository.ThrottleRepository
+	// retention is how long events are kept before Cleanup deletes them
+	retention time.Duration
+}
+
+func NewSecurityEventService(
+	securityEventRepository repository.SecurityEventRepository,
+	throttleRepository repository.ThrottleRepository,
+	retention time.Duration,
+) *SecurityEventService {
+	return &SecurityEventService{
+		securityEventRepository: securityEventRepository,
+		throttleRepository:      throttleRepository,
+		retention:               retention,
+	}
+}
+
+// Success records that the user did eventType
+func (s *SecurityEventService) Success(eventType string, user *model.User, client model.ClientInfo) {
+	s.record(eventType, model.SecurityOutcomeSuccess, user, "", client, "")
+}
+
+// SuccessInTenant records that the user did eventType inside another tenant, such as platform
+// staff impersonating one of its users, so the tenant sees it in its own activity
+func (s *SecurityEventService) SuccessInTenant(eventType string, user *model.User, tenantID uuid.UUID, client model.ClientInfo) {
+	event := newSecurityEvent(eventType, model.SecurityOutcomeSuccess, user, "", client, "")
+	event.TenantID = &tenantID
+	s.create(event)
+}
+
+// Failure records a refused attempt at eventType and why it was refused. The user is nil
+// when the attempt can't be tied to an account; email is what the client gave instead.
+func (s *SecurityEventService) Failure(eventType string, user *model.User, email string, client model.ClientInfo, reason string) {
+	s.record(eventType, model.SecurityOutcomeFailure, user, email, client, reason)
+}
+
+// Pending records that the user passed the first step of signing in with eventType and was
+// asked for their second factor; the outcome of that is recorded as its own event
+func (s *SecurityEventService) Pending(eventType string, user *model.User, client model.ClientInfo) {
+	s.record(eventType, model.SecurityOutcomeSuccess, user, "", client, model.SecurityReasonTwoFactorRequired)
+}
+
+// AnonymousFailure records a refused attempt at eventType that can't be tied to an account,
+// such as an unknown bearer token or link. Only the first few per client IP and hour are recorded.
+func (s *SecurityEventService) AnonymousFailure(eventType, email string, client model.ClientInfo, reason string) {
+	err := checkIPThrottle(s.throttleRepository, anonymousEventLimit, client.IPAddress)
+	if errors.Is(err, ErrTooManyRequests) {
+		return
+	}
+	if err != nil {
+		slog.Error("failed to throttle security event", "error", err, "type", eventType)
+		return
+	}
+	s.record(eventType, model.SecurityOutcomeFailure, nil, email, client, reason)
+}
+
+func (s *SecurityEventService) record(eventType, outcome string, user *model.User, email string, client model.ClientInfo, reason string) {
+	s.create(newSecurityEvent(eventType, outcome, user, email, client, reason))
+}
+
+func (s *SecurityEventService) create(event *model.SecurityEvent) {
+	err := s.securityEventRepository.Create(event)
+	if err != nil {
+		slog.Error("failed to record security event", "error", err, "type", event.Type, "outcome", event.Outcome, "email", event.ActorEmail)
+	}
+}
+
+// newSecurityEvent builds an event in the user's tenant
+func newSecurityEvent(eventType, outcome string, user *model.User, email string, client model.ClientInfo, reason string) *model.SecurityEvent {
+	event := &model.SecurityEvent{
+		Type:       eventType,
+		Outcome:    outcome,
+		ActorEmail: email,
+		IPAddress:  client.IPAddress,
+		UserAgent:  truncate(client.UserAgent, maxSecurityEventUserAgent),
+		Reason:     reason,
+	}
+	if user != nil {
+		event.ActorID = &user.ID
+		event.ActorEmail = user.Email
+		event.TenantID = &user.TenantID
+	}
+	return event
+}
+
+// Recent lists the user's own security activity, newest first
+func (s *SecurityEventService) Recent(userID uuid.UUID) ([]*model.SecurityEvent, error) {
+	events, err := s.securityEventRepository.ByActorID(userID, securityEventLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list security events: %w", err)
+	}
+	return events, nil
+}
+
+// RecentForTenant lists the security activity of the tenant's users, newest first
+func (s *SecurityEventService) RecentForTenant(tenantID uuid.UUID) ([]*model.SecurityEvent, error) {
+	events, err := s.securityEventRepository.ByTenantID(tenantID, securityEventLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list security events: %w", err)
+	}
+	return events, nil
+}
+
+// Cleanup deletes events older than the retention period
+func (s *SecurityEventService) Cleanup() error {
+	deleted, err := s.securityEventRepository.CleanupExpired(s.retention)
+	if err != nil {
+		return fmt.Errorf("failed to clean up security events: %w", err)
+	}
+	if deleted > 0 {
+		slog.Info("cleaned up security events", "deleted", deleted)
+	}
+	return nil
+}
+
+// truncate shortens s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+)
+
+func TestAuthService_Login_RecordsSecurityEvents(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "events@example.com", "a-long-enough-password", true)
+	unverified := env.addUser(t, "unverified@example.com", "a-long-enough-password", false)
+
+	tests := []struct {
+		name        string
+		email       string
+		password    string
+		wantActor   *model.User
+		wantOutcome string
+		wantReason  string
+	}{
+		{"wrong password", "events@example.com", "wrong-password-entirely", user, model.SecurityOutcomeFailure, model.SecurityReasonInvalidPassword},
+		{"unknown account", "nobody@example.com", "a-long-enough-password", nil, model.SecurityOutcomeFailure, model.SecurityReasonUnknownAccount},
+		{"unverified email", "unverified@example.com", "a-long-enough-password", unverified, model.SecurityOutcomeFailure, model.SecurityReasonEmailNotVerified},
+	}
+
+	t.Run("success", func(t *testing.T) {
+		if _, err := env.service.Login("events@example.com", "a-long-enough-password", testClient); err != nil {
+			t.Fatalf("Login() error = %v", err)
+		}
+		if len(env.events.events) != 0 {
+			t.Errorf("expected the sign-in to be recorded where the session starts, got %+v", env.events.events)
+		}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _ = env.service.Login(tt.email, tt.password, testClient)
+
+			event := env.events.last()
+			if event == nil || event.Type != model.SecurityEventLogin {
+				t.Fatalf("expected a login event, got %+v", event)
+			}
+			if event.Outcome != tt.wantOutcome || event.Reason != tt.wantReason {
+				t.Errorf("event outcome = %q (%q), want %q (%q)", event.Outcome, event.Reason, tt.wantOutcome, tt.wantReason)
+			}
+			if event.ActorEmail != tt.email || event.IPAddress != testClient.IPAddress || event.UserAgent != testClient.UserAgent {
+				t.Errorf("expected the event to record the email and client, got %+v", event)
+			}
+
+			if tt.wantActor == nil {
+				if event.ActorID != nil || event.TenantID != nil {
+					t.Errorf("expected no actor or tenant for an unknown account, got %+v", event)
+				}
+				return
+			}
+			if event.ActorID == nil || *event.ActorID != tt.wantActor.ID || event.TenantID == nil || *event.TenantID != tt.wantActor.TenantID {
+				t.Errorf("expected the event to belong to %s and their tenant, got %+v", tt.wantActor.Email, event)
+			}
+		})
+	}
+}
+
+func TestAuthService_RefreshSession_RecordsReuse(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "reuse@example.com", "long-enough-password", true)
+
+	first := mustStartSession(t, env.service, user)
+	if _, err := env.service.RefreshSession(first.RefreshToken, testClient); err != nil {
+		t.Fatalf("RefreshSession() error = %v", err)
+	}
+	if len(env.events.events) != 0 {
+		t.Fatalf("expected a refresh not to be recorded, got %+v", env.events.events)
+	}
+
+	env.sessions.backdateRefreshTokenUse(hashToken(first.RefreshToken), refreshReuseGrace*2)
+	_, _ = env.service.RefreshSession(first.RefreshToken, testClient)
+
+	event := env.events.last()
+	if event == nil || event.Type != model.SecurityEventRefreshTokenReused || event.Succeeded() {
+		t.Fatalf("expected a failed refresh token reuse event, got %+v", event)
+	}
+	if event.ActorID == nil || *event.ActorID != user.ID {
+		t.Errorf("expected the reuse to be recorded for the session's user, got %+v", event)
+	}
+}
+
+func TestSecurityEventService_Recent(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "recent@example.com", "a-long-enough-password", true)
+	other := env.addUser(t, "other@example.com", "a-long-enough-password", true)
+	events := NewSecurityEventService(env.events, env.throttle, 24*time.Hour)
+
+	events.Success(model.SecurityEventLogin, user, testClient)
+	events.Success(model.SecurityEventPasswordChanged, user, model.ClientInfo{UserAgent: strings.Repeat("x", 4096)})
+	events.Success(model.SecurityEventLogin, other, testClient)
+
+	recent, err := events.Recent(user.ID)
+	if err != nil {
+		t.Fatalf("Recent() error = %v", err)
+	}
+	if len(recent) != 2 || recent[0].Type != model.SecurityEventPasswordChanged {
+		t.Fatalf("expected the user's 2 events newest first, got %+v", recent)
+	}
+	if len(recent[0].UserAgent) != maxSecurityEventUserAgent {
+		t.Errorf("expected the user agent to be truncated to %d bytes, got %d", maxSecurityEventUserAgent, len(recent[0].UserAgent))
+	}
+
+	tenantEvents, err := events.RecentForTenant(other.TenantID)
+	if err != nil {
+		t.Fatalf("RecentForTenant() error = %v", err)
+	}
+	if len(tenantEvents) != 1 || *tenantEvents[0].ActorID != other.ID {
+		t.Errorf("expected only the other tenant's event, got %+v", tenantEvents)
+	}
+}
+
+func TestSecurityEventService_AnonymousFailure(t *testing.T) {
+	env := newAuthTestEnv(t)
+	events := NewSecurityEventService(env.events, env.throttle, 24*time.Hour)
+
+	for range anonymousEventLimit.max + 5 {
+		events.AnonymousFailure(model.SecurityEventBearerTokenRejected, "", testClient, model.SecurityReasonInvalidToken)
+	}
+	if got := len(env.events.events); got != anonymousEventLimit.max {
+		t.Errorf("expected %d events to be recorded for one IP, got %d", anonymousEventLimit.max, got)
+	}
+
+	events.AnonymousFailure(model.SecurityEventBearerTokenRejected, "", model.ClientInfo{IPAddress: "198.51.100.9"}, model.SecurityReasonInvalidToken)
+	if got := len(env.events.events); got != anonymousEventLimit.max+1 {
+		t.Errorf("expected another IP to be recorded, got %d events", got)
+	}
+}
+
+func TestSecurityEventService_Cleanup(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "cleanup@example.com", "a-long-enough-password", true)
+	events := NewSecurityEventService(env.events, env.throttle, 24*time.Hour)
+
+	events.Success(model.SecurityEventLogin, user, testClient)
+	env.events.events[0].CreatedAt = time.Now().Add(-25 * time.Hour)
+	events.Success(model.SecurityEventLogin, user, testClient)
+
+	if err := events.Cleanup(); err != nil {
+		t.Fatalf("Cleanup() error = %v", err)
+	}
+	if got := len(env.events.events); got != 1 {
+		t.Errorf("expected only the recent event to be kept, got %d", got)
+	}
+}
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidSession     = errors.New("session is invalid, expired or revoked")
+	ErrCurrentSession     = errors.New("use sign out to end the current session")
+	ErrRefreshTokenReused = errors.New("refresh token was already used")
+	// ErrRefreshTokenRotated means another request refreshed the session a moment ago
+	ErrRefreshTokenRotated = errors.New("refresh token was just rotated")
+)
+
+const (
+	// AccessTokenCookie holds the short-lived access JWT
+	AccessTokenCookie = "auth_token"
+	// RefreshTokenCookie holds the one-time-use refresh token
+	RefreshTokenCookie = "refresh_token"
+
+	// Session client info and last-seen time are written at most once per interval
+	sessionTouchInterval = time.Minute
+
+	// A refresh token presented again within this window by the client the
+	// session was last seen from is treated as two tabs racing to refresh
+	// rather than as theft
+	refreshReuseGrace = 10 * time.Second
+)
+
+// SessionTokens are the credentials handed to the browser for a session
+type SessionTokens struct {
+	AccessToken  string
+	RefreshToken string
+	// AccessExpiresAt is when the access JWT must be refreshed
+	AccessExpiresAt time.Time
+	// SessionExpiresAt is when the session ends and the user has to sign in again
+	SessionExpiresAt time.Time
+}
+
+// StartSession creates a server-side session for the user and issues its first access and refresh tokens
+func (s *AuthService) StartSession(user *model.User) (*SessionTokens, error) {
+	now := time.Now()
+	session := &model.Session{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		ExpiresAt: now.Add(s.sessionExpiry),
+		CreatedAt: now,
+	}
+	err := s.sessionRepository.Create(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return s.issueSessionTokens(user, session)
+}
+
+// RefreshSession exchanges a refresh token for a new access token and refresh token.
+// Refresh tokens are single use: presenting a used one again means it was copied,
+// so the whole session (the token family) is revoked.
+func (s *AuthService) RefreshSession(refreshToken string, client model.ClientInfo) (*SessionTokens, error) {
+	tokenHash := hashToken(refreshToken)
+
+	token, err := s.sessionRepository.ConsumeRefreshToken(tokenHash)
+	if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		return nil, s.checkRefreshTokenReuse(tokenHash, client)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume refresh token: %w", err)
+	}
+
+	session, err := s.sessionRepository.ByID(token.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if !session.IsActive() {
+		return nil, ErrInvalidSession
+	}
+
+	user, err := s.userRepository.ByID(session.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return s.issueSessionTokens(user, session)
+}
+
+// checkRefreshTokenReuse decides why a refresh token could not be consumed
+func (s *AuthService) checkRefreshTokenReuse(tokenHash string, client model.ClientInfo) error {
+	token, err := s.sessionRepository.RefreshTokenByHash(tokenHash)
+	if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	// Expired, never used
+	if !token.IsUsed() {
+		return ErrInvalidToken
+	}
+
+	if time.Since(*token.UsedAt) < refreshReuseGrace {
+		session, err := s.sessionRepository.ByID(token.SessionID)
+		if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+			return fmt.Errorf("failed to get session: %w", err)
+		}
+		// A replay from anywhere else is a stolen token, however quick
+		if session != nil && session.UserAgent != "" &&
+			session.UserAgent == client.UserAgent && session.IPAddress == client.IPAddress {
+			return ErrRefreshTokenRotated
+		}
+	}
+
+	err = s.sessionRepository.Revoke(token.SessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session after refresh token reuse: %w", err)
+	}
+
+	s.recordSessionEvent(token.SessionID, model.SecurityEventRefreshTokenReused, model.SecurityOutcomeFailure, client)
+	slog.Warn("refresh token reuse detected, session revoked", "session_id", token.SessionID)
+	return ErrRefreshTokenReused
+}
+
+// issueSessionTokens signs a new access JWT for the session and stores a new refresh token
+func (s *AuthService) issueSessionTokens(user *model.User, session *model.Session) (*SessionTokens, error) {
+	now := time.Now()
+	accessExpiresAt := now.Add(s.accessExpiry)
+	if accessExpiresAt.After(session.ExpiresAt) {
+		accessExpiresAt = session.ExpiresAt
+	}
+
+	claims := jwt.MapClaims{
+		"jti":       session.ID.String(),
+		"user_id":   user.ID.String(),
+		"tenant_id": user.TenantID.String(),
+		"email":     user.Email,
+		"exp":       accessExpiresAt.Unix(),
+		"iat":       now.Unix(),
+	}
+	accessToken, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	refreshToken, err := s.GenerateToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	err = s.sessionRepository.CreateRefreshToken(&model.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return &SessionTokens{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		AccessExpiresAt:  accessExpiresAt,
+		SessionExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// VerifyJWT verifies a JWT token against the keyring and returns the claims
+func (s *AuthService) VerifyJWT(tokenString string) (jwt.MapClaims, error) {
+	return s.keys.Parse(tokenString)
+}
+
+// NeedsRefresh reports whether the access token is in the last third of its lifetime
+// and should be renewed before it expires
+func (s *AuthService) NeedsRefresh(claims jwt.MapClaims) bool {
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return true
+	}
+	return time.Until(exp.Time) < s.accessExpiry/3
+}
+
+// ValidateSession checks that the session referenced by the JWT's jti claim exists,
+// belongs to the JWT's user and has been neither revoked nor expired
+func (s *AuthService) ValidateSession(claims jwt.MapClaims) (*model.Session, error) {
+	sessionID, err := sessionIDFromClaims(claims)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+
+	session, err := s.sessionRepository.ByID(sessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			return nil, ErrInvalidSession
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	userID, _ := claims["user_id"].(string)
+	if session.UserID.String() != userID || !session.IsActive() {
+		return nil, ErrInvalidSession
+	}
+
+	return session, nil
+}
+
+// TouchSession records the client a session is used from. Writes are skipped while the
+// client is unchanged and the session was seen within sessionTouchInterval.
+func (s *AuthService) TouchSession(session *model.Session, userAgent, ipAddress string) error {
+	now := time.Now()
+	if session.UserAgent == userAgent && session.IPAddress == ipAddress &&
+		session.LastSeenAt != nil && now.Sub(*session.LastSeenAt) < sessionTouchInterval {
+		return nil
+	}
+
+	err := s.sessionRepository.Touch(session.ID, userAgent, ipAddress, now)
+	if err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+
+	session.UserAgent = userAgent
+	session.IPAddress = ipAddress
+	session.LastSeenAt = &now
+	return nil
+}
+
+// ActiveSessions lists the devices the user is currently signed in on
+func (s *AuthService) ActiveSessions(userID uuid.UUID) ([]*model.Session, error) {
+	sessions, err := s.sessionRepository.ActiveByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeOtherSession signs out one of the user's other devices.
+// The current session can only be ended by signing out.
+func (s *AuthService) RevokeOtherSession(userID, currentSessionID, sessionID uuid.UUID, client model.ClientInfo) error {
+	if sessionID == currentSessionID {
+		return ErrCurrentSession
+	}
+
+	session, err := s.sessionRepository.ByID(sessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			return ErrInvalidSession
+		}
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	// Don't reveal whether another user's session exists
+	if session.UserID != userID {
+		return ErrInvalidSession
+	}
+
+	err = s.sessionRepository.Revoke(session.ID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	s.recordSessionEvent(session.ID, model.SecurityEventSessionRevoked, model.SecurityOutcomeSuccess, client)
+	slog.Info("session revoked", "user_id", userID, "session_id", session.ID)
+	return nil
+}
+
+// EndSession revokes the session behind the given cookies so neither token keeps working,
+// even if copies survive outside the browser. The refresh token identifies the
+// session when the access token has already expired.
+func (s *AuthService) EndSession(accessToken, refreshToken string, client model.ClientInfo) error {
+	var sessionID uuid.UUID
+
+	claims, err := s.VerifyJWT(accessToken)
+	if err == nil {
+		sessionID, _ = sessionIDFromClaims(claims)
+	}
+	if sessionID == uuid.Nil && refreshToken != "" {
+		token, err := s.sessionRepository.RefreshTokenByHash(hashToken(refreshToken))
+		if err == nil {
+			sessionID = token.SessionID
+		}
+	}
+	if sessionID == uuid.Nil {
+		// Neither token points at a session, so there is nothing left to revoke
+		return nil
+	}
+
+	err = s.sessionRepository.Revoke(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	s.recordSessionEvent(sessionID, model.SecurityEventLogout, model.SecurityOutcomeSuccess, client)
+	return nil
+}
+
+// recordSessionEvent records a security event for the user the session belongs to
+func (s *AuthService) recordSessionEvent(sessionID uuid.UUID, eventType, outcome string, client model.ClientInfo) {
+	session, err := s.sessionRepository.ByID(sessionID)
+	if err != nil {
+		slog.Warn("failed to get session for security event", "error", err, "session_id", sessionID)
+		return
+	}
+	user, err := s.userRepository.ByID(session.UserID)
+	if err != nil {
+		slog.Warn("failed to get user for security event", "error", err, "session_id", sessionID)
+		return
+	}
+
+	if outcome == model.SecurityOutcomeSuccess {
+		s.securityEvents.Success(eventType, user, client)
+	} else {
+		s.securityEvents.Failure(eventType, user, "", client, "")
+	}
+}
+
+// RevokeAllSessions signs the user out on every device
+func (s *AuthService) RevokeAllSessions(userID uuid.UUID) error {
+	err := s.sessionRepository.RevokeAllByUserID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	slog.Info("all sessions revoked", "user_id", userID)
+	return nil
+}
+
+// SetSessionCookies stores the session tokens in HTTP-only cookies.
+// The access cookie expires with the JWT; the refresh cookie lives as long as the session.
+func (s *AuthService) SetSessionCookies(w http.ResponseWriter, tokens *SessionTokens) {
+	s.setCookie(w, AccessTokenCookie, tokens.AccessToken, tokens.AccessExpiresAt)
+	s.setCookie(w, RefreshTokenCookie, tokens.RefreshToken, tokens.SessionExpiresAt)
+}
+
+// ClearSessionCookies clears the access and refresh cookies
+func (s *AuthService) ClearSessionCookies(w http.ResponseWriter) {
+	s.setCookie(w, AccessTokenCookie, "", time.Unix(0, 0))
+	s.setCookie(w, RefreshTokenCookie, "", time.Unix(0, 0))
+}
+
+func (s *AuthService) setCookie(w http.ResponseWriter, name, value string, expiry time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Expires:  expiry,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   s.isProduction,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sessionIDFromClaims parses the jti claim of a session JWT
+func sessionIDFromClaims(claims jwt.MapClaims) (uuid.UUID, error) {
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		return uuid.Nil, errors.New("missing jti claim")
+	}
+	return uuid.Parse(jti)
+}
+
+// hashToken returns the hex SHA-256 of a random token; only the hash is stored.
+// Tokens carry at least 80 bits of randomness, so a fast unsalted hash is sufficient.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+)
+
+func TestAuthService_ValidateSession(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "sessions@example.com", "long-enough-password", true)
+	other := env.addUser(t, "other@example.com", "long-enough-password", true)
+
+	tests := []struct {
+		name    string
+		claims  func(t *testing.T) map[string]any
+		wantErr bool
+	}{
+		{
+			name: "active session",
+			claims: func(t *testing.T) map[string]any {
+				return mustVerifyJWT(t, env.service, mustStartSession(t, env.service, user).AccessToken)
+			},
+		},
+		{
+			name: "missing jti",
+			claims: func(t *testing.T) map[string]any {
+				claims := mustVerifyJWT(t, env.service, mustStartSession(t, env.service, user).AccessToken)
+				delete(claims, "jti")
+				return claims
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown session",
+			claims: func(t *testing.T) map[string]any {
+				claims := mustVerifyJWT(t, env.service, mustStartSession(t, env.service, user).AccessToken)
+				claims["jti"] = uuid.New().String()
+				return claims
+			},
+			wantErr: true,
+		},
+		{
+			name: "session of another user",
+			claims: func(t *testing.T) map[string]any {
+				claims := mustVerifyJWT(t, env.service, mustStartSession(t, env.service, other).AccessToken)
+				claims["user_id"] = user.ID.String()
+				return claims
+			},
+			wantErr: true,
+		},
+		{
+			name: "ended session",
+			claims: func(t *testing.T) map[string]any {
+				token := mustStartSession(t, env.service, user).AccessToken
+				if err := env.service.EndSession(token, "", testClient); err != nil {
+					t.Fatalf("EndSession() error = %v", err)
+				}
+				return mustVerifyJWT(t, env.service, token)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := env.service.ValidateSession(tt.claims(t))
+			if tt.wantErr && !errors.Is(err, ErrInvalidSession) {
+				t.Errorf("expected ErrInvalidSession, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthService_RevokeAllSessions(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "everywhere@example.com", "long-enough-password", true)
+	other := env.addUser(t, "bystander@example.com", "long-enough-password", true)
+
+	laptop := mustStartSession(t, env.service, user).AccessToken
+	phone := mustStartSession(t, env.service, user).AccessToken
+	unrelated := mustStartSession(t, env.service, other).AccessToken
+
+	err := env.service.RevokeAllSessions(user.ID)
+	if err != nil {
+		t.Fatalf("RevokeAllSessions() error = %v", err)
+	}
+
+	for _, token := range []string{laptop, phone} {
+		if _, err := env.service.ValidateSession(mustVerifyJWT(t, env.service, token)); !errors.Is(err, ErrInvalidSession) {
+			t.Errorf("expected ErrInvalidSession, got %v", err)
+		}
+	}
+	if _, err := env.service.ValidateSession(mustVerifyJWT(t, env.service, unrelated)); err != nil {
+		t.Errorf("expected other user's session to stay valid, got %v", err)
+	}
+}
+
+func mustVerifyJWT(t *testing.T, s *AuthService, token string) map[string]any {
+	t.Helper()
+
+	claims, err := s.VerifyJWT(token)
+	if err != nil {
+		t.Fatalf("VerifyJWT() error = %v", err)
+	}
+	return claims
+}
+
+func TestAuthService_TouchSession(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "touch@example.com", "long-enough-password", true)
+
+	session, err := env.service.ValidateSession(mustVerifyJWT(t, env.service, mustStartSession(t, env.service, user).AccessToken))
+	if err != nil {
+		t.Fatalf("ValidateSession() error = %v", err)
+	}
+
+	err = env.service.TouchSession(session, "Firefox/131.0", "203.0.113.7")
+	if err != nil {
+		t.Fatalf("TouchSession() error = %v", err)
+	}
+	stored := env.sessions.sessions[session.ID]
+	if stored.UserAgent != "Firefox/131.0" || stored.IPAddress != "203.0.113.7" || stored.LastSeenAt == nil {
+		t.Fatalf("expected client info to be stored, got %+v", stored)
+	}
+
+	// A repeat request from the same client within the interval is not written
+	firstSeen := *stored.LastSeenAt
+	err = env.service.TouchSession(session, "Firefox/131.0", "203.0.113.7")
+	if err != nil {
+		t.Fatalf("TouchSession() error = %v", err)
+	}
+	if !stored.LastSeenAt.Equal(firstSeen) {
+		t.Error("expected last seen time to be throttled")
+	}
+
+	// A new IP is recorded straight away
+	err = env.service.TouchSession(session, "Firefox/131.0", "198.51.100.2")
+	if err != nil {
+		t.Fatalf("TouchSession() error = %v", err)
+	}
+	if stored.IPAddress != "198.51.100.2" {
+		t.Errorf("expected new IP to be recorded, got %q", stored.IPAddress)
+	}
+}
+
+func TestAuthService_RevokeOtherSession(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "devices@example.com", "long-enough-password", true)
+	other := env.addUser(t, "stranger@example.com", "long-enough-password", true)
+
+	current, err := env.service.ValidateSession(mustVerifyJWT(t, env.service, mustStartSession(t, env.service, user).AccessToken))
+	if err != nil {
+		t.Fatalf("ValidateSession() error = %v", err)
+	}
+	phoneToken := mustStartSession(t, env.service, user).AccessToken
+	phone, err := env.service.ValidateSession(mustVerifyJWT(t, env.service, phoneToken))
+	if err != nil {
+		t.Fatalf("ValidateSession() error = %v", err)
+	}
+	stranger, err := env.service.ValidateSession(mustVerifyJWT(t, env.service, mustStartSession(t, env.service, other).AccessToken))
+	if err != nil {
+		t.Fatalf("ValidateSession() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		sessionID uuid.UUID
+		wantErr   error
+	}{
+		{name: "current session", sessionID: current.ID, wantErr: ErrCurrentSession},
+		{name: "another user's session", sessionID: stranger.ID, wantErr: ErrInvalidSession},
+		{name: "unknown session", sessionID: uuid.New(), wantErr: ErrInvalidSession},
+		{name: "own other session", sessionID: phone.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := env.service.RevokeOtherSession(user.ID, current.ID, tt.sessionID, testClient)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	sessions, err := env.service.ActiveSessions(user.ID)
+	if err != nil {
+		t.Fatalf("ActiveSessions() error = %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != current.ID {
+		t.Errorf("expected only the current session to remain, got %+v", sessions)
+	}
+}
+
+func TestAuthService_StartSession(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "start@example.com", "long-enough-password", true)
+
+	tokens := mustStartSession(t, env.service, user)
+
+	if until := time.Until(tokens.AccessExpiresAt); until > 15*time.Minute || until < 14*time.Minute {
+		t.Errorf("expected access token to expire in 15m, got %v", until)
+	}
+	if until := time.Until(tokens.SessionExpiresAt); until < 59*time.Minute {
+		t.Errorf("expected session to last an hour, got %v", until)
+	}
+
+	claims := mustVerifyJWT(t, env.service, tokens.AccessToken)
+	if env.service.NeedsRefresh(claims) {
+		t.Error("expected a fresh access token not to need a refresh")
+	}
+	claims["exp"] = float64(time.Now().Add(time.Minute).Unix())
+	if !env.service.NeedsRefresh(claims) {
+		t.Error("expected an access token about to expire to need a refresh")
+	}
+
+	// Only the hash of the refresh token is stored
+	for _, stored := range env.sessions.refreshTokens {
+		if stored.TokenHash == tokens.RefreshToken {
+			t.Error("expected refresh token to be stored hashed")
+		}
+	}
+}
+
+func TestAuthService_RefreshSession(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "refresh@example.com", "long-enough-password", true)
+
+	first := mustStartSession(t, env.service, user)
+	second, err := env.service.RefreshSession(first.RefreshToken, testClient)
+	if err != nil {
+		t.Fatalf("RefreshSession() error = %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("expected refresh token to rotate")
+	}
+
+	firstClaims := mustVerifyJWT(t, env.service, first.AccessToken)
+	secondClaims := mustVerifyJWT(t, env.service, second.AccessToken)
+	if firstClaims["jti"] != secondClaims["jti"] {
+		t.Error("expected refreshed access token to belong to the same session")
+	}
+
+	session, err := env.service.ValidateSession(secondClaims)
+	if err != nil {
+		t.Fatalf("ValidateSession() error = %v", err)
+	}
+	err = env.service.TouchSession(session, testClient.UserAgent, testClient.IPAddress)
+	if err != nil {
+		t.Fatalf("TouchSession() error = %v", err)
+	}
+
+	// Two tabs refreshing at once: the loser is told to retry, nothing is revoked
+	_, err = env.service.RefreshSession(first.RefreshToken, testClient)
+	if !errors.Is(err, ErrRefreshTokenRotated) {
+		t.Fatalf("expected ErrRefreshTokenRotated, got %v", err)
+	}
+	if _, err := env.service.ValidateSession(secondClaims); err != nil {
+		t.Fatalf("expected session to survive a refresh race, got %v", err)
+	}
+
+	// Replaying the old token later is theft: the whole family is revoked
+	env.sessions.backdateRefreshTokenUse(hashToken(first.RefreshToken), time.Minute)
+	_, err = env.service.RefreshSession(first.RefreshToken, testClient)
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := env.service.ValidateSession(secondClaims); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("expected session to be revoked, got %v", err)
+	}
+	if _, err := env.service.RefreshSession(second.RefreshToken, testClient); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("expected latest refresh token to stop working, got %v", err)
+	}
+
+	if _, err := env.service.RefreshSession("not-a-real-token", testClient); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for unknown token, got %v", err)
+	}
+}
+
+func TestAuthService_RefreshSession_ReplayFromOtherClient(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "stolen@example.com", "long-enough-password", true)
+
+	first := mustStartSession(t, env.service, user)
+	second, err := env.service.RefreshSession(first.RefreshToken, testClient)
+	if err != nil {
+		t.Fatalf("RefreshSession() error = %v", err)
+	}
+	claims := mustVerifyJWT(t, env.service, second.AccessToken)
+	session, err := env.service.ValidateSession(claims)
+	if err != nil {
+		t.Fatalf("ValidateSession() error = %v", err)
+	}
+	err = env.service.TouchSession(session, testClient.UserAgent, testClient.IPAddress)
+	if err != nil {
+		t.Fatalf("TouchSession() error = %v", err)
+	}
+
+	// Replayed straight away, but from a different client: no grace
+	thief := model.ClientInfo{IPAddress: "198.51.100.66", UserAgent: "curl/8.5.0"}
+	_, err = env.service.RefreshSession(first.RefreshToken, thief)
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := env.service.ValidateSession(claims); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("expected session to be revoked, got %v", err)
+	}
+}
+
+func TestAuthService_EndSession_ExpiredAccessToken(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "logout@example.com", "long-enough-password", true)
+
+	tokens := mustStartSession(t, env.service, user)
+	claims := mustVerifyJWT(t, env.service, tokens.AccessToken)
+
+	// The access cookie has already expired; the refresh token still identifies the session
+	err := env.service.EndSession("", tokens.RefreshToken, testClient)
+	if err != nil {
+		t.Fatalf("EndSession() error = %v", err)
+	}
+	if _, err := env.service.ValidateSession(claims); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("expected session to be revoked, got %v", err)
+	}
+}
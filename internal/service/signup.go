@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"dotsat.work/internal/validation"
+)
+
+var ErrSubdomainTaken = errors.New("subdomain is already taken")
+
+// SignupInput is the data submitted on the self-service signup form
+type SignupInput struct {
+	OrganizationName string
+	Subdomain        string
+	Email            string
+	Password         string
+}
+
+// SignupService creates new organizations: a tenant, its first admin user and their profile
+type SignupService struct {
+	signupRepository repository.SignupRepository
+	tenantRepository repository.TenantRepository
+	userRepository   repository.UserRepository
+	authService      *AuthService
+}
+
+func NewSignupService(
+	signupRepository repository.SignupRepository,
+	tenantRepository repository.TenantRepository,
+	userRepository repository.UserRepository,
+	authService *AuthService,
+) *SignupService {
+	return &SignupService{
+		signupRepository: signupRepository,
+		tenantRepository: tenantRepository,
+		userRepository:   userRepository,
+		authService:      authService,
+	}
+}
+
+// SubdomainAvailable reports whether the subdomain is valid and not yet taken
+func (s *SignupService) SubdomainAvailable(subdomain string) (bool, error) {
+	subdomain = strings.ToLower(strings.TrimSpace(subdomain))
+	if err := validateSubdomain(subdomain); err != nil {
+		return false, err
+	}
+
+	_, err := s.tenantRepository.BySubdomain(subdomain)
+	if errors.Is(err, repository.ErrTenantNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check subdomain: %w", err)
+	}
+
+	return false, nil
+}
+
+// Signup creates the tenant, admin user and empty profile in one transaction,
+// then sends the verification email. The admin can sign in once the email is verified.
+// An email that already has an account gets a notice instead and Signup returns a nil user
+// without an error, so the signup form doesn't reveal which addresses are registered.
+func (s *SignupService) Signup(input SignupInput) (*model.User, error) {
+	tenant, err := newTenant(input.OrganizationName, input.Subdomain)
+	if err != nil {
+		return nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+	if err := validation.ValidateEmail(email); err != nil {
+		return nil, err
+	}
+
+	passwordContext := validation.PasswordContext{
+		Email:            email,
+		OrganizationName: tenant.Name,
+		Subdomain:        tenant.Subdomain,
+	}
+	if err := s.authService.ValidatePassword(input.Password, passwordContext); err != nil {
+		return nil, err
+	}
+
+	// Check availability up front for friendly errors; the unique constraints
+	// still guard against concurrent signups inside the transaction
+	available, err := s.SubdomainAvailable(tenant.Subdomain)
+	if err != nil {
+		return nil, err
+	}
+	if !available {
+		return nil, ErrSubdomainTaken
+	}
+
+	existing, err := s.userRepository.ByEmail(email)
+	if err == nil {
+		s.authService.NotifyAccountExists(existing)
+		return nil, nil
+	}
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, fmt.Errorf("failed to check email: %w", err)
+	}
+
+	hash, err := s.authService.HashPassword(input.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	now := time.Now()
+	user := &model.User{
+		ID:           uuid.New(),
+		TenantID:     tenant.ID,
+		Email:        email,
+		PasswordHash: &hash,
+		Role:         "admin",
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	profile := &model.Profile{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err = s.signupRepository.CreateOrganization(tenant, user, profile)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrDuplicateSubdomain):
+			return nil, ErrSubdomainTaken
+		case errors.Is(err, repository.ErrDuplicateEmail):
+			// A concurrent signup took the email after the check above
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("failed to create organization: %w", err)
+		}
+	}
+
+	slog.Info("organization signed up", "tenant_id", tenant.ID, "user_id", user.ID)
+
+	// The account exists at this point; if the email fails the user can resend it from the login page
+	err = s.authService.SendVerificationEmail(user)
+	if err != nil {
+		slog.Error("failed to send verification email after signup", "error", err, "user_id", user.ID)
+	}
+
+	return user, nil
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newSignupTestEnv(t *testing.T) (*authTestEnv, *fakeSignupRepository, *SignupService) {
+	t.Helper()
+
+	env := newAuthTestEnv(t)
+	tenants := newFakeTenantRepository()
+	signups := &fakeSignupRepository{tenants: tenants, users: env.users}
+	return env, signups, NewSignupService(signups, tenants, env.users, env.service)
+}
+
+func validSignupInput() SignupInput {
+	return SignupInput{
+		OrganizationName: "Acme Corp",
+		Subdomain:        "Acme",
+		Email:            "Founder@Acme.test",
+		Password:         "correct-horse-battery",
+	}
+}
+
+func TestSignupService_Signup(t *testing.T) {
+	env, signups, s := newSignupTestEnv(t)
+
+	user, err := s.Signup(validSignupInput())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if user.Role != "admin" {
+		t.Errorf("expected admin role, got %q", user.Role)
+	}
+	if user.Email != "founder@acme.test" {
+		t.Errorf("expected normalized email, got %q", user.Email)
+	}
+	if user.IsEmailVerified() {
+		t.Error("expected email to be unverified")
+	}
+
+	tenant, err := signups.tenants.BySubdomain("acme")
+	if err != nil {
+		t.Fatalf("expected tenant to be created, got %v", err)
+	}
+	if user.TenantID != tenant.ID {
+		t.Errorf("expected user in tenant %s, got %s", tenant.ID, user.TenantID)
+	}
+	if len(signups.profiles) != 1 || signups.profiles[0].UserID != user.ID {
+		t.Errorf("expected a profile for the new user, got %+v", signups.profiles)
+	}
+
+	msg, ok := env.mailer.Last()
+	if !ok {
+		t.Fatal("expected a verification email")
+	}
+	if msg.To != user.Email || !strings.Contains(msg.Text, "/auth/verify?token=") {
+		t.Errorf("expected verification email to %s, got %+v", user.Email, msg)
+	}
+}
+
+func TestSignupService_Signup_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(in *SignupInput)
+		wantErr error
+	}{
+		{
+			name:    "subdomain taken",
+			modify:  func(in *SignupInput) { in.Email = "other@acme.test" },
+			wantErr: ErrSubdomainTaken,
+		},
+		{
+			name:    "invalid subdomain",
+			modify:  func(in *SignupInput) { in.Subdomain = "-acme" },
+			wantErr: ErrInvalidSubdomain,
+		},
+		{
+			name:    "missing organization name",
+			modify:  func(in *SignupInput) { in.OrganizationName = "  " },
+			wantErr: ErrInvalidTenantName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, signups, s := newSignupTestEnv(t)
+
+			_, err := s.Signup(validSignupInput())
+			if err != nil {
+				t.Fatalf("failed to create first organization: %v", err)
+			}
+
+			input := validSignupInput()
+			tt.modify(&input)
+			_, err = s.Signup(input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+
+			// A rejected signup must not leave a tenant behind
+			tenants, _ := signups.tenants.List()
+			if len(tenants) != 1 {
+				t.Errorf("expected 1 tenant, got %d", len(tenants))
+			}
+		})
+	}
+}
+
+func TestSignupService_Signup_EmailTaken(t *testing.T) {
+	env, signups, s := newSignupTestEnv(t)
+
+	_, err := s.Signup(validSignupInput())
+	if err != nil {
+		t.Fatalf("failed to create first organization: %v", err)
+	}
+	env.mailer.Reset()
+
+	input := validSignupInput()
+	input.Subdomain = "acme-two"
+	for range 2 {
+		user, err := s.Signup(input)
+		if err != nil || user != nil {
+			t.Fatalf("expected a taken email to look like a successful signup, got %v, %v", user, err)
+		}
+	}
+
+	tenants, _ := signups.tenants.List()
+	if len(tenants) != 1 {
+		t.Errorf("expected no tenant for a taken email, got %d tenants", len(tenants))
+	}
+
+	messages := env.mailer.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected one notice to the account owner, got %d emails", len(messages))
+	}
+	if messages[0].To != "founder@acme.test" || !strings.Contains(messages[0].Text, "/auth/forgot-password") {
+		t.Errorf("expected an account exists notice to the owner, got %+v", messages[0])
+	}
+}
+
+func TestSignupService_SubdomainAvailable(t *testing.T) {
+	_, _, s := newSignupTestEnv(t)
+
+	_, err := s.Signup(validSignupInput())
+	if err != nil {
+		t.Fatalf("failed to create organization: %v", err)
+	}
+
+	available, err := s.SubdomainAvailable("ACME")
+	if err != nil || available {
+		t.Errorf("expected acme to be taken, got available=%v err=%v", available, err)
+	}
+
+	available, err = s.SubdomainAvailable("globex")
+	if err != nil || !available {
+		t.Errorf("expected globex to be available, got available=%v err=%v", available, err)
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSSONotAvailable  = errors.New("single sign-on is only available on the enterprise tier")
+	ErrSSONotConfigured = errors.New("single sign-on is not configured for this organization")
+	// ErrSSORequired means the user's organization only allows signing in through its identity provider
+	ErrSSORequired = errors.New("this organization requires single sign-on")
+	// ErrSSOEnforced keeps admins from disabling the identity provider their members must sign in with
+	ErrSSOEnforced = errors.New("turn off required single sign-on before disabling the identity provider")
+	// ErrInvalidSSOState means the callback doesn't belong to a sign-in this browser started
+	ErrInvalidSSOState      = errors.New("single sign-on request is invalid or expired")
+	ErrSSOFailed            = errors.New("the identity provider did not return a valid sign-in")
+	ErrSSOEmailNotVerified  = errors.New("the identity provider has not verified this email address")
+	ErrSSODomainNotAllowed  = errors.New("this email domain is not allowed to sign in to the organization")
+	ErrSSOUserNotFound      = errors.New("no account exists for this email address in the organization")
+	ErrInvalidEmailDomain   = errors.New("invalid email domain: enter domains like example.com, separated by commas")
+	ErrEmailDomainsRequired = errors.New("at least one allowed email domain is required")
+)
+
+var emailDomainPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)+$`)
+
+// ssoIdentity is a user as asserted by a tenant's identity provider
+type ssoIdentity struct {
+	Email         string
+	EmailVerified bool
+	Name          string
+	// Role is mapped from the IdP's attributes; empty keeps the user's current role
+	Role string
+}
+
+// ssoMembers maps identities asserted by a tenant's identity provider to users of that tenant
+type ssoMembers struct {
+	userRepository   repository.UserRepository
+	signupRepository repository.SignupRepository
+}
+
+// user returns the tenant user with the identity's email, creating it if access allows
+// just-in-time provisioning. A mapped role replaces the user's role, so the IdP stays the source of truth.
+func (m ssoMembers) user(tenantID uuid.UUID, access *model.SSOAccess, identity ssoIdentity) (*model.User, error) {
+	email := strings.ToLower(strings.TrimSpace(identity.Email))
+	if email == "" || !identity.EmailVerified {
+		return nil, ErrSSOEmailNotVerified
+	}
+	if !access.AllowsEmail(email) {
+		slog.Warn("sso email domain not allowed", "tenant_id", tenantID, "email", email)
+		return nil, ErrSSODomainNotAllowed
+	}
+
+	user, err := m.userRepository.ByTenantAndEmail(tenantID, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		if !access.JITProvisioning {
+			return nil, ErrSSOUserNotFound
+		}
+		role := identity.Role
+		if role == "" {
+			role = access.DefaultRole
+		}
+		return m.provision(tenantID, email, identity.Name, role)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if identity.Role != "" && identity.Role != user.Role {
+		previous := user.Role
+		user.Role = identity.Role
+		user.UpdatedAt = time.Now()
+		err = m.userRepository.Update(user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update role: %w", err)
+		}
+		slog.Info("sso role updated", "tenant_id", tenantID, "user_id", user.ID, "from", previous, "to", user.Role)
+	}
+	return user, nil
+}
+
+// provision creates a passwordless user whose email the IdP has verified
+func (m ssoMembers) provision(tenantID uuid.UUID, email, name, role string) (*model.User, error) {
+	now := time.Now()
+	user := &model.User{
+		ID:              uuid.New(),
+		TenantID:        tenantID,
+		Email:           email,
+		Role:            role,
+		EmailVerifiedAt: &now,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	profile := &model.Profile{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Name:      strings.TrimSpace(name),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err := m.signupRepository.CreateMember(user, profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provision sso user: %w", err)
+	}
+
+	slog.Info("sso user provisioned", "tenant_id", tenantID, "user_id", user.ID, "role", role)
+	return user, nil
+}
+
+// newSSOAccess validates the settings shared by every single sign-on protocol
+func newSSOAccess(allowedDomains string, jitProvisioning bool, defaultRole string, enabled bool) (model.SSOAccess, error) {
+	if defaultRole == "" {
+		defaultRole = "user"
+	}
+	if !isValidRole(defaultRole) {
+		return model.SSOAccess{}, ErrInvalidRole
+	}
+	domains, err := normalizeEmailDomains(allowedDomains)
+	if err != nil {
+		return model.SSOAccess{}, err
+	}
+
+	return model.SSOAccess{
+		AllowedDomains:  domains,
+		JITProvisioning: jitProvisioning,
+		DefaultRole:     defaultRole,
+		Enabled:         enabled,
+	}, nil
+}
+
+// normalizeEmailDomains validates a comma separated list of domains and returns it lowercased
+func normalizeEmailDomains(domains string) (string, error) {
+	var normalized []string
+	for _, domain := range strings.Split(domains, ",") {
+		domain = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(domain), "@")))
+		if domain == "" {
+			continue
+		}
+		if len(domain) > 253 || !emailDomainPattern.MatchString(domain) {
+			return "", ErrInvalidEmailDomain
+		}
+		if !slices.Contains(normalized, domain) {
+			normalized = append(normalized, domain)
+		}
+	}
+	if len(normalized) == 0 {
+		return "", ErrEmailDomainsRequired
+	}
+	return strings.Join(normalized, ","), nil
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
@@ -14,20 +15,52 @@ import (
 var (
 	ErrInvalidSubdomain  = errors.New("invalid subdomain: must be 1-63 characters, lowercase letters, numbers, and hyphens only")
 	ErrInvalidTenantName = errors.New("invalid tenant name: must be 1-100 characters")
+	ErrInvalidColor      = errors.New("invalid color: must be a hex color like #3B82F6")
+	ErrInvalidTimezone   = errors.New("invalid timezone: must be an IANA name like Europe/Berlin")
+	ErrInvalidLogoURL    = errors.New("invalid logo URL: must be an absolute http(s) URL")
 )
 
 type TenantService struct {
-	tenantRepository repository.TenantRepository
+	tenantRepository         repository.TenantRepository
+	tenantSettingsRepository repository.TenantSettingsRepository
+	oidcRepository           repository.OIDCRepository
+	samlRepository           repository.SAMLRepository
 }
 
-func NewTenantService(tenantRepository repository.TenantRepository) *TenantService {
+func NewTenantService(
+	tenantRepository repository.TenantRepository,
+	tenantSettingsRepository repository.TenantSettingsRepository,
+	oidcRepository repository.OIDCRepository,
+	samlRepository repository.SAMLRepository,
+) *TenantService {
 	return &TenantService{
-		tenantRepository: tenantRepository,
+		tenantRepository:         tenantRepository,
+		tenantSettingsRepository: tenantSettingsRepository,
+		oidcRepository:           oidcRepository,
+		samlRepository:           samlRepository,
 	}
 }
 
 // Create creates a new tenant with validation
 func (s *TenantService) Create(name, subdomain string) (*model.Tenant, error) {
+	tenant, err := newTenant(name, subdomain)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tenantRepository.Create(tenant)
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateSubdomain) {
+			return nil, fmt.Errorf("subdomain %q is already taken", tenant.Subdomain)
+		}
+		return nil, fmt.Errorf("failed to create tenant: %w", err)
+	}
+
+	return tenant, nil
+}
+
+// newTenant validates name and subdomain and builds an active tenant on the free tier
+func newTenant(name, subdomain string) (*model.Tenant, error) {
 	// Validate name
 	name = strings.TrimSpace(name)
 	if len(name) < 1 || len(name) > 100 {
@@ -40,8 +73,7 @@ func (s *TenantService) Create(name, subdomain string) (*model.Tenant, error) {
 		return nil, err
 	}
 
-	// Create tenant
-	tenant := &model.Tenant{
+	return &model.Tenant{
 		ID:        uuid.New(),
 		Name:      name,
 		Subdomain: subdomain,
@@ -49,17 +81,7 @@ func (s *TenantService) Create(name, subdomain string) (*model.Tenant, error) {
 		Tier:      "free",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
-	}
-
-	err := s.tenantRepository.Create(tenant)
-	if err != nil {
-		if errors.Is(err, repository.ErrDuplicateSubdomain) {
-			return nil, fmt.Errorf("subdomain %q is already taken", subdomain)
-		}
-		return nil, fmt.Errorf("failed to create tenant: %w", err)
-	}
-
-	return tenant, nil
+	}, nil
 }
 
 // ByID retrieves a tenant by ID
@@ -108,6 +130,51 @@ func (s *TenantService) Update(tenant *model.Tenant) error {
 	return nil
 }
 
+// SetSSOEnforced requires, or stops requiring, the tenant's members to sign in through its
+// identity provider. It can only be required while one is enabled, so members aren't locked out.
+func (s *TenantService) SetSSOEnforced(tenant *model.Tenant, enforced bool) error {
+	if enforced {
+		if !tenant.IsEnterprise() {
+			return ErrSSONotAvailable
+		}
+		enabled, err := s.ssoEnabled(tenant.ID)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			return ErrSSONotConfigured
+		}
+	}
+
+	tenant.SSOEnforced = enforced
+	tenant.UpdatedAt = time.Now()
+	err := s.tenantRepository.Update(tenant)
+	if err != nil {
+		return fmt.Errorf("failed to update tenant: %w", err)
+	}
+	return nil
+}
+
+// ssoEnabled reports whether the tenant has an enabled OIDC or SAML identity provider
+func (s *TenantService) ssoEnabled(tenantID uuid.UUID) (bool, error) {
+	oidcConfig, err := s.oidcRepository.ConfigByTenantID(tenantID)
+	if err == nil && oidcConfig.Enabled {
+		return true, nil
+	}
+	if err != nil && !errors.Is(err, repository.ErrOIDCConfigNotFound) {
+		return false, fmt.Errorf("failed to get oidc config: %w", err)
+	}
+
+	samlConfig, err := s.samlRepository.ConfigByTenantID(tenantID)
+	if err == nil && samlConfig.Enabled {
+		return true, nil
+	}
+	if err != nil && !errors.Is(err, repository.ErrSAMLConfigNotFound) {
+		return false, fmt.Errorf("failed to get saml config: %w", err)
+	}
+	return false, nil
+}
+
 // Delete deletes a tenant
 func (s *TenantService) Delete(id uuid.UUID) error {
 	err := s.tenantRepository.Delete(id)
@@ -122,6 +189,84 @@ func (s *TenantService) List() ([]*model.Tenant, error) {
 	return s.tenantRepository.List()
 }
 
+// Settings returns the tenant's settings, or the defaults if none were saved yet
+func (s *TenantService) Settings(tenantID uuid.UUID) (*model.TenantSettings, error) {
+	settings, err := s.tenantSettingsRepository.ByTenantID(tenantID)
+	if errors.Is(err, repository.ErrTenantSettingsNotFound) {
+		return &model.TenantSettings{
+			TenantID:     tenantID,
+			PrimaryColor: model.DefaultPrimaryColor,
+			Timezone:     model.DefaultTimezone,
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant settings: %w", err)
+	}
+	return settings, nil
+}
+
+// UpdateSettings validates and saves the tenant's settings
+func (s *TenantService) UpdateSettings(settings *model.TenantSettings) error {
+	settings.PrimaryColor = strings.TrimSpace(settings.PrimaryColor)
+	if settings.PrimaryColor == "" {
+		settings.PrimaryColor = model.DefaultPrimaryColor
+	}
+	if err := validateHexColor(settings.PrimaryColor); err != nil {
+		return err
+	}
+
+	settings.Timezone = strings.TrimSpace(settings.Timezone)
+	if settings.Timezone == "" {
+		settings.Timezone = model.DefaultTimezone
+	}
+	if _, err := time.LoadLocation(settings.Timezone); err != nil {
+		return ErrInvalidTimezone
+	}
+
+	if settings.LogoURL != nil {
+		logoURL := strings.TrimSpace(*settings.LogoURL)
+		if logoURL == "" {
+			settings.LogoURL = nil
+		} else {
+			if err := validateLogoURL(logoURL); err != nil {
+				return err
+			}
+			settings.LogoURL = &logoURL
+		}
+	}
+
+	err := s.tenantSettingsRepository.Upsert(settings)
+	if err != nil {
+		return fmt.Errorf("failed to save tenant settings: %w", err)
+	}
+
+	return nil
+}
+
+// validateHexColor validates a #RRGGBB color
+func validateHexColor(color string) error {
+	if len(color) != 7 || color[0] != '#' {
+		return ErrInvalidColor
+	}
+
+	for _, char := range color[1:] {
+		if !((char >= '0' && char <= '9') || (char >= 'a' && char <= 'f') || (char >= 'A' && char <= 'F')) {
+			return ErrInvalidColor
+		}
+	}
+
+	return nil
+}
+
+// validateLogoURL validates that the logo is an absolute http(s) URL
+func validateLogoURL(logoURL string) error {
+	u, err := url.Parse(logoURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidLogoURL
+	}
+	return nil
+}
+
 // validateSubdomain validates the subdomain format per RFC 1034
 // Must be 1-63 characters, lowercase letters, numbers, and hyphens
 // Cannot start or end with hyphen
@@ -1,7 +1,12 @@
 package service
 
 import (
+	"errors"
 	"testing"
+
+	"github.com/google/uuid"
+
+	"dotsat.work/internal/model"
 )
 
 func TestValidateSubdomain(t *testing.T) {
@@ -40,3 +45,97 @@ func TestValidateSubdomain(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateHexColor(t *testing.T) {
+	tests := []struct {
+		name    string
+		color   string
+		wantErr bool
+	}{
+		{"default blue", "#3B82F6", false},
+		{"lowercase", "#3b82f6", false},
+		{"black", "#000000", false},
+
+		{"empty", "", true},
+		{"missing hash", "3B82F6", true},
+		{"short form", "#FFF", true},
+		{"with alpha", "#3B82F6FF", true},
+		{"non-hex", "#GGGGGG", true},
+		{"named color", "blue", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHexColor(tt.color)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateHexColor(%q) error = %v, wantErr %v", tt.color, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateLogoURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		logoURL string
+		wantErr bool
+	}{
+		{"https", "https://cdn.example.com/logo.png", false},
+		{"http", "http://example.com/logo.svg", false},
+
+		{"relative", "/logo.png", true},
+		{"javascript", "javascript:alert(1)", true},
+		{"data uri", "data:image/png;base64,AAAA", true},
+		{"no host", "https://", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLogoURL(tt.logoURL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateLogoURL(%q) error = %v, wantErr %v", tt.logoURL, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTenantService_SetSSOEnforced(t *testing.T) {
+	tenants := newFakeTenantRepository()
+	oidcRepo := newFakeOIDCRepository()
+	samlRepo := newFakeSAMLRepository()
+	s := NewTenantService(tenants, nil, oidcRepo, samlRepo)
+
+	tenant := &model.Tenant{ID: uuid.New(), Subdomain: "acme", Status: "active", Tier: "enterprise"}
+	if err := tenants.Create(tenant); err != nil {
+		t.Fatalf("Create(tenant) error = %v", err)
+	}
+
+	if err := s.SetSSOEnforced(tenant, true); !errors.Is(err, ErrSSONotConfigured) {
+		t.Errorf("SetSSOEnforced() without an identity provider error = %v, want ErrSSONotConfigured", err)
+	}
+
+	samlRepo.configs[tenant.ID] = &model.SAMLConfig{TenantID: tenant.ID, SSOAccess: model.SSOAccess{Enabled: false}}
+	if err := s.SetSSOEnforced(tenant, true); !errors.Is(err, ErrSSONotConfigured) {
+		t.Errorf("SetSSOEnforced() with a disabled identity provider error = %v, want ErrSSONotConfigured", err)
+	}
+
+	oidcRepo.configs[tenant.ID] = &model.OIDCConfig{TenantID: tenant.ID, SSOAccess: model.SSOAccess{Enabled: true}}
+	if err := s.SetSSOEnforced(tenant, true); err != nil {
+		t.Fatalf("SetSSOEnforced() error = %v", err)
+	}
+	if !tenants.tenants[tenant.ID].SSOEnforced {
+		t.Error("expected SSOEnforced to be stored")
+	}
+
+	if err := s.SetSSOEnforced(tenant, false); err != nil {
+		t.Fatalf("SetSSOEnforced(false) error = %v", err)
+	}
+	if tenants.tenants[tenant.ID].SSOEnforced {
+		t.Error("expected SSOEnforced to be cleared")
+	}
+
+	standard := &model.Tenant{ID: uuid.New(), Subdomain: "globex", Status: "active", Tier: "standard"}
+	if err := s.SetSSOEnforced(standard, true); !errors.Is(err, ErrSSONotAvailable) {
+		t.Errorf("SetSSOEnforced() on standard tier error = %v, want ErrSSONotAvailable", err)
+	}
+}
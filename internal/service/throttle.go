@@ -0,0 +1,292 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"dotsat.work/internal/mail"
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+)
+
+var ErrAccountLocked = errors.New("account is temporarily locked after too many failed sign-in attempts")
+
+const (
+	// Failed password sign-ins are counted over this window; a lockout lifts once its failures age out
+	loginFailureWindow = 30 * time.Minute
+	// After this many failures each further attempt has to wait twice as long as the previous one
+	loginFreeFailures = 3
+	loginMaxDelay     = time.Minute
+	// This many failures for an email locks the account and emails an unlock link
+	loginLockoutThreshold = 10
+	accountUnlockTTL      = time.Hour
+
+	// Many users can share an IP address, so its limits are looser and it is never locked out by email
+	ipFreeFailures   = 20
+	ipBlockThreshold = 100
+
+	// Sign-in notices explaining why a password was refused are sent at most once per window
+	signInNoticeWindow = time.Hour
+
+	// Throttle events are kept a while past the longest window above, then deleted
+	throttleEventRetention = 24 * time.Hour
+)
+
+// recipientLimit caps how often an email can be requested for one address:
+// at most once per cooldown and max times per window
+type recipientLimit struct {
+	action   string
+	cooldown time.Duration
+	window   time.Duration
+	max      int
+}
+
+var (
+	magicLinkLimit          = recipientLimit{action: model.ThrottleActionMagicLink, cooldown: time.Minute, window: time.Hour, max: 5}
+	passwordResetLimit      = recipientLimit{action: model.ThrottleActionPasswordReset, cooldown: time.Minute, window: time.Hour, max: 5}
+	verificationResendLimit = recipientLimit{action: model.ThrottleActionVerificationResend, cooldown: time.Minute, window: time.Hour, max: 5}
+)
+
+// ipLimit caps how often a client IP can perform an action: at most max times per window
+type ipLimit struct {
+	action string
+	window time.Duration
+	max    int
+}
+
+// The strength meter checks the password as it is typed, so a person filling in a form stays
+// well below this
+var passwordStrengthLimit = ipLimit{action: model.ThrottleActionPasswordStrength, window: time.Minute, max: 60}
+
+// RetryAfterError is a throttling error that tells the client how long to wait before trying again
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// checkLoginThrottle refuses a password sign-in while the email is locked out,
+// or while the email or client IP is still waiting out its progressive delay
+func (s *AuthService) checkLoginThrottle(email, ipAddress string) error {
+	since := time.Now().Add(-loginFailureWindow)
+
+	emailStats, err := s.throttleRepository.StatsByEmailSince(model.ThrottleActionLoginFailure, email, since)
+	if err != nil {
+		return fmt.Errorf("failed to count failed sign-ins: %w", err)
+	}
+	if emailStats.Count >= loginLockoutThreshold {
+		return &RetryAfterError{Err: ErrAccountLocked, RetryAfter: time.Until(emailStats.LastAt.Add(loginFailureWindow))}
+	}
+	err = checkDelay(emailStats, loginFreeFailures)
+	if err != nil {
+		return err
+	}
+
+	if ipAddress == "" {
+		return nil
+	}
+
+	ipStats, err := s.throttleRepository.StatsByIPSince(model.ThrottleActionLoginFailure, ipAddress, since)
+	if err != nil {
+		return fmt.Errorf("failed to count failed sign-ins: %w", err)
+	}
+	if ipStats.Count >= ipBlockThreshold {
+		return &RetryAfterError{Err: ErrTooManyRequests, RetryAfter: time.Until(ipStats.LastAt.Add(loginFailureWindow))}
+	}
+	return checkDelay(ipStats, ipFreeFailures)
+}
+
+// checkDelay returns ErrTooManyRequests while the delay earned by the failures in stats hasn't passed
+func checkDelay(stats *model.ThrottleStats, free int) error {
+	if stats.LastAt == nil {
+		return nil
+	}
+
+	wait := time.Until(stats.LastAt.Add(loginDelay(stats.Count, free)))
+	if wait > 0 {
+		return &RetryAfterError{Err: ErrTooManyRequests, RetryAfter: wait}
+	}
+	return nil
+}
+
+// loginDelay is the wait after the last of failures: nothing for the first free failures,
+// then one second doubling with every further failure up to loginMaxDelay
+func loginDelay(failures, free int) time.Duration {
+	if failures < free {
+		return 0
+	}
+
+	delay := time.Second
+	for i := free; i < failures && delay < loginMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, loginMaxDelay)
+}
+
+// loginFailed records a failed password sign-in and returns the error for the caller.
+// The failure that reaches the lockout threshold emails the account owner an unlock link.
+func (s *AuthService) loginFailed(user *model.User, email, ipAddress string) error {
+	err := s.throttleRepository.Record(&model.ThrottleEvent{
+		Action:    model.ThrottleActionLoginFailure,
+		Email:     email,
+		IPAddress: ipAddress,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record failed sign-in: %w", err)
+	}
+
+	if user == nil {
+		return fmt.Errorf("invalid credentials: %w", ErrInvalidCredentials)
+	}
+
+	stats, err := s.throttleRepository.StatsByEmailSince(model.ThrottleActionLoginFailure, email, time.Now().Add(-loginFailureWindow))
+	if err != nil {
+		return fmt.Errorf("failed to count failed sign-ins: %w", err)
+	}
+	if stats.Count == loginLockoutThreshold {
+		slog.Warn("account locked after failed sign-ins", "user_id", user.ID, "ip_address", ipAddress)
+		err = s.sendUnlockEmail(user)
+		if err != nil {
+			slog.Warn("failed to send account unlock email", "error", err, "user_id", user.ID)
+		}
+	}
+
+	return fmt.Errorf("invalid credentials: %w", ErrInvalidCredentials)
+}
+
+// loginFailureReason names the throttle that refused a sign-in in the security log
+func loginFailureReason(err error) string {
+	if errors.Is(err, ErrAccountLocked) {
+		return model.SecurityReasonLocked
+	}
+	return model.SecurityReasonThrottled
+}
+
+// clearLoginFailures forgets the email's failed sign-ins after a correct password or an unlock
+func (s *AuthService) clearLoginFailures(email string) {
+	err := s.throttleRepository.DeleteByEmail(model.ThrottleActionLoginFailure, email)
+	if err != nil {
+		slog.Warn("failed to clear failed sign-ins", "error", err)
+	}
+}
+
+// sendUnlockEmail issues an account unlock token and emails the link to the user
+func (s *AuthService) sendUnlockEmail(user *model.User) error {
+	err := s.tokenRepository.DeleteByUserAndType(user.ID, model.TokenTypeAccountUnlock)
+	if err != nil {
+		slog.Warn("failed to delete old account unlock tokens", "error", err, "user_id", user.ID)
+	}
+
+	unlockToken, err := s.issueToken(user.ID, model.TokenTypeAccountUnlock, accountUnlockTTL)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(mail.AccountLockedMessage(user.Email, s.link("/auth/unlock", unlockToken)))
+	if err != nil {
+		return fmt.Errorf("failed to send account unlock email: %w", err)
+	}
+	return nil
+}
+
+// UnlockAccount consumes an account unlock token and clears the failed sign-ins that locked the account
+func (s *AuthService) UnlockAccount(token string, client model.ClientInfo) error {
+	tokenModel, err := s.tokenRepository.ConsumeToken(token, model.TokenTypeAccountUnlock)
+	if err != nil {
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			s.securityEvents.AnonymousFailure(model.SecurityEventAccountUnlocked, "", client, model.SecurityReasonInvalidToken)
+			return ErrInvalidToken
+		}
+		return fmt.Errorf("failed to consume token: %w", err)
+	}
+
+	user, err := s.userRepository.ByID(tokenModel.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	err = s.throttleRepository.DeleteByEmail(model.ThrottleActionLoginFailure, user.Email)
+	if err != nil {
+		return fmt.Errorf("failed to unlock account: %w", err)
+	}
+
+	s.securityEvents.Success(model.SecurityEventAccountUnlocked, user, client)
+	slog.Info("account unlocked", "user_id", user.ID)
+	return nil
+}
+
+// checkRecipientThrottle enforces limit for an email address and records the request.
+// Requests for unknown addresses count too, so the limit doesn't reveal which accounts exist.
+func (s *AuthService) checkRecipientThrottle(limit recipientLimit, email, ipAddress string) error {
+	now := time.Now()
+	stats, err := s.throttleRepository.StatsByEmailSince(limit.action, email, now.Add(-limit.window))
+	if err != nil {
+		return fmt.Errorf("failed to count %s requests: %w", limit.action, err)
+	}
+	if stats.LastAt != nil {
+		if wait := stats.LastAt.Add(limit.cooldown).Sub(now); wait > 0 {
+			return &RetryAfterError{Err: ErrTooManyRequests, RetryAfter: wait}
+		}
+	}
+	if stats.Count >= limit.max {
+		return &RetryAfterError{Err: ErrTooManyRequests, RetryAfter: limit.cooldown}
+	}
+
+	err = s.throttleRepository.Record(&model.ThrottleEvent{
+		Action:    limit.action,
+		Email:     email,
+		IPAddress: ipAddress,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record %s request: %w", limit.action, err)
+	}
+	return nil
+}
+
+// checkIPThrottle enforces limit for a client IP and records the request.
+// Refused requests aren't recorded, so a client over the limit can't grow the table.
+func checkIPThrottle(throttleRepository repository.ThrottleRepository, limit ipLimit, ipAddress string) error {
+	stats, err := throttleRepository.StatsByIPSince(limit.action, ipAddress, time.Now().Add(-limit.window))
+	if err != nil {
+		return fmt.Errorf("failed to count %s requests: %w", limit.action, err)
+	}
+	if stats.Count >= limit.max {
+		return &RetryAfterError{Err: ErrTooManyRequests, RetryAfter: limit.window}
+	}
+
+	err = throttleRepository.Record(&model.ThrottleEvent{
+		Action:    limit.action,
+		IPAddress: ipAddress,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record %s request: %w", limit.action, err)
+	}
+	return nil
+}
+
+// CheckPasswordStrengthThrottle limits how often a client IP can have a password's strength
+// estimated, as the estimate is run for anyone filling in the signup or reset form
+func (s *AuthService) CheckPasswordStrengthThrottle(ipAddress string) error {
+	return checkIPThrottle(s.throttleRepository, passwordStrengthLimit, ipAddress)
+}
+
+// CleanupThrottleEvents deletes throttle events that have aged out of every throttling window
+func (s *AuthService) CleanupThrottleEvents() error {
+	deleted, err := s.throttleRepository.CleanupExpired(throttleEventRetention)
+	if err != nil {
+		return fmt.Errorf("failed to clean up throttle events: %w", err)
+	}
+	if deleted > 0 {
+		slog.Info("cleaned up throttle events", "deleted", deleted)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+)
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Second},
+		{failures: 4, want: 2 * time.Second},
+		{failures: 6, want: 8 * time.Second},
+		{failures: 9, want: loginMaxDelay},
+		{failures: 500, want: loginMaxDelay},
+	}
+
+	for _, tt := range tests {
+		if got := loginDelay(tt.failures, loginFreeFailures); got != tt.want {
+			t.Errorf("loginDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestAuthService_Login_ProgressiveDelay(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.addUser(t, "user@example.com", "a-long-enough-password", true)
+
+	for i := range loginFreeFailures {
+		_, err := env.service.Login("user@example.com", "wrong-password-entirely", testClient)
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: Login() error = %v, want ErrInvalidCredentials", i+1, err)
+		}
+	}
+
+	// Even the right password has to wait out the delay
+	_, err := env.service.Login("user@example.com", "a-long-enough-password", testClient)
+	var retry *RetryAfterError
+	if !errors.As(err, &retry) || !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("Login() error = %v, want ErrTooManyRequests with retry after", err)
+	}
+	if retry.RetryAfter <= 0 || retry.RetryAfter > time.Second {
+		t.Errorf("expected a wait of up to a second, got %v", retry.RetryAfter)
+	}
+
+	env.throttle.backdate(time.Second)
+	if _, err := env.service.Login("user@example.com", "a-long-enough-password", testClient); err != nil {
+		t.Fatalf("Login() after delay error = %v", err)
+	}
+
+	// A successful sign-in starts the count over
+	if _, err := env.service.Login("user@example.com", "wrong-password-entirely", testClient); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestAuthService_Login_UnknownEmailsAreThrottled(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	for range loginFreeFailures {
+		if _, err := env.service.Login("nobody@example.com", "wrong-password-entirely", testClient); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Login() error = %v, want ErrInvalidCredentials", err)
+		}
+	}
+
+	if _, err := env.service.Login("nobody@example.com", "wrong-password-entirely", testClient); !errors.Is(err, ErrTooManyRequests) {
+		t.Errorf("Login() error = %v, want ErrTooManyRequests", err)
+	}
+}
+
+func TestAuthService_Login_IPThrottle(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.addUser(t, "user@example.com", "a-long-enough-password", true)
+
+	// Spread over many emails so no single account is delayed
+	for i := range ipFreeFailures {
+		email := strings.Repeat("x", i+1) + "@example.com"
+		if _, err := env.service.Login(email, "wrong-password-entirely", testClient); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: Login() error = %v, want ErrInvalidCredentials", i+1, err)
+		}
+	}
+
+	if _, err := env.service.Login("user@example.com", "a-long-enough-password", testClient); !errors.Is(err, ErrTooManyRequests) {
+		t.Errorf("Login() error = %v, want ErrTooManyRequests", err)
+	}
+	if _, err := env.service.Login("user@example.com", "a-long-enough-password", model.ClientInfo{IPAddress: "198.51.100.7"}); err != nil {
+		t.Errorf("Login() from another IP error = %v", err)
+	}
+}
+
+func TestAuthService_Login_LockoutAndUnlock(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.addUser(t, "user@example.com", "a-long-enough-password", true)
+
+	for i := range loginLockoutThreshold {
+		// Step past the progressive delay so every attempt is checked
+		env.throttle.backdate(loginMaxDelay)
+		_, err := env.service.Login("user@example.com", "wrong-password-entirely", testClient)
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: Login() error = %v, want ErrInvalidCredentials", i+1, err)
+		}
+	}
+
+	token, msg := env.lastLinkToken(t)
+	if msg.To != "user@example.com" || !strings.Contains(msg.Text, "http://localhost:8090/auth/unlock?token=") {
+		t.Errorf("expected unlock link emailed to user@example.com, got %+v", msg)
+	}
+
+	env.throttle.backdate(loginMaxDelay)
+	_, err := env.service.Login("user@example.com", "a-long-enough-password", testClient)
+	if !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Login() error = %v, want ErrAccountLocked", err)
+	}
+
+	err = env.service.UnlockAccount(token, testClient)
+	if err != nil {
+		t.Fatalf("UnlockAccount() error = %v", err)
+	}
+	if event := env.events.last(); event == nil || event.Type != model.SecurityEventAccountUnlocked || !event.Succeeded() {
+		t.Errorf("expected the unlock to be recorded, got %+v", event)
+	}
+	if err := env.service.UnlockAccount(token, testClient); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected unlock link to be single use, got %v", err)
+	}
+
+	if _, err := env.service.Login("user@example.com", "a-long-enough-password", testClient); err != nil {
+		t.Errorf("Login() after unlock error = %v", err)
+	}
+}
+
+func TestAuthService_Login_LockoutExpires(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.addUser(t, "user@example.com", "a-long-enough-password", true)
+
+	for range loginLockoutThreshold {
+		env.throttle.backdate(loginMaxDelay)
+		_, _ = env.service.Login("user@example.com", "wrong-password-entirely", testClient)
+	}
+
+	env.throttle.backdate(loginFailureWindow)
+	if _, err := env.service.Login("user@example.com", "a-long-enough-password", testClient); err != nil {
+		t.Errorf("Login() after lockout window error = %v", err)
+	}
+}
+
+func TestAuthService_RequestPasswordReset_RateLimited(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.addUser(t, "victim@example.com", "a-long-enough-password", true)
+
+	if err := env.service.RequestPasswordReset("victim@example.com", testClient); err != nil {
+		t.Fatalf("RequestPasswordReset() error = %v", err)
+	}
+	err := env.service.RequestPasswordReset("victim@example.com", testClient)
+	var retry *RetryAfterError
+	if !errors.As(err, &retry) || !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("RequestPasswordReset() within cooldown error = %v, want RetryAfterError", err)
+	}
+
+	for i := 1; i < passwordResetLimit.max; i++ {
+		env.throttle.backdate(passwordResetLimit.cooldown)
+		if err := env.service.RequestPasswordReset("victim@example.com", testClient); err != nil {
+			t.Fatalf("request %d: RequestPasswordReset() error = %v", i+1, err)
+		}
+	}
+
+	env.throttle.backdate(passwordResetLimit.cooldown)
+	if err := env.service.RequestPasswordReset("victim@example.com", testClient); !errors.Is(err, ErrTooManyRequests) {
+		t.Errorf("RequestPasswordReset() over hourly limit error = %v, want ErrTooManyRequests", err)
+	}
+	if got := len(env.mailer.Messages()); got != passwordResetLimit.max {
+		t.Errorf("expected %d emails, got %d", passwordResetLimit.max, got)
+	}
+}
+
+func TestAuthService_CheckPasswordStrengthThrottle(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	for i := range passwordStrengthLimit.max {
+		if err := env.service.CheckPasswordStrengthThrottle(testIP); err != nil {
+			t.Fatalf("check %d: CheckPasswordStrengthThrottle() error = %v", i+1, err)
+		}
+	}
+	if err := env.service.CheckPasswordStrengthThrottle(testIP); !errors.Is(err, ErrTooManyRequests) {
+		t.Errorf("CheckPasswordStrengthThrottle() over limit error = %v, want ErrTooManyRequests", err)
+	}
+	if got := len(env.throttle.events); got != passwordStrengthLimit.max {
+		t.Errorf("expected refused checks not to be recorded, got %d events", got)
+	}
+
+	// Other clients are unaffected, and the limit lifts once the window has passed
+	if err := env.service.CheckPasswordStrengthThrottle("198.51.100.9"); err != nil {
+		t.Errorf("CheckPasswordStrengthThrottle() for another IP error = %v", err)
+	}
+	env.throttle.backdate(passwordStrengthLimit.window)
+	if err := env.service.CheckPasswordStrengthThrottle(testIP); err != nil {
+		t.Errorf("CheckPasswordStrengthThrottle() after window error = %v", err)
+	}
+}
+
+func TestAuthService_CleanupThrottleEvents(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.addUser(t, "user@example.com", "a-long-enough-password", true)
+
+	_, _ = env.service.Login("user@example.com", "wrong-password-entirely", testClient)
+	env.throttle.backdate(throttleEventRetention + time.Minute)
+	_, _ = env.service.Login("user@example.com", "wrong-password-entirely", testClient)
+
+	if err := env.service.CleanupThrottleEvents(); err != nil {
+		t.Fatalf("CleanupThrottleEvents() error = %v", err)
+	}
+	if got := len(env.throttle.events); got != 1 {
+		t.Errorf("expected only the recent event to be kept, got %d", got)
+	}
+}
+
+func TestAuthService_SendMagicLink_RateLimited(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.addUser(t, "magic@example.com", "", true)
+
+	if err := env.service.SendMagicLink("magic@example.com", testIP); err != nil {
+		t.Fatalf("SendMagicLink() error = %v", err)
+	}
+	if err := env.service.SendMagicLink("magic@example.com", testIP); !errors.Is(err, ErrTooManyRequests) {
+		t.Errorf("SendMagicLink() within cooldown error = %v, want ErrTooManyRequests", err)
+	}
+
+	for i := 1; i < magicLinkLimit.max; i++ {
+		env.throttle.backdate(magicLinkLimit.cooldown)
+		if err := env.service.SendMagicLink("magic@example.com", testIP); err != nil {
+			t.Fatalf("request %d: SendMagicLink() error = %v", i+1, err)
+		}
+	}
+
+	env.throttle.backdate(magicLinkLimit.cooldown)
+	if err := env.service.SendMagicLink("magic@example.com", testIP); !errors.Is(err, ErrTooManyRequests) {
+		t.Errorf("SendMagicLink() over hourly limit error = %v, want ErrTooManyRequests", err)
+	}
+	if got := len(env.mailer.Messages()); got != magicLinkLimit.max {
+		t.Errorf("expected %d emails, got %d", magicLinkLimit.max, got)
+	}
+}
@@ -0,0 +1,595 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"dotsat.work/internal/model"
+	"dotsat.work/internal/repository"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/google/uuid"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrNoPendingEnrollment  = errors.New("no two-factor enrollment is pending")
+	ErrInvalidTwoFactorCode = errors.New("invalid authentication code")
+	// ErrInvalidChallenge means the sign-in has to start over from the password step
+	ErrInvalidChallenge = errors.New("two-factor challenge is invalid, expired or exhausted")
+)
+
+const (
+	// TwoFactorChallengeCookie holds the challenge token between the password and code steps
+	TwoFactorChallengeCookie = "two_factor_challenge"
+
+	totpPeriod = 30
+	// Codes from one step either side of the current one are accepted to tolerate clock drift
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+	// 10 random bytes encode to 16 base32 characters (80 bits)
+	recoveryCodeBytes = 10
+
+	twoFactorChallengeTTL = 5 * time.Minute
+	maxChallengeAttempts  = 5
+
+	// Wrong codes and refused passkeys are also counted per account across challenges and
+	// settings changes, as a correct password or a session cookie can start as many of those as it likes
+	twoFactorFailureWindow = 15 * time.Minute
+	maxTwoFactorFailures   = 10
+
+	// Challenges are deleted by the maintenance job once they have been expired this long
+	twoFactorChallengeRetention = 24 * time.Hour
+)
+
+var (
+	totpOpts        = totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+	totpCodePattern = regexp.MustCompile(`^[0-9]{6}$`)
+	base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// TOTPEnrollment is what the user needs to add the account to an authenticator app
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+	// QRCode is the otpauth URI as a PNG data URI
+	QRCode string
+}
+
+// TwoFactorStatus summarises a user's second factor for the account page
+type TwoFactorStatus struct {
+	Enabled                bool
+	RecoveryCodesRemaining int
+}
+
+// TwoFactorService manages authenticator app enrollment and the sign-in challenge.
+// Once two-factor is on, a registered passkey can answer the challenge instead of a code.
+type TwoFactorService struct {
+	twoFactorRepository repository.TwoFactorRepository
+	userRepository      repository.UserRepository
+	throttleRepository  repository.ThrottleRepository
+	passkeyService      *PasskeyService
+	securityEvents      *SecurityEventService
+	issuer              string
+	isProduction        bool
+}
+
+func NewTwoFactorService(
+	twoFactorRepository repository.TwoFactorRepository,
+	userRepository repository.UserRepository,
+	throttleRepository repository.ThrottleRepository,
+	passkeyService *PasskeyService,
+	securityEvents *SecurityEventService,
+	issuer string,
+	isProduction bool,
+) *TwoFactorService {
+	return &TwoFactorService{
+		twoFactorRepository: twoFactorRepository,
+		userRepository:      userRepository,
+		throttleRepository:  throttleRepository,
+		passkeyService:      passkeyService,
+		securityEvents:      securityEvents,
+		issuer:              issuer,
+		isProduction:        isProduction,
+	}
+}
+
+// Enabled reports whether the user has to pass a second factor to sign in
+func (s *TwoFactorService) Enabled(userID uuid.UUID) (bool, error) {
+	credential, err := s.twoFactorRepository.TOTPByUserID(userID)
+	if errors.Is(err, repository.ErrTOTPNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get totp credential: %w", err)
+	}
+	return credential.IsConfirmed(), nil
+}
+
+// Status returns whether two-factor is enabled and how many recovery codes are left
+func (s *TwoFactorService) Status(userID uuid.UUID) (*TwoFactorStatus, error) {
+	enabled, err := s.Enabled(userID)
+	if err != nil || !enabled {
+		return &TwoFactorStatus{}, err
+	}
+
+	remaining, err := s.twoFactorRepository.CountUnusedRecoveryCodes(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return &TwoFactorStatus{Enabled: true, RecoveryCodesRemaining: remaining}, nil
+}
+
+// BeginEnrollment generates a new TOTP secret for the user. It only takes effect
+// once ConfirmEnrollment proves the authenticator app produces matching codes.
+func (s *TwoFactorService) BeginEnrollment(user *model.User) (*TOTPEnrollment, error) {
+	enabled, err := s.Enabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.issuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+
+	err = s.twoFactorRepository.UpsertTOTP(&model.TOTPCredential{
+		UserID: user.ID,
+		Secret: key.Secret(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store totp secret: %w", err)
+	}
+
+	return newTOTPEnrollment(key)
+}
+
+// PendingEnrollment rebuilds the enrollment details for a secret that has not been confirmed yet
+func (s *TwoFactorService) PendingEnrollment(user *model.User) (*TOTPEnrollment, error) {
+	credential, err := s.pendingCredential(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := base32NoPadding.DecodeString(credential.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode totp secret: %w", err)
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.issuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Secret:      secret,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build totp key: %w", err)
+	}
+
+	return newTOTPEnrollment(key)
+}
+
+// ConfirmEnrollment enables two-factor authentication once the user enters a valid code
+// from their authenticator app, and returns the first set of recovery codes
+func (s *TwoFactorService) ConfirmEnrollment(userID uuid.UUID, code string) ([]string, error) {
+	credential, err := s.pendingCredential(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.verifyTOTP(credential, normalizeTwoFactorCode(code))
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.twoFactorRepository.ConfirmTOTP(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm totp: %w", err)
+	}
+
+	codes, err := s.replaceRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("two-factor authentication enabled", "user_id", userID)
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes invalidates all existing recovery codes and returns new ones.
+// A current authenticator or recovery code is required.
+func (s *TwoFactorService) RegenerateRecoveryCodes(userID uuid.UUID, code string) ([]string, error) {
+	err := s.VerifyCode(userID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("recovery codes regenerated", "user_id", userID)
+	return codes, nil
+}
+
+// Disable removes the authenticator and recovery codes.
+// A current authenticator or recovery code is required.
+func (s *TwoFactorService) Disable(userID uuid.UUID, code string) error {
+	err := s.VerifyCode(userID, code)
+	if err != nil {
+		return err
+	}
+
+	err = s.twoFactorRepository.DeleteTOTP(userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete totp credential: %w", err)
+	}
+
+	slog.Info("two-factor authentication disabled", "user_id", userID)
+	return nil
+}
+
+// VerifyCode checks a six-digit authenticator code or, failing that format, a recovery code.
+// Accepted codes can't be used again, and wrong codes count towards maxTwoFactorFailures.
+func (s *TwoFactorService) VerifyCode(userID uuid.UUID, code string) error {
+	return s.limitFailures(userID, "", func() error {
+		return s.verifyCode(userID, code)
+	})
+}
+
+func (s *TwoFactorService) verifyCode(userID uuid.UUID, code string) error {
+	credential, err := s.twoFactorRepository.TOTPByUserID(userID)
+	if errors.Is(err, repository.ErrTOTPNotFound) {
+		return ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get totp credential: %w", err)
+	}
+	if !credential.IsConfirmed() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = normalizeTwoFactorCode(code)
+	if totpCodePattern.MatchString(code) {
+		return s.verifyTOTP(credential, code)
+	}
+	return s.useRecoveryCode(userID, code)
+}
+
+// BeginChallenge records that the user passed the first factor and returns the
+// token that lets them continue to the second
+func (s *TwoFactorService) BeginChallenge(userID uuid.UUID) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate challenge token: %w", err)
+	}
+
+	err = s.twoFactorRepository.CreateChallenge(&model.TwoFactorChallenge{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(twoFactorChallengeTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create two-factor challenge: %w", err)
+	}
+
+	return token, nil
+}
+
+// CompleteChallenge verifies the second factor for a pending sign-in and returns the user
+// to start a session for. Each challenge allows maxChallengeAttempts codes and succeeds once.
+func (s *TwoFactorService) CompleteChallenge(token, code string, client model.ClientInfo) (*model.User, error) {
+	return s.completeChallenge(token, client, model.SecurityReasonInvalidCode, func(userID uuid.UUID) error {
+		return s.verifyCode(userID, code)
+	})
+}
+
+// ChallengeOffersPasskey reports whether the pending sign-in can be completed with a passkey
+func (s *TwoFactorService) ChallengeOffersPasskey(token string) bool {
+	challenge, err := s.activeChallenge(token)
+	if err != nil {
+		return false
+	}
+	hasPasskeys, err := s.passkeyService.HasPasskeys(challenge.UserID)
+	return err == nil && hasPasskeys
+}
+
+// BeginPasskeyChallenge returns assertion options for the user of a pending sign-in
+// and the ceremony token to send back with the response
+func (s *TwoFactorService) BeginPasskeyChallenge(token string) (*protocol.CredentialAssertion, string, error) {
+	challenge, err := s.activeChallenge(token)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.passkeyService.BeginSecondFactor(challenge.UserID)
+}
+
+// CompletePasskeyChallenge is CompleteChallenge with a passkey assertion instead of a code.
+// A failed assertion counts as an attempt.
+func (s *TwoFactorService) CompletePasskeyChallenge(token, ceremonyToken string, response io.Reader, client model.ClientInfo) (*model.User, error) {
+	return s.completeChallenge(token, client, model.SecurityReasonInvalidPasskey, func(userID uuid.UUID) error {
+		return s.passkeyService.VerifySecondFactor(userID, ceremonyToken, response)
+	})
+}
+
+// completeChallenge counts an attempt against the challenge, runs verify for its user and
+// consumes the challenge if verify succeeds. This is where a sign-in with two-factor
+// completes, so the outcome is recorded in the security event log; a refused second factor
+// is recorded with failureReason.
+func (s *TwoFactorService) completeChallenge(token string, client model.ClientInfo, failureReason string, verify func(userID uuid.UUID) error) (*model.User, error) {
+	challenge, err := s.activeChallenge(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepository.ByID(challenge.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	attempts, err := s.twoFactorRepository.IncrementChallengeAttempts(challenge.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count two-factor attempt: %w", err)
+	}
+	if attempts > maxChallengeAttempts {
+		slog.Warn("two-factor challenge exhausted", "user_id", challenge.UserID)
+		s.securityEvents.Failure(model.SecurityEventTwoFactor, user, "", client, model.SecurityReasonThrottled)
+		return nil, ErrInvalidChallenge
+	}
+
+	err = s.limitFailures(challenge.UserID, client.IPAddress, func() error {
+		return verify(challenge.UserID)
+	})
+	if errors.Is(err, ErrTooManyRequests) {
+		slog.Warn("two-factor attempts throttled", "user_id", challenge.UserID)
+		s.securityEvents.Failure(model.SecurityEventTwoFactor, user, "", client, model.SecurityReasonThrottled)
+		return nil, err
+	}
+	if errors.Is(err, ErrInvalidTwoFactorCode) || errors.Is(err, ErrPasskeyVerification) || errors.Is(err, ErrInvalidCeremony) {
+		s.securityEvents.Failure(model.SecurityEventTwoFactor, user, "", client, failureReason)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.twoFactorRepository.ConsumeChallenge(challenge.ID)
+	if errors.Is(err, repository.ErrChallengeNotFound) {
+		return nil, ErrInvalidChallenge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume two-factor challenge: %w", err)
+	}
+
+	s.securityEvents.Success(model.SecurityEventTwoFactor, user, client)
+	return user, nil
+}
+
+// limitFailures runs verify unless the user has had maxTwoFactorFailures wrong second factors
+// within twoFactorFailureWindow, and counts a wrong code or refused passkey towards that limit
+func (s *TwoFactorService) limitFailures(userID uuid.UUID, ipAddress string, verify func() error) error {
+	stats, err := s.throttleRepository.StatsByUserSince(model.ThrottleActionTwoFactorFailure, userID, time.Now().Add(-twoFactorFailureWindow))
+	if err != nil {
+		return fmt.Errorf("failed to count failed two-factor attempts: %w", err)
+	}
+	if stats.Count >= maxTwoFactorFailures {
+		return &RetryAfterError{Err: ErrTooManyRequests, RetryAfter: time.Until(stats.LastAt.Add(twoFactorFailureWindow))}
+	}
+
+	err = verify()
+	if errors.Is(err, ErrInvalidTwoFactorCode) || errors.Is(err, ErrPasskeyVerification) {
+		recordErr := s.throttleRepository.Record(&model.ThrottleEvent{
+			Action:    model.ThrottleActionTwoFactorFailure,
+			IPAddress: ipAddress,
+			UserID:    &userID,
+		})
+		if recordErr != nil {
+			return fmt.Errorf("failed to record failed two-factor attempt: %w", recordErr)
+		}
+	}
+	return err
+}
+
+// CleanupChallenges deletes sign-in challenges that expired more than a day ago
+func (s *TwoFactorService) CleanupChallenges() error {
+	deleted, err := s.twoFactorRepository.CleanupExpiredChallenges(twoFactorChallengeRetention)
+	if err != nil {
+		return fmt.Errorf("failed to clean up two-factor challenges: %w", err)
+	}
+	if deleted > 0 {
+		slog.Info("cleaned up two-factor challenges", "deleted", deleted)
+	}
+	return nil
+}
+
+func (s *TwoFactorService) activeChallenge(token string) (*model.TwoFactorChallenge, error) {
+	if token == "" {
+		return nil, ErrInvalidChallenge
+	}
+
+	challenge, err := s.twoFactorRepository.ActiveChallengeByHash(hashToken(token))
+	if errors.Is(err, repository.ErrChallengeNotFound) {
+		return nil, ErrInvalidChallenge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get two-factor challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// SetChallengeCookie stores the challenge token for the second sign-in step
+func (s *TwoFactorService) SetChallengeCookie(w http.ResponseWriter, token string) {
+	s.setChallengeCookie(w, token, time.Now().Add(twoFactorChallengeTTL))
+}
+
+// ClearChallengeCookie removes the challenge token once the sign-in is finished or abandoned
+func (s *TwoFactorService) ClearChallengeCookie(w http.ResponseWriter) {
+	s.setChallengeCookie(w, "", time.Unix(0, 0))
+}
+
+func (s *TwoFactorService) setChallengeCookie(w http.ResponseWriter, value string, expiry time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     TwoFactorChallengeCookie,
+		Value:    value,
+		Expires:  expiry,
+		Path:     "/auth/2fa",
+		HttpOnly: true,
+		Secure:   s.isProduction,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// pendingCredential returns the user's unconfirmed TOTP secret
+func (s *TwoFactorService) pendingCredential(userID uuid.UUID) (*model.TOTPCredential, error) {
+	credential, err := s.twoFactorRepository.TOTPByUserID(userID)
+	if errors.Is(err, repository.ErrTOTPNotFound) {
+		return nil, ErrNoPendingEnrollment
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get totp credential: %w", err)
+	}
+	if credential.IsConfirmed() {
+		return nil, ErrTwoFactorEnabled
+	}
+	return credential, nil
+}
+
+// verifyTOTP accepts a code for the current time step or one step either side,
+// then records the step so the same code (or an older one) is rejected afterwards
+func (s *TwoFactorService) verifyTOTP(credential *model.TOTPCredential, code string) error {
+	current := time.Now().Unix() / totpPeriod
+
+	for _, offset := range []int64{0, -totpSkew, totpSkew} {
+		step := current + offset
+		expected, err := totp.GenerateCodeCustom(credential.Secret, time.Unix(step*totpPeriod, 0), totpOpts)
+		if err != nil {
+			return fmt.Errorf("failed to generate totp code: %w", err)
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+
+		err = s.twoFactorRepository.MarkTOTPStepUsed(credential.UserID, step)
+		if errors.Is(err, repository.ErrTOTPStepUsed) {
+			slog.Warn("totp code replayed", "user_id", credential.UserID)
+			return ErrInvalidTwoFactorCode
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record totp step: %w", err)
+		}
+		return nil
+	}
+
+	return ErrInvalidTwoFactorCode
+}
+
+// useRecoveryCode consumes a single-use recovery code
+func (s *TwoFactorService) useRecoveryCode(userID uuid.UUID, code string) error {
+	if code == "" {
+		return ErrInvalidTwoFactorCode
+	}
+
+	err := s.twoFactorRepository.ConsumeRecoveryCode(userID, hashToken(code))
+	if errors.Is(err, repository.ErrRecoveryCodeNotFound) {
+		return ErrInvalidTwoFactorCode
+	}
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	slog.Info("recovery code used", "user_id", userID)
+	return nil
+}
+
+// replaceRecoveryCodes generates a new set of recovery codes and stores their hashes
+func (s *TwoFactorService) replaceRecoveryCodes(userID uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		codes[i] = code
+		hashes[i] = hashToken(normalizeTwoFactorCode(code))
+	}
+
+	err := s.twoFactorRepository.ReplaceRecoveryCodes(userID, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// newTOTPEnrollment renders the key's otpauth URI as a QR code
+func newTOTPEnrollment(key *otp.Key) (*TOTPEnrollment, error) {
+	img, err := key.Image(240, 240)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render qr code: %w", err)
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode qr code: %w", err)
+	}
+
+	return &TOTPEnrollment{
+		Secret: key.Secret(),
+		URI:    key.URL(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// generateRecoveryCode returns a random code formatted for reading, e.g. abcd-efgh-ijkl-mnop
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	raw := strings.ToLower(base32NoPadding.EncodeToString(b))
+	groups := make([]string, 0, len(raw)/4)
+	for i := 0; i < len(raw); i += 4 {
+		groups = append(groups, raw[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// normalizeTwoFactorCode strips the separators and spacing users tend to type or paste
+func normalizeTwoFactorCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,393 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pquerna/otp/totp"
+
+	"dotsat.work/internal/model"
+)
+
+type twoFactorTestEnv struct {
+	users     *fakeUserRepository
+	twoFactor *fakeTwoFactorRepository
+	throttle  *fakeThrottleRepository
+	events    *fakeSecurityEventRepository
+	service   *TwoFactorService
+}
+
+func newTwoFactorTestEnv() *twoFactorTestEnv {
+	env := &twoFactorTestEnv{
+		users:     newFakeUserRepository(),
+		twoFactor: newFakeTwoFactorRepository(),
+		throttle:  &fakeThrottleRepository{},
+		events:    &fakeSecurityEventRepository{},
+	}
+	events := NewSecurityEventService(env.events, &fakeThrottleRepository{}, 24*time.Hour)
+	env.service = NewTwoFactorService(env.twoFactor, env.users, env.throttle, nil, events, "dotsat.work", false)
+	return env
+}
+
+func (env *twoFactorTestEnv) addUser(t *testing.T) *model.User {
+	t.Helper()
+
+	user := &model.User{ID: uuid.New(), TenantID: uuid.New(), Email: "alice@example.com", Role: "user"}
+	if err := env.users.Create(user); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return user
+}
+
+// enableTOTP enrolls the user without using up a time step, and returns the secret
+func (env *twoFactorTestEnv) enableTOTP(t *testing.T, user *model.User) string {
+	t.Helper()
+
+	enrollment, err := env.service.BeginEnrollment(user)
+	if err != nil {
+		t.Fatalf("BeginEnrollment() error = %v", err)
+	}
+	if err := env.twoFactor.ConfirmTOTP(user.ID); err != nil {
+		t.Fatalf("ConfirmTOTP() error = %v", err)
+	}
+	return enrollment.Secret
+}
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	code, err := totp.GenerateCode(secret, at)
+	if err != nil {
+		t.Fatalf("GenerateCode() error = %v", err)
+	}
+	return code
+}
+
+func TestTwoFactorService_Enrollment(t *testing.T) {
+	env := newTwoFactorTestEnv()
+	user := env.addUser(t)
+
+	enrollment, err := env.service.BeginEnrollment(user)
+	if err != nil {
+		t.Fatalf("BeginEnrollment() error = %v", err)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/dotsat.work:alice@example.com?") {
+		t.Errorf("expected otpauth URI for the user, got %q", enrollment.URI)
+	}
+	if !strings.HasPrefix(enrollment.QRCode, "data:image/png;base64,") {
+		t.Errorf("expected PNG data URI, got %.40q", enrollment.QRCode)
+	}
+
+	enabled, _ := env.service.Enabled(user.ID)
+	if enabled {
+		t.Error("expected 2FA to stay disabled until the enrollment is confirmed")
+	}
+
+	pending, err := env.service.PendingEnrollment(user)
+	if err != nil {
+		t.Fatalf("PendingEnrollment() error = %v", err)
+	}
+	if pending.Secret != enrollment.Secret || pending.URI != enrollment.URI {
+		t.Errorf("expected pending enrollment to match, got %q", pending.URI)
+	}
+
+	_, err = env.service.ConfirmEnrollment(user.ID, "000000")
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("expected ErrInvalidTwoFactorCode, got %v", err)
+	}
+
+	codes, err := env.service.ConfirmEnrollment(user.ID, totpCode(t, enrollment.Secret, time.Now()))
+	if err != nil {
+		t.Fatalf("ConfirmEnrollment() error = %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 19 || seen[code] {
+			t.Errorf("expected unique codes like abcd-efgh-ijkl-mnop, got %q", code)
+		}
+		seen[code] = true
+	}
+
+	enabled, _ = env.service.Enabled(user.ID)
+	if !enabled {
+		t.Error("expected 2FA to be enabled")
+	}
+
+	_, err = env.service.BeginEnrollment(user)
+	if !errors.Is(err, ErrTwoFactorEnabled) {
+		t.Errorf("expected ErrTwoFactorEnabled, got %v", err)
+	}
+}
+
+func TestTwoFactorService_VerifyCode_ClockSkew(t *testing.T) {
+	tests := []struct {
+		name    string
+		offset  time.Duration
+		wantErr error
+	}{
+		{name: "current step", offset: 0},
+		{name: "one step behind", offset: -totpPeriod * time.Second},
+		{name: "one step ahead", offset: totpPeriod * time.Second},
+		{name: "three steps behind", offset: -3 * totpPeriod * time.Second, wantErr: ErrInvalidTwoFactorCode},
+		{name: "three steps ahead", offset: 3 * totpPeriod * time.Second, wantErr: ErrInvalidTwoFactorCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTwoFactorTestEnv()
+			user := env.addUser(t)
+			secret := env.enableTOTP(t, user)
+
+			err := env.service.VerifyCode(user.ID, totpCode(t, secret, time.Now().Add(tt.offset)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTwoFactorService_VerifyCode_Replay(t *testing.T) {
+	env := newTwoFactorTestEnv()
+	user := env.addUser(t)
+	secret := env.enableTOTP(t, user)
+
+	code := totpCode(t, secret, time.Now())
+	if err := env.service.VerifyCode(user.ID, code); err != nil {
+		t.Fatalf("VerifyCode() error = %v", err)
+	}
+
+	err := env.service.VerifyCode(user.ID, code)
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("expected replayed code to be rejected, got %v", err)
+	}
+
+	// An older code that is still inside the skew window must not work either
+	err = env.service.VerifyCode(user.ID, totpCode(t, secret, time.Now().Add(-totpPeriod*time.Second)))
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("expected earlier code to be rejected, got %v", err)
+	}
+}
+
+func TestTwoFactorService_RecoveryCodes(t *testing.T) {
+	env := newTwoFactorTestEnv()
+	user := env.addUser(t)
+	secret := env.enableTOTP(t, user)
+
+	codes, err := env.service.RegenerateRecoveryCodes(user.ID, totpCode(t, secret, time.Now()))
+	if err != nil {
+		t.Fatalf("RegenerateRecoveryCodes() error = %v", err)
+	}
+
+	// Codes are accepted regardless of case, spacing and dashes, but only once
+	typed := " " + strings.ToUpper(strings.ReplaceAll(codes[0], "-", " ")) + " "
+	if err := env.service.VerifyCode(user.ID, typed); err != nil {
+		t.Fatalf("VerifyCode(recovery code) error = %v", err)
+	}
+	err = env.service.VerifyCode(user.ID, codes[0])
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("expected used recovery code to be rejected, got %v", err)
+	}
+
+	status, err := env.service.Status(user.ID)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if !status.Enabled || status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Errorf("expected %d remaining codes, got %+v", recoveryCodeCount-1, status)
+	}
+
+	// Regenerating invalidates the previous set
+	newCodes, err := env.service.RegenerateRecoveryCodes(user.ID, codes[1])
+	if err != nil {
+		t.Fatalf("RegenerateRecoveryCodes() error = %v", err)
+	}
+	err = env.service.VerifyCode(user.ID, codes[2])
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("expected old recovery code to be rejected, got %v", err)
+	}
+	if err := env.service.VerifyCode(user.ID, newCodes[0]); err != nil {
+		t.Errorf("expected new recovery code to work, got %v", err)
+	}
+}
+
+func TestTwoFactorService_Challenge(t *testing.T) {
+	env := newTwoFactorTestEnv()
+	user := env.addUser(t)
+	secret := env.enableTOTP(t, user)
+
+	token, err := env.service.BeginChallenge(user.ID)
+	if err != nil {
+		t.Fatalf("BeginChallenge() error = %v", err)
+	}
+
+	_, err = env.service.CompleteChallenge(token, "000000", testClient)
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("expected ErrInvalidTwoFactorCode, got %v", err)
+	}
+
+	got, err := env.service.CompleteChallenge(token, totpCode(t, secret, time.Now()), testClient)
+	if err != nil {
+		t.Fatalf("CompleteChallenge() error = %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("expected user %s, got %s", user.ID, got.ID)
+	}
+
+	// The wrong code and the completed sign-in are both recorded
+	if len(env.events.events) != 2 {
+		t.Fatalf("expected 2 security events, got %+v", env.events.events)
+	}
+	if failed := env.events.events[0]; failed.Type != model.SecurityEventTwoFactor || failed.Succeeded() || failed.Reason != model.SecurityReasonInvalidCode {
+		t.Errorf("expected a failed two-factor event, got %+v", failed)
+	}
+	if passed := env.events.last(); passed.Type != model.SecurityEventTwoFactor || !passed.Succeeded() || *passed.ActorID != user.ID {
+		t.Errorf("expected a successful two-factor event for the user, got %+v", passed)
+	}
+
+	_, err = env.service.CompleteChallenge(token, totpCode(t, secret, time.Now().Add(totpPeriod*time.Second)), testClient)
+	if !errors.Is(err, ErrInvalidChallenge) {
+		t.Errorf("expected completed challenge to be rejected, got %v", err)
+	}
+
+	_, err = env.service.CompleteChallenge("", "123456", testClient)
+	if !errors.Is(err, ErrInvalidChallenge) {
+		t.Errorf("expected missing challenge to be rejected, got %v", err)
+	}
+}
+
+func TestTwoFactorService_Challenge_AttemptLimit(t *testing.T) {
+	env := newTwoFactorTestEnv()
+	user := env.addUser(t)
+	secret := env.enableTOTP(t, user)
+
+	token, err := env.service.BeginChallenge(user.ID)
+	if err != nil {
+		t.Fatalf("BeginChallenge() error = %v", err)
+	}
+
+	for i := 0; i < maxChallengeAttempts; i++ {
+		_, err = env.service.CompleteChallenge(token, "000000", testClient)
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("attempt %d: expected ErrInvalidTwoFactorCode, got %v", i+1, err)
+		}
+	}
+
+	_, err = env.service.CompleteChallenge(token, totpCode(t, secret, time.Now()), testClient)
+	if !errors.Is(err, ErrInvalidChallenge) {
+		t.Errorf("expected exhausted challenge to be rejected even with a valid code, got %v", err)
+	}
+	if event := env.events.last(); event == nil || event.Succeeded() || event.Reason != model.SecurityReasonThrottled {
+		t.Errorf("expected the exhausted challenge to be recorded, got %+v", event)
+	}
+}
+
+func TestTwoFactorService_Challenge_FailureLimitAcrossChallenges(t *testing.T) {
+	env := newTwoFactorTestEnv()
+	user := env.addUser(t)
+	secret := env.enableTOTP(t, user)
+
+	// A correct password can start a fresh challenge whenever the last one is used up
+	var token string
+	for i := 0; i < maxTwoFactorFailures; i++ {
+		if i%maxChallengeAttempts == 0 {
+			var err error
+			token, err = env.service.BeginChallenge(user.ID)
+			if err != nil {
+				t.Fatalf("BeginChallenge() error = %v", err)
+			}
+		}
+		_, err := env.service.CompleteChallenge(token, "000000", testClient)
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("attempt %d: expected ErrInvalidTwoFactorCode, got %v", i+1, err)
+		}
+	}
+
+	token, err := env.service.BeginChallenge(user.ID)
+	if err != nil {
+		t.Fatalf("BeginChallenge() error = %v", err)
+	}
+	_, err = env.service.CompleteChallenge(token, totpCode(t, secret, time.Now()), testClient)
+	if !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("expected ErrTooManyRequests once the account's failures add up, got %v", err)
+	}
+	if event := env.events.last(); event == nil || event.Succeeded() || event.Reason != model.SecurityReasonThrottled {
+		t.Errorf("expected the throttled attempt to be recorded, got %+v", event)
+	}
+
+	env.throttle.backdate(twoFactorFailureWindow)
+	if _, err := env.service.CompleteChallenge(token, totpCode(t, secret, time.Now()), testClient); err != nil {
+		t.Errorf("expected the challenge to work once the failures aged out, got %v", err)
+	}
+}
+
+func TestTwoFactorService_Disable_FailureLimit(t *testing.T) {
+	env := newTwoFactorTestEnv()
+	user := env.addUser(t)
+	secret := env.enableTOTP(t, user)
+
+	for i := 0; i < maxTwoFactorFailures; i++ {
+		err := env.service.Disable(user.ID, "000000")
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("attempt %d: expected ErrInvalidTwoFactorCode, got %v", i+1, err)
+		}
+	}
+
+	err := env.service.Disable(user.ID, totpCode(t, secret, time.Now()))
+	if !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("expected ErrTooManyRequests, got %v", err)
+	}
+	if enabled, _ := env.service.Enabled(user.ID); !enabled {
+		t.Error("expected 2FA to stay enabled")
+	}
+}
+
+func TestTwoFactorService_CleanupChallenges(t *testing.T) {
+	env := newTwoFactorTestEnv()
+	user := env.addUser(t)
+
+	if _, err := env.service.BeginChallenge(user.ID); err != nil {
+		t.Fatalf("BeginChallenge() error = %v", err)
+	}
+	expired := &model.TwoFactorChallenge{UserID: user.ID, TokenHash: "expired", ExpiresAt: time.Now().Add(-2 * twoFactorChallengeRetention)}
+	if err := env.twoFactor.CreateChallenge(expired); err != nil {
+		t.Fatalf("CreateChallenge() error = %v", err)
+	}
+
+	if err := env.service.CleanupChallenges(); err != nil {
+		t.Fatalf("CleanupChallenges() error = %v", err)
+	}
+	if len(env.twoFactor.challenges) != 1 {
+		t.Errorf("expected only the active challenge to be kept, got %d", len(env.twoFactor.challenges))
+	}
+}
+
+func TestTwoFactorService_Disable(t *testing.T) {
+	env := newTwoFactorTestEnv()
+	user := env.addUser(t)
+	secret := env.enableTOTP(t, user)
+
+	err := env.service.Disable(user.ID, "000000")
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("expected ErrInvalidTwoFactorCode, got %v", err)
+	}
+
+	err = env.service.Disable(user.ID, totpCode(t, secret, time.Now()))
+	if err != nil {
+		t.Fatalf("Disable() error = %v", err)
+	}
+
+	enabled, _ := env.service.Enabled(user.ID)
+	if enabled {
+		t.Error("expected 2FA to be disabled")
+	}
+	err = env.service.VerifyCode(user.ID, "123456")
+	if !errors.Is(err, ErrTwoFactorNotEnabled) {
+		t.Errorf("expected ErrTwoFactorNotEnabled, got %v", err)
+	}
+}
@@ -10,21 +10,36 @@ import (
 	"dotsat.work/internal/repository"
 	"dotsat.work/internal/validation"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrInvalidRole            = errors.New("invalid role: must be 'admin', 'user', or 'viewer'")
 	ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+	ErrNoCurrentPassword      = errors.New("passwordless accounts cannot update password")
+	ErrEmailChangeNotAllowed  = errors.New("email can only be changed by confirming the new address")
 )
 
 type UserService struct {
-	userRepository repository.UserRepository
+	userRepository    repository.UserRepository
+	sessionRepository repository.SessionRepository
+	passwordHasher    *PasswordHasher
+	passwordPolicy    *PasswordPolicyService
+	securityEvents    *SecurityEventService
 }
 
-func NewUserService(userRepository repository.UserRepository) *UserService {
+func NewUserService(
+	userRepository repository.UserRepository,
+	sessionRepository repository.SessionRepository,
+	passwordHasher *PasswordHasher,
+	passwordPolicy *PasswordPolicyService,
+	securityEvents *SecurityEventService,
+) *UserService {
 	return &UserService{
-		userRepository: userRepository,
+		userRepository:    userRepository,
+		sessionRepository: sessionRepository,
+		passwordHasher:    passwordHasher,
+		passwordPolicy:    passwordPolicy,
+		securityEvents:    securityEvents,
 	}
 }
 
@@ -44,16 +59,15 @@ func (s *UserService) Create(tenantID uuid.UUID, email, password, role string) (
 	// Hash password (if provided)
 	var passwordHash *string
 	if password != "" {
-		if err := validation.ValidatePassword(password); err != nil {
+		if err := s.passwordPolicy.Validate(tenantID, password, validation.PasswordContext{Email: email}); err != nil {
 			return nil, err
 		}
 
-		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		hash, err := s.passwordHasher.Hash(password)
 		if err != nil {
 			return nil, fmt.Errorf("failed to hash password: %w", err)
 		}
-		hashStr := string(hash)
-		passwordHash = &hashStr
+		passwordHash = &hash
 	}
 
 	// Create user
@@ -94,14 +108,19 @@ func (s *UserService) ByTenantID(tenantID uuid.UUID) ([]*model.User, error) {
 	return s.userRepository.ByTenantID(tenantID)
 }
 
-// Update updates a user
+// Update updates a user.
+// The email cannot be changed here; use AuthService.RequestEmailChange instead.
 func (s *UserService) Update(user *model.User) error {
-	// Validate email
-	user.Email = strings.ToLower(strings.TrimSpace(user.Email))
-	if err := validation.ValidateEmail(user.Email); err != nil {
-		return err
+	existing, err := s.userRepository.ByID(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
 	}
 
+	if !strings.EqualFold(strings.TrimSpace(user.Email), existing.Email) {
+		return ErrEmailChangeNotAllowed
+	}
+	user.Email = existing.Email
+
 	// Validate role
 	if !isValidRole(user.Role) {
 		return ErrInvalidRole
@@ -109,19 +128,17 @@ func (s *UserService) Update(user *model.User) error {
 
 	user.UpdatedAt = time.Now()
 
-	err := s.userRepository.Update(user)
+	err = s.userRepository.Update(user)
 	if err != nil {
-		if errors.Is(err, repository.ErrDuplicateEmail) {
-			return fmt.Errorf("email %q is already registered", user.Email)
-		}
 		return fmt.Errorf("failed to update user: %w", err)
 	}
 
 	return nil
 }
 
-// UpdatePassword updates a user's password
-func (s *UserService) UpdatePassword(userID uuid.UUID, currentPassword, newPassword string) error {
+// UpdatePassword updates a user's password and signs out all of their sessions,
+// including the current one; callers that want to stay signed in start a new session
+func (s *UserService) UpdatePassword(userID uuid.UUID, currentPassword, newPassword string, client model.ClientInfo) error {
 	user, err := s.userRepository.ByID(userID)
 	if err != nil {
 		return fmt.Errorf("failed to get user: %w", err)
@@ -129,34 +146,50 @@ func (s *UserService) UpdatePassword(userID uuid.UUID, currentPassword, newPassw
 
 	// Check if the user has a password
 	if user.PasswordHash == nil {
-		return fmt.Errorf("passwordless accounts cannot update password")
+		return ErrNoCurrentPassword
 	}
 
 	// Verify the current password
-	err = bcrypt.CompareHashAndPassword([]byte(*user.PasswordHash), []byte(currentPassword))
-	if err != nil {
+	_, err = s.passwordHasher.Verify(currentPassword, *user.PasswordHash)
+	if errors.Is(err, ErrPasswordMismatch) {
+		s.securityEvents.Failure(model.SecurityEventPasswordChanged, user, "", client, model.SecurityReasonInvalidPassword)
 		return ErrInvalidCurrentPassword
 	}
+	if err != nil {
+		return fmt.Errorf("failed to verify password: %w", err)
+	}
 
 	// Validate new password
-	if err := validation.ValidatePassword(newPassword); err != nil {
+	if err := s.passwordPolicy.ValidateChange(user, newPassword); err != nil {
+		return err
+	}
+
+	if err := s.passwordPolicy.Remember(user); err != nil {
 		return err
 	}
 
 	// Hash new password
-	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hash, err := s.passwordHasher.Hash(newPassword)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	hashStr := string(hash)
-	user.PasswordHash = &hashStr
+	now := time.Now()
+	user.PasswordHash = &hash
+	user.PasswordChangedAt = &now
+	user.UpdatedAt = now
 
 	err = s.userRepository.Update(user)
 	if err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
 	}
 
+	err = s.sessionRepository.RevokeAllByUserID(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	s.securityEvents.Success(model.SecurityEventPasswordChanged, user, client)
 	return nil
 }
 
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dotsat.work/internal/model"
+)
+
+func TestUserService_UpdatePassword(t *testing.T) {
+	env := newAuthTestEnv(t)
+	user := env.addUser(t, "change@example.com", "a-long-enough-password", true)
+	passwordless := env.addUser(t, "passwordless@example.com", "", true)
+	users := NewUserService(env.users, env.sessions, testPasswordHasher(), env.policy, NewSecurityEventService(env.events, env.throttle, 24*time.Hour))
+
+	mustStartSession(t, env.service, user)
+	mustStartSession(t, env.service, user)
+
+	err := users.UpdatePassword(user.ID, "not-the-current-password", "another-long-enough-password", testClient)
+	if !errors.Is(err, ErrInvalidCurrentPassword) {
+		t.Fatalf("expected ErrInvalidCurrentPassword, got %v", err)
+	}
+	for _, session := range env.sessions.sessions {
+		if session.RevokedAt != nil {
+			t.Fatal("expected a wrong current password to leave the sessions alone")
+		}
+	}
+	if event := env.events.last(); event == nil || event.Type != model.SecurityEventPasswordChanged || event.Succeeded() {
+		t.Errorf("expected the refused change to be recorded, got %+v", event)
+	}
+
+	err = users.UpdatePassword(user.ID, "a-long-enough-password", "another-long-enough-password", testClient)
+	if err != nil {
+		t.Fatalf("UpdatePassword() error = %v", err)
+	}
+	for _, session := range env.sessions.sessions {
+		if session.RevokedAt == nil {
+			t.Errorf("expected session %s to be revoked after the password change", session.ID)
+		}
+	}
+	if event := env.events.last(); event == nil || event.Type != model.SecurityEventPasswordChanged || !event.Succeeded() {
+		t.Errorf("expected the password change to be recorded, got %+v", event)
+	}
+
+	if _, err := env.service.Login("change@example.com", "another-long-enough-password", testClient); err != nil {
+		t.Errorf("expected the new password to work, got %v", err)
+	}
+
+	err = users.UpdatePassword(passwordless.ID, "", "another-long-enough-password", testClient)
+	if !errors.Is(err, ErrNoCurrentPassword) {
+		t.Errorf("expected ErrNoCurrentPassword for a passwordless account, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package useragent
+
+import "strings"
+
+// rule maps a substring of the User-Agent header to a display name
+type rule struct {
+	token string
+	name  string
+}
+
+// browsers are checked in order; several browsers also claim to be Chrome or Safari
+var browsers = []rule{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+}
+
+// platforms are checked in order; iOS and Android user agents also mention macOS and Linux
+var platforms = []rule{
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"CrOS", "ChromeOS"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// Describe turns a User-Agent header into a short description like "Chrome on macOS"
+func Describe(userAgent string) string {
+	browser := match(userAgent, browsers)
+	platform := match(userAgent, platforms)
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return "Unknown browser on " + platform
+	default:
+		return "Unknown device"
+	}
+}
+
+// match returns the name of the first rule whose token appears in userAgent
+func match(userAgent string, rules []rule) string {
+	for _, r := range rules {
+		if strings.Contains(userAgent, r.token) {
+			return r.name
+		}
+	}
+	return ""
+}
@@ -5,6 +5,12 @@ import (
 	"net/mail"
 )
 
+var (
+	ErrEmailRequired = errors.New("email address is required")
+	ErrEmailTooLong  = errors.New("email address is too long (max 254 characters)")
+	ErrInvalidEmail  = errors.New("invalid email address format")
+)
+
 // ValidateEmail validates email format and length
 // Uses Go's built-in net/mail parser, which follows RFC 5322
 // By testing found that the net/mail package actually accepts user@domain (without a TLD).
@@ -12,17 +18,17 @@ import (
 func ValidateEmail(email string) error {
 	// Check length (RFC 5321: local part max 64, domain max 255, total max 254 with @)
 	if len(email) > 254 {
-		return errors.New("email address is too long (max 254 characters)")
+		return ErrEmailTooLong
 	}
 
 	if email == "" {
-		return errors.New("email address is required")
+		return ErrEmailRequired
 	}
 
 	// Parse using Go's RFC 5322 compliant parser
 	_, err := mail.ParseAddress(email)
 	if err != nil {
-		return errors.New("invalid email address format")
+		return ErrInvalidEmail
 	}
 
 	return nil
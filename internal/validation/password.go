@@ -1,61 +1,278 @@
 package validation
 
 import (
-	"errors"
 	"fmt"
-	"regexp"
+	"log/slog"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
 	MinPasswordLength   = 12
-	MaxPasswordLength   = 72 // bcrypt limit
+	MaxPasswordLength   = 128
 	MaxConsecutiveChars = 6
+
+	// MaxPasswordHistory caps how many previous passwords a policy can forbid reusing
+	MaxPasswordHistory = 24
+
+	// Personal information shorter than this isn't checked, so a name like "Al" doesn't
+	// rule out every password containing those letters
+	minPersonalInfoLength = 4
 )
 
-func ValidatePassword(password string) error {
-	if len(password) < MinPasswordLength {
-		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
-	}
+// Reason codes for a password that doesn't meet the policy
+const (
+	PasswordTooShort     = "too_short"
+	PasswordTooLong      = "too_long"
+	PasswordCommon       = "common"
+	PasswordRepetitive   = "repetitive"
+	PasswordPersonalInfo = "personal_info"
+	PasswordWeak         = "weak"
+	PasswordBreached     = "breached"
+	PasswordReused       = "reused"
+)
 
-	if len(password) > MaxPasswordLength {
-		return fmt.Errorf("password must not exceed %d characters", MaxPasswordLength)
+// commonPasswordAffixes are the digits and symbols commonly added before or after a common password
+const commonPasswordAffixes = "0123456789!@#$%^&*"
+
+// Shorter common passwords like "abc" or "1234" only count on their own; with affixes they
+// would rule out too many reasonable passwords
+const minAffixedCommonPasswordLength = 5
+
+// isCommonPassword reports whether the lowercased password is one of the embedded common
+// passwords on its own or with digits and symbols before or after it
+func isCommonPassword(lower string) bool {
+	if _, ok := commonPasswordRanks[lower]; ok {
+		return true
 	}
+	for i := len(lower) - 1; i >= minAffixedCommonPasswordLength; i-- {
+		if !strings.ContainsRune(commonPasswordAffixes, rune(lower[i])) {
+			break
+		}
+		if _, ok := commonPasswordRanks[lower[:i]]; ok {
+			return true
+		}
+	}
+	for i := 0; i < len(lower)-minAffixedCommonPasswordLength; i++ {
+		if !strings.ContainsRune(commonPasswordAffixes, rune(lower[i])) {
+			break
+		}
+		if _, ok := commonPasswordRanks[lower[i+1:]]; ok {
+			return true
+		}
+	}
+	return false
+}
 
-	lower := strings.ToLower(password)
+// PasswordPolicy is the set of rules new passwords must meet. The platform-wide policy is
+// configured globally; tenants can make it stricter but not weaker, see Merge.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MinScore is the lowest acceptable EstimateStrength score, from 0 (too guessable) to 4
+	MinScore int
+	// HistorySize is how many previous passwords, including the current one, can't be reused.
+	// Comparing against password hashes is up to the caller, see PasswordReusedReason.
+	HistorySize int
+}
 
-	// High-risk passwords only
-	commonPasswords := []string{
-		"password", "passw0rd",
-		"123456", "12345678", "123456789", "1234567890",
-		"qwerty", "qwertyuiop", "asdfghjkl",
-		"letmein", "admin", "welcome", "monkey",
+// DefaultPasswordPolicy is used when no policy is configured
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: MinPasswordLength,
+	MaxLength: MaxPasswordLength,
+	MinScore:  3,
+}
+
+// Merge returns the stricter of both policies for every rule. The maximum length is capped at
+// MaxPasswordLength and never drops below the minimum, so some password always fits.
+func (p PasswordPolicy) Merge(other PasswordPolicy) PasswordPolicy {
+	merged := PasswordPolicy{
+		MinLength:   max(p.MinLength, other.MinLength),
+		MaxLength:   p.MaxLength,
+		MinScore:    max(p.MinScore, other.MinScore),
+		HistorySize: max(p.HistorySize, other.HistorySize),
+	}
+	if other.MaxLength > 0 && (merged.MaxLength == 0 || other.MaxLength < merged.MaxLength) {
+		merged.MaxLength = other.MaxLength
+	}
+	if merged.MaxLength == 0 || merged.MaxLength > MaxPasswordLength {
+		merged.MaxLength = MaxPasswordLength
 	}
+	merged.MaxLength = max(merged.MaxLength, merged.MinLength)
+	return merged
+}
+
+// PasswordContext is what is known about the password's owner. Passwords containing any of
+// it are rejected, and it counts as easy to guess in the strength estimate.
+type PasswordContext struct {
+	Email            string
+	Name             string
+	OrganizationName string
+	Subdomain        string
+}
 
-	for _, weak := range commonPasswords {
-		// Exact match
-		if lower == weak {
-			return errors.New("password is too common")
+// inputs returns the lowercase words of the context worth checking for
+func (c PasswordContext) inputs() []string {
+	var inputs []string
+	add := func(value string) {
+		for _, word := range strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if utf8.RuneCountInString(word) >= minPersonalInfoLength {
+				inputs = append(inputs, word)
+			}
 		}
+	}
+
+	local, domain, _ := strings.Cut(c.Email, "@")
+	add(local)
+	// Only the organization part of the email domain, not the top-level domain
+	if label, _, ok := strings.Cut(domain, "."); ok {
+		add(label)
+	}
+	add(c.Name)
+	add(c.OrganizationName)
+	add(c.Subdomain)
+	return inputs
+}
+
+// PasswordReason is a rule a password doesn't meet, with a message the UI can show
+type PasswordReason struct {
+	Code    string
+	Message string
+}
+
+// PasswordCheck is the outcome of checking a password against a policy, for the strength meter
+type PasswordCheck struct {
+	Score   int
+	Reasons []PasswordReason
+}
 
-		// weak + numbers/special OR numbers/special + weak
-		pattern := `[\d!@#$%^&*]+`
-		if regexp.MustCompile(`^`+weak+pattern+`$`).MatchString(lower) ||
-			regexp.MustCompile(`^`+pattern+weak+`$`).MatchString(lower) {
-			return errors.New("password is too common")
+// OK reports whether the password meets the policy
+func (c PasswordCheck) OK() bool {
+	return len(c.Reasons) == 0
+}
+
+// PasswordError is returned for passwords that don't meet the policy
+type PasswordError struct {
+	Reasons []PasswordReason
+}
+
+func (e *PasswordError) Error() string {
+	messages := make([]string, len(e.Reasons))
+	for i, reason := range e.Reasons {
+		messages[i] = reason.Message
+	}
+	return strings.Join(messages, " ")
+}
+
+// HasReason reports whether the password failed the rule with the given code
+func (e *PasswordError) HasReason(code string) bool {
+	for _, reason := range e.Reasons {
+		if reason.Code == code {
+			return true
 		}
 	}
+	return false
+}
+
+// PasswordReusedReason is reported by callers that find the password in the owner's history
+var PasswordReusedReason = PasswordReason{
+	Code:    PasswordReused,
+	Message: "You have used this password recently. Choose a different one.",
+}
+
+// Check evaluates the password against every rule of the policy that can be checked offline
+func (p PasswordPolicy) Check(password string, context PasswordContext) PasswordCheck {
+	length := utf8.RuneCountInString(password)
+	if p.MaxLength > 0 && length > p.MaxLength {
+		// Don't spend time estimating the strength of oversized input
+		return PasswordCheck{Reasons: []PasswordReason{{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("Use at most %d characters.", p.MaxLength),
+		}}}
+	}
+
+	inputs := context.inputs()
+	check := PasswordCheck{Score: EstimateStrength(password, inputs...).Score}
+
+	if length < p.MinLength {
+		check.Reasons = append(check.Reasons, PasswordReason{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("Use at least %d characters.", p.MinLength),
+		})
+	}
+
+	lower := strings.ToLower(password)
+	if isCommonPassword(lower) {
+		check.Reasons = append(check.Reasons, PasswordReason{
+			Code:    PasswordCommon,
+			Message: "This is a commonly used password.",
+		})
+	}
 
 	// Reject excessive repetition (6+ same characters)
 	if hasExcessiveRepetition(password) {
-		return errors.New("password contains excessive repetition")
+		check.Reasons = append(check.Reasons, PasswordReason{
+			Code:    PasswordRepetitive,
+			Message: "Avoid repeating the same character many times.",
+		})
+	}
+
+	for _, input := range inputs {
+		if strings.Contains(lower, input) {
+			check.Reasons = append(check.Reasons, PasswordReason{
+				Code:    PasswordPersonalInfo,
+				Message: "Don't use your name, email address or organization in your password.",
+			})
+			break
+		}
+	}
+
+	if check.Score < p.MinScore {
+		check.Reasons = append(check.Reasons, PasswordReason{
+			Code:    PasswordWeak,
+			Message: "This password is easy to guess. Add more words or less common ones.",
+		})
+	}
+
+	return check
+}
+
+// BreachedPasswordChecker reports whether a password is known from a data breach,
+// see package breach for the offline filter and the Pwned Passwords client
+type BreachedPasswordChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// Validate checks the password against the policy and, when breached is not nil, whether it
+// has been exposed in a data breach. It returns a *PasswordError listing every rule the
+// password doesn't meet. A checker that fails, e.g. because the breach API is unreachable,
+// doesn't block the password.
+func (p PasswordPolicy) Validate(password string, context PasswordContext, breached BreachedPasswordChecker) error {
+	check := p.Check(password, context)
+
+	// Only look up passwords that are otherwise acceptable, which keeps the API off the hot path
+	if check.OK() && breached != nil {
+		found, err := breached.IsBreached(password)
+		if err != nil {
+			slog.Warn("failed to check password against breaches", "error", err)
+		} else if found {
+			check.Reasons = append(check.Reasons, PasswordReason{
+				Code:    PasswordBreached,
+				Message: "This password has appeared in a data breach. Choose a different one.",
+			})
+		}
 	}
 
+	if !check.OK() {
+		return &PasswordError{Reasons: check.Reasons}
+	}
 	return nil
 }
 
 // hasExcessiveRepetition checks if the password has MaxConsecutiveChars or more consecutive identical characters
-// Note: No length check needed - password length is already validated in ValidatePassword
 func hasExcessiveRepetition(password string) bool {
 	count := 1
 	for i := 1; i < len(password); i++ {
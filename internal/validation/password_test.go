@@ -1,11 +1,15 @@
 package validation
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
 
-func TestValidatePassword(t *testing.T) {
+func TestPasswordPolicy_Validate(t *testing.T) {
+	// Only the rules, the strength estimate is covered by TestPasswordPolicy_MinScore
+	policy := PasswordPolicy{MinLength: MinPasswordLength, MaxLength: MaxPasswordLength}
+
 	tests := []struct {
 		name     string
 		password string
@@ -15,7 +19,7 @@ func TestValidatePassword(t *testing.T) {
 		{"valid strong passphrase", "correct-horse-battery-staple", false},
 		{"valid long password", "MySecretPassword2024!", false},
 		{"valid with spaces", "my super secret phrase 2024", false},
-		{"valid 12 chars exactly", "abcDEF123!@#", false},
+		{"valid 12 chars exactly", "abcXYZ123!@#", false},
 		{"valid unicode", "пароль-секретный-2024", false},
 		{"valid numbers only", "123409876543", false},
 
@@ -25,10 +29,11 @@ func TestValidatePassword(t *testing.T) {
 		{"too short 1 char", "a", true},
 		{"empty", "", true},
 
-		// Too long (bcrypt limit)
-		{"too long 73 chars", strings.Repeat("a", 73), true},
-		{"too long 100 chars", strings.Repeat("x", 100), true},
-		{"exactly 72 chars mixed", "abcdefghij" + strings.Repeat("klmnopqrst", 6) + "uv", false}, // 72 chars, no repetition
+		// Too long
+		{"too long 129 chars", "abcdefghij" + strings.Repeat("klmnopqrst", 11) + "uvwxyz123", true},
+		{"too long 200 chars", strings.Repeat("x", 200), true},
+		{"exactly 128 chars mixed", "abcdefghij" + strings.Repeat("klmnopqrst", 11) + "uvwxyz12", false}, // 128 chars, no repetition
+		{"over the old bcrypt limit", "abcdefghij" + strings.Repeat("klmnopqrst", 6) + "uvw", false},     // 73 chars
 
 		// Exact match - common passwords (blocked)
 		{"exact password", "password", true},
@@ -57,6 +62,7 @@ func TestValidatePassword(t *testing.T) {
 		{"welcome123", "welcome123", true},
 		{"monkey456", "monkey456", true},
 		{"1234567890123", "1234567890123", true}, // 1234567890 + 123
+		{"abcdef123!@#", "abcDEF123!@#", true},   // from the embedded list
 
 		// Numbers + common password (blocked)
 		{"123password", "123password", true},
@@ -121,14 +127,151 @@ func TestValidatePassword(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := ValidatePassword(tt.password)
+			err := policy.Validate(tt.password, PasswordContext{}, nil)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("ValidatePassword(%q) error = %v, wantErr %v", tt.password, err, tt.wantErr)
+				t.Errorf("Validate(%q) error = %v, wantErr %v", tt.password, err, tt.wantErr)
 			}
 		})
 	}
 }
 
+// fakeBreachedPasswords is a BreachedPasswordChecker over a fixed set of passwords
+type fakeBreachedPasswords struct {
+	passwords map[string]bool
+	err       error
+}
+
+func (f *fakeBreachedPasswords) IsBreached(password string) (bool, error) {
+	return f.passwords[password], f.err
+}
+
+func TestPasswordPolicy_Validate_Breached(t *testing.T) {
+	breached := &fakeBreachedPasswords{passwords: map[string]bool{"correct-horse-battery-staple": true}}
+
+	err := DefaultPasswordPolicy.Validate("correct-horse-battery-staple", PasswordContext{}, breached)
+	var passwordErr *PasswordError
+	if !errors.As(err, &passwordErr) || !passwordErr.HasReason(PasswordBreached) {
+		t.Errorf("Validate() error = %v, want breached", err)
+	}
+
+	err = DefaultPasswordPolicy.Validate("my super secret phrase 2024", PasswordContext{}, breached)
+	if err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+
+	// An unavailable checker doesn't block the password
+	err = DefaultPasswordPolicy.Validate("correct-horse-battery-staple", PasswordContext{}, &fakeBreachedPasswords{err: errors.New("unreachable")})
+	if err != nil {
+		t.Errorf("Validate() with failing checker error = %v, want nil", err)
+	}
+}
+
+func TestPasswordPolicy_Validate_Reasons(t *testing.T) {
+	err := DefaultPasswordPolicy.Validate("password", PasswordContext{}, nil)
+	var passwordErr *PasswordError
+	if !errors.As(err, &passwordErr) {
+		t.Fatalf("Validate() error = %v, want *PasswordError", err)
+	}
+	for _, code := range []string{PasswordTooShort, PasswordCommon, PasswordWeak} {
+		if !passwordErr.HasReason(code) {
+			t.Errorf("Validate() reasons = %v, want %s", passwordErr.Reasons, code)
+		}
+	}
+	if passwordErr.HasReason(PasswordRepetitive) {
+		t.Errorf("Validate() reasons = %v, want no %s", passwordErr.Reasons, PasswordRepetitive)
+	}
+}
+
+func TestPasswordPolicy_Validate_PersonalInfo(t *testing.T) {
+	context := PasswordContext{
+		Email:            "jane.doe@example.com",
+		Name:             "Jane Doe",
+		OrganizationName: "Acme Widgets",
+		Subdomain:        "acme-widgets",
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"email local part", "JANE-tangerine-orbit-42", true},
+		{"email domain", "my-example-tangerine-orbit", true},
+		{"organization name", "widgets-tangerine-orbit-42", true},
+		{"subdomain", "tangerine-acme-orbit-4217", true},
+		{"short parts are ignored", "doe-tangerine-orbit-4217", false},
+		{"top-level domain is ignored", "com-tangerine-orbit-4217", false},
+		{"unrelated", "tangerine-orbit-lantern-42", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := DefaultPasswordPolicy.Validate(tt.password, context, nil)
+			var passwordErr *PasswordError
+			got := errors.As(err, &passwordErr) && passwordErr.HasReason(PasswordPersonalInfo)
+			if got != tt.wantErr {
+				t.Errorf("Validate(%q) error = %v, want personal info %v", tt.password, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicy_MinScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		minScore int
+		password string
+		wantErr  bool
+	}{
+		{"sequence", 3, "abcdefghijkl", true},
+		{"keyboard row", 3, "qwertyuiop[]", true},
+		{"repeated word", 3, "abcabcabcabc", true},
+		{"passphrase", 3, "correct-horse-battery-staple", false},
+		{"random", 4, "xK9#mQ2$vL7pT4", false},
+		{"sequence without minimum score", 0, "abcdefghijkl", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := PasswordPolicy{MinLength: MinPasswordLength, MaxLength: MaxPasswordLength, MinScore: tt.minScore}
+			err := policy.Validate(tt.password, PasswordContext{}, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate(%q) error = %v, wantErr %v", tt.password, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicy_Merge(t *testing.T) {
+	global := PasswordPolicy{MinLength: 12, MaxLength: 128, MinScore: 3, HistorySize: 0}
+
+	got := global.Merge(PasswordPolicy{MinLength: 16, MinScore: 2, HistorySize: 5})
+	want := PasswordPolicy{MinLength: 16, MaxLength: 128, MinScore: 3, HistorySize: 5}
+	if got != want {
+		t.Errorf("Merge() = %+v, want %+v", got, want)
+	}
+
+	// A tenant can't weaken the global policy
+	got = global.Merge(PasswordPolicy{MinLength: 8, MaxLength: 256})
+	if got != global {
+		t.Errorf("Merge() = %+v, want %+v", got, global)
+	}
+
+	// A lower maximum is stricter, but can't rule out every password
+	got = global.Merge(PasswordPolicy{MaxLength: 64})
+	if got.MaxLength != 64 {
+		t.Errorf("Merge() MaxLength = %d, want 64", got.MaxLength)
+	}
+	got = global.Merge(PasswordPolicy{MinLength: 20, MaxLength: 16})
+	if got.MaxLength != 20 {
+		t.Errorf("Merge() MaxLength = %d, want the minimum length 20", got.MaxLength)
+	}
+	got = PasswordPolicy{MinLength: 12}.Merge(PasswordPolicy{})
+	if got.MaxLength != MaxPasswordLength {
+		t.Errorf("Merge() MaxLength = %d, want %d", got.MaxLength, MaxPasswordLength)
+	}
+}
+
 func TestHasExcessiveRepetition(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,38 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	MinPhoneDigits = 7
+	MaxPhoneDigits = 15 // E.164 limit
+)
+
+// ValidatePhone validates a phone number loosely.
+// Allows an optional leading +, digits and common separators (spaces, dots, dashes, parentheses)
+func ValidatePhone(phone string) error {
+	trimmed := strings.TrimSpace(phone)
+	if trimmed == "" {
+		return errors.New("phone number is required")
+	}
+
+	digits := 0
+	for i, char := range trimmed {
+		switch {
+		case char >= '0' && char <= '9':
+			digits++
+		case char == '+' && i == 0:
+		case char == ' ' || char == '.' || char == '-' || char == '(' || char == ')':
+		default:
+			return errors.New("phone number may only contain digits, spaces, and + - . ( )")
+		}
+	}
+
+	if digits < MinPhoneDigits || digits > MaxPhoneDigits {
+		return errors.New("phone number must have between 7 and 15 digits")
+	}
+
+	return nil
+}
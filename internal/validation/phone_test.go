@@ -0,0 +1,39 @@
+package validation
+
+import (
+	"testing"
+)
+
+func TestValidatePhone(t *testing.T) {
+	tests := []struct {
+		name    string
+		phone   string
+		wantErr bool
+	}{
+		// Valid phone numbers
+		{"international", "+1 555 123 4567", false},
+		{"dashes", "555-123-4567", false},
+		{"parentheses", "(555) 123-4567", false},
+		{"dots", "030.1234.5678", false},
+		{"digits only", "5551234", false},
+		{"max digits", "+123456789012345", false},
+
+		// Invalid phone numbers
+		{"empty", "", true},
+		{"whitespace", "   ", true},
+		{"too few digits", "12345", true},
+		{"too many digits", "+1234567890123456", true},
+		{"letters", "555-CALL-NOW", true},
+		{"plus in middle", "555+1234567", true},
+		{"extension", "555 123 4567 ext 12", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePhone(tt.phone)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePhone(%q) error = %v, wantErr %v", tt.phone, err, tt.wantErr)
+			}
+		})
+	}
+}
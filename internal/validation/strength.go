@@ -0,0 +1,512 @@
+package validation
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// commonPasswordList is the ranked list of frequently used passwords and words the strength
+// estimate treats as dictionary words, most common first
+//
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswordRanks = func() map[string]int {
+	ranks := make(map[string]int)
+	for i, word := range strings.Fields(commonPasswordList) {
+		if _, ok := ranks[word]; !ok {
+			ranks[word] = i + 1
+		}
+	}
+	return ranks
+}()
+
+// Keyboard rows of a US layout; runs along a row are as guessable as a short dictionary word
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+// l33t substitutions; 1 and | are ambiguous, so there is a table for each reading
+var l33tTables = []map[rune]rune{
+	{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '9': 'g', '1': 'i', '!': 'i', '|': 'i', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'},
+	{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '9': 'g', '1': 'l', '!': 'i', '|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'},
+}
+
+// Tuning of the estimate, taken from zxcvbn
+const (
+	bruteforceCardinality       = 10
+	minSubmatchGuesses          = 50
+	minSingleCharSubmatch       = 10
+	minGuessesBeforeGrowingSeq  = 10000
+	minYearSpace                = 20
+	keyboardStartingPositions   = 47
+	keyboardAverageDegree       = 4
+	minDictionaryMatchLength    = 3
+	minSequenceOrKeyboardLength = 3
+)
+
+// Strength is an estimate of how many guesses an attacker needs to find a password
+type Strength struct {
+	Guesses float64
+	// Score is 0 (too guessable) to 4 (very unguessable), as shown by the strength meter
+	Score int
+}
+
+// strengthMatch is a part of the password an attacker would guess as a whole, from i to j inclusive
+type strengthMatch struct {
+	i, j    int
+	guesses float64
+}
+
+// EstimateStrength estimates the guesses needed to find the password in the style of zxcvbn:
+// it splits the password into the dictionary words, l33t spellings, keyboard runs, sequences,
+// repeats and years an attacker would try first, and bruteforces the rest. userInputs, such as
+// the owner's name, are treated as the most common words of all.
+func EstimateStrength(password string, userInputs ...string) Strength {
+	estimator := newStrengthEstimator(userInputs)
+	guesses := estimator.guesses([]rune(password))
+	return Strength{Guesses: guesses, Score: guessesScore(guesses)}
+}
+
+type strengthEstimator struct {
+	userInputRanks map[string]int
+	maxWordLength  int
+	// repeatGuesses caches the estimates of repeated parts, which are estimated recursively
+	repeatGuesses map[string]float64
+}
+
+func newStrengthEstimator(userInputs []string) *strengthEstimator {
+	e := &strengthEstimator{
+		userInputRanks: make(map[string]int),
+		repeatGuesses:  make(map[string]float64),
+	}
+	for word := range commonPasswordRanks {
+		e.maxWordLength = max(e.maxWordLength, len([]rune(word)))
+	}
+	for i, input := range userInputs {
+		input = strings.ToLower(input)
+		if _, ok := e.userInputRanks[input]; !ok {
+			e.userInputRanks[input] = i + 1
+		}
+		e.maxWordLength = max(e.maxWordLength, len([]rune(input)))
+	}
+	return e
+}
+
+// rank returns the dictionary rank of a lowercase word, or 0 if it isn't in any dictionary
+func (e *strengthEstimator) rank(word string) int {
+	if rank, ok := e.userInputRanks[word]; ok {
+		return rank
+	}
+	return commonPasswordRanks[word]
+}
+
+// guesses returns the guesses needed for the most guessable way to split the password
+func (e *strengthEstimator) guesses(password []rune) float64 {
+	n := len(password)
+	if n == 0 {
+		return 1
+	}
+
+	matchesByEnd := make([][]strengthMatch, n)
+	for _, match := range e.matches(password) {
+		// Matches covering only part of the password are never trivially cheap
+		if match.j-match.i+1 < n {
+			if match.i == match.j {
+				match.guesses = max(match.guesses, minSingleCharSubmatch)
+			} else {
+				match.guesses = max(match.guesses, minSubmatchGuesses)
+			}
+		}
+		matchesByEnd[match.j] = append(matchesByEnd[match.j], match)
+	}
+
+	// best[k][l] is the lowest product of guesses of l matches covering password[0..k]; zxcvbn
+	// then weighs the number of matches, since an attacker also has to guess how many there are
+	best := make([][]float64, n)
+	for k := range best {
+		best[k] = make([]float64, n+1)
+		for l := range best[k] {
+			best[k][l] = math.Inf(1)
+		}
+	}
+
+	extend := func(match strengthMatch) {
+		if match.i == 0 {
+			best[match.j][1] = min(best[match.j][1], match.guesses)
+			return
+		}
+		for l, product := range best[match.i-1] {
+			if !math.IsInf(product, 1) {
+				best[match.j][l+1] = min(best[match.j][l+1], product*match.guesses)
+			}
+		}
+	}
+
+	for k := 0; k < n; k++ {
+		for _, match := range matchesByEnd[k] {
+			extend(match)
+		}
+		for i := 0; i <= k; i++ {
+			extend(strengthMatch{i: i, j: k, guesses: bruteforceGuesses(k - i + 1)})
+		}
+	}
+
+	guesses := math.Inf(1)
+	for l, product := range best[n-1] {
+		if l == 0 || math.IsInf(product, 1) {
+			continue
+		}
+		guesses = min(guesses, factorial(l)*product+math.Pow(minGuessesBeforeGrowingSeq, float64(l-1)))
+	}
+	return guesses
+}
+
+// matches returns every guessable part of the password
+func (e *strengthEstimator) matches(password []rune) []strengthMatch {
+	lower := make([]rune, len(password))
+	for i, r := range password {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	var matches []strengthMatch
+	matches = append(matches, e.dictionaryMatches(password, lower)...)
+	matches = append(matches, e.reversedDictionaryMatches(password, lower)...)
+	matches = append(matches, e.l33tMatches(password, lower)...)
+	matches = append(matches, sequenceMatches(lower)...)
+	matches = append(matches, keyboardMatches(lower)...)
+	matches = append(matches, yearMatches(lower)...)
+	matches = append(matches, e.repeatMatches(password)...)
+	return matches
+}
+
+// dictionaryMatches finds the dictionary words in the password, in any capitalization
+func (e *strengthEstimator) dictionaryMatches(password, lower []rune) []strengthMatch {
+	var matches []strengthMatch
+	for i := range lower {
+		for j := i + minDictionaryMatchLength - 1; j < len(lower) && j-i < e.maxWordLength; j++ {
+			rank := e.rank(string(lower[i : j+1]))
+			if rank == 0 {
+				continue
+			}
+			matches = append(matches, strengthMatch{
+				i:       i,
+				j:       j,
+				guesses: float64(rank) * uppercaseVariations(password[i:j+1]),
+			})
+		}
+	}
+	return matches
+}
+
+// reversedDictionaryMatches finds dictionary words spelled backwards, which doubles the guesses
+func (e *strengthEstimator) reversedDictionaryMatches(password, lower []rune) []strengthMatch {
+	n := len(lower)
+	reversed := make([]rune, n)
+	reversedLower := make([]rune, n)
+	for i := range lower {
+		reversed[n-1-i] = password[i]
+		reversedLower[n-1-i] = lower[i]
+	}
+
+	var matches []strengthMatch
+	for _, match := range e.dictionaryMatches(reversed, reversedLower) {
+		// Palindromes are already found as dictionary words
+		word := reversedLower[match.i : match.j+1]
+		if string(word) == string(lower[n-1-match.j:n-match.i]) {
+			continue
+		}
+		matches = append(matches, strengthMatch{
+			i:       n - 1 - match.j,
+			j:       n - 1 - match.i,
+			guesses: match.guesses * 2,
+		})
+	}
+	return matches
+}
+
+// l33tMatches finds dictionary words with letters swapped for lookalike digits and symbols
+func (e *strengthEstimator) l33tMatches(password, lower []rune) []strengthMatch {
+	var matches []strengthMatch
+	for _, table := range l33tTables {
+		translated := make([]rune, len(lower))
+		for i, r := range lower {
+			if sub, ok := table[r]; ok {
+				translated[i] = sub
+			} else {
+				translated[i] = r
+			}
+		}
+
+		for i := range translated {
+			for j := i + minDictionaryMatchLength - 1; j < len(translated) && j-i < e.maxWordLength; j++ {
+				if string(translated[i:j+1]) == string(lower[i:j+1]) {
+					continue
+				}
+				rank := e.rank(string(translated[i : j+1]))
+				if rank == 0 {
+					continue
+				}
+				matches = append(matches, strengthMatch{
+					i:       i,
+					j:       j,
+					guesses: float64(rank) * uppercaseVariations(password[i:j+1]) * l33tVariations(lower[i:j+1], translated[i:j+1]),
+				})
+			}
+		}
+	}
+	return matches
+}
+
+// sequenceMatches finds runs of consecutive characters such as "abcd" or "9876"
+func sequenceMatches(lower []rune) []strengthMatch {
+	var matches []strengthMatch
+	add := func(i, j int, delta rune) {
+		if j-i+1 < minSequenceOrKeyboardLength {
+			return
+		}
+		var base float64
+		switch first := lower[i]; {
+		case first == 'a' || first == 'z' || first == '0' || first == '1' || first == '9':
+			// Obvious starting points
+			base = 4
+		case unicode.IsDigit(first):
+			base = 10
+		default:
+			base = 26
+		}
+		if delta < 0 {
+			base *= 2
+		}
+		matches = append(matches, strengthMatch{i: i, j: j, guesses: base * float64(j-i+1)})
+	}
+
+	if len(lower) < minSequenceOrKeyboardLength {
+		return nil
+	}
+	start, delta := 0, lower[1]-lower[0]
+	for k := 2; k < len(lower); k++ {
+		d := lower[k] - lower[k-1]
+		if d == delta {
+			continue
+		}
+		if delta == 1 || delta == -1 {
+			add(start, k-1, delta)
+		}
+		start, delta = k-1, d
+	}
+	if delta == 1 || delta == -1 {
+		add(start, len(lower)-1, delta)
+	}
+	return matches
+}
+
+// keyboardMatches finds runs along a keyboard row such as "qwerty" or "lkjh"
+func keyboardMatches(lower []rune) []strengthMatch {
+	var matches []strengthMatch
+	for i := 0; i < len(lower); {
+		longest := 0
+		for _, row := range keyboardRows {
+			for _, candidate := range []string{row, reverseString(row)} {
+				length := 0
+				for i+length < len(lower) && strings.Contains(candidate, string(lower[i:i+length+1])) {
+					length++
+				}
+				longest = max(longest, length)
+			}
+		}
+		if longest < minSequenceOrKeyboardLength {
+			i++
+			continue
+		}
+		matches = append(matches, strengthMatch{
+			i:       i,
+			j:       i + longest - 1,
+			guesses: keyboardStartingPositions * keyboardAverageDegree * float64(longest),
+		})
+		i += longest
+	}
+	return matches
+}
+
+// yearMatches finds years from 1900 to 2099, which are guessed close to the current year first
+func yearMatches(lower []rune) []strengthMatch {
+	var matches []strengthMatch
+	currentYear := time.Now().Year()
+	for i := 0; i+4 <= len(lower); i++ {
+		word := string(lower[i : i+4])
+		if !(strings.HasPrefix(word, "19") || strings.HasPrefix(word, "20")) {
+			continue
+		}
+		year := 0
+		for _, r := range word {
+			if r < '0' || r > '9' {
+				year = -1
+				break
+			}
+			year = year*10 + int(r-'0')
+		}
+		if year < 0 {
+			continue
+		}
+		span := year - currentYear
+		if span < 0 {
+			span = -span
+		}
+		matches = append(matches, strengthMatch{i: i, j: i + 3, guesses: float64(max(span, minYearSpace))})
+	}
+	return matches
+}
+
+// repeatMatches finds parts repeated back to back such as "abcabc" or "zzzz". A repeat takes
+// as many guesses as the repeated part times the number of repetitions.
+func (e *strengthEstimator) repeatMatches(password []rune) []strengthMatch {
+	var matches []strengthMatch
+	n := len(password)
+	for i := 0; i < n; {
+		bestBase, bestCount := 0, 0
+		for base := 1; i+2*base <= n; base++ {
+			count := 1
+			for i+(count+1)*base <= n && string(password[i+count*base:i+(count+1)*base]) == string(password[i:i+base]) {
+				count++
+			}
+			if count > 1 && base*count > bestBase*bestCount {
+				bestBase, bestCount = base, count
+			}
+		}
+		if bestCount == 0 {
+			i++
+			continue
+		}
+
+		base := string(password[i : i+bestBase])
+		baseGuesses, ok := e.repeatGuesses[base]
+		if !ok {
+			baseGuesses = e.guesses([]rune(base))
+			e.repeatGuesses[base] = baseGuesses
+		}
+		matches = append(matches, strengthMatch{
+			i:       i,
+			j:       i + bestBase*bestCount - 1,
+			guesses: baseGuesses * float64(bestCount),
+		})
+		i += bestBase * bestCount
+	}
+	return matches
+}
+
+// uppercaseVariations is how many capitalizations of a word an attacker tries before this one
+func uppercaseVariations(word []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+	// Capitalized, all caps or a trailing capital are tried first
+	if lower == 0 || (upper == 1 && (unicode.IsUpper(word[0]) || unicode.IsUpper(word[len(word)-1]))) {
+		return 2
+	}
+	variations := 0.0
+	for k := 1; k <= min(upper, lower); k++ {
+		variations += binomial(upper+lower, k)
+	}
+	return variations
+}
+
+// l33tVariations is how many l33t spellings of a word an attacker tries before this one
+func l33tVariations(original, translated []rune) float64 {
+	substitutions := make(map[[2]rune]bool)
+	for i := range original {
+		if original[i] != translated[i] {
+			substitutions[[2]rune{original[i], translated[i]}] = true
+		}
+	}
+
+	variations := 1.0
+	for sub := range substitutions {
+		subbed, unsubbed := 0, 0
+		for _, r := range original {
+			switch r {
+			case sub[0]:
+				subbed++
+			case sub[1]:
+				unsubbed++
+			}
+		}
+		if subbed == 0 || unsubbed == 0 {
+			variations *= 2
+			continue
+		}
+		possibilities := 0.0
+		for k := 1; k <= min(subbed, unsubbed); k++ {
+			possibilities += binomial(subbed+unsubbed, k)
+		}
+		variations *= possibilities
+	}
+	return variations
+}
+
+func bruteforceGuesses(length int) float64 {
+	guesses := math.Pow(bruteforceCardinality, float64(length))
+	if length == 1 {
+		return max(guesses, minSingleCharSubmatch+1)
+	}
+	return max(guesses, minSubmatchGuesses+1)
+}
+
+// guessesScore maps guesses to a score, by what an online or offline attacker can try in time
+func guessesScore(guesses float64) int {
+	const delta = 5
+	switch {
+	case guesses < 1e3+delta:
+		return 0
+	case guesses < 1e6+delta:
+		return 1
+	case guesses < 1e8+delta:
+		return 2
+	case guesses < 1e10+delta:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func factorial(n int) float64 {
+	result := 1.0
+	for i := 2; i <= n; i++ {
+		result *= float64(i)
+	}
+	return result
+}
+
+func binomial(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+func reverseString(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
@@ -0,0 +1,60 @@
+package validation
+
+import "testing"
+
+func TestEstimateStrength(t *testing.T) {
+	tests := []struct {
+		name       string
+		password   string
+		userInputs []string
+		wantScore  int
+	}{
+		{"empty", "", nil, 0},
+		{"common password", "password", nil, 0},
+		{"capitalized common password", "Password", nil, 0},
+		{"l33t common password", "p4ssw0rd", nil, 0},
+		{"reversed common password", "drowssap", nil, 0},
+		{"sequence", "abcdefghijkl", nil, 0},
+		{"repeat", "abcabcabcabc", nil, 0},
+		{"keyboard row", "qwertyuiopas", nil, 1},
+		{"user input", "acmewidgets", []string{"acmewidgets"}, 0},
+		{"passphrase", "correct-horse-battery-staple", nil, 4},
+		{"random", "xK9#mQ2$vL7p", nil, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EstimateStrength(tt.password, tt.userInputs...)
+			if got.Score != tt.wantScore {
+				t.Errorf("EstimateStrength(%q) score = %d (%g guesses), want %d", tt.password, got.Score, got.Guesses, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestEstimateStrength_Year(t *testing.T) {
+	recent := EstimateStrength("tangerine1999")
+	random := EstimateStrength("tangerine7351")
+	if recent.Guesses >= random.Guesses {
+		t.Errorf("guesses with a year = %g, want fewer than with random digits (%g)", recent.Guesses, random.Guesses)
+	}
+}
+
+func TestUppercaseVariations(t *testing.T) {
+	tests := []struct {
+		word string
+		want float64
+	}{
+		{"password", 1},
+		{"Password", 2},
+		{"passworD", 2},
+		{"PASSWORD", 2},
+		{"PassWord", 28 + 8},
+	}
+
+	for _, tt := range tests {
+		if got := uppercaseVariations([]rune(tt.word)); got != tt.want {
+			t.Errorf("uppercaseVariations(%q) = %g, want %g", tt.word, got, tt.want)
+		}
+	}
+}